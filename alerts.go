@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Alerts ---
+
+// Values for AlertRule.Type.
+const (
+	alertMissing = "missing" // The expression matched nothing on more than Threshold percent of the URLs
+	alertChanged = "changed" // The expression's value changed since the previous run
+)
+
+// alertTimeout bounds the webhook request.
+const alertTimeout = 30 * time.Second
+
+// AlertOptions posts alerts to a webhook when rules fire at the end of a run.
+type AlertOptions struct {
+	Webhook string `json:"webhook"`         // URL the alerts are POSTed to
+	Slack   bool   `json:"slack,omitempty"` // Post a Slack message ({"text": ...}) instead of {"alerts": [...]}
+	// Previous is an earlier output file for "changed" rules. Without it the latest values
+	// in the input's history store are used.
+	Previous string      `json:"previous,omitempty"`
+	Rules    []AlertRule `json:"rules"`
+}
+
+// AlertRule is one condition to alert on.
+type AlertRule struct {
+	Type      string  `json:"type"`                // "missing" or "changed"
+	XPath     string  `json:"xpath"`               // Output key, which is the expression's name if it has one
+	URL       string  `json:"url,omitempty"`       // Only check this URL; default all
+	Threshold float64 `json:"threshold,omitempty"` // Percentage of URLs "missing" tolerates; default 0
+}
+
+// alert is a rule that fired.
+type alert struct {
+	Type    string `json:"type"`
+	XPath   string `json:"xpath"`
+	URL     string `json:"url,omitempty"`
+	Message string `json:"message"`
+}
+
+func (opts *AlertOptions) check() error {
+	if opts.Webhook == "" {
+		return fmt.Errorf("alerts need a webhook URL")
+	}
+	for i, rule := range opts.Rules {
+		switch rule.Type {
+		case alertMissing, alertChanged:
+		default:
+			return fmt.Errorf("alert rule %d: unknown type %q (want missing or changed)", i, rule.Type)
+		}
+		if rule.XPath == "" {
+			return fmt.Errorf("alert rule %d: missing xpath", i)
+		}
+		if rule.Threshold < 0 || rule.Threshold > 100 {
+			return fmt.Errorf("alert rule %d: threshold %v is not a percentage", i, rule.Threshold)
+		}
+	}
+	return nil
+}
+
+// needsPrevious reports whether any rule compares with an earlier run.
+func (opts *AlertOptions) needsPrevious() bool {
+	for _, rule := range opts.Rules {
+		if rule.Type == alertChanged {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate returns the alerts raised by output, in rule order. "changed" rules compare
+// with previous; they don't fire when previous is empty (the first run), which would
+// otherwise report every value.
+func (opts *AlertOptions) evaluate(input *InputJson, previous, output OutputJson) []alert {
+	var alerts []alert
+	for _, rule := range opts.Rules {
+		switch rule.Type {
+		case alertMissing:
+			var urls []string
+			for pageURL := range input.Urls {
+				if rule.URL == "" || pageURL == rule.URL {
+					urls = append(urls, pageURL)
+				}
+			}
+			missing := 0
+			for _, pageURL := range urls {
+				if _, found := output[rule.XPath][pageURL]; !found {
+					missing++
+				}
+			}
+			if missing == 0 {
+				continue
+			}
+			percent := float64(missing) * 100 / float64(len(urls))
+			if percent > rule.Threshold {
+				alerts = append(alerts, alert{
+					Type:    rule.Type,
+					XPath:   rule.XPath,
+					URL:     rule.URL,
+					Message: fmt.Sprintf("%s matched nothing on %d of %d URLs (%.0f%%)", rule.XPath, missing, len(urls), percent),
+				})
+			}
+		case alertChanged:
+			if len(previous) == 0 {
+				continue
+			}
+			for _, c := range diffOutputs(previous, output) {
+				if _, inInput := input.Urls[c.URL]; !inInput || c.XPath != rule.XPath || rule.URL != "" && c.URL != rule.URL {
+					continue
+				}
+				alerts = append(alerts, alert{
+					Type:    rule.Type,
+					XPath:   rule.XPath,
+					URL:     c.URL,
+					Message: fmt.Sprintf("%s on %s %s: %s -> %s", rule.XPath, c.URL, c.Change, compactJSON(c.Old), compactJSON(c.New)),
+				})
+			}
+		}
+	}
+	return alerts
+}
+
+// send POSTs alerts to the webhook; nothing is sent if there are none.
+func (opts *AlertOptions) send(alerts []alert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+	var payload interface{} = map[string][]alert{"alerts": alerts}
+	if opts.Slack {
+		lines := make([]string, len(alerts))
+		for i, a := range alerts {
+			lines[i] = a.Message
+		}
+		payload = map[string]string{"text": "goatpaver: " + strings.Join(lines, "\n")}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: alertTimeout}
+	resp, err := client.Post(opts.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", opts.Webhook, resp.Status)
+	}
+	return nil
+}
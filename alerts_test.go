@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAlertsEvaluate(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", {"xpath": "//span", "name": "price"}],
+		"urls": {
+			"http://a.com": {"content": "<p><h1>A</h1><span>12</span></p>"},
+			"http://b.com": {"content": "<p><h1>B</h1></p>"},
+			"http://c.com": {"content": "<p><h1>C</h1></p>"}
+		},
+		"alerts": {
+			"webhook": "http://hooks.example.com",
+			"rules": [
+				{"type": "missing", "xpath": "price", "threshold": 50},
+				{"type": "missing", "xpath": "price", "threshold": 70},
+				{"type": "missing", "xpath": "//h1"},
+				{"type": "changed", "xpath": "price", "url": "http://a.com"},
+				{"type": "changed", "xpath": "//h1"}
+			]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := OutputJson{
+		"//h1":  {"http://a.com": "A", "http://b.com": "Old B", "http://c.com": "C"},
+		"price": {"http://a.com": "10"},
+	}
+
+	expected := []alert{
+		{Type: alertMissing, XPath: "price", Message: "price matched nothing on 2 of 3 URLs (67%)"},
+		{Type: alertChanged, XPath: "price", URL: "http://a.com", Message: `price on http://a.com changed: "10" -> "12"`},
+		{Type: alertChanged, XPath: "//h1", URL: "http://b.com", Message: `//h1 on http://b.com changed: "Old B" -> "B"`},
+	}
+	if actual := input.Alerts.evaluate(input, previous, output); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Unexpected alerts.\nExpected: %#v\nGot:      %#v", expected, actual)
+	}
+
+	// Without an earlier run only "missing" rules fire
+	if actual := input.Alerts.evaluate(input, OutputJson{}, output); len(actual) != 1 || actual[0].Type != alertMissing {
+		t.Errorf("Unexpected alerts on the first run: %#v", actual)
+	}
+}
+
+func TestAlertsCheck(t *testing.T) {
+	for _, config := range []string{
+		`{"rules": [{"type": "missing", "xpath": "//h1"}]}`,
+		`{"webhook": "http://hooks.example.com", "rules": [{"type": "gone", "xpath": "//h1"}]}`,
+		`{"webhook": "http://hooks.example.com", "rules": [{"type": "missing"}]}`,
+		`{"webhook": "http://hooks.example.com", "rules": [{"type": "missing", "xpath": "//h1", "threshold": 150}]}`,
+	} {
+		if _, err := parseInput([]byte(`{"xpaths": [], "urls": {}, "alerts": ` + config + `}`)); err == nil {
+			t.Errorf("Expected an error for alerts %s", config)
+		}
+	}
+}
+
+func TestAlertsSend(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		if strings.Contains(string(data), "fail") {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	alerts := []alert{{Type: alertMissing, XPath: "//h1", Message: "//h1 matched nothing on 1 of 1 URLs (100%)"}}
+	opts := &AlertOptions{Webhook: server.URL}
+	if err := opts.send(nil); err != nil || len(bodies) != 0 {
+		t.Fatalf("send without alerts = %v and posted %d times; want nothing posted", err, len(bodies))
+	}
+	if err := opts.send(alerts); err != nil {
+		t.Fatal(err)
+	}
+	var posted struct{ Alerts []alert }
+	if err := json.Unmarshal([]byte(bodies[0]), &posted); err != nil || !reflect.DeepEqual(posted.Alerts, alerts) {
+		t.Errorf("Unexpected webhook body %s", bodies[0])
+	}
+
+	opts.Slack = true
+	if err := opts.send(alerts); err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"text":"goatpaver: //h1 matched nothing on 1 of 1 URLs (100%)"}`; bodies[1] != expected {
+		t.Errorf("Unexpected Slack body.\nExpected: %s\nGot:      %s", expected, bodies[1])
+	}
+
+	if err := opts.send([]alert{{Message: "fail"}}); err == nil {
+		t.Error("Expected an error for a failing webhook")
+	}
+}
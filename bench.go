@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// --- bench Subcommand ---
+
+// benchUsage is printed for -h and argument errors.
+const benchUsage = `Usage: goatpaver bench [-input FILE] [-docs N] [-doc-size SIZE] [-runs N] [-json]
+
+Runs a corpus through the pipeline -runs times and reports, for each stage, the documents
+and megabytes per second and the allocations per document, to compare releases and
+changes. The corpus is the -input document, with its URL files read beforehand, or else
+-docs synthetic pages of about -doc-size each (1000 of 20KB by default) with a dozen
+typical expressions. Stages:
+
+  input    decoding the input document
+  parse    parsing each URL's content, alone
+  process  everything process does for the URLs: parsing, expressions, rules and sections
+  output   encoding the output as compact JSON
+
+-json prints the report as JSON, with the goatpaver and Go versions.
+`
+
+// benchStages are the stages timed, in order.
+var benchStages = []string{"input", "parse", "process", "output"}
+
+// benchReport is what "goatpaver bench" prints.
+type benchReport struct {
+	Version     string       `json:"version"`
+	GoVersion   string       `json:"go_version"`
+	Corpus      string       `json:"corpus"` // The -input file, or "synthetic"
+	Documents   int          `json:"documents"`
+	Bytes       int          `json:"bytes"` // Of content, over all documents
+	Expressions int          `json:"expressions"`
+	Runs        int          `json:"runs"`
+	Stages      []benchStage `json:"stages"`
+}
+
+// benchStage is how one stage did, on average over the runs.
+type benchStage struct {
+	Name         string  `json:"name"`
+	Seconds      float64 `json:"seconds"` // Per run
+	DocsPerSec   float64 `json:"docs_per_sec"`
+	MBPerSec     float64 `json:"mb_per_sec"`
+	AllocsPerDoc float64 `json:"allocs_per_doc"`
+	BytesPerDoc  float64 `json:"alloc_bytes_per_doc"`
+}
+
+// runBench implements "goatpaver bench".
+func runBench(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), benchUsage) }
+	inputFile := flags.String("input", "", "input document to run instead of a synthetic corpus")
+	docs := flags.Int("docs", 1000, "number of synthetic documents")
+	docSize := flags.String("doc-size", "20KB", "size of each synthetic document")
+	runs := flags.Int("runs", 3, "number of times to run the corpus")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	size, err := parseSize(*docSize)
+	if err != nil {
+		return fmt.Errorf("-doc-size: %w", err)
+	}
+	if *docs < 1 || *runs < 1 {
+		return errors.New("-docs and -runs must be at least 1")
+	}
+
+	corpus, document := "synthetic", syntheticCorpus(*docs, int(size))
+	if *inputFile != "" {
+		corpus = *inputFile
+		if document, err = loadBenchInput(*inputFile); err != nil {
+			return err
+		}
+	}
+	report, err := bench(document, *runs)
+	if err != nil {
+		return err
+	}
+	report.Corpus = corpus
+	if *asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(data))
+		return nil
+	}
+	report.write(stdout)
+	return nil
+}
+
+// loadBenchInput reads the input document at location with the content of its URL files
+// put inline, so that reading files isn't part of what is timed.
+func loadBenchInput(location string) ([]byte, error) {
+	data, err := readInputFile(context.Background(), location, formatJSON)
+	if err != nil {
+		return nil, err
+	}
+	input, err := parseInput(data)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	urls := make(map[string]UrlData, len(input.Urls))
+	for pageURL, urlData := range input.Urls {
+		if urlData.File != "" {
+			if urlData.Content, err = readObject(context.Background(), urlData.File); err != nil {
+				return nil, fmt.Errorf("reading content for URL '%s': %w", pageURL, err)
+			}
+		} else if len(urlData.Content) == 0 {
+			return nil, fmt.Errorf("URL '%s' has no content; bench doesn't fetch", pageURL)
+		} else if urlData.ContentEncoding != "" {
+			if urlData.Content, err = decodeContent(urlData.Content, urlData.ContentEncoding, 0); err != nil {
+				return nil, fmt.Errorf("decoding content for URL '%s': %w", pageURL, err)
+			}
+		}
+		urls[pageURL] = UrlData{Content: urlData.Content}
+	}
+	if document["urls"], err = json.Marshal(urls); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+// syntheticCorpus returns an input document of n product pages of about size bytes each.
+// The pages are the same on every call.
+func syntheticCorpus(n, size int) []byte {
+	random := rand.New(rand.NewSource(1))
+	words := strings.Fields("goat paver stone path garden slate granite edge border patio drive gravel sand lay level")
+	sentence := func(length int) string {
+		s := make([]string, length)
+		for i := range s {
+			s[i] = words[random.Intn(len(words))]
+		}
+		return strings.Join(s, " ")
+	}
+	urls := make(map[string]UrlData, n)
+	for i := 0; i < n; i++ {
+		var page strings.Builder
+		fmt.Fprintf(&page, "<html><head><title>Product %d</title><meta name=\"description\" content=\"%s\"/></head><body>", i, sentence(12))
+		fmt.Fprintf(&page, "<nav><a href=\"/\">Home</a> <a href=\"/c/%d\">Category</a></nav><h1>%s</h1>", i%20, sentence(4))
+		fmt.Fprintf(&page, "<table><tr><td class=\"sku\">SKU-%06d</td><td class=\"price\">%d.%02d</td></tr></table>", i, random.Intn(500), random.Intn(100))
+		page.WriteString("<article>")
+		for page.Len() < size-100 {
+			fmt.Fprintf(&page, "<p>%s <a href=\"/p/%d\">%s</a>.</p>", sentence(30), random.Intn(n), sentence(2))
+			fmt.Fprintf(&page, "<ul><li>%s</li><li>%s</li></ul>", sentence(3), sentence(3))
+		}
+		page.WriteString("</article></body></html>")
+		urls[fmt.Sprintf("https://shop.example.com/p/%d", i)] = UrlData{Content: documentContent(page.String())}
+	}
+	document, _ := json.Marshal(map[string]interface{}{
+		"xpaths": []interface{}{
+			"//title",
+			"//h1",
+			"//meta[@name='description']/@content",
+			"//td[@class='sku']",
+			map[string]interface{}{"xpath": "//td[@class='price']", "name": "price", "transforms": []interface{}{map[string]string{"type": "number"}}},
+			map[string]interface{}{"xpath": "//a/@href", "name": "links", "mode": "all", "resolve": true, "dedupe": true},
+			map[string]interface{}{"xpath": "//li", "name": "features", "mode": "all", "normalize": map[string]bool{"collapse": true, "trim": true}},
+			map[string]interface{}{"xpath": "//p", "name": "first paragraph", "return": "innerHTML"},
+			map[string]interface{}{"xpath": "//nav", "name": "nav", "return": "outerHTML"},
+			"count(//p)",
+			"boolean(//table)",
+			"string(//article/p[2])",
+		},
+		"urls": urls,
+	})
+	return document
+}
+
+// benchMeter measures a stage.
+type benchMeter struct {
+	started time.Time
+	stats   runtime.MemStats
+}
+
+func startMeter() benchMeter {
+	runtime.GC() // So garbage from earlier stages isn't collected on this one's time
+	m := benchMeter{}
+	runtime.ReadMemStats(&m.stats)
+	m.started = time.Now()
+	return m
+}
+
+// stop adds the stage's time and allocations since m started to stage.
+func (m benchMeter) stop(stage *benchStage) {
+	elapsed := time.Since(m.started)
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	stage.Seconds += elapsed.Seconds()
+	stage.AllocsPerDoc += float64(stats.Mallocs - m.stats.Mallocs)
+	stage.BytesPerDoc += float64(stats.TotalAlloc - m.stats.TotalAlloc)
+}
+
+// bench runs the input document through the stages runs times.
+func bench(document []byte, runs int) (*benchReport, error) {
+	report := &benchReport{Version: toolVersion(), GoVersion: runtime.Version(), Runs: runs}
+	stages := make([]benchStage, len(benchStages))
+	for i, name := range benchStages {
+		stages[i].Name = name
+	}
+	quiet := logger
+	defer func() { logger = quiet }()
+	logger = slog.New(slog.DiscardHandler) // Warnings about the corpus would be timed too
+
+	for run := 0; run < runs; run++ {
+		m := startMeter()
+		input, err := parseInput(document)
+		m.stop(&stages[0])
+		if err != nil {
+			return nil, err
+		}
+		report.Documents, report.Bytes, report.Expressions = len(input.Urls), 0, len(input.Xpaths)+len(input.Presets)
+
+		m = startMeter()
+		for pageURL, urlData := range input.Urls {
+			report.Bytes += len(urlData.Content)
+			decode(bytes.NewReader(urlData.Content), input, pageURL, pageSource{size: int64(len(urlData.Content))}) // Failures show in process
+		}
+		m.stop(&stages[1])
+
+		m = startMeter()
+		output, err := process(input)
+		m.stop(&stages[2])
+		if err != nil {
+			return nil, err
+		}
+
+		m = startMeter()
+		err = writeOutput(io.Discard, formatJSON, false, input.ordered(output))
+		m.stop(&stages[3])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	docs, mb := float64(report.Documents), float64(report.Bytes)/(1<<20)
+	for i := range stages {
+		s := &stages[i]
+		s.Seconds /= float64(runs)
+		if s.Seconds > 0 {
+			s.DocsPerSec, s.MBPerSec = docs/s.Seconds, mb/s.Seconds
+		}
+		if docs > 0 {
+			s.AllocsPerDoc /= docs * float64(runs)
+			s.BytesPerDoc /= docs * float64(runs)
+		}
+	}
+	report.Stages = stages
+	return report, nil
+}
+
+// write prints r as a table.
+func (r *benchReport) write(w io.Writer) {
+	fmt.Fprintf(w, "goatpaver %s, %s\n", r.Version, r.GoVersion)
+	fmt.Fprintf(w, "%s: %d documents, %.1f MB, %d expressions, %d runs\n\n", r.Corpus, r.Documents, float64(r.Bytes)/(1<<20), r.Expressions, r.Runs)
+	fmt.Fprintf(w, "%-8s %10s %10s %10s %12s %12s\n", "stage", "seconds", "docs/s", "MB/s", "allocs/doc", "KB/doc")
+	for _, s := range r.Stages {
+		fmt.Fprintf(w, "%-8s %10.3f %10.0f %10.1f %12.0f %12.1f\n", s.Name, s.Seconds, s.DocsPerSec, s.MBPerSec, s.AllocsPerDoc, s.BytesPerDoc/1024)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyntheticCorpus(t *testing.T) {
+	document := syntheticCorpus(3, 4000)
+	if !bytes.Equal(document, syntheticCorpus(3, 4000)) {
+		t.Error("The synthetic corpus differs between calls")
+	}
+	input, err := parseInput(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pageURL, urlData := range input.Urls {
+		if n := len(urlData.Content); n < 3500 || n > 5000 {
+			t.Errorf("Page %s is %d bytes, want about 4000", pageURL, n)
+		}
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(input.status.log) > 0 {
+		t.Errorf("Warnings on the synthetic corpus: %v", input.status.log)
+	}
+	for _, key := range []string{"//title", "price", "links", "features", "nav", "count(//p)"} {
+		if len(output[key]) != 3 {
+			t.Errorf("%s matched on %d pages, want 3", key, len(output[key]))
+		}
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	var out bytes.Buffer
+	if err := runBench([]string{"-docs", "5", "-doc-size", "2KB", "-runs", "2", "-json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var report benchReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Corpus != "synthetic" || report.Documents != 5 || report.Runs != 2 || len(report.Stages) != len(benchStages) {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	for _, stage := range report.Stages {
+		if stage.Seconds <= 0 || stage.DocsPerSec <= 0 || stage.AllocsPerDoc <= 0 {
+			t.Errorf("Stage %s not measured: %+v", stage.Name, stage)
+		}
+	}
+
+	// The table has a line per stage
+	out.Reset()
+	if err := runBench([]string{"-docs", "2", "-doc-size", "1KB", "-runs", "1"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range benchStages {
+		if !strings.Contains(out.String(), "\n"+name+" ") {
+			t.Errorf("No line for stage %s in:\n%s", name, out.String())
+		}
+	}
+
+	for _, args := range [][]string{{"-docs", "0"}, {"-doc-size", "big"}, {"extra"}} {
+		if err := runBench(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("runBench(%q) succeeded", args)
+		}
+	}
+}
+
+func TestBenchInput(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(page, []byte("<h1>From a file</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "input.json")
+	document := `{"xpaths": ["//h1"], "urls": {"a": {"file": "` + page + `"}, "b": {"content": "<h1>Inline</h1>"}}}`
+	if err := os.WriteFile(input, []byte(document), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := loadBenchInput(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := parseInput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(loaded.Urls["a"].Content); got != "<h1>From a file</h1>" || loaded.Urls["a"].File != "" {
+		t.Errorf("File content not put inline: %+v", loaded.Urls["a"])
+	}
+
+	var out bytes.Buffer
+	if err := runBench([]string{"-input", input, "-runs", "1", "-json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"documents": 2`) {
+		t.Errorf("Unexpected report: %s", out.String())
+	}
+
+	// URLs to fetch can't be benchmarked
+	if err := os.WriteFile(input, []byte(`{"xpaths": ["//h1"], "urls": {"https://example.com/": {}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBenchInput(input); err == nil || !strings.Contains(err.Error(), "doesn't fetch") {
+		t.Errorf("Loaded an input with a URL to fetch: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+// --- BigQuery Sink ---
+
+const bigQueryScope = "https://www.googleapis.com/auth/bigquery"
+
+// bigQueryEndpoint is the root of the BigQuery REST API.
+var bigQueryEndpoint = "https://bigquery.googleapis.com/bigquery/v2"
+
+// bigQueryClient returns an HTTP client authorized for BigQuery: with the service account
+// key in credentialsFile if given, otherwise with Application Default Credentials
+// ($GOOGLE_APPLICATION_CREDENTIALS, gcloud or the metadata server).
+var bigQueryClient = func(ctx context.Context, credentialsFile string) (*http.Client, error) {
+	if credentialsFile == "" {
+		return google.DefaultClient(ctx, bigQueryScope)
+	}
+	key, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	config, err := google.JWTConfigFromJSON(key, bigQueryScope)
+	if err != nil {
+		return nil, fmt.Errorf("reading service account key %s: %w", credentialsFile, err)
+	}
+	return config.Client(ctx), nil
+}
+
+// bigQueryBatchSize is the number of rows per streaming insert request.
+const bigQueryBatchSize = 500
+
+// bigQuerySchema is the table created for the flat shape when the table doesn't exist.
+var bigQuerySchema = []map[string]string{
+	{"name": "url", "type": "STRING", "mode": "REQUIRED"},
+	{"name": "xpath", "type": "STRING", "mode": "REQUIRED"},
+	{"name": "value", "type": "STRING", "mode": "NULLABLE", "description": "JSON encoding of the value"},
+	{"name": "matched", "type": "BOOL", "mode": "REQUIRED"},
+	{"name": "run_id", "type": "STRING", "mode": "REQUIRED"},
+	{"name": "timestamp", "type": "TIMESTAMP", "mode": "REQUIRED"},
+}
+
+// bigQuerySink streams records into a BigQuery table: bigquery://PROJECT/DATASET/TABLE,
+// with ?credentials=key.json for a service account key file. The table is created with
+// the flat-shape columns if it doesn't exist. Rows carry insert IDs hashed from run, URL
+// and xpath, so BigQuery drops duplicates when a run is retried.
+type bigQuerySink struct {
+	client *http.Client
+	table  string // Path of the table resource below bigQueryEndpoint
+}
+
+func openBigQuerySink(target *url.URL) (sink, error) {
+	parts := strings.Split(strings.Trim(target.Path, "/"), "/")
+	if target.Host == "" || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("bigquery output needs bigquery://PROJECT/DATASET/TABLE")
+	}
+	ctx := context.Background()
+	client, err := bigQueryClient(ctx, target.Query().Get("credentials"))
+	if err != nil {
+		return nil, err
+	}
+	s := &bigQuerySink{
+		client: client,
+		table:  "/projects/" + url.PathEscape(target.Host) + "/datasets/" + url.PathEscape(parts[0]) + "/tables/" + url.PathEscape(parts[1]),
+	}
+	if err := s.ensureTable(target.Host, parts[0], parts[1]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ensureTable creates the table unless it exists.
+func (s *bigQuerySink) ensureTable(project, dataset, table string) error {
+	resp, err := s.client.Get(bigQueryEndpoint + s.table)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("looking up table %s.%s: %s", dataset, table, resp.Status)
+	}
+	return s.call("/projects/"+url.PathEscape(project)+"/datasets/"+url.PathEscape(dataset)+"/tables", map[string]interface{}{
+		"tableReference": map[string]string{"projectId": project, "datasetId": dataset, "tableId": table},
+		"schema":         map[string]interface{}{"fields": bigQuerySchema},
+	}, nil)
+}
+
+func (s *bigQuerySink) write(run sinkRun) error {
+	stamp := run.Time.UTC().Format(time.RFC3339Nano)
+	for start := 0; start < len(run.Records); start += bigQueryBatchSize {
+		var rows []map[string]interface{}
+		for _, r := range run.Records[start:min(start+bigQueryBatchSize, len(run.Records))] {
+			value, err := recordValue(r)
+			if err != nil {
+				return err
+			}
+			insertID := sha256.Sum256([]byte(run.ID + historySeparator + r.URL + historySeparator + r.XPath))
+			rows = append(rows, map[string]interface{}{
+				"insertId": hex.EncodeToString(insertID[:]),
+				"json": map[string]interface{}{
+					"url": r.URL, "xpath": r.XPath, "value": value, "matched": r.Matched,
+					"run_id": run.ID, "timestamp": stamp,
+				},
+			})
+		}
+		var result struct {
+			InsertErrors []struct {
+				Index  int `json:"index"`
+				Errors []struct {
+					Reason  string `json:"reason"`
+					Message string `json:"message"`
+				} `json:"errors"`
+			} `json:"insertErrors"`
+		}
+		if err := s.call(s.table+"/insertAll", map[string]interface{}{"rows": rows}, &result); err != nil {
+			return err
+		}
+		if len(result.InsertErrors) > 0 {
+			first := result.InsertErrors[0]
+			message := "unknown error"
+			if len(first.Errors) > 0 {
+				message = first.Errors[0].Reason + ": " + first.Errors[0].Message
+			}
+			return fmt.Errorf("%d rows rejected, row %d: %s", len(result.InsertErrors), start+first.Index, message)
+		}
+	}
+	return nil
+}
+
+// call POSTs request as JSON to path and decodes the response into result unless nil.
+func (s *bigQuerySink) call(path string, request, result interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(bigQueryEndpoint+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("bigquery %s returned %s: %s", path, resp.Status, bytes.TrimSpace(data))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (s *bigQuerySink) Close() error {
+	return nil
+}
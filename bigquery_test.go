@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBigQuerySink(t *testing.T) {
+	var created bool
+	var rows []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		table := "/projects/acme/datasets/scrapes/tables/pages"
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == table:
+			if !created {
+				http.NotFound(w, r)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/projects/acme/datasets/scrapes/tables":
+			var request struct {
+				Schema struct{ Fields []map[string]string }
+			}
+			json.NewDecoder(r.Body).Decode(&request)
+			if len(request.Schema.Fields) != len(bigQuerySchema) {
+				t.Errorf("Unexpected schema %v", request.Schema)
+			}
+			created = true
+		case r.Method == http.MethodPost && r.URL.Path == table+"/insertAll":
+			var request struct{ Rows []map[string]interface{} }
+			json.NewDecoder(r.Body).Decode(&request)
+			rows = append(rows, request.Rows...)
+			w.Write([]byte(`{}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			http.Error(w, "unexpected", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	defer func(endpoint string, client func(context.Context, string) (*http.Client, error)) {
+		bigQueryEndpoint, bigQueryClient = endpoint, client
+	}(bigQueryEndpoint, bigQueryClient)
+	bigQueryEndpoint = server.URL
+	bigQueryClient = func(ctx context.Context, credentialsFile string) (*http.Client, error) {
+		if credentialsFile != "key.json" {
+			t.Errorf("Unexpected credentials file %q", credentialsFile)
+		}
+		return server.Client(), nil
+	}
+
+	opts, err := parseFlags([]string{"-output", "bigquery://acme/scrapes/pages?credentials=key.json", "-run-id", "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := OutputJson{"//h1": {"http://a.com": "A"}}
+	input := &InputJson{Urls: map[string]UrlData{"http://a.com": {}, "http://b.com": {}}}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := opts.writeSink(input, records, at); err != nil {
+		t.Fatal(err)
+	}
+	if !created || len(rows) != 2 {
+		t.Fatalf("created = %v, %d rows; want the table created and 2 rows", created, len(rows))
+	}
+	first := rows[0]["json"].(map[string]interface{})
+	if first["url"] != "http://a.com" || first["value"] != `"A"` || first["matched"] != true || first["timestamp"] != "2024-03-01T12:00:00Z" {
+		t.Errorf("Unexpected row %v", first)
+	}
+	if second := rows[1]["json"].(map[string]interface{}); second["value"] != nil || second["matched"] != false {
+		t.Errorf("Unexpected row %v", second)
+	}
+	if rows[0]["insertId"] == rows[1]["insertId"] {
+		t.Error("Rows share an insert ID")
+	}
+
+	// An existing table is used as it is; rejected rows are reported
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/insertAll") {
+			w.Write([]byte(`{"insertErrors": [{"index": 1, "errors": [{"reason": "invalid", "message": "no such field"}]}]}`))
+		}
+	})
+	if err := opts.writeSink(input, records, at); err == nil || !strings.Contains(err.Error(), "no such field") {
+		t.Errorf("Expected the insert error to be reported, got %v", err)
+	}
+
+	if _, err := openBigQuerySink(mustParseURL(t, "bigquery://acme/scrapes")); err == nil {
+		t.Error("Expected an error for a target without a table")
+	}
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
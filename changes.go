@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// --- Change-Only Output ---
+
+// ChangeOptions limits the output to values that differ from an earlier run.
+type ChangeOptions struct {
+	// Previous is an earlier output file to compare against. Without it the latest values
+	// in the input's history store are used.
+	Previous string `json:"previous,omitempty"`
+}
+
+// previousOutput loads the output of an earlier run for comparison: the output file at
+// path if given, otherwise the latest values in the input's history store. A file that
+// doesn't exist yet counts as an empty output, so the first scheduled run reports
+// everything.
+func (input *InputJson) previousOutput(path string) (OutputJson, error) {
+	switch {
+	case path != "":
+		previous, err := readOutput(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return OutputJson{}, nil
+		}
+		return previous, err
+	case input.History != "":
+		return latestHistory(input.History)
+	default:
+		return nil, fmt.Errorf("comparing with an earlier run needs a previous output file or a history store")
+	}
+}
+
+// changedOnly reduces output to the values that were added or changed since previous;
+// values that disappeared are reported as null. Only URLs of the current input are
+// considered, so dropping a URL from the input doesn't report all of its values as removed.
+// Report sections are kept as they are.
+func changedOnly(input *InputJson, previous, output OutputJson) OutputJson {
+	changed := make(OutputJson, len(output))
+	for key, results := range output {
+		if strings.HasPrefix(key, "$") {
+			changed[key] = results
+		} else {
+			changed[key] = make(map[string]interface{})
+		}
+	}
+	for _, c := range diffOutputs(previous, output) {
+		if _, inInput := input.Urls[c.URL]; !inInput {
+			continue
+		}
+		if changed[c.XPath] == nil {
+			changed[c.XPath] = make(map[string]interface{})
+		}
+		changed[c.XPath][c.URL] = c.New // nil for removed values
+	}
+	return changed
+}
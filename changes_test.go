@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChangedOnly(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", "//span"],
+		"urls": {
+			"http://a.com": {"content": "<p><h1>A</h1><span>12</span></p>"},
+			"http://b.com": {"content": "<p><h1>B</h1></p>"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := OutputJson{
+		"//h1":   {"http://a.com": "A", "http://b.com": "Old B", "http://gone.com": "G"},
+		"//span": {"http://a.com": "10", "http://b.com": "5"},
+	}
+	output[coverageKey] = map[string]interface{}{"kept": true}
+
+	expected := OutputJson{
+		"//h1":      {"http://b.com": "B"},
+		"//span":    {"http://a.com": "12", "http://b.com": nil},
+		coverageKey: {"kept": true},
+	}
+	if actual := changedOnly(input, previous, output); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expected, actual)
+	}
+}
+
+func TestPreviousOutput(t *testing.T) {
+	dir := t.TempDir()
+	input := &InputJson{ChangesOnly: &ChangeOptions{Previous: filepath.Join(dir, "missing.json")}}
+	if previous, err := input.previousOutput(input.ChangesOnly.Previous); err != nil || len(previous) != 0 {
+		t.Errorf("previousOutput of a missing file = %v, %v; want an empty output", previous, err)
+	}
+
+	path := filepath.Join(dir, "old.json")
+	data, _ := json.Marshal(OutputJson{"//h1": {"http://a.com": "A"}})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	input.ChangesOnly.Previous = path
+	if previous, err := input.previousOutput(input.ChangesOnly.Previous); err != nil || previous["//h1"]["http://a.com"] != "A" {
+		t.Errorf("previousOutput of a file = %v, %v", previous, err)
+	}
+
+	// From the history store, only the latest non-null value of each series counts
+	db := filepath.Join(dir, "history.db")
+	urls := map[string]UrlData{"http://a.com": {}}
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	recordHistory(db, &InputJson{Urls: urls}, OutputJson{"//h1": {"http://a.com": "A"}, "//p": {"http://a.com": "P"}}, day)
+	recordHistory(db, &InputJson{Urls: urls}, OutputJson{"//h1": {"http://a.com": "A2"}, "//p": {}}, day.AddDate(0, 0, 1))
+	input = &InputJson{History: db, ChangesOnly: &ChangeOptions{}}
+	previous, err := input.previousOutput(input.ChangesOnly.Previous)
+	if err != nil {
+		t.Fatalf("previousOutput from history returned an unexpected error: %v", err)
+	}
+	if expected := (OutputJson{"//h1": {"http://a.com": "A2"}}); !reflect.DeepEqual(expected, previous) {
+		t.Errorf("Unexpected previous output.\nExpected: %#v\nGot:      %#v", expected, previous)
+	}
+
+	if _, err := (&InputJson{}).previousOutput(""); err == nil {
+		t.Errorf("Expected an error without a previous output or history, but got nil")
+	}
+}
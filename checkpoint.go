@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// --- Checkpoints ---
+
+// A long run can write checkpoints of the URLs it has done, with their values, and be
+// resumed from one after it was interrupted: the run then skips the URLs in the
+// checkpoint and puts their values into its output as if it had processed them. URLs that
+// failed aren't in the checkpoint, so a resumed run tries them again.
+
+// checkpointInterval is how often a checkpoint is written during a run, at most.
+var checkpointInterval = 10 * time.Second
+
+// checkpoint is a checkpoint file, and the run writing it.
+type checkpoint struct {
+	Input  string     `json:"input_sha256"` // Of the input document, which a resumed run must share
+	URLs   []string   `json:"urls"`         // The URLs done
+	Output OutputJson `json:"output"`       // Their values and report sections, before the script's per-URL hook
+
+	path  string
+	done  map[string]bool
+	saved time.Time
+}
+
+// newCheckpoint starts a checkpoint at path for a run of the input document with the
+// checksum document. If resume is not "", the run continues from the checkpoint at resume
+// instead, which must exist.
+func newCheckpoint(path, resume string, document checksum) (*checkpoint, error) {
+	c := &checkpoint{Input: document.SHA256, path: path, done: make(map[string]bool), saved: time.Now()}
+	if resume == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(resume)
+	if err != nil {
+		return nil, err
+	}
+	var resumed checkpoint
+	if err := json.Unmarshal(data, &resumed); err != nil {
+		return nil, fmt.Errorf("reading checkpoint %s: %w", resume, err)
+	}
+	if resumed.Input != c.Input {
+		return nil, fmt.Errorf("checkpoint %s is of a different input document", resume)
+	}
+	c.URLs, c.Output = resumed.URLs, resumed.Output
+	for _, pageURL := range c.URLs {
+		c.done[pageURL] = true
+	}
+	return c, nil
+}
+
+// checkpointPath returns where the run writes checkpoints, or "" if it doesn't: the
+// -checkpoint file, or else the one it resumes from.
+func (opts runOptions) checkpointPath() string {
+	if opts.checkpoint != "" {
+		return opts.checkpoint
+	}
+	return opts.resume
+}
+
+// resume puts the values from the checkpoint into output, for the keys it has. It is nil
+// safe, like the other methods.
+func (c *checkpoint) resume(output OutputJson) {
+	if c == nil {
+		return
+	}
+	for key, values := range c.Output {
+		if output[key] == nil {
+			continue
+		}
+		for pageURL, value := range values {
+			output[key][pageURL] = value
+		}
+	}
+}
+
+// skips tells whether pageURL is done already, before the run was resumed.
+func (c *checkpoint) skips(pageURL string) bool {
+	return c != nil && c.done[pageURL]
+}
+
+// completed records that pageURL is done, writing the checkpoint if it is due.
+func (input *InputJson) completed(pageURL string, output OutputJson) {
+	c := input.checkpoint
+	if c == nil {
+		return
+	}
+	c.done[pageURL] = true
+	if time.Since(c.saved) >= checkpointInterval {
+		input.saveCheckpoint(output)
+	}
+}
+
+// saveCheckpoint writes the checkpoint of output. A checkpoint that can't be written is
+// a warning, since the run itself can go on.
+func (input *InputJson) saveCheckpoint(output OutputJson) {
+	c := input.checkpoint
+	if c == nil {
+		return
+	}
+	c.saved = time.Now()
+	c.URLs = c.URLs[:0]
+	for pageURL := range c.done {
+		c.URLs = append(c.URLs, pageURL)
+	}
+	sort.Strings(c.URLs)
+	c.Output = output
+	if err := c.write(); err != nil {
+		input.warn(warnCheckpoint, c.path, "Failed to write checkpoint: %v", err)
+	}
+}
+
+// write replaces the checkpoint file, so that it is never left half written.
+func (c *checkpoint) write() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), c.path)
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(temp.Name()))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint(t *testing.T) {
+	defer func(saved time.Duration) { checkpointInterval = saved }(checkpointInterval)
+	checkpointInterval = 0 // Every URL
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	document := []byte(`{"xpaths": ["//h1"], "urls": {"a": {"content": "<h1>A</h1>"}, "b": {"content": "<h1>"}}}`)
+
+	input, err := parseInput(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.checkpoint, err = newCheckpoint(path, "", newChecksum(document)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := process(input); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved checkpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved.URLs, []string{"a"}) || saved.Output["//h1"]["a"] != "A" || saved.Input != newChecksum(document).SHA256 {
+		t.Errorf("Unexpected checkpoint %s", data)
+	}
+
+	// Resuming skips a: its content is gone, yet its value is kept. b is tried again.
+	resumed := []byte(strings.Replace(string(document), `"content": "<h1>A</h1>"`, `"content": "<p>"`, 1))
+	if _, err := newCheckpoint(path, path, newChecksum(resumed)); err == nil {
+		t.Error("Resumed from the checkpoint of a different input")
+	}
+	input, err = parseInput(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.Urls["a"] = UrlData{Content: documentContent("<p>")}
+	if input.checkpoint, err = newCheckpoint(path, path, newChecksum(document)); err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output["//h1"]["a"] != "A" || !input.status.skipped["b"] || input.status.skipped["a"] {
+		t.Errorf("Unexpected resumed output %v and status %+v", output, input.status)
+	}
+
+	if _, err := newCheckpoint(path, filepath.Join(t.TempDir(), "missing.json"), newChecksum(document)); err == nil {
+		t.Error("Resumed from a missing checkpoint")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// --- go_goat Compatibility ---
+
+// goatpaver and go_goat, as "go build" names the binary, are the same program. Invoked as
+// go_goat, or as "goatpaver goat", it keeps to what go_goat builds did before exit
+// statuses and terminal-aware output: JSON is always indented and URLs that fail don't
+// change the exit status.
+
+// legacyName is the name invoking compatible behaviour.
+const legacyName = "go_goat"
+
+// errorsKey is the output section of -error-values, giving why each failed URL was given
+// up on.
+const errorsKey = "$errors"
+
+// urlError is a failed URL's entry in the errors section.
+type urlError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// invokedAsLegacy tells whether the program was run by the name go_goat, given
+// os.Args[0].
+func invokedAsLegacy(arg0 string) bool {
+	name := strings.TrimSuffix(filepath.Base(arg0), ".exe")
+	return name == legacyName
+}
+
+// legacy adjusts opts for a run invoked as go_goat.
+func (opts *runOptions) legacy() {
+	opts.pretty = !opts.compact
+	opts.legacyExit = true
+}
+
+// exitStatus returns the exit status of a run whose URLs failed with code, which
+// go_goat builds reported by warnings alone.
+func (opts runOptions) exitStatus(code int) int {
+	if opts.legacyExit && (code == exitPartial || code == exitFailed) {
+		return 0
+	}
+	return code
+}
+
+// errorSection returns the errors section of -error-values: the first warning of each URL
+// given up on, by URL.
+func (input *InputJson) errorSection() map[string]interface{} {
+	section := make(map[string]interface{})
+	for _, w := range input.status.log {
+		if _, seen := section[w.URL]; w.Skipped && !seen {
+			section[w.URL] = urlError{Code: w.Code, Message: w.Message}
+		}
+	}
+	return section
+}
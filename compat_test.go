@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestErrorSection(t *testing.T) {
+	input, err := parseInput([]byte(`{"xpaths": ["//h1"], "urls": {"a": {"content": "<h1>A</h1>"}, "b": {"content": "<h1>"}, "c": {"file": "testdata/missing.html"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := process(input); err != nil {
+		t.Fatal(err)
+	}
+	section := input.errorSection()
+	if len(section) != 2 || section["a"] != nil {
+		t.Fatalf("Unexpected errors %v", section)
+	}
+	if b := section["b"].(urlError); b.Code != warnParse || !strings.HasPrefix(b.Message, "Failed to parse content for URL 'b'") {
+		t.Errorf("Unexpected error of b %+v", b)
+	}
+	if c := section["c"].(urlError); c.Code != warnRead {
+		t.Errorf("Unexpected error of c %+v", c)
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	for arg0, want := range map[string]bool{"go_goat": true, "/usr/local/bin/go_goat": true, `go_goat.exe`: true, "goatpaver": false, "./go_goat2": false} {
+		if got := invokedAsLegacy(arg0); got != want {
+			t.Errorf("invokedAsLegacy(%q) = %v", arg0, got)
+		}
+	}
+
+	opts, err := parseFlags(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.exitStatus(exitPartial) != exitPartial {
+		t.Error("Changed the exit status without go_goat")
+	}
+	opts.legacy()
+	if !opts.pretty || opts.exitStatus(exitPartial) != 0 || opts.exitStatus(exitFailed) != 0 || opts.exitStatus(1) != 1 {
+		t.Errorf("Unexpected go_goat options %+v", opts)
+	}
+	if opts, err = parseFlags([]string{"-compact"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.legacy(); opts.pretty {
+		t.Error("Indented with -compact")
+	}
+}
+
+func TestEmptyOnNoMatch(t *testing.T) {
+	opts, err := parseFlags([]string{"-empty-on-no-match"})
+	if err != nil || opts.onNoMatch != noMatchEmpty {
+		t.Errorf("Unexpected -on-no-match %q and error %v", opts.onNoMatch, err)
+	}
+	if _, err := parseFlags([]string{"-empty-on-no-match", "-on-no-match", "null"}); err == nil {
+		t.Error("Expected an error for conflicting flags")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// --- completion Subcommand ---
+
+const completionUsage = `Usage: goatpaver completion bash|zsh|fish
+
+Prints a script completing goatpaver's subcommands, flags and flag values in the shell,
+e.g. for bash:
+
+  source <(goatpaver completion bash)
+
+or for zsh, saved as _goatpaver in a directory on $fpath, and for fish, saved as
+~/.config/fish/completions/goatpaver.fish.
+`
+
+// completionCommand is a subcommand, or the plain run with name "", as completed.
+type completionCommand struct {
+	name  string
+	flags []completionFlag
+	args  []string // Words completed as arguments, or nil
+	files bool     // Whether the arguments are files
+}
+
+// completionFlag is a flag. value is "" for a boolean flag, the choices ("xpath|url") or
+// the placeholder of the usage text.
+type completionFlag struct {
+	name  string
+	value string
+}
+
+// choices returns the values the flag takes, if they are a list.
+func (f completionFlag) choices() []string {
+	if f.value == strings.ToUpper(f.value) {
+		return nil
+	}
+	return strings.Split(f.value, "|")
+}
+
+// file tells whether the flag's value is a file.
+func (f completionFlag) file() bool {
+	return f.value == "PATH" || f.value == "FILE"
+}
+
+// usageFlag matches the flags in a usage synopsis, e.g. "[-group-by xpath|url]" and
+// "[-compact|-pretty]".
+var usageFlag = regexp.MustCompile(`(?:^|[\s\[|])-([a-z][a-z-]*)(?: ([A-Za-z|]+))?`)
+
+// completionCommands lists what is completed. The flags are taken from the synopses of
+// the usage texts, which name every flag, so they don't need to be kept in step.
+func completionCommands() []completionCommand {
+	var subcommands []string
+	commands := []completionCommand{}
+	for _, c := range []struct {
+		name, usage string
+		args        []string
+		files       bool
+	}{
+		{"", usage, nil, false},
+		{"bench", benchUsage, nil, true},
+		{"completion", completionUsage, []string{"bash", "zsh", "fish"}, false},
+		{"diff", diffUsage, nil, true},
+		{"goat", usage, nil, true},
+		{"history", historyUsage, nil, true},
+		{"infer", inferUsage, nil, true},
+		{"pave", usage, nil, true},
+		{"test", testUsage, nil, true},
+		{"validate", validateUsage, nil, true},
+		{"version", versionUsage, nil, false},
+		{"worker", workerUsage, nil, false},
+	} {
+		synopsis, _, _ := strings.Cut(c.usage, "\n\n")
+		command := completionCommand{name: c.name, args: c.args, files: c.files}
+		for _, m := range usageFlag.FindAllStringSubmatch(synopsis, -1) {
+			command.flags = append(command.flags, completionFlag{name: m[1], value: m[2]})
+		}
+		commands = append(commands, command)
+		if c.name != "" {
+			subcommands = append(subcommands, c.name)
+		}
+	}
+	commands[0].args = subcommands
+	return commands
+}
+
+// runCompletion implements "goatpaver completion".
+func runCompletion(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("completion", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), completionUsage) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("completion needs a shell")
+	}
+	commands := completionCommands()
+	switch flags.Arg(0) {
+	case "bash":
+		writeBashCompletion(stdout, commands)
+	case "zsh":
+		writeZshCompletion(stdout, commands)
+	case "fish":
+		writeFishCompletion(stdout, commands)
+	default:
+		return fmt.Errorf("unknown shell %q (want bash, zsh or fish)", flags.Arg(0))
+	}
+	return nil
+}
+
+func writeBashCompletion(w io.Writer, commands []completionCommand) {
+	fmt.Fprint(w, `# bash completion for goatpaver
+_goatpaver() {
+    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+    local command=${COMP_WORDS[1]} words="" files=""
+    case $command in
+        `+strings.Join(commands[0].args, "|")+`) ;;
+        *) command="" ;;
+    esac
+    case "$command $prev" in
+`)
+	for _, c := range commands {
+		for _, f := range c.flags {
+			switch {
+			case f.value == "":
+				continue
+			case f.file():
+				fmt.Fprintf(w, "        \"%s -%s\") COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", c.name, f.name)
+			case f.choices() != nil:
+				fmt.Fprintf(w, "        \"%s -%s\") COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", c.name, f.name, strings.Join(f.choices(), " "))
+			default:
+				fmt.Fprintf(w, "        \"%s -%s\") return ;;\n", c.name, f.name)
+			}
+		}
+	}
+	fmt.Fprint(w, "    esac\n    case $command in\n")
+	for _, c := range commands {
+		var flags []string
+		for _, f := range c.flags {
+			flags = append(flags, "-"+f.name)
+		}
+		fmt.Fprintf(w, "        %q) words=%q", c.name, strings.Join(flags, " "))
+		if c.name == "" {
+			// Subcommands come first
+			fmt.Fprintf(w, "; [[ $COMP_CWORD -eq 1 ]] && words+=%q", " "+strings.Join(c.args, " "))
+		} else if c.args != nil {
+			fmt.Fprintf(w, "; words+=%q", " "+strings.Join(c.args, " "))
+		}
+		if c.files {
+			fmt.Fprint(w, "; files=1")
+		}
+		fmt.Fprint(w, " ;;\n")
+	}
+	fmt.Fprint(w, `    esac
+    COMPREPLY=($(compgen -W "$words" -- "$cur"))
+    if [[ -n $files && $cur != -* ]]; then
+        COMPREPLY+=($(compgen -f -- "$cur"))
+    fi
+}
+complete -F _goatpaver goatpaver
+`)
+}
+
+func writeZshCompletion(w io.Writer, commands []completionCommand) {
+	fmt.Fprint(w, "#compdef goatpaver\n\n_goatpaver() {\n")
+	fmt.Fprint(w, "    if (( CURRENT > 2 )); then\n        case $words[2] in\n")
+	for _, c := range commands[1:] {
+		fmt.Fprintf(w, "            %s) shift words; (( CURRENT-- )); _arguments%s", c.name, zshSpecs(c.flags))
+		switch {
+		case c.args != nil:
+			fmt.Fprintf(w, " '1:%s:(%s)'", c.name, strings.Join(c.args, " "))
+		case c.files:
+			fmt.Fprint(w, " '*:file:_files'")
+		}
+		fmt.Fprint(w, "; return ;;\n")
+	}
+	fmt.Fprint(w, "        esac\n    fi\n")
+	fmt.Fprintf(w, "    _arguments%s '1:command:(%s)'\n}\n\n_goatpaver \"$@\"\n", zshSpecs(commands[0].flags), strings.Join(commands[0].args, " "))
+}
+
+// zshSpecs returns the _arguments specs of flags, each with a leading space.
+func zshSpecs(flags []completionFlag) string {
+	var specs strings.Builder
+	for _, f := range flags {
+		switch {
+		case f.value == "":
+			fmt.Fprintf(&specs, " '-%s'", f.name)
+		case f.file():
+			fmt.Fprintf(&specs, " '-%s:%s:_files'", f.name, strings.ToLower(f.value))
+		case f.choices() != nil:
+			fmt.Fprintf(&specs, " '-%s:%s:(%s)'", f.name, f.name, strings.Join(f.choices(), " "))
+		default:
+			fmt.Fprintf(&specs, " '-%s:%s: '", f.name, strings.ToLower(f.value))
+		}
+	}
+	return specs.String()
+}
+
+func writeFishCompletion(w io.Writer, commands []completionCommand) {
+	fmt.Fprint(w, "# fish completion for goatpaver\ncomplete -c goatpaver -f\n")
+	fmt.Fprintf(w, "complete -c goatpaver -n __fish_use_subcommand -a %q\n", strings.Join(commands[0].args, " "))
+	for _, c := range commands {
+		condition := "__fish_use_subcommand"
+		if c.name != "" {
+			condition = "__fish_seen_subcommand_from " + c.name
+		}
+		for _, f := range c.flags {
+			fmt.Fprintf(w, "complete -c goatpaver -n %q -o %s", condition, f.name)
+			switch {
+			case f.value == "":
+			case f.file():
+				fmt.Fprint(w, " -r -F")
+			case f.choices() != nil:
+				fmt.Fprintf(w, " -x -a %q", strings.Join(f.choices(), " "))
+			default:
+				fmt.Fprint(w, " -x")
+			}
+			fmt.Fprint(w, "\n")
+		}
+		switch {
+		case c.name == "":
+		case c.args != nil:
+			fmt.Fprintf(w, "complete -c goatpaver -n %q -a %q\n", condition, strings.Join(c.args, " "))
+		case c.files:
+			fmt.Fprintf(w, "complete -c goatpaver -n %q -F\n", condition)
+		}
+	}
+}
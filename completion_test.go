@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCompletionCommands(t *testing.T) {
+	commands := completionCommands()
+	run := commands[0]
+	if run.name != "" || strings.Join(run.args, " ") != "bench completion diff goat history infer pave test validate version worker" {
+		t.Fatalf("Unexpected plain run %+v", run)
+	}
+	flags := make(map[string]completionFlag)
+	for _, f := range run.flags {
+		flags[f.name] = f
+		// Every flag of the synopsis is a flag of the plain run
+		args := []string{"-" + f.name}
+		if f.value != "" {
+			args = append(args, "x")
+		}
+		if _, err := parseFlags(args); err != nil && strings.Contains(err.Error(), "not defined") {
+			t.Errorf("Flag -%s is not defined: %v", f.name, err)
+		}
+	}
+	if len(flags) < 20 {
+		t.Errorf("Only found flags %v", run.flags)
+	}
+	if groupBy := flags["group-by"]; strings.Join(groupBy.choices(), " ") != "xpath url" {
+		t.Errorf("Unexpected -group-by %+v", groupBy)
+	}
+	if compact, pretty := flags["compact"], flags["pretty"]; compact.value != "" || pretty.value != "" {
+		t.Errorf("Unexpected -compact %+v and -pretty %+v", compact, pretty)
+	}
+	if input := flags["input"]; !input.file() || input.choices() != nil {
+		t.Errorf("Unexpected -input %+v", input)
+	}
+
+	for _, c := range commands {
+		if c.name == "history" && (len(c.flags) != 4 || c.flags[0] != (completionFlag{"url", "URL"})) {
+			t.Errorf("Unexpected history flags %+v", c.flags)
+		}
+		if c.name == "worker" && (len(c.flags) != 12 || c.flags[0] != (completionFlag{"queue", "URL"})) {
+			t.Errorf("Unexpected worker flags %+v", c.flags)
+		}
+	}
+}
+
+func TestRunCompletion(t *testing.T) {
+	for shell, want := range map[string][]string{
+		"bash": {"completion|diff|goat|history|infer|pave|test|validate|version|worker) ;;", `" -group-by") COMPREPLY=($(compgen -W "xpath url"`, `"infer") words="-max"; files=1`},
+		"zsh":  {"#compdef goatpaver", "'-group-by:group-by:(xpath url)'", "'-input:file:_files'", "'1:completion:(bash zsh fish)'"},
+		"fish": {`-n "__fish_use_subcommand" -o output-format -x -a "json msgpack cbor protobuf"`, `-n "__fish_seen_subcommand_from diff" -o json`},
+	} {
+		var stdout bytes.Buffer
+		if err := runCompletion([]string{shell}, &stdout); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range want {
+			if !strings.Contains(stdout.String(), s) {
+				t.Errorf("%s completion has no %s:\n%s", shell, s, stdout.String())
+			}
+		}
+		if path, err := exec.LookPath(shell); err == nil {
+			check := exec.Command(path, "-n")
+			check.Stdin = &stdout
+			if output, err := check.CombinedOutput(); err != nil {
+				t.Errorf("Invalid %s completion: %v\n%s", shell, err, output)
+			}
+		}
+	}
+
+	var stdout bytes.Buffer
+	for _, args := range [][]string{{}, {"tcsh"}, {"bash", "zsh"}} {
+		if err := runCompletion(args, &stdout); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
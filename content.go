@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// --- Document Content ---
+
+// documentContent is the content of a URL, kept as bytes from decoding the input to
+// parsing the document. The parser, the validator and the stylesheet all read bytes, so a
+// string would have to be copied back for each of them. Content is still a JSON string in
+// the input: it is unescaped straight into bytes.
+type documentContent []byte
+
+// UnmarshalJSON decodes a JSON string into content, or null into none.
+func (c *documentContent) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*c = nil
+		return nil
+	}
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return errors.New("content must be a string")
+	}
+	quoted := data[1 : len(data)-1]
+	if bytes.IndexByte(quoted, '\\') < 0 && utf8.Valid(quoted) {
+		*c = bytes.Clone(quoted) // data belongs to the decoder
+		return nil
+	}
+	content, err := unquoteJSON(quoted)
+	if err != nil {
+		return err
+	}
+	*c = content
+	return nil
+}
+
+// MarshalJSON encodes content as a JSON string, not the base64 of []byte.
+func (c documentContent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(c))
+}
+
+// unquoteJSON unescapes the inside of a JSON string as encoding/json does, replacing
+// invalid UTF-8 and unpaired surrogates with U+FFFD.
+func unquoteJSON(quoted []byte) ([]byte, error) {
+	unquoted := make([]byte, 0, len(quoted))
+	for i := 0; i < len(quoted); {
+		b := quoted[i]
+		if b != '\\' {
+			if b < utf8.RuneSelf {
+				unquoted = append(unquoted, b)
+				i++
+				continue
+			}
+			r, size := utf8.DecodeRune(quoted[i:])
+			unquoted = utf8.AppendRune(unquoted, r) // RuneError for invalid UTF-8
+			i += size
+			continue
+		}
+		if i+1 >= len(quoted) {
+			return nil, errors.New("invalid escape in content")
+		}
+		switch quoted[i+1] {
+		case '"', '\\', '/':
+			unquoted = append(unquoted, quoted[i+1])
+		case 'b':
+			unquoted = append(unquoted, '\b')
+		case 'f':
+			unquoted = append(unquoted, '\f')
+		case 'n':
+			unquoted = append(unquoted, '\n')
+		case 'r':
+			unquoted = append(unquoted, '\r')
+		case 't':
+			unquoted = append(unquoted, '\t')
+		case 'u':
+			r, ok := unicodeEscape(quoted[i:])
+			if !ok {
+				return nil, errors.New("invalid escape in content")
+			}
+			i += 6
+			if utf16.IsSurrogate(r) {
+				// A surrogate pair is two escapes; an unpaired surrogate stands for U+FFFD
+				pair := utf8.RuneError
+				if low, ok := unicodeEscape(quoted[i:]); ok {
+					if pair = utf16.DecodeRune(r, low); pair != utf8.RuneError {
+						i += 6
+					}
+				}
+				r = pair
+			}
+			unquoted = utf8.AppendRune(unquoted, r)
+			continue
+		default:
+			return nil, errors.New("invalid escape in content")
+		}
+		i += 2
+	}
+	return unquoted, nil
+}
+
+// unicodeEscape reads the \uXXXX escape at the start of b.
+func unicodeEscape(b []byte) (rune, bool) {
+	if len(b) < 6 || b[0] != '\\' || b[1] != 'u' {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(string(b[2:6]), 16, 16)
+	return rune(n), err == nil
+}
+
+// Values of "content_encoding", for content that isn't the document's text. Callers can
+// ship binary documents, or compressed ones to keep large inputs small; content is
+// decoded when its URL is processed, so the input holds it encoded until then.
+const (
+	encodingBase64     = "base64"      // Standard base64, line breaks allowed
+	encodingGzipBase64 = "gzip+base64" // Gzipped, then base64
+)
+
+// checkContentEncoding checks the content_encoding of urlData.
+func checkContentEncoding(urlData UrlData) error {
+	switch urlData.ContentEncoding {
+	case "":
+		return nil
+	case encodingBase64, encodingGzipBase64:
+		if urlData.File != "" {
+			return errors.New("content_encoding applies to content, not files")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown content_encoding %q (want base64 or gzip+base64)", urlData.ContentEncoding)
+}
+
+// decodeContent returns the document that content encodes. A gzipped document larger
+// than limit bytes, unless it is 0, is a *tooLargeError and isn't decompressed beyond it.
+func decodeContent(content []byte, encoding string, limit int64) ([]byte, error) {
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(content)))
+	n, err := base64.StdEncoding.Decode(decoded, content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	decoded = decoded[:n]
+	if encoding == encodingBase64 {
+		return decoded, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(decoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip: %w", err)
+	}
+	r := io.Reader(zr)
+	if limit > 0 {
+		r = io.LimitReader(zr, limit+1)
+	}
+	data, err := readAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip: %w", err)
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, &tooLargeError{size: -1, limit: limit}
+	}
+	return data, nil
+}
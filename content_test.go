@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDocumentContent(t *testing.T) {
+	// Content must decode exactly as encoding/json decodes the string
+	for _, quoted := range []string{
+		`""`,
+		`"<h1>plain</h1>"`,
+		`"<p class=\"a\">café\n\t\\ \/ \b\f\r</p>"`,
+		`"😀 pair"`,
+		`"\ud83d lone high"`,
+		`"\ude00 lone low"`,
+		`"\ud83dA high before other"`,
+		"\"invalid \xff utf-8\"",
+		"\"raw é and \\\" escape\"",
+	} {
+		var want string
+		if err := json.Unmarshal([]byte(quoted), &want); err != nil {
+			t.Fatalf("json.Unmarshal(%s): %v", quoted, err)
+		}
+		var content documentContent
+		if err := json.Unmarshal([]byte(quoted), &content); err != nil || string(content) != want {
+			t.Errorf("Decoded %s to %q (%v), want %q", quoted, content, err, want)
+		}
+		encoded, err := json.Marshal(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var again string
+		if err := json.Unmarshal(encoded, &again); err != nil || again != want {
+			t.Errorf("Content %q encoded as %s", content, encoded)
+		}
+	}
+
+	var content documentContent
+	if err := json.Unmarshal([]byte(`null`), &content); err != nil || content != nil {
+		t.Errorf("Decoded null to %q, %v", content, err)
+	}
+	if err := json.Unmarshal([]byte(`["<h1/>"]`), &content); err == nil {
+		t.Error("Decoded a list as content")
+	}
+}
+
+func TestContentEncoding(t *testing.T) {
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte("<h1>Compressed</h1>"))
+	zw.Close()
+	document := fmt.Sprintf(`{"xpaths": ["//h1"], "urls": {
+		"gzip": {"content": %q, "content_encoding": "gzip+base64"},
+		"base64": {"content": "PGgxPkJhc2U2NDwvaDE+\n", "content_encoding": "base64"},
+		"broken": {"content": "not base64!", "content_encoding": "base64"},
+		"not gzip": {"content": "PGgxPg==", "content_encoding": "gzip+base64"}}}`, base64.StdEncoding.EncodeToString(gzipped.Bytes()))
+	input, err := parseInput([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output["//h1"]["gzip"] != "Compressed" || output["//h1"]["base64"] != "Base64" {
+		t.Errorf("Unexpected output %v", output["//h1"])
+	}
+	for _, pageURL := range []string{"broken", "not gzip"} {
+		if !input.status.skipped[pageURL] {
+			t.Errorf("URL %s with invalid content wasn't skipped", pageURL)
+		}
+	}
+	if codes := input.status.log; len(codes) != 2 || codes[0].Code != warnDecode {
+		t.Errorf("Unexpected warnings %+v", codes)
+	}
+
+	// -max-doc-size applies to the document decompressed
+	data, err := decodeContent([]byte(base64.StdEncoding.EncodeToString(gzipped.Bytes())), encodingGzipBase64, 10)
+	var large *tooLargeError
+	if !errors.As(err, &large) || data != nil {
+		t.Errorf("decodeContent past the limit returned %q, %v", data, err)
+	}
+
+	for _, urlData := range []string{`{"content": "x", "content_encoding": "zip"}`, `{"file": "a.gz", "content_encoding": "base64"}`} {
+		if _, err := parseInput([]byte(`{"xpaths": ["//h1"], "urls": {"a": ` + urlData + `}}`)); err == nil || !strings.Contains(err.Error(), "content_encoding") {
+			t.Errorf("Unexpected error %v for %s", err, urlData)
+		}
+	}
+}
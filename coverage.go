@@ -0,0 +1,39 @@
+package main
+
+import "sort"
+
+// --- Coverage Report ---
+
+// coverageKey is the output section summarizing, per expression, how many URLs it matched.
+const coverageKey = "$coverage"
+
+// coverageEntry is the coverage of one expression across all input URLs. A drop in
+// coverage between runs is usually the first sign that a site changed its layout.
+type coverageEntry struct {
+	Matched int      `json:"matched"` // URLs with a value
+	Total   int      `json:"total"`   // URLs in the input
+	Percent float64  `json:"percent"` // Matched as a percentage of Total, 0 when there are no URLs
+	Missing []string `json:"missing"` // URLs without a value, sorted
+}
+
+// coverageReport computes the coverage of every expression from the final output.
+func coverageReport(input *InputJson, output OutputJson) map[string]interface{} {
+	report := make(map[string]interface{})
+	for _, expr := range input.Xpaths {
+		key := expr.Key()
+		entry := coverageEntry{Total: len(input.Urls), Missing: []string{}}
+		for pageURL := range input.Urls {
+			if _, found := output[key][pageURL]; found {
+				entry.Matched++
+			} else {
+				entry.Missing = append(entry.Missing, pageURL)
+			}
+		}
+		sort.Strings(entry.Missing)
+		if entry.Total > 0 {
+			entry.Percent = 100 * float64(entry.Matched) / float64(entry.Total)
+		}
+		report[key] = entry
+	}
+	return report
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProcessInput_Coverage(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"coverage": true,
+		"xpaths": ["//h1", {"xpath": "//span[@class='price']", "name": "price"}, "[broken"],
+		"urls": {
+			"http://a.com": {"content": "<html><body><h1>A</h1><span class=\"price\">1</span></body></html>"},
+			"http://b.com": {"content": "<html><body><h1>B</h1></body></html>"},
+			"http://c.com": {"content": "<html><body><h2>redesigned</h2></body></html>"},
+			"http://d.com": {"content": "<html><body><h1>D</h1></body></html>"}
+		}
+	}`)
+
+	expectedCoverage := map[string]interface{}{
+		"//h1":    coverageEntry{Matched: 3, Total: 4, Percent: 75, Missing: []string{"http://c.com"}},
+		"price":   coverageEntry{Matched: 1, Total: 4, Percent: 25, Missing: []string{"http://b.com", "http://c.com", "http://d.com"}},
+		"[broken": coverageEntry{Matched: 0, Total: 4, Percent: 0, Missing: []string{"http://a.com", "http://b.com", "http://c.com", "http://d.com"}},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedCoverage, actualOutput[coverageKey]) {
+		t.Errorf("Unexpected coverage.\nExpected: %#v\nGot:      %#v", expectedCoverage, actualOutput[coverageKey])
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Date Transform ---
+
+// The date transform turns human-written dates into ISO-8601: "2024-03-03" for a calendar
+// date, RFC 3339 with offset for a time of day with a zone, or a local date-time like
+// "2024-03-03T10:30:00" for one without, since no zone can be assumed. It understands
+// standard machine formats (RFC 822/1123, RFC 3339, plain ISO), written-out dates in the
+// configured locales ("March 3, 2024", "3. März 2024", "3 de marzo de 2024"), numeric
+// dates, and relative dates ("2 days ago", "vor 2 Tagen", "yesterday"). Values that
+// don't parse are omitted.
+
+// defaultDateLocales is used when a date transform lists no locales.
+var defaultDateLocales = []string{"en"}
+
+// dateNow is the reference time for relative dates; tests replace it.
+var dateNow = time.Now
+
+// dateLocale holds the words a locale uses for dates. Relative patterns capture the
+// amount, or nothing for a fixed offset like "yesterday".
+type dateLocale struct {
+	months   map[string]time.Month // Full names and abbreviations, lower case
+	relative []relativeDate
+	// dayFirst makes ambiguous slashed dates like 3/4/2024 read as day/month
+	dayFirst bool
+}
+
+type relativeDate struct {
+	pattern *regexp.Regexp
+	unit    string // "day", "week", "month" or "year"
+	sign    int    // -1 for the past, 1 for the future
+	amount  int    // Fixed amount if the pattern captures none
+}
+
+var dateLocales = map[string]*dateLocale{
+	"en": {
+		months: monthNames(
+			"january jan", "february feb", "march mar", "april apr", "may", "june jun",
+			"july jul", "august aug", "september sep sept", "october oct", "november nov", "december dec"),
+		relative: []relativeDate{
+			{pattern: regexp.MustCompile(`^today$`), unit: "day"},
+			{pattern: regexp.MustCompile(`^yesterday$`), unit: "day", sign: -1, amount: 1},
+			{pattern: regexp.MustCompile(`^tomorrow$`), unit: "day", sign: 1, amount: 1},
+			{pattern: regexp.MustCompile(`^(\d+|an?) (day|week|month|year)s? ago$`), sign: -1},
+			{pattern: regexp.MustCompile(`^in (\d+|an?) (day|week|month|year)s?$`), sign: 1},
+		},
+	},
+	"de": {
+		months: monthNames(
+			"januar jan jänner", "februar feb", "märz mär mrz", "april apr", "mai", "juni jun",
+			"juli jul", "august aug", "september sep sept", "oktober okt", "november nov", "dezember dez"),
+		relative: []relativeDate{
+			{pattern: regexp.MustCompile(`^heute$`), unit: "day"},
+			{pattern: regexp.MustCompile(`^gestern$`), unit: "day", sign: -1, amount: 1},
+			{pattern: regexp.MustCompile(`^vorgestern$`), unit: "day", sign: -1, amount: 2},
+			{pattern: regexp.MustCompile(`^morgen$`), unit: "day", sign: 1, amount: 1},
+			{pattern: regexp.MustCompile(`^vor (\d+|einem|einer) (tag|woche|monat|jahr)(en|e|n)?$`), sign: -1},
+			{pattern: regexp.MustCompile(`^in (\d+|einem|einer) (tag|woche|monat|jahr)(en|e|n)?$`), sign: 1},
+		},
+		dayFirst: true,
+	},
+	"fr": {
+		months: monthNames(
+			"janvier janv", "février févr fevrier", "mars", "avril avr", "mai", "juin",
+			"juillet juil", "août aout", "septembre sept", "octobre oct", "novembre nov", "décembre déc decembre"),
+		relative: []relativeDate{
+			{pattern: regexp.MustCompile(`^aujourd'hui$`), unit: "day"},
+			{pattern: regexp.MustCompile(`^hier$`), unit: "day", sign: -1, amount: 1},
+			{pattern: regexp.MustCompile(`^demain$`), unit: "day", sign: 1, amount: 1},
+			{pattern: regexp.MustCompile(`^il y a (\d+|un|une) (jour|semaine|mois|an|année)s?$`), sign: -1},
+			{pattern: regexp.MustCompile(`^dans (\d+|un|une) (jour|semaine|mois|an|année)s?$`), sign: 1},
+		},
+		dayFirst: true,
+	},
+	"es": {
+		months: monthNames(
+			"enero ene", "febrero feb", "marzo mar", "abril abr", "mayo may", "junio jun",
+			"julio jul", "agosto ago", "septiembre sep sept setiembre", "octubre oct", "noviembre nov", "diciembre dic"),
+		relative: []relativeDate{
+			{pattern: regexp.MustCompile(`^hoy$`), unit: "day"},
+			{pattern: regexp.MustCompile(`^ayer$`), unit: "day", sign: -1, amount: 1},
+			{pattern: regexp.MustCompile(`^mañana$`), unit: "day", sign: 1, amount: 1},
+			{pattern: regexp.MustCompile(`^hace (\d+|un|una) (día|dia|semana|mes|año)(s|es)?$`), sign: -1},
+			{pattern: regexp.MustCompile(`^en (\d+|un|una) (día|dia|semana|mes|año)(s|es)?$`), sign: 1},
+		},
+		dayFirst: true,
+	},
+}
+
+// relativeUnits maps the localized unit words captured by relative patterns.
+var relativeUnits = map[string]string{
+	"day": "day", "week": "week", "month": "month", "year": "year",
+	"tag": "day", "woche": "week", "monat": "month", "jahr": "year",
+	"jour": "day", "semaine": "week", "mois": "month", "an": "year", "année": "year",
+	"día": "day", "dia": "day", "semana": "week", "mes": "month", "año": "year",
+}
+
+// monthNames builds a month table from space-separated spellings, one string per month.
+func monthNames(spellings ...string) map[string]time.Month {
+	months := make(map[string]time.Month)
+	for i, names := range spellings {
+		for _, name := range strings.Fields(names) {
+			months[name] = time.Month(i + 1)
+		}
+	}
+	return months
+}
+
+// zonedLayouts, localLayouts and dateLayouts are tried first, in order, on the trimmed
+// value.
+var (
+	zonedLayouts = []string{
+		time.RFC3339Nano, time.RFC1123Z, time.RFC1123, time.RFC822Z, time.RFC822, time.RFC850,
+		"Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700",
+	}
+	localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04"}
+	dateLayouts  = []string{"2006-01-02", "20060102"}
+)
+
+// zoneOffsets gives the offsets of the zone abbreviations dates are commonly written
+// with, in seconds east of UTC. Those of RFC 822 read as North American zones; ones as
+// ambiguous as IST are left out, so that their dates print without an offset.
+var zoneOffsets = map[string]int{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0,
+	"EST": -5 * 3600, "EDT": -4 * 3600, "CST": -6 * 3600, "CDT": -5 * 3600,
+	"MST": -7 * 3600, "MDT": -6 * 3600, "PST": -8 * 3600, "PDT": -7 * 3600,
+	"AKST": -9 * 3600, "AKDT": -8 * 3600, "HST": -10 * 3600,
+	"WET": 0, "WEST": 1 * 3600, "BST": 1 * 3600, "CET": 1 * 3600, "CEST": 2 * 3600,
+	"EET": 2 * 3600, "EEST": 3 * 3600, "MSK": 3 * 3600,
+	"JST": 9 * 3600, "KST": 9 * 3600, "AEST": 10 * 3600, "AEDT": 11 * 3600,
+	"NZST": 12 * 3600, "NZDT": 13 * 3600,
+}
+
+// localDateTime is the ISO-8601 layout of a date-time without offset.
+const localDateTime = "2006-01-02T15:04:05"
+
+var (
+	dateWord    = regexp.MustCompile(`[\p{L}]+\.?|\d+`)
+	numericDate = regexp.MustCompile(`^(\d{1,4})([./-])(\d{1,2})([./-])(\d{1,4})$`)
+)
+
+// newDateStep returns a transform step parsing dates in the given locales.
+func newDateStep(locales []string) (transformStep, error) {
+	if len(locales) == 0 {
+		locales = defaultDateLocales
+	}
+	var tables []*dateLocale
+	for _, name := range locales {
+		table, ok := dateLocales[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown locale %q", name)
+		}
+		tables = append(tables, table)
+	}
+	return func(s string) (interface{}, bool) {
+		return parseDate(s, tables)
+	}, nil
+}
+
+// parseDate formats s as ISO-8601 if any of the approaches above recognizes it.
+func parseDate(s string, locales []*dateLocale) (string, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range zonedLayouts {
+		// Parsing in UTC rather than the host's zone keeps abbreviations from matching it
+		t, err := time.ParseInLocation(layout, s, time.UTC)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(layout, "MST") {
+			name, _ := t.Zone()
+			offset, ok := zoneOffsets[name]
+			if !ok {
+				return t.Format(localDateTime), true // Go gives unknown abbreviations a zero offset
+			}
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.FixedZone(name, offset))
+		}
+		return t.Format(time.RFC3339), true
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(localDateTime), true
+		}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.DateOnly), true
+		}
+	}
+
+	lower := strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	for _, locale := range locales {
+		if t, ok := locale.parseRelative(lower); ok {
+			return t.Format(time.DateOnly), true
+		}
+	}
+	if m := numericDate.FindStringSubmatch(lower); m != nil && m[2] == m[4] {
+		return parseNumericDate(m[1], m[2], m[3], m[5], locales[0].dayFirst)
+	}
+	for _, locale := range locales {
+		if t, ok := locale.parseWritten(lower); ok {
+			return t.Format(time.DateOnly), true
+		}
+	}
+	return "", false
+}
+
+// parseRelative resolves phrases like "3 days ago" against now.
+func (l *dateLocale) parseRelative(s string) (time.Time, bool) {
+	for _, rel := range l.relative {
+		m := rel.pattern.FindStringSubmatch(s)
+		if m == nil {
+			continue
+		}
+		unit, amount := rel.unit, rel.amount
+		if len(m) > 2 {
+			unit = relativeUnits[m[2]]
+			amount = 1
+			if n, err := strconv.Atoi(m[1]); err == nil {
+				amount = n
+			}
+		}
+		amount *= rel.sign
+		t := dateNow().UTC()
+		switch unit {
+		case "day":
+			t = t.AddDate(0, 0, amount)
+		case "week":
+			t = t.AddDate(0, 0, 7*amount)
+		case "month":
+			t = t.AddDate(0, amount, 0)
+		case "year":
+			t = t.AddDate(amount, 0, 0)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// parseWritten finds a month name, a day and a four-digit year among the words of s, in
+// any order, ignoring other words such as weekdays or "de".
+func (l *dateLocale) parseWritten(s string) (time.Time, bool) {
+	var month time.Month
+	day, year := 0, 0
+	for _, word := range dateWord.FindAllString(s, -1) {
+		if n, err := strconv.Atoi(word); err == nil {
+			switch {
+			case len(word) == 4 && year == 0:
+				year = n
+			case len(word) <= 2 && n >= 1 && n <= 31 && day == 0:
+				day = n
+			case day != 0 && year != 0:
+				// Trailing numbers such as a time of day
+			default:
+				return time.Time{}, false
+			}
+			continue
+		}
+		if m, ok := l.months[strings.TrimSuffix(word, ".")]; ok {
+			if month != 0 {
+				return time.Time{}, false
+			}
+			month = m
+		}
+	}
+	if month == 0 || day == 0 || year == 0 {
+		return time.Time{}, false
+	}
+	return makeDate(year, month, day)
+}
+
+// parseNumericDate reads year-first dates (2024/03/04) and day/month orders; dots always
+// mean day first, other separators follow the first locale.
+func parseNumericDate(a, sep, b, c string, dayFirst bool) (string, bool) {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	z, _ := strconv.Atoi(c)
+	var year, month, day int
+	switch {
+	case len(a) == 4:
+		year, month, day = x, y, z
+	case len(c) == 4 && (dayFirst || sep == "."):
+		year, month, day = z, y, x
+	case len(c) == 4:
+		year, month, day = z, x, y
+	default:
+		return "", false
+	}
+	t, ok := makeDate(year, time.Month(month), day)
+	if !ok {
+		return "", false
+	}
+	return t.Format(time.DateOnly), true
+}
+
+// makeDate builds a date, rejecting out-of-range values rather than normalizing them.
+func makeDate(year int, month time.Month, day int) (time.Time, bool) {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if t.Year() != year || t.Month() != month || t.Day() != day {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDateTransform(t *testing.T) {
+	defer func(saved func() time.Time) { dateNow = saved }(dateNow)
+	dateNow = func() time.Time { return time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC) }
+
+	step, err := newDateStep([]string{"en", "de", "fr", "es"})
+	if err != nil {
+		t.Fatalf("newDateStep returned an unexpected error: %v", err)
+	}
+	cases := map[string]string{
+		"March 3, 2024":                   "2024-03-03",
+		"Sunday, March 3rd, 2024 10:30":   "2024-03-03",
+		"3 Mar 2024":                      "2024-03-03",
+		"3. März 2024":                    "2024-03-03",
+		"le 3 mars 2024":                  "2024-03-03",
+		"3 de marzo de 2024":              "2024-03-03",
+		"vor 2 Tagen":                     "2024-03-08",
+		"2 weeks ago":                     "2024-02-25",
+		"yesterday":                       "2024-03-09",
+		"il y a un mois":                  "2024-02-10",
+		"hace 1 año":                      "2023-03-10",
+		"Sun, 03 Mar 2024 10:30:00 +0100": "2024-03-03T10:30:00+01:00",
+		"2024-03-03T10:30:00Z":            "2024-03-03T10:30:00Z",
+		"2024-03-03T10:30:00":             "2024-03-03T10:30:00", // No zone, so no offset either
+		"2024-03-03 10:30:00":             "2024-03-03T10:30:00",
+		"2024-03-03T10:30":                "2024-03-03T10:30:00",
+		" 2024-03-03 ":                    "2024-03-03",
+		"03.03.2024":                      "2024-03-03",
+		"3/4/2024":                        "2024-03-04", // en is listed first, so month/day
+		"2024/03/04":                      "2024-03-04",
+		"February 30, 2024":               "",
+		"soon":                            "",
+		"3 and 4, 2024":                   "",
+	}
+	for in, expected := range cases {
+		value, ok := step(in)
+		if expected == "" {
+			if ok {
+				t.Errorf("date(%q) = %v, want no value", in, value)
+			}
+			continue
+		}
+		if !ok || value != expected {
+			t.Errorf("date(%q) = %v, %v; want %q", in, value, ok, expected)
+		}
+	}
+
+	deStep, _ := newDateStep([]string{"de"})
+	if value, _ := deStep("3/4/2024"); value != "2024-04-03" {
+		t.Errorf("date(%q) in de = %v, want 2024-04-03", "3/4/2024", value)
+	}
+	if _, err := newDateStep([]string{"xx"}); err == nil {
+		t.Errorf("Expected an error for an unknown locale, but got nil")
+	}
+}
+
+func TestDateTransform_ZoneAbbreviations(t *testing.T) {
+	defer func(saved *time.Location) { time.Local = saved }(time.Local)
+	step, _ := newDateStep(nil)
+	cases := map[string]string{
+		"Mon, 02 Jan 2006 15:04:05 PST": "2006-01-02T15:04:05-08:00",
+		"Mon, 02 Jan 2006 15:04:05 EST": "2006-01-02T15:04:05-05:00",
+		"Mon, 02 Jan 2006 15:04:05 CET": "2006-01-02T15:04:05+01:00",
+		"Mon, 02 Jan 2006 15:04:05 GMT": "2006-01-02T15:04:05Z",
+		"02 Jan 06 15:04 EDT":           "2006-01-02T15:04:00-04:00",
+		"Mon, 02 Jan 2006 15:04:05 XYZ": "2006-01-02T15:04:05", // Unknown, so no offset
+	}
+	// The host's zone must not matter, not even when its abbreviation is the one in the date
+	for _, local := range []*time.Location{time.FixedZone("PST", -8*3600), time.FixedZone("XYZ", 3*3600)} {
+		time.Local = local
+		for in, expected := range cases {
+			if value, ok := step(in); !ok || value != expected {
+				t.Errorf("date(%q) with local zone %s = %v, %v; want %q", in, local, value, ok, expected)
+			}
+		}
+	}
+}
+
+func TestProcessInput_DateTransform(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"xpaths": [
+			{"xpath": "//time", "name": "published", "transforms": [{"type": "date", "locales": ["de"]}]},
+			{"xpath": "//time", "name": "bad", "transforms": [{"type": "date", "locales": ["klingon"]}]}
+		],
+		"urls": {
+			"http://news.de": {"content": "<html><body><time>Veröffentlicht am 1. Februar 2024</time></body></html>"}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"published": {"http://news.de": "2024-02-01"},
+		"bad":       {},
+	}
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// --- Duplicate Content ---
+
+// duplicatesKey is the output section mapping each URL whose content was deduplicated to
+// the URL it shares the content with, see contentIndex.
+const duplicatesKey = "$duplicates"
+
+// contentIndex finds URLs with the same content when the "dedupe_content" option is set,
+// for mirrored pages: only the first such URL is parsed and evaluated, and its values are
+// given to the others once all URLs are done. When the values can depend on the URL as
+// well, because links are resolved, presets are applied or xi:includes expanded, only
+// content under the same URL counts as the same. Warnings stay with the URL that was
+// evaluated.
+type contentIndex struct {
+	byURL      bool              // The URL is part of what makes content the same
+	first      map[string]string // The URL evaluated, by content key
+	duplicates map[string]string // The URL evaluated, by URL sharing its content
+}
+
+// newContentIndex returns the index for input, or nil without "dedupe_content". byURL
+// tells whether values can depend on the URL.
+func newContentIndex(input *InputJson, byURL bool) *contentIndex {
+	if !input.DedupeContent {
+		return nil
+	}
+	return &contentIndex{byURL: byURL, first: make(map[string]string), duplicates: make(map[string]string)}
+}
+
+// key returns what content at pageURL is deduplicated by, or "" for a nil index.
+func (c *contentIndex) key(pageURL string, content []byte) string {
+	if c == nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	key := hex.EncodeToString(sum[:])
+	if c.byURL {
+		key += " " + pageURL
+	}
+	return key
+}
+
+// duplicate tells whether content with key has been evaluated already, recording pageURL
+// as sharing it if so.
+func (c *contentIndex) duplicate(key, pageURL string) bool {
+	if c == nil {
+		return false
+	}
+	first, ok := c.first[key]
+	if ok {
+		c.duplicates[pageURL] = first
+	}
+	return ok
+}
+
+// evaluated records that pageURL has been evaluated, standing for the content with key.
+func (c *contentIndex) evaluated(key, pageURL string) {
+	if c != nil {
+		c.first[key] = pageURL
+	}
+}
+
+// fanOut gives each duplicate URL the values of the URL it shares content with, in every
+// section but those about reading the URL itself, and lists the duplicates under
+// duplicatesKey.
+func (c *contentIndex) fanOut(output OutputJson) {
+	if c == nil {
+		return
+	}
+	section := make(map[string]interface{}, len(c.duplicates))
+	for pageURL, first := range c.duplicates {
+		for key, values := range output {
+			if key == metricsKey || key == responsesKey {
+				continue
+			}
+			if value, ok := values[first]; ok {
+				values[pageURL] = value
+			}
+		}
+		section[pageURL] = first
+	}
+	output[duplicatesKey] = section
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDedupeContent(t *testing.T) {
+	input, err := parseInput([]byte(`{"xpaths": ["//h1", {"xpath": "//h2", "rules": {"required": true}}], "dedupe_content": true, "metrics": true,
+		"urls": {"a": {"content": "<h1>A</h1>"}, "b": {"content": "<h1>A</h1>"}, "c": {"content": "<h1>C</h1>"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Either of a and b is evaluated, and the other shares its values
+	duplicates := output[duplicatesKey]
+	if len(duplicates) != 1 || duplicates["a"] == nil && duplicates["b"] == nil {
+		t.Fatalf("Unexpected duplicates %v", duplicates)
+	}
+	want := map[string]interface{}{"a": "A", "b": "A", "c": "C"}
+	if !reflect.DeepEqual(output["//h1"], want) {
+		t.Errorf("Unexpected values %v, want %v", output["//h1"], want)
+	}
+	if len(output[rulesKey]) != 3 || len(output[metricsKey]) != 3 {
+		t.Errorf("Unexpected rules %v and metrics %v", output[rulesKey], output[metricsKey])
+	}
+	if output[metricsKey]["a"] == output[metricsKey]["b"] {
+		t.Error("Duplicates share their metrics")
+	}
+}
+
+func TestDedupeContentByURL(t *testing.T) {
+	// Resolved links depend on the URL, so the same content at other URLs is evaluated again
+	input, err := parseInput([]byte(`{"xpaths": [{"xpath": "//a/@href", "resolve": true}], "dedupe_content": true,
+		"urls": {"http://a.com/": {"content": "<a href='x'/>"}, "http://b.com/": {"content": "<a href='x'/>"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output[duplicatesKey]) != 0 || output["//a/@href"]["http://b.com/"] != "http://b.com/x" {
+		t.Errorf("Unexpected output %v", output)
+	}
+
+	var none *contentIndex
+	if key := none.key("a", []byte("<h1/>")); key != "" || none.duplicate(key, "a") {
+		t.Error("A nil index deduplicated content")
+	}
+}
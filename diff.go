@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// --- diff Subcommand ---
+
+const diffUsage = `Usage: goatpaver diff [-json] OLD NEW
+
+Compares two goatpaver JSON outputs, with or without -envelope or -group-by url, and lists
+the values that were added (+), removed (-) or changed (~) per xpath and URL. Exits 1 if
+there are differences, like diff(1).
+`
+
+// Values for valueChange.Change.
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+// errDifferent reports that the compared outputs differ.
+var errDifferent = errors.New("outputs differ")
+
+// valueChange is one difference between two outputs.
+type valueChange struct {
+	XPath  string      `json:"xpath"` // Output key, which is the expression's name if it has one
+	URL    string      `json:"url"`
+	Change string      `json:"change"`
+	Old    interface{} `json:"old,omitempty"`
+	New    interface{} `json:"new,omitempty"`
+}
+
+// runDiff implements "goatpaver diff".
+func runDiff(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), diffUsage) }
+	asJSON := flags.Bool("json", false, "print the changes as a JSON array")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("diff needs two output files")
+	}
+	old, err := readOutput(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	next, err := readOutput(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	changes := diffOutputs(old, next)
+	if *asJSON {
+		data, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(data))
+	} else {
+		for _, c := range changes {
+			switch c.Change {
+			case changeAdded:
+				fmt.Fprintf(stdout, "+ %s %s: %s\n", c.XPath, c.URL, compactJSON(c.New))
+			case changeRemoved:
+				fmt.Fprintf(stdout, "- %s %s: %s\n", c.XPath, c.URL, compactJSON(c.Old))
+			default:
+				fmt.Fprintf(stdout, "~ %s %s: %s -> %s\n", c.XPath, c.URL, compactJSON(c.Old), compactJSON(c.New))
+			}
+		}
+	}
+	if len(changes) > 0 {
+		return errDifferent
+	}
+	return nil
+}
+
+// readOutput loads a goatpaver JSON output file, taking the results out of an -envelope.
+func readOutput(path string) (OutputJson, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var wrapped struct {
+		Run     *runInfo        `json:"run"`
+		Results json.RawMessage `json:"results"`
+	}
+	// An expression named "run" doesn't have a schema version
+	if json.Unmarshal(data, &wrapped) == nil && wrapped.Run != nil && wrapped.Run.SchemaVersion > 0 && wrapped.Results != nil {
+		data = wrapped.Results
+	}
+	var output OutputJson
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if groupedByURL(output) {
+		output = ungroupOutput(output)
+	}
+	return output, nil
+}
+
+// groupedByURL tells whether output was printed with -group-by url: its keys are URLs
+// and theirs are not. Outputs whose URLs are local paths look alike either way, and are
+// taken to be keyed by xpath.
+func groupedByURL(output OutputJson) bool {
+	inner := false
+	for key, results := range output {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		if !strings.Contains(key, "://") {
+			return false
+		}
+		for innerKey := range results {
+			if strings.Contains(innerKey, "://") {
+				return false
+			}
+			inner = true
+		}
+	}
+	return inner
+}
+
+// ungroupOutput turns output of -group-by url back around, as groupOutputByURL did it.
+func ungroupOutput(grouped OutputJson) OutputJson {
+	output := make(OutputJson)
+	for pageURL, results := range grouped {
+		if strings.HasPrefix(pageURL, "$") {
+			output[pageURL] = results
+			continue
+		}
+		for key, value := range results {
+			if output[key] == nil {
+				output[key] = make(map[string]interface{})
+			}
+			output[key][pageURL] = value
+		}
+	}
+	return output
+}
+
+// diffOutputs lists the differences from old to next, sorted by xpath and URL. Report
+// sections ("$" keys) are not compared. Values are compared in their JSON form, so a
+// freshly computed output can be compared with one read from a file.
+func diffOutputs(old, next OutputJson) []valueChange {
+	changes := []valueChange{}
+	keys := make(map[string]bool)
+	for key := range old {
+		keys[key] = true
+	}
+	for key := range next {
+		keys[key] = true
+	}
+	for key := range keys {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		urls := make(map[string]bool)
+		for pageURL := range old[key] {
+			urls[pageURL] = true
+		}
+		for pageURL := range next[key] {
+			urls[pageURL] = true
+		}
+		for pageURL := range urls {
+			before, hadBefore := old[key][pageURL]
+			after, hasAfter := next[key][pageURL]
+			switch {
+			case !hadBefore:
+				changes = append(changes, valueChange{XPath: key, URL: pageURL, Change: changeAdded, New: after})
+			case !hasAfter:
+				changes = append(changes, valueChange{XPath: key, URL: pageURL, Change: changeRemoved, Old: before})
+			case !reflect.DeepEqual(jsonForm(before), jsonForm(after)):
+				changes = append(changes, valueChange{XPath: key, URL: pageURL, Change: changeChanged, Old: before, New: after})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].XPath != changes[j].XPath {
+			return changes[i].XPath < changes[j].XPath
+		}
+		return changes[i].URL < changes[j].URL
+	})
+	return changes
+}
+
+// jsonForm returns v as encoding/json would decode its encoding.
+func jsonForm(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return v
+	}
+	return decoded
+}
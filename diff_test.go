@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffOutputs(t *testing.T) {
+	old := OutputJson{
+		"//title":     {"http://a.com": "A", "http://b.com": "B"},
+		"count(//li)": {"http://a.com": 2},
+		"$coverage":   {"//title": "ignored"},
+	}
+	next := OutputJson{
+		"//title":     {"http://a.com": "A2", "http://c.com": "C"},
+		"count(//li)": {"http://a.com": 2.0}, // As decoded from a file; still equal
+		"price":       {"http://a.com": money{Amount: 1, Currency: "EUR"}},
+	}
+
+	expected := []valueChange{
+		{XPath: "//title", URL: "http://a.com", Change: changeChanged, Old: "A", New: "A2"},
+		{XPath: "//title", URL: "http://b.com", Change: changeRemoved, Old: "B"},
+		{XPath: "//title", URL: "http://c.com", Change: changeAdded, New: "C"},
+		{XPath: "price", URL: "http://a.com", Change: changeAdded, New: money{Amount: 1, Currency: "EUR"}},
+	}
+	if actual := diffOutputs(old, next); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Unexpected changes.\nExpected: %+v\nGot:      %+v", expected, actual)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, output OutputJson) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		data, _ := json.Marshal(output)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	oldPath := write("old.json", OutputJson{"//h1": {"http://a.com": "Old", "http://b.com": "B"}})
+	newPath := write("new.json", OutputJson{"//h1": {"http://a.com": "New", "http://c.com": "C"}})
+
+	var out bytes.Buffer
+	if err := runDiff([]string{oldPath, newPath}, &out); !errors.Is(err, errDifferent) {
+		t.Fatalf("runDiff returned %v, want errDifferent", err)
+	}
+	expected := "~ //h1 http://a.com: \"Old\" -> \"New\"\n" +
+		"- //h1 http://b.com: \"B\"\n" +
+		"+ //h1 http://c.com: \"C\"\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected diff.\nExpected:\n%s\nGot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	if err := runDiff([]string{"-json", oldPath, oldPath}, &out); err != nil {
+		t.Fatalf("runDiff of identical outputs returned an unexpected error: %v", err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("Unexpected JSON diff of identical outputs: %q", out.String())
+	}
+}
+
+func TestRunDiff_Envelope(t *testing.T) {
+	input, err := parseInput([]byte(`{"xpaths": ["//h1"], "urls": {"http://a.com": {"content": "<h1>A</h1>"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	var paths []string
+	for _, runID := range []string{"r1", "r2"} {
+		opts := runOptions{encoding: formatJSON, envelope: true, runID: runID}
+		data, err := encodeOutput(formatJSON, false, opts.document(input, output, opts.format(input, output), time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, runID+".json")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	// Runs of the same input differ only in their envelopes
+	var out bytes.Buffer
+	if err := runDiff(paths, &out); err != nil || out.Len() != 0 {
+		t.Errorf("runDiff of two enveloped runs = %v with %q; want no differences", err, out.String())
+	}
+	previous, err := (&InputJson{}).previousOutput(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := changedOnly(input, previous, output); len(changes["//h1"]) != 0 {
+		t.Errorf("Unexpected changes since an enveloped run: %v", changes)
+	}
+}
+
+func TestReadOutput_GroupedByURL(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", "//h2"],
+		"urls": {"http://a.com": {"content": "<p><h1>A</h1><h2>B</h2></p>"}, "http://b.com": {"content": "<h1>C</h1>"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	write := func(name string, v interface{}) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		data, _ := json.Marshal(v)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	byXPath := write("xpath.json", output)
+	byURL := write("url.json", runOptions{groupBy: groupByURL}.format(input, output))
+
+	read, err := readOutput(byURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := OutputJson{"//h1": {"http://a.com": "A", "http://b.com": "C"}, "//h2": {"http://a.com": "B"}}
+	if !reflect.DeepEqual(expected, read) {
+		t.Errorf("Unexpected output read from -group-by url.\nExpected: %#v\nGot:      %#v", expected, read)
+	}
+	var out bytes.Buffer
+	if err := runDiff([]string{byXPath, byURL}, &out); err != nil || out.Len() != 0 {
+		t.Errorf("runDiff across groupings = %v with %q; want no differences", err, out.String())
+	}
+	previous, err := (&InputJson{}).previousOutput(byURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := changedOnly(input, previous, output); len(changes["//h1"])+len(changes["//h2"]) != 0 {
+		t.Errorf("Unexpected changes since a -group-by url run: %v", changes)
+	}
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Distributed Runs ---
+
+// With -workers, a plain run coordinates workers started with "goatpaver worker -listen"
+// instead of processing the URLs itself. The coordinator compiles the expressions, which
+// warns about them once, then splits the URLs into batches of -batch-size and POSTs each
+// batch to an idle worker as an input document of its own. Workers process a batch like a
+// plain run would and answer with its output and warnings, which the coordinator merges
+// and reports as its own, so everything after processing (rules, alerts, history, reports
+// and every output option) works as it does for a single host.
+//
+// A batch a worker fails to answer is handed to another, and the worker that failed is
+// dropped for the rest of the run; after batchAttempts tries its URLs are given up on.
+// Workers read the files and fetch the URLs of their batches themselves, so file paths must
+// mean the same on every worker: object URLs, or a shared file system.
+//
+// A batch is a whole input document, so a worker taking batches from anyone would read any
+// file and fetch any URL they named. Workers therefore only listen beyond the loopback
+// interface with $GOATPAVER_WORKER_TOKEN set. On loopback, batches must still come as
+// application/json and without an Origin header, which a web page open in a local browser
+// can't manage.
+//
+// Workers and coordinator talk HTTP only; there is no gRPC transport.
+
+// workerTokenEnv is the environment variable with the token workers require, if set, and
+// the coordinator sends as "Authorization: Bearer TOKEN".
+const workerTokenEnv = "GOATPAVER_WORKER_TOKEN"
+
+// batchPath is where workers take batches.
+const batchPath = "/batch"
+
+// batchAttempts is how many workers a batch is tried on before its URLs are given up.
+const batchAttempts = 3
+
+// Tests shorten batchTimeout and replace workerClient.
+var (
+	batchTimeout = 30 * time.Minute // For a worker to answer a batch
+	workerClient = &http.Client{}
+)
+
+// batchResult is a worker's answer to a batch.
+type batchResult struct {
+	Output   json.RawMessage `json:"output,omitempty"`
+	Warnings []batchWarning  `json:"warnings,omitempty"`
+	Bytes    int             `json:"bytes"` // Content read, over the batch's URLs
+	Error    string          `json:"error,omitempty"`
+
+	output OutputJson // Output as decoded by postBatch
+}
+
+// batchWarning is a warning a worker reported, with the URL runWarning leaves out of JSON.
+type batchWarning struct {
+	Code    string `json:"code"`
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+	Skipped bool   `json:"skipped,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// errBatchRejected is wrapped by postBatch when a worker answers that the batch itself is
+// wrong, which trying another worker won't fix.
+var errBatchRejected = errors.New("batch rejected")
+
+// parseWorkers parses a -workers value, a comma-separated list of worker URLs.
+func parseWorkers(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var workers []string
+	for _, worker := range strings.Split(value, ",") {
+		u, err := url.Parse(strings.TrimSpace(worker))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid -workers URL %q (want http://HOST:PORT)", worker)
+		}
+		workers = append(workers, strings.TrimSuffix(u.String(), "/"))
+	}
+	return workers, nil
+}
+
+// pendingBatch is a batch of URLs waiting for a worker.
+type pendingBatch struct {
+	urls     []string
+	attempts int
+}
+
+// answeredBatch is what came of sending a batch to a worker.
+type answeredBatch struct {
+	worker string
+	batch  *pendingBatch
+	result *batchResult
+	err    error
+}
+
+// distribute processes the URLs of input on workers, batchSize at a time, and returns the
+// merged output, as process would. Batches are sent and merged from this goroutine only,
+// so warnings and the output need no locking.
+func (input *InputJson) distribute(workers []string, batchSize int) (OutputJson, error) {
+	// Compile the expressions and set up the sections once, without the URLs
+	urls := input.Urls
+	input.Urls = nil
+	output, err := process(input)
+	var template map[string]json.RawMessage
+	if err == nil {
+		template, err = input.batchTemplate()
+	}
+	input.Urls = urls
+	if err != nil {
+		return nil, err
+	}
+
+	pageURLs := make([]string, 0, len(urls))
+	for pageURL := range urls {
+		pageURLs = append(pageURLs, pageURL)
+	}
+	sort.Strings(pageURLs) // So that batches are the same each run
+	var pending []*pendingBatch
+	for start := 0; start < len(pageURLs); start += batchSize {
+		pending = append(pending, &pendingBatch{urls: pageURLs[start:min(start+batchSize, len(pageURLs))]})
+	}
+
+	idle := append([]string(nil), workers...)
+	answers := make(chan answeredBatch, len(workers)) // So none are left blocked if distribute returns early
+	busy := 0
+	var rejected error
+	for {
+		for len(pending) > 0 && len(idle) > 0 && rejected == nil && input.status.abort == nil && !input.status.stopped {
+			batch, worker := pending[0], idle[0]
+			pending, idle = pending[1:], idle[1:]
+			body, err := input.batchDocument(template, batch.urls)
+			if err != nil {
+				return nil, err
+			}
+			busy++
+			go func() {
+				result, err := postBatch(worker, body, input.batchQuery())
+				answers <- answeredBatch{worker: worker, batch: batch, result: result, err: err}
+			}()
+		}
+		if busy == 0 {
+			break
+		}
+		answer := <-answers
+		busy--
+		batch := answer.batch
+		switch {
+		case errors.Is(answer.err, errBatchRejected):
+			idle = append(idle, answer.worker)
+			rejected = answer.err
+		case answer.err != nil:
+			batch.attempts++
+			logger.Warn(fmt.Sprintf("Worker %s failed: %v. Leaving it out of the rest of the run.", answer.worker, answer.err), "worker", answer.worker)
+			if batch.attempts < batchAttempts {
+				pending = append(pending, batch)
+				break
+			}
+			for _, pageURL := range batch.urls {
+				input.warnURL(warnWorker, pageURL, true, "No worker could process URL '%s' after %d attempts: %v. Skipping this URL.", pageURL, batch.attempts, answer.err)
+			}
+			input.progress.add(len(batch.urls))
+		default:
+			idle = append(idle, answer.worker)
+			input.merge(output, answer.result)
+			input.progress.add(len(batch.urls))
+		}
+	}
+
+	input.progress.clear()
+	if rejected != nil {
+		return nil, rejected
+	}
+	if input.status.abort != nil {
+		return nil, input.status.abort
+	}
+	left := 0
+	for _, batch := range pending {
+		left += len(batch.urls)
+	}
+	if left > 0 && !input.status.stopped {
+		return nil, fmt.Errorf("every worker failed; %d URLs were not processed", left)
+	}
+	if input.status.left = left; left > 0 {
+		input.warn(warnStopped, "", "Stopping after %d failed URLs (-max-errors). %d URLs were not processed.", len(input.status.skipped), left)
+	}
+	if input.Coverage {
+		output[coverageKey] = coverageReport(input, output)
+	}
+	return output, nil
+}
+
+// merge adds the answer to a batch to output, reporting its warnings as the run's.
+func (input *InputJson) merge(output OutputJson, result *batchResult) {
+	for key, values := range result.output {
+		if key == coverageKey {
+			continue // Of the batch; the run's is made once all are in
+		}
+		if output[key] == nil {
+			output[key] = make(map[string]interface{})
+		}
+		for pageURL, value := range values {
+			output[key][pageURL] = value
+		}
+	}
+	input.status.bytes += result.Bytes
+	for _, w := range result.Warnings {
+		// Warnings about the run as a whole were made when compiling, once
+		if w.URL != "" {
+			input.warnURL(w.Code, w.URL, w.Skipped, "%s", w.Message)
+		}
+	}
+}
+
+// batchTemplate marshals input, whose URLs have been set aside, into the fields of the
+// document batches are made from.
+func (input *InputJson) batchTemplate() (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("preparing batches: %w", err)
+	}
+	var template map[string]json.RawMessage
+	return template, json.Unmarshal(data, &template)
+}
+
+// batchDocument returns the input document of a batch of pageURLs, the fields of template
+// with their URLs, releasing their content as process does.
+func (input *InputJson) batchDocument(template map[string]json.RawMessage, pageURLs []string) ([]byte, error) {
+	urls := make(map[string]UrlData, len(pageURLs))
+	for _, pageURL := range pageURLs {
+		urls[pageURL] = input.Urls[pageURL]
+	}
+	data, err := json.Marshal(urls)
+	if err != nil {
+		return nil, fmt.Errorf("preparing batches: %w", err)
+	}
+	document := make(map[string]json.RawMessage, len(template)+1)
+	for key, value := range template {
+		document[key] = value
+	}
+	document["urls"] = data
+	if input.consume {
+		for _, pageURL := range pageURLs {
+			input.Urls[pageURL] = UrlData{File: input.Urls[pageURL].File}
+		}
+	}
+	return json.Marshal(document)
+}
+
+// batchQuery passes the flags that apply to each URL on to workers.
+func (input *InputJson) batchQuery() url.Values {
+	query := url.Values{}
+	if input.maxDocSize > 0 {
+		query.Set("max_doc_size", strconv.FormatInt(input.maxDocSize, 10))
+	}
+	if input.concurrency > 1 {
+		query.Set("xpath_concurrency", strconv.Itoa(input.concurrency))
+	}
+	return query
+}
+
+// postBatch sends a batch's input document to worker and returns its answer.
+func postBatch(worker string, body []byte, query url.Values) (*batchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+	defer cancel()
+	target := worker + batchPath
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv(workerTokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := workerClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result batchResult
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+	if decodeErr == nil && resp.StatusCode == http.StatusOK {
+		result.output, decodeErr = decodeBatchOutput(result.Output)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnprocessableEntity && decodeErr == nil:
+		return nil, fmt.Errorf("worker %s: %w: %s", worker, errBatchRejected, result.Error)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("POST %s: %s", target, resp.Status)
+	case decodeErr != nil:
+		return nil, fmt.Errorf("reading the answer of %s: %w", worker, decodeErr)
+	}
+	return &result, nil
+}
+
+// decodeBatchOutput decodes the output of a batch with the types process gives its values:
+// integers for whole numbers, as spilled values are, and rule failures as such so they are
+// printed the same.
+func decodeBatchOutput(data []byte) (OutputJson, error) {
+	var sections map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return nil, err
+	}
+	output := make(OutputJson, len(sections))
+	for key, values := range sections {
+		output[key] = make(map[string]interface{}, len(values))
+		for pageURL, data := range values {
+			var value interface{}
+			var err error
+			if key == rulesKey {
+				var failures []ruleFailure
+				err = json.Unmarshal(data, &failures)
+				value = failures
+			} else {
+				value, err = decodeSpilledValue(data)
+			}
+			if err != nil {
+				return nil, err
+			}
+			output[key][pageURL] = value
+		}
+	}
+	return output, nil
+}
+
+// isLoopback tells whether the listening address addr, such as ":8080" or
+// "localhost:8080", only takes connections from this host.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serveBatchesUntil serves batches on addr, concurrency at a time, until ctx is done, and
+// then waits for the batches at hand to be answered. Beyond the loopback interface, it
+// needs the token.
+func serveBatchesUntil(ctx context.Context, addr string, concurrency int) error {
+	token := os.Getenv(workerTokenEnv)
+	if token == "" && !isLoopback(addr) {
+		return fmt.Errorf("-listen %s takes batches from other hosts, which needs $%s set; or listen on localhost", addr, workerTokenEnv)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("-listen: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(batchPath, batchHandler(concurrency, token))
+	server := &http.Server{Handler: mux}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+	logger.Info(fmt.Sprintf("Taking batches on %s", listener.Addr()), "addr", listener.Addr().String())
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	return server.Shutdown(context.Background())
+}
+
+// batchHandler processes the batches POSTed to it, concurrency at a time. Requests from
+// browsers are refused, and with a token, requests without it.
+func batchHandler(concurrency int, token string) http.Handler {
+	slots := make(chan struct{}, concurrency)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "batches are POSTed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Origin") != "" {
+			http.Error(w, "batches aren't taken from web pages", http.StatusForbidden)
+			return
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			http.Error(w, "batches are application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		given, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "missing or wrong token", http.StatusUnauthorized)
+			return
+		}
+		slots <- struct{}{}
+		defer func() { <-slots }()
+
+		result, status := runBatch(r.Body, r.URL.Query())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to answer a batch: %v", err))
+		}
+	})
+}
+
+// runBatch processes the batch read from body with the flags in query, returning the
+// answer and its HTTP status.
+func runBatch(body io.Reader, query url.Values) (batchResult, int) {
+	data, err := readAll(body)
+	if err != nil {
+		return batchResult{Error: err.Error()}, http.StatusBadRequest
+	}
+	input, err := parseInput(data)
+	if err != nil {
+		return batchResult{Error: err.Error()}, http.StatusUnprocessableEntity
+	}
+	if value := query.Get("max_doc_size"); value != "" {
+		input.maxDocSize, _ = strconv.ParseInt(value, 10, 64)
+	}
+	if value := query.Get("xpath_concurrency"); value != "" {
+		input.concurrency, _ = strconv.Atoi(value)
+	}
+	input.consume = true
+	output, err := process(input)
+	if err != nil {
+		return batchResult{Error: err.Error()}, http.StatusUnprocessableEntity
+	}
+	data, err = json.Marshal(output)
+	if err != nil {
+		return batchResult{Error: err.Error()}, http.StatusInternalServerError
+	}
+	result := batchResult{Output: data, Bytes: input.status.bytes}
+	for _, w := range input.status.log {
+		result.Warnings = append(result.Warnings, batchWarning{Code: w.Code, Subject: w.Subject, Message: w.Message, Skipped: w.Skipped, URL: w.URL})
+	}
+	logger.Debug(fmt.Sprintf("Processed a batch of %d URLs", len(input.Urls)), "urls", len(input.Urls))
+	return result, http.StatusOK
+}
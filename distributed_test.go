@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const distributedInput = `{
+	"xpaths": [
+		"//h1",
+		"count(//li)",
+		{"xpath": "//li", "name": "items", "mode": "all", "normalize": {"collapse": true}},
+		{"xpath": "//span[@class='price']", "name": "price", "transforms": [{"type": "number"}], "rules": {"min": 10}},
+		"//bad["
+	],
+	"coverage": true,
+	"urls": {
+		"https://example.com/1": {"content": "<html><h1>One</h1><ul><li>a  b</li></ul><span class='price'>5</span></html>"},
+		"https://example.com/2": {"content": "<html><h1>Two</h1><ul><li>c</li><li>d</li></ul><span class='price'>12.5</span></html>"},
+		"https://example.com/3": {"content": "<html><h1>Three</h1></html>"},
+		"https://example.com/4": {"content": "<html><ul><li>e</li></ul></html>"},
+		"https://example.com/5": {"content": "<html><h1>Five</h1><span class='price'>20</span></html>"},
+		"https://example.com/broken": {"content": "<html><h1>Unclosed &bogus; <<"}
+	}
+}`
+
+// newBatchWorker starts a worker taking batches, as "goatpaver worker -listen" does.
+func newBatchWorker(t *testing.T, token string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle(batchPath, batchHandler(2, token))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDistribute(t *testing.T) {
+	local, err := parseInput([]byte(distributedInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := process(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input, err := parseInput([]byte(distributedInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.consume = true
+	workers := []string{newBatchWorker(t, "").URL, newBatchWorker(t, "").URL}
+	got, err := input.distribute(workers, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("Distributed output\n%s\ndiffers from the local\n%s", gotJSON, wantJSON)
+	}
+	// Counts stay integers, as for MessagePack and CBOR output
+	if count := got["count(//li)"]["https://example.com/2"]; count != int64(2) {
+		t.Errorf("Unexpected count %#v", count)
+	}
+	if len(input.status.skipped) != len(local.status.skipped) || input.status.warnings != 1 || input.status.bytes != local.status.bytes {
+		t.Errorf("Unexpected status %+v; want that of %+v", input.status, local.status)
+	}
+	if input.Urls["https://example.com/1"].Content != nil {
+		t.Error("Content was not released once sent")
+	}
+}
+
+func TestDistributeFailures(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of memory", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	input, err := parseInput([]byte(distributedInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The failing worker is dropped and its batch goes to the other
+	output, err := input.distribute([]string{failing.URL, newBatchWorker(t, "").URL}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output["//h1"]) != 4 {
+		t.Errorf("Unexpected output %v", output["//h1"])
+	}
+
+	input, _ = parseInput([]byte(distributedInput))
+	if _, err := input.distribute([]string{failing.URL}, 10); err == nil || !strings.Contains(err.Error(), "every worker failed; 6 URLs") {
+		t.Errorf("Unexpected error %v with every worker failing", err)
+	}
+
+	// A batch that fails on batchAttempts workers is given up on
+	input, _ = parseInput([]byte(distributedInput))
+	output, err = input.distribute([]string{failing.URL, failing.URL, failing.URL, newBatchWorker(t, "").URL}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(input.status.skipped) != 6 || input.status.log[len(input.status.log)-1].Code != warnWorker {
+		t.Errorf("Unexpected status %+v", input.status)
+	}
+
+	// A worker rejecting the batch fails the run
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"error": "unknown field \"new_option\""}`))
+	}))
+	defer rejecting.Close()
+	input, _ = parseInput([]byte(distributedInput))
+	if _, err := input.distribute([]string{rejecting.URL}, 10); err == nil || !strings.Contains(err.Error(), "new_option") {
+		t.Errorf("Unexpected error %v for a rejected batch", err)
+	}
+}
+
+func TestBatchToken(t *testing.T) {
+	worker := newBatchWorker(t, "secret")
+	input, _ := parseInput([]byte(distributedInput))
+	if _, err := input.distribute([]string{worker.URL}, 10); err == nil {
+		t.Error("A worker with a token took a batch without it")
+	}
+	t.Setenv(workerTokenEnv, "secret")
+	input, _ = parseInput([]byte(distributedInput))
+	if _, err := input.distribute([]string{worker.URL}, 10); err != nil {
+		t.Errorf("A batch with the token failed: %v", err)
+	}
+
+	resp, err := http.Get(worker.URL + batchPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET answered %s", resp.Status)
+	}
+}
+
+func TestBatchRefusals(t *testing.T) {
+	for addr, want := range map[string]bool{":8080": false, "0.0.0.0:8080": false, "localhost:8080": true, "127.0.0.1:0": true, "[::1]:0": true} {
+		if got := isLoopback(addr); got != want {
+			t.Errorf("isLoopback(%q) = %v", addr, got)
+		}
+	}
+	t.Setenv(workerTokenEnv, "")
+	if err := serveBatchesUntil(t.Context(), ":0", 1); err == nil || !strings.Contains(err.Error(), workerTokenEnv) {
+		t.Errorf("Unexpected error %v listening beyond loopback without a token", err)
+	}
+}
+
+func TestBatchFromBrowser(t *testing.T) {
+	worker := newBatchWorker(t, "")
+	post := func(contentType, origin string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, worker.URL+batchPath, strings.NewReader(distributedInput))
+		req.Header.Set("Content-Type", contentType)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// What a web page can send without a preflight, and what it sends with one
+	if status := post("text/plain", ""); status != http.StatusUnsupportedMediaType {
+		t.Errorf("A text/plain batch was answered with %d", status)
+	}
+	if status := post("application/json", "http://evil.example"); status != http.StatusForbidden {
+		t.Errorf("A batch with an Origin was answered with %d", status)
+	}
+	if status := post("application/json; charset=utf-8", ""); status != http.StatusOK {
+		t.Errorf("A batch from a coordinator was answered with %d", status)
+	}
+}
+
+func TestWorkersFlags(t *testing.T) {
+	opts, err := parseFlags([]string{"-workers", "http://a:8080/, https://b", "-batch-size", "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(opts.workers, " ") != "http://a:8080 https://b" || opts.batchSize != 10 {
+		t.Errorf("Unexpected workers %q and batch size %d", opts.workers, opts.batchSize)
+	}
+	for _, args := range [][]string{
+		{"-workers", "a:8080"},
+		{"-workers", "ftp://a"},
+		{"-workers", "http://a", "-checkpoint", "run.json"},
+		{"-workers", "http://a", "-max-memory", "1GB"},
+		{"-batch-size", "0"},
+	} {
+		if _, err := parseFlags(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+	for _, args := range [][]string{{"-queue", "sqs://q", "-listen", ":0"}, {"-listen", ":0", "-results", "sns://t"}} {
+		if err := runWorker(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("Expected an error for worker %q", args)
+		}
+	}
+}
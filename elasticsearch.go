@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// --- Elasticsearch/OpenSearch Sink ---
+
+// Bulk requests are retried this many times when the cluster pushes back with 429,
+// waiting esBackoff, then twice as long, and so on.
+const esRetries = 5
+
+var esBackoff = time.Second
+
+// esBatchSize is the number of documents per bulk request.
+const esBatchSize = 500
+
+// esSink bulk-indexes one document per URL holding all of its values:
+// elasticsearch://host:9200/INDEX (or opensearch://), with ?tls=true for HTTPS and any
+// user:password in the URL for basic auth. INDEX is a text/template with .Date (the run's
+// day, 2006-01-02), .RunID and .Host (the page's host), e.g. goatpaver-{{.Date}}. A page's
+// document ID is derived from its URL, so a later run in the same index replaces it.
+type esSink struct {
+	endpoint string // The _bulk URL
+	user     *url.Userinfo
+	index    *template.Template
+	client   *http.Client
+}
+
+// esIndexData is what the index name template sees.
+type esIndexData struct {
+	Date  string
+	RunID string
+	Host  string
+}
+
+func openESSink(target *url.URL) (sink, error) {
+	name := strings.TrimPrefix(target.Path, "/")
+	if target.Host == "" || name == "" {
+		return nil, fmt.Errorf("%s output needs a host and an index, e.g. %s://localhost:9200/goatpaver", target.Scheme, target.Scheme)
+	}
+	index, err := template.New("index").Option("missingkey=error").Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("parsing index name: %w", err)
+	}
+	scheme := "http"
+	if target.Query().Get("tls") == "true" {
+		scheme = "https"
+	}
+	return &esSink{
+		endpoint: scheme + "://" + target.Host + "/_bulk",
+		user:     target.User,
+		index:    index,
+		client:   &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+func (s *esSink) write(run sinkRun) error {
+	var lines [][]byte // Action and source line pairs, one per document
+	for _, doc := range run.documents() {
+		data := esIndexData{Date: run.Time.UTC().Format("2006-01-02"), RunID: run.ID}
+		if u, err := url.Parse(doc.URL); err == nil {
+			data.Host = u.Host
+		}
+		var index strings.Builder
+		if err := s.index.Execute(&index, data); err != nil {
+			return err
+		}
+		id := sha256.Sum256([]byte(doc.URL))
+		action, err := json.Marshal(map[string]interface{}{
+			"index": map[string]string{"_index": index.String(), "_id": hex.EncodeToString(id[:16])},
+		})
+		if err != nil {
+			return err
+		}
+		source, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, append(append(append(action, '\n'), source...), '\n'))
+	}
+	for start := 0; start < len(lines); start += esBatchSize {
+		if err := s.bulk(lines[start:min(start+esBatchSize, len(lines))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bulk sends one bulk request, resending the documents rejected with 429.
+func (s *esSink) bulk(pending [][]byte) error {
+	wait := esBackoff
+	for attempt := 0; ; attempt++ {
+		rejected, err := s.send(pending)
+		if err != nil {
+			return err
+		}
+		if len(rejected) == 0 {
+			return nil
+		}
+		if attempt == esRetries {
+			return fmt.Errorf("%d documents still rejected with 429 after %d retries", len(rejected), esRetries)
+		}
+		time.Sleep(wait)
+		wait *= 2
+		pending = rejected
+	}
+}
+
+// send posts documents and returns those to retry: all of them if the whole request got
+// 429, otherwise those whose item got 429. Other failures are errors.
+func (s *esSink) send(documents [][]byte) ([][]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(bytes.Join(documents, nil)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.user != nil {
+		password, _ := s.user.Password()
+		req.SetBasicAuth(s.user.Username(), password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return documents, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("bulk request returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("reading bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	var rejected [][]byte
+	for i, item := range result.Items {
+		for _, outcome := range item {
+			switch {
+			case outcome.Status == http.StatusTooManyRequests && i < len(documents):
+				rejected = append(rejected, documents[i])
+			case outcome.Status > 299:
+				return nil, fmt.Errorf("indexing document %d: %s", i, outcome.Error)
+			}
+		}
+	}
+	return rejected, nil
+}
+
+func (s *esSink) Close() error {
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestESSink(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", {"xpath": "//span", "name": "price"}],
+		"urls": {
+			"http://a.com/x": {"content": "<p><h1>A</h1><span>12</span></p>"},
+			"http://b.com/y": {"content": "<p><h1>B</h1></p>"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(backoff time.Duration) { esBackoff = backoff }(esBackoff)
+	esBackoff = time.Millisecond
+	requests := 0
+	indexed := map[string]urlDocument{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if user, password, _ := r.BasicAuth(); r.URL.Path != "/_bulk" || user != "elastic" || password != "secret" {
+			t.Errorf("Unexpected request %s by %s:%s", r.URL.Path, user, password)
+		}
+		if requests == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		var items []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			scanner.Scan() // Skip the action line
+			var doc urlDocument
+			json.Unmarshal(scanner.Bytes(), &doc)
+			// The second request has the first document rejected, the third succeeds
+			if requests == 2 && len(items) == 0 {
+				items = append(items, `{"index": {"status": 429, "error": {"type": "es_rejected_execution_exception"}}}`)
+				continue
+			}
+			indexed[doc.URL] = doc
+			items = append(items, `{"index": {"status": 201}}`)
+		}
+		fmt.Fprintf(w, `{"errors": %v, "items": [%s]}`, requests == 2, strings.Join(items, ","))
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	opts, err := parseFlags([]string{"-output", "elasticsearch://elastic:secret@" + host + "/goatpaver-{{.Date}}", "-run-id", "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := opts.writeSink(input, output, at); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Errorf("Got %d requests, want 3", requests)
+	}
+	expected := map[string]urlDocument{
+		"http://a.com/x": {URL: "http://a.com/x", RunID: "r1", Timestamp: at, Fields: map[string]interface{}{"//h1": "A", "price": "12"}},
+		"http://b.com/y": {URL: "http://b.com/y", RunID: "r1", Timestamp: at, Fields: map[string]interface{}{"//h1": "B"}},
+	}
+	if a, b := jsonEncoding(t, expected), jsonEncoding(t, indexed); a != b {
+		t.Errorf("Unexpected documents.\nExpected: %s\nGot:      %s", a, b)
+	}
+}
+
+func TestESSinkIndexName(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		fmt.Fprint(w, `{"errors": true, "items": [{"index": {"status": 400, "error": {"type": "mapper_parsing_exception"}}}]}`)
+	}))
+	defer server.Close()
+
+	target, err := parseSinkTarget("opensearch://" + strings.TrimPrefix(server.URL, "http://") + "/pages-{{.Host}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := openESSink(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.write(sinkRun{ID: "r1", Records: []record{{URL: "http://shop.com/a", XPath: "//h1", Value: "A", Matched: true}}})
+	if err == nil || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Errorf("Expected the item error to be reported, got %v", err)
+	}
+	if !bytes.Contains(body, []byte(`"_index":"pages-shop.com"`)) {
+		t.Errorf("Unexpected bulk body %s", body)
+	}
+
+	for _, bad := range []string{"elasticsearch://localhost:9200", "elasticsearch:///index", "elasticsearch://localhost/{{.Nope"} {
+		u, _ := parseSinkTarget(bad)
+		if _, err := openESSink(u); err == nil {
+			t.Errorf("Expected an error for %s", bad)
+		}
+	}
+}
+
+func jsonEncoding(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// --- Embedded Markup ---
+
+// EmbeddedOptions makes markup that a page hides from the parser addressable by xpaths.
+// Comments are always available through //comment(); these options additionally parse
+// their content, so <!-- <div id="data">...</div> --> can be reached as //div[@id='data'].
+type EmbeddedOptions struct {
+	// Comments inserts the elements parsed from a comment right after the comment node,
+	// which is kept. Comments that aren't well-formed markup are left alone.
+	Comments bool `json:"comments,omitempty"`
+	// CDATA replaces text that is well-formed markup with the parsed elements. The XML
+	// decoder reports CDATA sections as plain text, so entity-escaped markup such as
+	// &lt;p&gt;...&lt;/p&gt; in feed descriptions is expanded as well.
+	CDATA bool `json:"cdata,omitempty"`
+}
+
+// fragmentRoot wraps embedded content so that a fragment with several top-level
+// elements or surrounding text still parses as a document.
+const fragmentRoot = "goatpaver-fragment"
+
+// newEmbeddedDecoder wraps decoder so that embedded markup is expanded per input.Embedded.
+func newEmbeddedDecoder(decoder *xml.Decoder, input *InputJson) *xml.Decoder {
+	wrapped := xml.NewTokenDecoder(&embeddedReader{
+		decoder:  decoder,
+		options:  *input.Embedded,
+		entities: input.Entities,
+	})
+	wrapped.Strict = decoder.Strict
+	return wrapped
+}
+
+// embeddedReader is an xml.TokenReader that splices parsed fragments into the token stream.
+type embeddedReader struct {
+	decoder  *xml.Decoder
+	options  EmbeddedOptions
+	entities string
+	pending  []xml.Token
+}
+
+func (e *embeddedReader) Token() (xml.Token, error) {
+	if len(e.pending) > 0 {
+		t := e.pending[0]
+		e.pending = e.pending[1:]
+		return t, nil
+	}
+	t, err := e.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := t.(type) {
+	case xml.Comment:
+		if e.options.Comments {
+			if fragment, ok := parseFragment(string(tok), e.entities); ok {
+				e.pending = fragment
+			}
+		}
+	case xml.CharData:
+		if e.options.CDATA && strings.ContainsRune(string(tok), '<') {
+			if fragment, ok := parseFragment(string(tok), e.entities); ok {
+				if len(fragment) == 0 {
+					return tok, nil
+				}
+				e.pending = fragment[1:]
+				return fragment[0], nil
+			}
+		}
+	}
+	return t, nil
+}
+
+// parseFragment parses content as a markup fragment and returns its tokens. It reports
+// false if the content contains no elements or is not well-formed, so that ordinary
+// prose which merely contains "<" is never mangled.
+func parseFragment(content string, entities string) ([]xml.Token, bool) {
+	decoder := newDecoder(strings.NewReader("<"+fragmentRoot+">"+content+"</"+fragmentRoot+">"), entities)
+	var tokens []xml.Token
+	hasElement := false
+	for {
+		t, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			if se.Name.Local == fragmentRoot {
+				continue
+			}
+			hasElement = true
+		}
+		if ee, ok := t.(xml.EndElement); ok && ee.Name.Local == fragmentRoot {
+			continue
+		}
+		tokens = append(tokens, xml.CopyToken(t))
+	}
+	if !hasElement {
+		return nil, false
+	}
+	return tokens, true
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProcessInput_Embedded(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"embedded": {"comments": true, "cdata": true},
+		"xpaths": [
+			"//comment()",
+			"//div[@id='data']/@data-price",
+			"//item/description/p",
+			"//item/title",
+			"count(//b)"
+		],
+		"urls": {
+			"http://shop.com": {
+				"content": "<html><body><!-- <div id=\"data\" data-price=\"9.99\"/> --><!-- not markup --></body></html>"
+			},
+			"http://feed.com": {
+				"content": "<rss><item><title>a &lt; b</title><description><![CDATA[<p>Hello <b>there</b></p>]]></description></item><item><title>Escaped &lt;b&gt;bold&lt;/b&gt;</title></item></rss>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"//comment()":                   {"http://shop.com": ` <div id="data" data-price="9.99"/> `},
+		"//div[@id='data']/@data-price": {"http://shop.com": "9.99"},
+		"//item/description/p":          {"http://feed.com": "Hello there"},
+		"//item/title":                  {"http://feed.com": "a < b"},
+		"count(//b)":                    {"http://shop.com": 0, "http://feed.com": 2},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// --- Incremental Encoding ---
+
+// Output is written as it is encoded rather than encoded whole first, which for a run
+// over a million URLs took as much memory again as the output itself. JSON is written a
+// value at a time, indented alike; MessagePack is written as its encoder goes. CBOR and
+// protobuf output are still encoded whole before they are written. An output that can't
+// be encoded fails the run partway through writing it.
+
+// writeOutput writes v to w encoded as encoding, as encodeOutput returns it.
+func writeOutput(w io.Writer, encoding string, indent bool, v interface{}) error {
+	switch encoding {
+	case formatMsgpack:
+		enc := msgpack.NewEncoder(w)
+		enc.SetCustomStructTag("json")
+		enc.SetSortMapKeys(true)
+		return enc.Encode(v)
+	case formatCBOR, formatProtobuf:
+		var data []byte
+		var err error
+		if encoding == formatCBOR {
+			data, err = cborMode.Marshal(v)
+		} else {
+			data, err = encodeProto(v)
+		}
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		return err
+	}
+	jw := &jsonWriter{w: bufio.NewWriter(w), indent: indent}
+	jw.value(v, "")
+	jw.w.WriteByte('\n')
+	if jw.err != nil {
+		return jw.err
+	}
+	return jw.w.Flush()
+}
+
+// jsonWriter writes a document as json.Marshal, or with indent json.MarshalIndent with
+// two spaces, would encode it. The first two levels of the output, where the keys and
+// URLs are, and the records of flat output are written one entry at a time.
+type jsonWriter struct {
+	w      *bufio.Writer
+	indent bool
+	err    error // The first error, after which nothing is written
+}
+
+// value writes v at the depth where lines are indented by prefix.
+func (jw *jsonWriter) value(v interface{}, prefix string) {
+	switch v := v.(type) {
+	case orderedDocument:
+		jw.value(v.tree(), prefix)
+	case OutputJson:
+		jw.value(orderedDocument{value: v}.tree(), prefix)
+	case map[string]interface{}:
+		jw.value(orderedDocument{value: v}.tree(), prefix)
+	case orderedMap:
+		jw.object(len(v.keys), prefix, func(i int) (string, interface{}) { return v.keys[i], v.values[v.keys[i]] })
+	case envelope:
+		jw.object(2, prefix, func(i int) (string, interface{}) {
+			if i == 0 {
+				return "run", v.Run
+			}
+			return "results", v.Results
+		})
+	case []record:
+		jw.list(len(v), prefix, func(i int) interface{} { return v[i] })
+	default:
+		var data []byte
+		if data, jw.err = json.Marshal(v); jw.err == nil && jw.indent {
+			var buf bytes.Buffer
+			jw.err = json.Indent(&buf, data, prefix, "  ")
+			data = buf.Bytes()
+		}
+		jw.write(data)
+	}
+}
+
+// object writes an object of n entries, as entry returns them.
+func (jw *jsonWriter) object(n int, prefix string, entry func(i int) (string, interface{})) {
+	jw.write([]byte{'{'})
+	for i := 0; i < n && jw.err == nil; i++ {
+		key, value := entry(i)
+		jw.separate(i, prefix)
+		jw.value(key, "")
+		if jw.indent {
+			jw.write([]byte(": "))
+		} else {
+			jw.write([]byte{':'})
+		}
+		jw.value(value, prefix+"  ")
+	}
+	jw.end(n, prefix, '}')
+}
+
+// list writes a list of n elements, as element returns them.
+func (jw *jsonWriter) list(n int, prefix string, element func(i int) interface{}) {
+	jw.write([]byte{'['})
+	for i := 0; i < n && jw.err == nil; i++ {
+		jw.separate(i, prefix)
+		jw.value(element(i), prefix+"  ")
+	}
+	jw.end(n, prefix, ']')
+}
+
+// separate starts the ith entry of an object or list.
+func (jw *jsonWriter) separate(i int, prefix string) {
+	if i > 0 {
+		jw.write([]byte{','})
+	}
+	if jw.indent {
+		jw.write([]byte("\n" + prefix + "  "))
+	}
+}
+
+// end closes an object or list of n entries with delim.
+func (jw *jsonWriter) end(n int, prefix string, delim byte) {
+	if n > 0 && jw.indent {
+		jw.write([]byte("\n" + prefix))
+	}
+	jw.write([]byte{delim})
+}
+
+func (jw *jsonWriter) write(data []byte) {
+	if jw.err == nil {
+		_, jw.err = jw.w.Write(data)
+	}
+}
+
+// printTo writes to stdout through write, compressed with -compress, and returns the
+// checksum of what it wrote.
+func (opts runOptions) printTo(write func(w io.Writer) error) (checksum, error) {
+	printed := &checksumWriter{w: os.Stdout, runningChecksum: newRunningChecksum()}
+	out := bufio.NewWriterSize(printed, 64<<10)
+	var w io.Writer = out
+	var zw *gzip.Writer
+	if opts.compress == compressGzip {
+		zw = gzip.NewWriter(out)
+		w = zw
+	}
+	err := write(w)
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	return printed.sum(), err
+}
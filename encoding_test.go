@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWriteOutputJSON(t *testing.T) {
+	input, err := parseInput([]byte(`{"xpaths": ["//h1", "//a"], "urls": {"http://a.com/?x=<&>": {}, "b": {}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := OutputJson{
+		"//h1":     {"b": "B <i>", "http://a.com/?x=<&>": []interface{}{"x", map[string]interface{}{"z": 1, "a": nil}}},
+		"//a":      {},
+		rulesKey:   {"b": []ruleFailure{{Expression: "//h1", Rule: "required", Message: "no value"}}},
+		metricsKey: {"b": &urlMetrics{Bytes: 3}},
+	}
+	finished := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	docs := map[string]interface{}{
+		"nested":   input.ordered(output),
+		"by URL":   input.ordered(groupOutputByURL(input, output)),
+		"flat":     input.ordered(flatRecords(input, output, false)),
+		"envelope": runOptions{envelope: true}.document(input, output, output, finished),
+		"raw":      output,
+		"empty":    OutputJson{},
+	}
+	for name, doc := range docs {
+		for _, indent := range []bool{false, true} {
+			var want []byte
+			if indent {
+				want, err = json.MarshalIndent(doc, "", "  ")
+			} else {
+				want, err = json.Marshal(doc)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			if err := writeOutput(&got, formatJSON, indent, doc); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != string(want)+"\n" {
+				t.Errorf("%s (indent %v) written as\n%s\nwant\n%s", name, indent, got.String(), want)
+			}
+		}
+	}
+
+	var got bytes.Buffer
+	var unsupported *json.UnsupportedValueError
+	if err := writeOutput(&got, formatJSON, false, OutputJson{"//h1": {"a": math.Inf(1)}}); !errors.As(err, &unsupported) {
+		t.Errorf("Encoded an infinite value: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// --- Environment ---
+
+// envPrefix starts the environment variables that set flags: GOATPAVER_OUTPUT_FORMAT sets
+// -output-format, and so on.
+const envPrefix = "GOATPAVER_"
+
+// flagEnv returns the environment variable that sets the flag called name.
+func flagEnv(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// setFlagsFromEnv sets the flags of flags that have an environment variable, so that
+// they can be configured in containers; flags given on the command line, parsed after,
+// take precedence.
+func setFlagsFromEnv(flags *flag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(flagEnv(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %w", flagEnv(f.Name), setErr)
+		}
+	})
+	return err
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlagsFromEnv(t *testing.T) {
+	t.Setenv("GOATPAVER_OUTPUT_FORMAT", "cbor")
+	t.Setenv("GOATPAVER_STRICT", "true")
+	t.Setenv("GOATPAVER_GROUP_BY", "url")
+	opts, err := parseFlags([]string{"-group-by", "xpath"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.encoding != formatCBOR || !opts.strict || opts.groupBy != groupByXPath {
+		t.Errorf("Unexpected options %+v; want the environment, overridden by the command line", opts)
+	}
+	if opts.params["output-format"] != "cbor" {
+		t.Errorf("Unexpected parameters %v; want flags from the environment recorded", opts.params)
+	}
+
+	t.Setenv("GOATPAVER_STRICT", "sometimes")
+	if _, err := parseFlags(nil); err == nil || !strings.HasPrefix(err.Error(), "GOATPAVER_STRICT: ") {
+		t.Errorf("parseFlags() = %v; want an error naming the variable", err)
+	}
+}
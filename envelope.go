@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// --- Output Envelope ---
+
+// outputSchemaVersion is the version of the output's layout, given in the envelope. It goes
+// up whenever consumers of earlier output would misread the new one, e.g. when a value
+// changes type or a key moves.
+const outputSchemaVersion = 1
+
+// envelope wraps what a run prints with -envelope, so consumers can tell which goatpaver
+// and output layout produced it and whether the run got through all its URLs.
+type envelope struct {
+	Run     runInfo         `json:"run"`
+	Results orderedDocument `json:"results"` // The output as printed without -envelope
+}
+
+// runInfo describes a run in its envelope. Times are RFC 3339 in UTC, alike in every
+// output format.
+type runInfo struct {
+	Version       string    `json:"version"` // As in the manifest, see toolVersion
+	SchemaVersion int       `json:"schema_version"`
+	RunID         string    `json:"run_id"`
+	StartedAt     string    `json:"started_at"`
+	FinishedAt    string    `json:"finished_at"`
+	Complete      bool      `json:"complete"`    // False if the run exits with exitPartial or exitFailed
+	ExitStatus    int       `json:"exit_status"` // What goatpaver exits with, see status.go
+	Counts        runCounts `json:"counts"`
+}
+
+type runCounts struct {
+	URLs        int `json:"urls"`
+	FailedURLs  int `json:"failed_urls"` // URLs that could not be read or parsed
+	WarnedURLs  int `json:"warned_urls"` // Other URLs with warnings
+	Expressions int `json:"expressions"` // Output keys: expressions and presets
+	Values      int `json:"values"`      // Values in the output, not counting report sections
+	Warnings    int `json:"warnings"`    // Warnings about the run as a whole
+}
+
+// document returns v, output as printed in the run finished at finished, ready to be
+// encoded: in output order, and in its envelope with -envelope.
+func (opts runOptions) document(input *InputJson, output OutputJson, v interface{}, finished time.Time) interface{} {
+	doc := input.ordered(v)
+	if !opts.envelope {
+		return doc
+	}
+	status := input.status
+	code := input.exitCode(output, opts.strict)
+	info := runInfo{
+		Version:       toolVersion(),
+		SchemaVersion: outputSchemaVersion,
+		RunID:         opts.runID,
+		StartedAt:     status.started.UTC().Format(time.RFC3339Nano),
+		FinishedAt:    finished.UTC().Format(time.RFC3339Nano),
+		Complete:      code != exitPartial && code != exitFailed,
+		ExitStatus:    code,
+		Counts: runCounts{
+			URLs:       len(input.Urls),
+			FailedURLs: len(status.skipped),
+			Warnings:   status.warnings,
+		},
+	}
+	for pageURL := range status.warned {
+		if !status.skipped[pageURL] {
+			info.Counts.WarnedURLs++
+		}
+	}
+	for key, results := range output {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		info.Counts.Expressions++
+		for _, value := range results {
+			if value != nil {
+				info.Counts.Values++
+			}
+		}
+	}
+	return envelope{Run: info, Results: doc}
+}
+
+// encodeProtoEnvelope encodes e as goatpaver.v1.Envelope.
+func encodeProtoEnvelope(e envelope) ([]byte, error) {
+	var run, counts []byte
+	for i, n := range []int{e.Run.Counts.URLs, e.Run.Counts.FailedURLs, e.Run.Counts.WarnedURLs, e.Run.Counts.Expressions, e.Run.Counts.Values, e.Run.Counts.Warnings} {
+		counts = appendProtoVarint(counts, protowire.Number(i+1), uint64(n))
+	}
+	run = appendProtoString(run, 1, e.Run.Version)
+	run = appendProtoVarint(run, 2, uint64(e.Run.SchemaVersion))
+	run = appendProtoString(run, 3, e.Run.RunID)
+	run = appendProtoString(run, 4, e.Run.StartedAt)
+	run = appendProtoString(run, 5, e.Run.FinishedAt)
+	run = appendProtoVarint(run, 6, protowire.EncodeBool(e.Run.Complete))
+	run = appendProtoVarint(run, 7, uint64(e.Run.ExitStatus))
+	run = protowire.AppendTag(run, 8, protowire.BytesType)
+	run = protowire.AppendBytes(run, counts)
+
+	results, err := encodeProto(e.Results)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, run)
+	switch v := e.Results.value.(type) {
+	case OutputJson:
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+	case []record:
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+	default:
+		return nil, fmt.Errorf("no protobuf envelope field for %T", v)
+	}
+	return protowire.AppendBytes(b, results), nil
+}
+
+// appendProtoString appends the string field num to b unless s is "", the proto3 default.
+func appendProtoString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendProtoVarint appends the varint field num to b unless v is 0, the proto3 default.
+func appendProtoVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
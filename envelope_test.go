@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEnvelope(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", "//h2"],
+		"urls": {"http://a.com": {"content": "<h1>A</h1>"}, "http://b.com": {"content": "<h1>"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := input.status.started.Add(time.Second)
+	opts := runOptions{encoding: formatJSON, envelope: true, runID: "r1"}
+
+	data, err := encodeOutput(formatJSON, false, opts.document(input, output, opts.format(input, output), finished))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Run     runInfo    `json:"run"`
+		Results OutputJson `json:"results"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := runCounts{URLs: 2, FailedURLs: 1, Expressions: 2, Values: 1}
+	if got.Run.SchemaVersion != outputSchemaVersion || got.Run.Version == "" || got.Run.RunID != "r1" || got.Run.Counts != expected {
+		t.Errorf("Unexpected run %+v", got.Run)
+	}
+	if got.Run.Complete || got.Run.ExitStatus != exitPartial || got.Run.FinishedAt != finished.UTC().Format(time.RFC3339Nano) {
+		t.Errorf("Unexpected run %+v; want an incomplete run finished at %s", got.Run, finished)
+	}
+	if got.Results["//h1"]["http://a.com"] != "A" {
+		t.Errorf("Unexpected results %s", data)
+	}
+
+	if (runOptions{}).document(input, output, output, finished).(orderedDocument).value == nil {
+		t.Error("Expected the output alone without -envelope")
+	}
+
+	// Protobuf output is an Envelope, with the flat shape as records
+	schema := protoSchema(t)
+	opts.encoding, opts.shape = formatProtobuf, shapeFlat
+	data, err = encodeOutput(formatProtobuf, false, opts.document(input, output, opts.format(input, output), finished))
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := protoMessage(t, schema, "Envelope")
+	if err := proto.Unmarshal(data, message); err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := protojson.Marshal(message)
+	var fields struct {
+		Run struct {
+			SchemaVersion int            `json:"schemaVersion"`
+			ExitStatus    int            `json:"exitStatus"`
+			Counts        map[string]int `json:"counts"`
+		} `json:"run"`
+		Records struct {
+			Records []map[string]interface{} `json:"records"`
+		} `json:"records"`
+	}
+	json.Unmarshal(decoded, &fields)
+	if fields.Run.SchemaVersion != outputSchemaVersion || fields.Run.ExitStatus != exitPartial || fields.Run.Counts["failedUrls"] != 1 || len(fields.Records.Records) != 4 {
+		t.Errorf("Unexpected envelope %s", decoded)
+	}
+}
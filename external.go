@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --- External Tools ---
+
+// Some document processing (XSLT, schema validation) has no workable pure-Go
+// implementation, so it is delegated to the libxml2/libxslt command line tools. Which
+// executables run is up to whoever runs goatpaver, through flags, never the input
+// document: inputs come from queues, workers' senders and URLs as well.
+
+// externalCommands are the executables run for the input's external processing.
+type externalCommands struct {
+	xslt     string // xsltproc-compatible XSLT processor
+	validate string // xmllint-compatible validator
+}
+
+// defaultCommands are the tools run unless flags name others.
+var defaultCommands = externalCommands{xslt: "xsltproc", validate: "xmllint"}
+
+// toolCommands are the tools of the run, which sets them from its flags.
+var toolCommands = defaultCommands
+
+// externalFlags adds the flags naming the external tools to flags, returning the commands
+// they set once they are parsed.
+func externalFlags(flags *flag.FlagSet) *externalCommands {
+	commands := defaultCommands
+	flags.StringVar(&commands.xslt, "xslt-command", commands.xslt, "run this xsltproc-compatible processor for \"xslt\"")
+	flags.StringVar(&commands.validate, "validate-command", commands.validate, "run this xmllint-compatible validator for \"validate\"")
+	return &commands
+}
+
+// runTool runs command with args, feeding stdin and returning its standard output.
+// A non-zero exit is returned as an error carrying the tool's stderr.
+func runTool(command string, args []string, stdin []byte) ([]byte, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.Bytes(), fmt.Errorf("%s: %w: %s", command, err, msg)
+		}
+		return stdout.Bytes(), fmt.Errorf("%s: %w", command, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// --- XSLT ---
+
+// XSLTOptions configures a stylesheet applied to every document before xpath evaluation.
+// Presets still see the original content, since they work on the HTML as served.
+type XSLTOptions struct {
+	Stylesheet string            `json:"stylesheet"`       // Path to the .xsl file
+	Params     map[string]string `json:"params,omitempty"` // Passed as string parameters
+}
+
+// check verifies the options before any document is processed, so a missing
+// processor fails the run instead of every URL.
+func (o *XSLTOptions) check() error {
+	if o.Stylesheet == "" {
+		return fmt.Errorf("xslt: stylesheet is required")
+	}
+	if _, err := exec.LookPath(toolCommands.xslt); err != nil {
+		return fmt.Errorf("xslt: %w", err)
+	}
+	return nil
+}
+
+// externalEntity matches the declaration of an entity read from a file or URL.
+var externalEntity = regexp.MustCompile(`<!ENTITY\s+(%\s+)?[^\s>]+\s+(SYSTEM|PUBLIC)\b`)
+
+// transform applies the stylesheet to content and returns the result document. Documents
+// are untrusted, so xsltproc doesn't load their DTDs or anything over the network; since
+// it still expands external entities from local files, documents declaring any are
+// refused.
+func (o *XSLTOptions) transform(content []byte) ([]byte, error) {
+	if externalEntity.Match(content) {
+		return nil, errors.New("xslt: documents with external entities are not transformed")
+	}
+	names := make([]string, 0, len(o.Params))
+	for name := range o.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Stable command lines make failures reproducible
+	args := []string{"--nonet", "--novalid"}
+	for _, name := range names {
+		args = append(args, "--stringparam", name, o.Params[name])
+	}
+	args = append(args, o.Stylesheet, "-")
+	return runTool(toolCommands.xslt, args, content)
+}
+
+// --- Schema Validation ---
+
+// validationKey is the output section listing validation problems per URL.
+const validationKey = "$validation"
+
+// xmllint exits with 1-4 when the document is malformed or invalid, and 5 or more
+// when the schema itself can't be used or the tool failed.
+const xmllintMaxDocumentError = 4
+
+// ValidationOptions configures schema validation of every document before extraction.
+// Problems are reported per URL in the "$validation" output section.
+type ValidationOptions struct {
+	XSD         string `json:"xsd,omitempty"`          // W3C XML Schema file
+	DTD         string `json:"dtd,omitempty"`          // External DTD file
+	Doctype     bool   `json:"doctype,omitempty"`      // Validate against the document's own DOCTYPE
+	SkipInvalid bool   `json:"skip_invalid,omitempty"` // Don't extract from documents that fail validation
+}
+
+func (o *ValidationOptions) args() []string {
+	args := []string{"--noout", "--nonet"}
+	if o.XSD != "" {
+		args = append(args, "--schema", o.XSD)
+	}
+	if o.DTD != "" {
+		args = append(args, "--dtdvalid", o.DTD)
+	}
+	if o.Doctype {
+		args = append(args, "--valid")
+	}
+	return append(args, "-")
+}
+
+// check verifies the options before any document is processed. Validating a
+// trivial document makes a broken or missing schema fail the run up front.
+func (o *ValidationOptions) check() error {
+	if o.XSD == "" && o.DTD == "" && !o.Doctype {
+		return fmt.Errorf("validate: one of xsd, dtd or doctype is required")
+	}
+	if _, err := exec.LookPath(toolCommands.validate); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	if o.XSD != "" {
+		_, err := o.validate([]byte("<goatpaver-schema-check/>"))
+		if err != nil {
+			return fmt.Errorf("validate: %w", err)
+		}
+	}
+	return nil
+}
+
+// validate checks content and returns the problems found, or nil if it is valid.
+// The error is only set if validation itself could not be carried out.
+func (o *ValidationOptions) validate(content []byte) ([]string, error) {
+	cmd := exec.Command(toolCommands.validate, o.args()...)
+	cmd.Stdin = bytes.NewReader(content)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil, nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() > xmllintMaxDocumentError {
+		return nil, fmt.Errorf("%s: %w: %s", toolCommands.validate, err, strings.TrimSpace(stderr.String()))
+	}
+
+	// Each problem starts with "-:<line>:" (the document is read from stdin); the
+	// source excerpt and caret lines that follow parser errors are dropped.
+	var problems []string
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		if strings.HasPrefix(line, "-:") {
+			problems = append(problems, "line "+strings.TrimPrefix(line, "-:"))
+		}
+	}
+	if len(problems) == 0 {
+		problems = append(problems, strings.TrimSpace(stderr.String()))
+	}
+	return problems, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeTool writes an executable shell script standing in for an external tool.
+func fakeTool(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+	path := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("writing fake tool: %v", err)
+	}
+	return path
+}
+
+func TestProcessInput_XSLT(t *testing.T) {
+	// Echoes the parameter value and stylesheet it was called with, failing for documents mentioning "bad"
+	xsltproc := fakeTool(t, `grep -q bad && { echo "bad document" >&2; exit 6; }
+echo "<result><param>$5</param><sheet>$6</sheet></result>"
+`)
+	defer func() { toolCommands = defaultCommands }()
+	toolCommands.xslt = xsltproc
+	inputJsonBytes := []byte(`{
+		"xslt": {"stylesheet": "legacy.xsl", "params": {"mode": "full"}},
+		"xpaths": ["//param", "//sheet", "//original"],
+		"urls": {
+			"http://good.com": {"content": "<original>x</original>"},
+			"http://bad.com": {"content": "<original>bad</original>"}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"//param":    {"http://good.com": "full"},
+		"//sheet":    {"http://good.com": "legacy.xsl"},
+		"//original": {},
+	}
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+}
+
+func TestProcessInput_XSLTExternalEntity(t *testing.T) {
+	xsltproc := fakeTool(t, `echo "<result><flags>$1 $2</flags><doc>$(cat)</doc></result>"
+`)
+	defer func() { toolCommands = defaultCommands }()
+	toolCommands.xslt = xsltproc
+	inputJsonBytes := []byte(`{
+		"xslt": {"stylesheet": "legacy.xsl"},
+		"xpaths": ["//flags", "//doc"],
+		"urls": {
+			"http://good.com": {"content": "<original>x</original>"},
+			"http://xxe.com": {"content": "<!DOCTYPE original [<!ENTITY x SYSTEM \"file:///etc/hostname\">]><original>&x;</original>"},
+			"http://param.com": {"content": "<!DOCTYPE original [<!ENTITY % x PUBLIC \"-//X\" \"http://169.254.169.254/\"> %x;]><original/>"}
+		}
+	}`)
+
+	// The processor stays off the network and away from DTDs, and never sees external entities
+	expectedOutput := OutputJson{
+		"//flags": {"http://good.com": "--nonet --novalid"},
+		"//doc":   {"http://good.com": "x"},
+	}
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+}
+
+func TestProcessInput_XSLTMissingProcessor(t *testing.T) {
+	opts, err := parseFlags([]string{"-xslt-command", "/nonexistent/xsltproc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { toolCommands = defaultCommands }()
+	toolCommands = opts.commands
+	inputJsonBytes := []byte(`{
+		"xslt": {"stylesheet": "legacy.xsl"},
+		"xpaths": ["//p"],
+		"urls": {}
+	}`)
+	if _, err := processInput(inputJsonBytes); err == nil {
+		t.Errorf("Expected an error for a missing XSLT processor, but got nil")
+	}
+}
+
+func TestProcessInput_Validation(t *testing.T) {
+	if _, err := exec.LookPath("xmllint"); err != nil {
+		t.Skip("xmllint not available")
+	}
+	inputJsonBytes := []byte(`{
+		"validate": {"xsd": "testdata/validate/price.xsd", "skip_invalid": true},
+		"xpaths": ["//price"],
+		"urls": {
+			"http://valid.com": {"content": "<price>9.99</price>"},
+			"http://invalid.com": {"content": "<price>cheap</price>"},
+			"http://malformed.com": {"content": "<price>1"}
+		}
+	}`)
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+
+	if want := map[string]interface{}{"http://valid.com": "9.99"}; !reflect.DeepEqual(want, actualOutput["//price"]) {
+		t.Errorf("Unexpected //price results: %#v", actualOutput["//price"])
+	}
+	report := actualOutput[validationKey]
+	if len(report) != 2 || report["http://invalid.com"] == nil || report["http://malformed.com"] == nil {
+		t.Fatalf("Expected problems for the invalid and malformed URLs, got %#v", report)
+	}
+	problems := report["http://invalid.com"].([]string)
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "line 1:") || !strings.Contains(problems[0], "xs:decimal") {
+		t.Errorf("Unexpected problems for the invalid URL: %q", problems)
+	}
+}
+
+func TestProcessInput_ValidationBrokenSchema(t *testing.T) {
+	if _, err := exec.LookPath("xmllint"); err != nil {
+		t.Skip("xmllint not available")
+	}
+	inputJsonBytes := []byte(`{"validate": {"xsd": "testdata/validate/missing.xsd"}, "xpaths": [], "urls": {}}`)
+	if _, err := processInput(inputJsonBytes); err == nil {
+		t.Errorf("Expected an error for a missing schema, but got nil")
+	}
+}
+
+func TestProcessInput_CommandsInInput(t *testing.T) {
+	for _, options := range []string{
+		`"xslt": {"stylesheet": "legacy.xsl", "command": "/bin/sh"}`,
+		`"validate": {"doctype": true, "command": "/bin/sh"}`,
+	} {
+		inputJsonBytes := []byte(`{` + options + `, "xpaths": [], "urls": {}}`)
+		if _, err := processInput(inputJsonBytes); err == nil || !strings.Contains(err.Error(), "command") {
+			t.Errorf("Expected an error for an input naming its tool, %s, got %v", options, err)
+		}
+	}
+}
+
+func TestProcessInput_ValidateCommand(t *testing.T) {
+	// Finds a problem in every document
+	xmllint := fakeTool(t, `echo "-:1: element p: not expected" >&2; exit 3
+`)
+	opts, err := parseFlags([]string{"-validate-command", xmllint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { toolCommands = defaultCommands }()
+	toolCommands = opts.commands
+	actualOutput, err := processInput([]byte(`{"validate": {"doctype": true}, "xpaths": ["//p"], "urls": {"http://a.com": {"content": "<p>x</p>"}}}`))
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if problems := actualOutput[validationKey]["http://a.com"]; !reflect.DeepEqual(problems, []string{"line 1: element p: not expected"}) {
+		t.Errorf("Unexpected problems %#v", problems)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --- Fetching ---
+
+// responsesKey is the output section with the HTTP response of each fetched URL, for
+// telling failures and soft 404s (error pages served as 200 OK) from pages that changed.
+const responsesKey = "$responses"
+
+// defaultFetchTimeout bounds each request unless the options say otherwise.
+const defaultFetchTimeout = 30 * time.Second
+
+// FetchOptions makes goatpaver fetch the URLs that have neither content nor a file,
+// with a GET request each. Others are read as before. file:// and data: URLs are fetched
+// too, by reading the file or decoding the URL, so that test fixtures and generated
+// documents take the same path as pages; their response is a 200 with the content type
+// the file extension or the data: URL gives.
+type FetchOptions struct {
+	Timeout   string   `json:"timeout,omitempty"`    // Per request, as a Go duration such as "10s"; default 30s
+	UserAgent string   `json:"user_agent,omitempty"` // Default "goatpaver/VERSION"
+	Headers   []string `json:"headers,omitempty"`    // Response headers to report in "$responses", e.g. ["Last-Modified"]
+
+	TLS     *TLSOptions `json:"tls,omitempty"`     // CAs and client certificate, see tls.go
+	Resolve []string    `json:"resolve,omitempty"` // Addresses to connect to, "HOST:PORT:ADDR"; see resolve.go
+
+	timeout time.Duration // Timeout as parsed by check
+	client  *http.Client  // For TLS and Resolve, made by check; fetchClient otherwise
+}
+
+// responseInfo is the response to one fetch.
+type responseInfo struct {
+	Status        int               `json:"status"`
+	ContentType   string            `json:"content_type,omitempty"`
+	ContentLength int64             `json:"content_length"`      // As announced, -1 if it wasn't
+	FinalURL      string            `json:"final_url,omitempty"` // Where redirects led, if elsewhere
+	Headers       map[string]string `json:"headers,omitempty"`   // The requested headers that were sent
+}
+
+// fetchClient makes the requests; timeouts are set per request.
+var fetchClient = &http.Client{}
+
+func (o *FetchOptions) check() error {
+	o.timeout = defaultFetchTimeout
+	if o.Timeout != "" {
+		timeout, err := time.ParseDuration(o.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("fetch: invalid timeout %q", o.Timeout)
+		}
+		o.timeout = timeout
+	}
+	o.client = nil
+	pins, err := parseResolve(o.Resolve)
+	if err != nil {
+		return fmt.Errorf("fetch: %w", err)
+	}
+	if o.TLS != nil || pins != nil {
+		client, err := httpClient(o.TLS, pins, 0) // Timeouts are per request
+		if err != nil {
+			return fmt.Errorf("fetch: %w", err)
+		}
+		o.client = client
+	}
+	return nil
+}
+
+// userAgent is the User-Agent header of requests. o may be nil, for the default.
+func (o *FetchOptions) userAgent() string {
+	if o != nil && o.UserAgent != "" {
+		return o.UserAgent
+	}
+	return "goatpaver/" + toolVersion()
+}
+
+// fetch GETs pageURL and returns the body along with the response. A response other than
+// 2xx is an error, but its details are still returned, and so is a body larger than limit
+// bytes unless it is 0; such a body is not read beyond the limit.
+func (o *FetchOptions) fetch(pageURL string, limit int64) ([]byte, *responseInfo, error) {
+	if len(pageURL) > 5 && strings.EqualFold(pageURL[:5], "data:") {
+		// Before parsing, which data: URLs with spaces or quotes would fail
+		return fetchData(pageURL, limit)
+	}
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "file":
+		return fetchFile(u, limit)
+	default:
+		return nil, nil, fmt.Errorf("cannot fetch %q URLs", u.Scheme)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", o.userAgent())
+	client := fetchClient
+	if o.client != nil {
+		client = o.client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	info := &responseInfo{
+		Status:        resp.StatusCode,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+	}
+	if final := resp.Request.URL.String(); final != pageURL {
+		info.FinalURL = final
+	}
+	for _, name := range o.Headers {
+		if value := resp.Header.Get(name); value != "" {
+			if info.Headers == nil {
+				info.Headers = make(map[string]string)
+			}
+			info.Headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, info, fmt.Errorf("GET %s: %s", pageURL, resp.Status)
+	}
+	if err := checkSize(resp.ContentLength, limit); err != nil {
+		return nil, info, err
+	}
+	body := io.Reader(resp.Body)
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+	data, err := readAll(body)
+	if err != nil {
+		return nil, info, err
+	}
+	if int64(len(data)) > limit && limit > 0 {
+		return nil, info, &tooLargeError{size: -1, limit: limit}
+	}
+	return data, info, nil
+}
+
+// fileURLPath returns the path of the file:// URL u, which is relative to the working
+// directory for an opaque URL like file:fixtures/page.html.
+func fileURLPath(u *url.URL) (string, error) {
+	if u.Opaque != "" {
+		return url.PathUnescape(u.Opaque)
+	}
+	return u.Path, nil
+}
+
+// fetchFile reads the file of a file:// URL, such as file:///srv/fixtures/page.html or,
+// relative to the working directory, file:fixtures/page.html.
+func fetchFile(u *url.URL, limit int64) ([]byte, *responseInfo, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, nil, fmt.Errorf("cannot fetch files on %s", u.Host)
+	}
+	path, err := fileURLPath(u)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if stat.IsDir() {
+		return nil, nil, fmt.Errorf("%s is a directory", path)
+	}
+	info := &responseInfo{Status: http.StatusOK, ContentType: mime.TypeByExtension(filepath.Ext(path)), ContentLength: stat.Size()}
+	if err := checkSize(stat.Size(), limit); err != nil {
+		return nil, info, err
+	}
+	data, err := readAll(file)
+	if err != nil {
+		return nil, info, err
+	}
+	return data, info, nil
+}
+
+// fetchData decodes a data: URL (RFC 2397), data:[MEDIATYPE][;base64],DATA.
+func fetchData(pageURL string, limit int64) ([]byte, *responseInfo, error) {
+	meta, payload, found := strings.Cut(pageURL[len("data:"):], ",")
+	if !found {
+		return nil, nil, errors.New("data: URL without a comma")
+	}
+	encoded, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := []byte(encoded)
+	mediaType, isBase64 := meta, false
+	if strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		mediaType, isBase64 = meta[:len(meta)-len(";base64")], true
+	}
+	if isBase64 {
+		encoded = strings.TrimRight(encoded, "=")
+		if data, err = base64.RawStdEncoding.DecodeString(encoded); err != nil {
+			return nil, nil, fmt.Errorf("invalid base64 in data: URL: %w", err)
+		}
+	}
+	if mediaType == "" {
+		mediaType = "text/plain;charset=US-ASCII"
+	}
+	info := &responseInfo{Status: http.StatusOK, ContentType: mediaType, ContentLength: int64(len(data))}
+	if err := checkSize(int64(len(data)), limit); err != nil {
+		return nil, info, err
+	}
+	return data, info, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+		case "/page":
+			if !strings.HasPrefix(r.UserAgent(), "goatpaver/") {
+				t.Errorf("Unexpected User-Agent %q", r.UserAgent())
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("X-Cache", "HIT")
+			w.Write([]byte("<h1>Page</h1>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1"],
+		"urls": {"` + server.URL + `/old": {}, "` + server.URL + `/gone": {}, "http://inline.com": {"content": "<h1>Inline</h1>"}},
+		"fetch": {"timeout": "5s", "headers": ["x-cache", "Last-Modified"]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output["//h1"][server.URL+"/old"] != "Page" || output["//h1"]["http://inline.com"] != "Inline" {
+		t.Errorf("Unexpected values %v", output["//h1"])
+	}
+	page := output[responsesKey][server.URL+"/old"].(*responseInfo)
+	if page.Status != 200 || page.ContentType != "text/html" || page.ContentLength != 13 || page.FinalURL != server.URL+"/page" {
+		t.Errorf("Unexpected response %+v", page)
+	}
+	if len(page.Headers) != 1 || page.Headers["X-Cache"] != "HIT" {
+		t.Errorf("Unexpected headers %v; want the requested ones that were sent", page.Headers)
+	}
+	gone := output[responsesKey][server.URL+"/gone"].(*responseInfo)
+	if gone.Status != 404 || !input.status.skipped[server.URL+"/gone"] {
+		t.Errorf("Unexpected response %+v; want a 404 reported and the URL skipped", gone)
+	}
+	if _, found := output[responsesKey]["http://inline.com"]; found {
+		t.Error("Expected no response for inline content")
+	}
+
+	if _, err := parseInput([]byte(`{"xpaths": [], "urls": {}, "fetch": {"timeout": "soon"}}`)); err == nil {
+		t.Error("Expected an error for an invalid timeout")
+	}
+}
+
+func TestFetchFileAndData(t *testing.T) {
+	dir := t.TempDir()
+	fixture := filepath.Join(dir, "fixture.html")
+	if err := os.WriteFile(fixture, []byte("<h1>Fixture</h1><a href='next.html'>Next</a>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fileURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(fixture)}).String()
+	dataURL := "data:text/html;charset=utf-8,%3Ch1%3EInline data%3C/h1%3E"
+	base64URL := "data:text/html;base64,PGgxPkJhc2U2NDwvaDE+"
+	document, _ := json.Marshal(map[string]interface{}{
+		"xpaths": []interface{}{"//h1", map[string]interface{}{"xpath": "//a/@href", "name": "next", "resolve": true}},
+		"urls": map[string]interface{}{
+			fileURL: map[string]string{}, dataURL: map[string]string{}, base64URL: map[string]string{},
+			"file:///missing/page.html": map[string]string{}, "data:no comma": map[string]string{},
+		},
+		"fetch": map[string]string{},
+	})
+	input, err := parseInput(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pageURL, want := range map[string]string{fileURL: "Fixture", dataURL: "Inline data", base64URL: "Base64"} {
+		if got := output["//h1"][pageURL]; got != want {
+			t.Errorf("%s gave %v; want %q", pageURL, got, want)
+		}
+	}
+	if next := output["next"][fileURL]; next != "file://"+filepath.ToSlash(filepath.Join(dir, "next.html")) {
+		t.Errorf("Unexpected link %v resolved against a file URL", next)
+	}
+	file := output[responsesKey][fileURL].(*responseInfo)
+	if file.Status != 200 || file.ContentType != "text/html; charset=utf-8" || file.ContentLength != 44 {
+		t.Errorf("Unexpected response %+v for a file", file)
+	}
+	if data := output[responsesKey][base64URL].(*responseInfo); data.ContentType != "text/html" || data.ContentLength != 15 {
+		t.Errorf("Unexpected response %+v for a data: URL", data)
+	}
+	if !input.status.skipped["file:///missing/page.html"] || !input.status.skipped["data:no comma"] {
+		t.Errorf("Unexpected skipped URLs %v", input.status.skipped)
+	}
+
+	o := &FetchOptions{}
+	o.check()
+	if _, _, err := o.fetch("file://example.com/etc/passwd", 0); err == nil {
+		t.Error("Fetched a file on another host")
+	}
+	if _, info, err := o.fetch(fileURL, 10); err == nil || info == nil {
+		t.Errorf("Fetched a file past the limit: %v", err)
+	}
+	if _, _, err := o.fetch("data:;base64,!!!", 0); err == nil {
+		t.Error("Decoded invalid base64")
+	}
+	if data, info, err := o.fetch("data:,plain", 0); string(data) != "plain" || info.ContentType != "text/plain;charset=US-ASCII" || err != nil {
+		t.Errorf("Unexpected %q, %+v, %v for a plain data: URL", data, info, err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// --- Unknown Fields ---
+
+// Input documents are decoded strictly: a misspelt option such as "xpath" for "xpaths" is
+// an error naming the field, and the known field it is closest to, instead of an option
+// silently left at its default.
+
+// unknownFieldError matches the error encoding/json gives for a field not in the struct.
+var unknownFieldError = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+// strictUnmarshal decodes data into v like json.Unmarshal, but rejects unknown fields. what
+// names v for errors, e.g. "the input" or `expression "//h1"`.
+func strictUnmarshal(data []byte, v interface{}, what string) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after the document")
+	}
+	return strictError(err, v, what)
+}
+
+// strictError turns the error of decoding v with unknown fields disallowed into one
+// naming the field, and what it is closest to, as strictUnmarshal does.
+func strictError(err error, v interface{}, what string) error {
+	if m := unknownFieldError.FindStringSubmatch(fmt.Sprint(err)); m != nil {
+		message := fmt.Sprintf("unknown field %q in %s", m[1], what)
+		if known := closestField(m[1], knownFields(reflect.TypeOf(v))); known != "" {
+			message += fmt.Sprintf("; did you mean %q?", known)
+		}
+		return errors.New(message)
+	}
+	return err
+}
+
+// knownFields returns the JSON field names of t and of the structs nested in it. Types
+// decoding themselves check their own fields and are left out.
+func knownFields(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	addKnownFields(t, names, make(map[reflect.Type]bool))
+	return names
+}
+
+func addKnownFields(t reflect.Type, names map[string]bool, visited map[reflect.Type]bool) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || visited[t] {
+		return
+	}
+	visited[t] = true
+	unmarshaler := reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+		if !reflect.PointerTo(field.Type).Implements(unmarshaler) {
+			addKnownFields(field.Type, names, visited)
+		}
+	}
+}
+
+// closestField returns the name in names that name is most likely a typo of, or "".
+// Names are known from anywhere in the document, so name itself may be among them, for
+// another struct; it is passed over.
+func closestField(name string, names map[string]bool) string {
+	best, bestDistance := "", len(name)/3+1
+	for known := range names {
+		if known == name {
+			continue
+		}
+		d := editDistance(strings.ToLower(name), strings.ToLower(known))
+		if d < bestDistance || d == bestDistance && best != "" && known < best {
+			best, bestDistance = known, d
+		}
+	}
+	return best
+}
+
+// editDistance is the number of single-character insertions, deletions, substitutions
+// and transpositions of neighbours turning a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// expressionName names the expression object in data for errors, by its XPath if it has
+// one.
+func expressionName(data []byte) string {
+	var expr struct {
+		XPath string `json:"xpath"`
+	}
+	if json.Unmarshal(data, &expr) == nil && expr.XPath != "" {
+		return fmt.Sprintf("expression %q", expr.XPath)
+	}
+	return "an expression"
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnknownFields(t *testing.T) {
+	for _, c := range []struct {
+		document string
+		expected string // "" if the document is fine
+	}{
+		{`{"xpath": ["//h1"], "urls": {}}`, `unknown field "xpath" in the input; did you mean "xpaths"?`},
+		{`{"xpaths": ["//h1"], "urls": {"a": {"contents": "<h1/>"}}}`, `unknown field "contents" in the input; did you mean "content"?`},
+		{`{"xpaths": ["//h1"], "normalize": {"colapse": true}}`, `unknown field "colapse" in the input; did you mean "collapse"?`},
+		{`{"xpaths": [{"xpath": "//h1", "mdoe": "all"}]}`, `unknown field "mdoe" in expression "//h1"; did you mean "mode"?`},
+		{`{"xpaths": [{"xpath": "//h1", "transforms": [{"type": "replace", "patern": "a"}]}]}`, `unknown field "patern" in a transform; did you mean "pattern"?`},
+		{`{"xpaths": [{"xpath": "//p", "return": "innerHTML", "sanitize": {"tag": ["b"]}}]}`, `unknown field "tag" in sanitize options; did you mean "tags"?`},
+		{`{"xpaths": ["//h1"], "frobnicate": true}`, `unknown field "frobnicate" in the input`},
+		{`{"xpaths": ["//h1", {"xpath": "//a", "transforms": ["uppercase"], "sanitize": false}], "alerts": {"webhook": "http://x", "rules": [{"type": "missing", "xpath": "//h1"}]}}`, ""},
+	} {
+		_, err := parseInput([]byte(c.document))
+		switch {
+		case c.expected == "" && err != nil:
+			t.Errorf("parseInput(%s): %v", c.document, err)
+		case c.expected != "" && (err == nil || !strings.HasSuffix(err.Error(), c.expected)):
+			t.Errorf("parseInput(%s) = %v, want %q", c.document, err, c.expected)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		d    int
+	}{{"", "", 0}, {"xpath", "xpaths", 1}, {"nmae", "name", 1}, {"colapse", "collapse", 1}, {"kitten", "sitting", 3}, {"é", "e", 1}} {
+		if d := editDistance(c.a, c.b); d != c.d {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", c.a, c.b, d, c.d)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/user/go_goat/internal/xmlpath"
+)
+
+// --- Result Modes ---
+
+// Values for Expression.Return, selecting how a matched node is turned into a result.
+const (
+	returnText      = "text"      // String value of the node (the default)
+	returnOuterHTML = "outerHTML" // The node itself serialized as markup
+	returnInnerHTML = "innerHTML" // The node's children serialized as markup
+	returnC14N      = "c14n"      // The node serialized as Exclusive Canonical XML, without comments
+)
+
+// validReturnMode reports whether mode is a supported Expression.Return value.
+// The empty string selects the default text mode.
+func validReturnMode(mode string) bool {
+	switch mode {
+	case "", returnText, returnOuterHTML, returnInnerHTML, returnC14N:
+		return true
+	}
+	return false
+}
+
+// renderNode converts a matched node into its result string according to mode.
+// Markup modes are filtered through policy if it is not nil; see sanitize.go.
+func renderNode(node *xmlpath.Node, mode string, policy *sanitizePolicy) string {
+	switch mode {
+	case returnOuterHTML:
+		buf := getBuffer()
+		defer putBuffer(buf)
+		writeNode(buf, node, policy)
+		return buf.String()
+	case returnInnerHTML:
+		buf := getBuffer()
+		defer putBuffer(buf)
+		for _, child := range node.Children() {
+			writeNode(buf, child, policy)
+		}
+		return buf.String()
+	case returnC14N:
+		buf := getBuffer()
+		defer putBuffer(buf)
+		writeCanonical(buf, node, map[string]string{"": ""})
+		return buf.String()
+	default:
+		return node.String()
+	}
+}
+
+// voidElements are HTML elements that never have content; they are written self-closed
+// when empty. Other empty elements get an explicit end tag so HTML parsers don't treat
+// the self-closing syntax as an unclosed start tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true,
+	"img": true, "input": true, "link": true, "meta": true, "param": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// writeNode serializes node and its subtree as markup. The parsed tree only keeps
+// namespace URIs, so prefixes are recovered from the xmlns declarations in scope.
+// A non-nil policy drops everything it doesn't allow.
+func writeNode(buf *bytes.Buffer, node *xmlpath.Node, policy *sanitizePolicy) {
+	switch node.Kind() {
+	case xmlpath.TextNode:
+		escapeText(buf, node.Bytes())
+	case xmlpath.CommentNode, xmlpath.ProcInstNode:
+		if policy != nil {
+			return
+		}
+		writeOther(buf, node)
+	case xmlpath.AttrNode:
+		buf.WriteString(qualifiedName(node.Parent(), node.Name(), true))
+		buf.WriteString(`="`)
+		escapeAttr(buf, node.String())
+		buf.WriteByte('"')
+	case xmlpath.ElementNode:
+		name := qualifiedName(node, node.Name(), false)
+		if node.Parent() == nil || policy != nil && !policy.allowElement(node) {
+			// The document root has no tag of its own; disallowed elements are unwrapped
+			if policy == nil || !policy.dropContent(node) {
+				for _, child := range node.Children() {
+					writeNode(buf, child, policy)
+				}
+			}
+			return
+		}
+		buf.WriteByte('<')
+		buf.WriteString(name)
+		for _, attr := range node.Attrs() {
+			if policy != nil && !policy.allowAttr(attr) {
+				continue
+			}
+			buf.WriteByte(' ')
+			writeNode(buf, attr, policy)
+		}
+		children := node.Children()
+		if len(children) == 0 && voidElements[strings.ToLower(name)] {
+			buf.WriteString("/>")
+			return
+		}
+		buf.WriteByte('>')
+		for _, child := range children {
+			writeNode(buf, child, policy)
+		}
+		buf.WriteString("</")
+		buf.WriteString(name)
+		buf.WriteByte('>')
+	}
+}
+
+// writeOther serializes a comment or processing instruction.
+func writeOther(buf *bytes.Buffer, node *xmlpath.Node) {
+	if node.Kind() == xmlpath.CommentNode {
+		buf.WriteString("<!--")
+		buf.Write(node.Bytes())
+		buf.WriteString("-->")
+		return
+	}
+	fmt.Fprintf(buf, "<?%s %s?>", node.Name().Local, node.Bytes())
+}
+
+// qualifiedName renders name as it would appear in the source, looking up a prefix for its
+// namespace URI among the xmlns declarations on scope and its ancestors. Namespace
+// declarations themselves are decoded with Space "xmlns" and are written back verbatim.
+func qualifiedName(scope *xmlpath.Node, name xml.Name, isAttr bool) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	if name.Space == "xmlns" {
+		return "xmlns:" + name.Local
+	}
+	for n := scope; n != nil; n = n.Parent() {
+		for _, attr := range n.Attrs() {
+			decl := attr.Name()
+			if attr.String() != name.Space {
+				continue
+			}
+			if decl.Space == "xmlns" {
+				return decl.Local + ":" + name.Local
+			}
+			if decl.Space == "" && decl.Local == "xmlns" && !isAttr {
+				return name.Local // Default namespace; attributes never take it
+			}
+		}
+	}
+	// No declaration in scope (e.g. the predeclared xml prefix, or an undeclared prefix
+	// which the decoder reports as its own Space).
+	if name.Space == "http://www.w3.org/XML/1998/namespace" {
+		return "xml:" + name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// escapeText writes text content escaped for markup. Unlike xml.EscapeText it keeps
+// newlines and tabs literal, so fragments keep their original layout.
+func escapeText(buf *bytes.Buffer, text []byte) {
+	for _, b := range text {
+		switch b {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		default:
+			buf.WriteByte(b)
+		}
+	}
+}
+
+// escapeAttr writes s escaped for use inside a double-quoted attribute value.
+func escapeAttr(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '"':
+			buf.WriteString("&quot;")
+		case '\n':
+			buf.WriteString("&#xA;")
+		case '\t':
+			buf.WriteString("&#x9;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+// --- Canonical XML ---
+
+// xmlNamespace is the namespace bound to the reserved xml prefix, which is never declared.
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// writeCanonical serializes node following Exclusive XML Canonicalization 1.0 without
+// comments (http://www.w3.org/2001/10/xml-exc-c14n#), so the same fragment always yields
+// the same bytes. rendered maps the prefixes already declared by output ancestors to
+// their namespace URIs; an element only declares the prefixes it visibly uses that are
+// not yet rendered with the same URI.
+func writeCanonical(buf *bytes.Buffer, node *xmlpath.Node, rendered map[string]string) {
+	switch node.Kind() {
+	case xmlpath.TextNode:
+		escapeCanonicalText(buf, node.Bytes())
+	case xmlpath.CommentNode:
+		// Dropped by the without-comments variant
+	case xmlpath.ProcInstNode:
+		buf.WriteString("<?")
+		buf.WriteString(node.Name().Local)
+		if data := node.Bytes(); len(data) > 0 {
+			buf.WriteByte(' ')
+			buf.Write(data)
+		}
+		buf.WriteString("?>")
+	case xmlpath.AttrNode:
+		buf.WriteString(qualifiedName(node.Parent(), node.Name(), true))
+		buf.WriteString(`="`)
+		escapeAttr(buf, node.String())
+		buf.WriteByte('"')
+	case xmlpath.ElementNode:
+		if node.Parent() == nil {
+			for _, child := range node.Children() {
+				writeCanonical(buf, child, rendered)
+			}
+			return
+		}
+		name := qualifiedName(node, node.Name(), false)
+
+		// Namespaces visibly utilized by the element and its attributes
+		used := map[string]string{namePrefix(name): node.Name().Space}
+		var attrs []*xmlpath.Node
+		for _, attr := range node.Attrs() {
+			an := attr.Name()
+			if an.Space == "xmlns" || an.Space == "" && an.Local == "xmlns" {
+				continue // Declarations are regenerated from usage below
+			}
+			attrs = append(attrs, attr)
+			if an.Space != "" && an.Space != xmlNamespace {
+				used[namePrefix(qualifiedName(node, an, true))] = an.Space
+			}
+		}
+		var prefixes []string
+		for prefix, space := range used {
+			if rendered[prefix] != space {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+		sort.Strings(prefixes) // The default namespace ("") sorts first, as required
+		sort.SliceStable(attrs, func(i, j int) bool {
+			a, b := attrs[i].Name(), attrs[j].Name()
+			if a.Space != b.Space {
+				return a.Space < b.Space
+			}
+			return a.Local < b.Local
+		})
+
+		buf.WriteByte('<')
+		buf.WriteString(name)
+		scope := rendered
+		if len(prefixes) > 0 {
+			scope = make(map[string]string, len(rendered)+len(prefixes))
+			for prefix, space := range rendered {
+				scope[prefix] = space
+			}
+		}
+		for _, prefix := range prefixes {
+			if prefix == "" {
+				buf.WriteString(` xmlns="`)
+			} else {
+				buf.WriteString(" xmlns:" + prefix + `="`)
+			}
+			escapeAttr(buf, used[prefix])
+			buf.WriteByte('"')
+			scope[prefix] = used[prefix]
+		}
+		for _, attr := range attrs {
+			buf.WriteByte(' ')
+			writeCanonical(buf, attr, scope)
+		}
+		buf.WriteByte('>')
+		for _, child := range node.Children() {
+			writeCanonical(buf, child, scope)
+		}
+		buf.WriteString("</")
+		buf.WriteString(name)
+		buf.WriteByte('>')
+	}
+}
+
+// namePrefix returns the prefix of a qualified name, or "" if it has none.
+func namePrefix(qname string) string {
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		return qname[:i]
+	}
+	return ""
+}
+
+// escapeCanonicalText escapes text content as Canonical XML requires: like escapeText,
+// plus carriage returns as character references.
+func escapeCanonicalText(buf *bytes.Buffer, text []byte) {
+	for len(text) > 0 {
+		i := bytes.IndexByte(text, '\r')
+		if i < 0 {
+			escapeText(buf, text)
+			return
+		}
+		escapeText(buf, text[:i])
+		buf.WriteString("&#xD;")
+		text = text[i+1:]
+	}
+}
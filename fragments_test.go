@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/user/go_goat/internal/xmlpath"
+)
+
+func TestProcessInput_ReturnModes(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"xpaths": [
+			"//div",
+			{"xpath": "//div", "name": "div outer", "return": "outerHTML"},
+			{"xpath": "//div", "name": "div inner", "return": "innerHTML"},
+			{"xpath": "//div", "name": "bogus", "return": "markdown"}
+		],
+		"urls": {
+			"http://example.com": {
+				"content": "<html><body><div class=\"a&amp;b\">Hi <b>there</b><br/>&lt;3<!-- note --></div></body></html>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"//div": {
+			"http://example.com": "Hi there<3",
+		},
+		"div outer": {
+			"http://example.com": `<div class="a&amp;b">Hi <b>there</b><br/>&lt;3<!-- note --></div>`,
+		},
+		"div inner": {
+			"http://example.com": `Hi <b>there</b><br/>&lt;3<!-- note -->`,
+		},
+		"bogus": {},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		expectedJson, _ := json.MarshalIndent(expectedOutput, "", "  ")
+		actualJson, _ := json.MarshalIndent(actualOutput, "", "  ")
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
+	}
+}
+
+func TestRenderNode_Namespaces(t *testing.T) {
+	root, err := xmlpath.Parse(strings.NewReader(`<feed xmlns="http://www.w3.org/2005/Atom" xmlns:m="urn:media"><entry m:id="1"><m:thumb/></entry></feed>`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	iter := xmlpath.MustCompile("//entry").Iter(root)
+	if !iter.Next() {
+		t.Fatalf("Expected //entry to match")
+	}
+	want := `<entry m:id="1"><m:thumb></m:thumb></entry>`
+	if got := renderNode(iter.Node(), returnOuterHTML, nil); got != want {
+		t.Errorf("Unexpected markup.\nExpected: %s\nGot:      %s", want, got)
+	}
+}
+
+func TestRenderNode_TextEscaping(t *testing.T) {
+	root, err := xmlpath.Parse(strings.NewReader("<pre title=\"a&quot;b\">x &lt; y\n\t\"z\" &amp; 'w'</pre>"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	iter := xmlpath.MustCompile("//pre").Iter(root)
+	if !iter.Next() {
+		t.Fatalf("Expected //pre to match")
+	}
+	// Only markup characters are escaped in text, so layout and quotes read as in the source
+	want := "<pre title=\"a&quot;b\">x &lt; y\n\t\"z\" &amp; 'w'</pre>"
+	if got := renderNode(iter.Node(), returnOuterHTML, nil); got != want {
+		t.Errorf("Unexpected markup.\nExpected: %s\nGot:      %s", want, got)
+	}
+}
+
+func TestRenderNode_Canonical(t *testing.T) {
+	root, err := xmlpath.Parse(strings.NewReader(`<?xml version="1.0"?>
+<doc xmlns="urn:default" xmlns:a="urn:a" xmlns:unused="urn:unused">
+  <a:item z="1" a:b="2" xml:lang="en" id="x"><!-- dropped --><empty/><?pi data?>x &gt; y</a:item>
+</doc>`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	iter := xmlpath.MustCompile("//item").Iter(root)
+	if !iter.Next() {
+		t.Fatalf("Expected //item to match")
+	}
+	// Attributes sort by namespace URI, then local name; unused declarations are dropped
+	want := `<a:item xmlns:a="urn:a" id="x" z="1" xml:lang="en" a:b="2"><empty xmlns="urn:default"></empty><?pi data?>x &gt; y</a:item>`
+	if got := renderNode(iter.Node(), returnC14N, nil); got != want {
+		t.Errorf("Unexpected canonical form.\nExpected: %s\nGot:      %s", want, got)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/user/go_goat/internal/xmlpath"
+)
+
+// --- Typed Result Functions ---
+
+// xmlpath only evaluates location paths, so expressions wrapped in one of these XPath
+// functions are unwrapped here and the function applied to the inner path's node set.
+// Only a single outermost call is supported, e.g. count(//a) but not count(//a) > 1.
+const (
+	fnBoolean = "boolean" // true if the path matches anything
+	fnNot     = "not"     // false if the path matches anything
+	fnCount   = "count"   // number of matched nodes
+	fnNumber  = "number"  // string value of the first match parsed as a number
+	fnString  = "string"  // string value of the first match, same as a bare path
+)
+
+var (
+	functionCall = regexp.MustCompile(`^\s*(boolean|not|count|number|string)\s*\((.*)\)\s*$`)
+	// xpathNumber is the XPath 1.0 Number production, optionally signed as number() allows
+	xpathNumber = regexp.MustCompile(`^-?(\d+(\.\d*)?|\.\d+)$`)
+)
+
+// splitFunctionCall returns the function name and inner path of an expression like
+// "count(//a)". For a bare path it returns an empty name and the path unchanged.
+func splitFunctionCall(xpath string) (fn string, path string) {
+	m := functionCall.FindStringSubmatch(xpath)
+	if m == nil {
+		return "", xpath
+	}
+	return m[1], strings.TrimSpace(m[2])
+}
+
+// applyFunction evaluates fn over the nodes path matches on root. The boolean result is
+// false when there is no value to report: number() of a missing or non-numeric string, or
+// string() without a match. boolean(), not() and count() always produce a value. Matching
+// stops early once done is closed, as for compiledExpression.match.
+func applyFunction(fn string, path *xmlpath.Path, root *xmlpath.Node, done <-chan struct{}) (interface{}, bool) {
+	switch fn {
+	case fnBoolean:
+		return path.IterUntil(root, done).Next(), true
+	case fnNot:
+		return !path.IterUntil(root, done).Next(), true
+	case fnCount:
+		count := 0
+		for iter := path.IterUntil(root, done); iter.Next(); {
+			count++
+		}
+		return count, true
+	case fnNumber:
+		s, ok := firstString(path, root, done)
+		if !ok {
+			return nil, false
+		}
+		// XPath would yield NaN for non-numbers, which JSON cannot represent, so the entry is omitted
+		s = strings.TrimSpace(s)
+		if !xpathNumber.MatchString(s) {
+			return nil, false
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil
+	default: // fnString
+		return firstString(path, root, done)
+	}
+}
+
+// firstString is path.String, stopping early once done is closed.
+func firstString(path *xmlpath.Path, root *xmlpath.Node, done <-chan struct{}) (string, bool) {
+	iter := path.IterUntil(root, done)
+	if iter.Next() {
+		return iter.Node().String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProcessInput_TypedResults(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"xpaths": [
+			"boolean(//div[@id='paywall'])",
+			"not(//div[@id='paywall'])",
+			"count(//li)",
+			"count(//table)",
+			"number(//span[@class='price'])",
+			"number(//h1)",
+			"string(//h1)",
+			{"xpath": "count(//li)", "name": "bad", "return": "outerHTML"}
+		],
+		"urls": {
+			"http://shop.com": {
+				"content": "<html><body><h1>Sale</h1><span class=\"price\"> 12.50 </span><ul><li>a</li><li>b</li></ul></body></html>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"boolean(//div[@id='paywall'])":  {"http://shop.com": false},
+		"not(//div[@id='paywall'])":      {"http://shop.com": true},
+		"count(//li)":                    {"http://shop.com": 2},
+		"count(//table)":                 {"http://shop.com": 0},
+		"number(//span[@class='price'])": {"http://shop.com": 12.5},
+		"number(//h1)":                   {},
+		"string(//h1)":                   {"http://shop.com": "Sale"},
+		"bad":                            {},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		expectedJson, _ := json.MarshalIndent(expectedOutput, "", "  ")
+		actualJson, _ := json.MarshalIndent(actualOutput, "", "  ")
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// --- History Store ---
+
+// The history store is a bbolt database with one bucket per (URL, output key) pair under
+// historyBucket. Each run adds an entry keyed by its timestamp (big-endian Unix nanoseconds,
+// so keys sort chronologically) holding the JSON-encoded value, or null if the expression
+// produced nothing for the URL in that run.
+
+// historyBucket is the top-level bucket holding the per-series buckets.
+var historyBucket = []byte("values")
+
+// historySeparator joins URL and output key in series bucket names; it cannot occur in a URL.
+const historySeparator = "\x00"
+
+// historyEntry is one recorded value.
+type historyEntry struct {
+	Time  time.Time       `json:"time"`
+	URL   string          `json:"url"`
+	XPath string          `json:"xpath"`
+	Value json.RawMessage `json:"value"` // null when the expression matched nothing
+}
+
+// openHistory opens the store at path, creating it unless readOnly is set.
+func openHistory(path string, readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 10 * time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("opening history %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// recordHistory appends the results of a run at time at to the store at path. Every
+// expression is recorded for every input URL, so a value that stops matching shows up.
+func recordHistory(path string, input *InputJson, output OutputJson, at time.Time) error {
+	db, err := openHistory(path, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	stamp := make([]byte, 8)
+	binary.BigEndian.PutUint64(stamp, uint64(at.UnixNano()))
+	return db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(historyBucket)
+		if err != nil {
+			return err
+		}
+		for _, key := range historyKeys(output) {
+			for pageURL := range input.Urls {
+				series, err := root.CreateBucketIfNotExists([]byte(pageURL + historySeparator + key))
+				if err != nil {
+					return err
+				}
+				value := []byte("null")
+				if v, found := output[key][pageURL]; found {
+					if value, err = json.Marshal(v); err != nil {
+						return err
+					}
+				}
+				if err := series.Put(stamp, value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// historyKeys returns the result keys of a run: expressions, presets and keys added by
+// a script, but no report sections.
+func historyKeys(output OutputJson) []string {
+	var keys []string
+	for key := range output {
+		if !strings.HasPrefix(key, "$") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// queryHistory returns the entries matching the filters (empty matches all), ordered by
+// URL, key and time. With changesOnly, entries repeating the previous value of their
+// series are left out.
+func queryHistory(db *bolt.DB, pageURL, key string, changesOnly bool) ([]historyEntry, error) {
+	entries := []historyEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(historyBucket)
+		if root == nil {
+			return nil
+		}
+		return root.ForEachBucket(func(name []byte) error {
+			u, k, ok := strings.Cut(string(name), historySeparator)
+			if !ok || pageURL != "" && u != pageURL || key != "" && k != key {
+				return nil
+			}
+			var previous []byte
+			return root.Bucket(name).ForEach(func(stamp, value []byte) error {
+				if changesOnly && previous != nil && string(previous) == string(value) {
+					return nil
+				}
+				previous = append([]byte(nil), value...)
+				entries = append(entries, historyEntry{
+					Time:  time.Unix(0, int64(binary.BigEndian.Uint64(stamp))).UTC(),
+					URL:   u,
+					XPath: k,
+					Value: json.RawMessage(previous),
+				})
+				return nil
+			})
+		})
+	})
+	return entries, err
+}
+
+// latestHistory returns the most recent value of every series in the store at path, in
+// the shape of an output; values recorded as null are left out.
+func latestHistory(path string) (OutputJson, error) {
+	db, err := openHistory(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	output := make(OutputJson)
+	err = db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(historyBucket)
+		if root == nil {
+			return nil
+		}
+		return root.ForEachBucket(func(name []byte) error {
+			u, k, ok := strings.Cut(string(name), historySeparator)
+			if !ok {
+				return nil
+			}
+			_, value := root.Bucket(name).Cursor().Last()
+			if value == nil || string(value) == "null" {
+				return nil
+			}
+			var v interface{}
+			if err := json.Unmarshal(value, &v); err != nil {
+				return err
+			}
+			if output[k] == nil {
+				output[k] = make(map[string]interface{})
+			}
+			output[k][u] = v
+			return nil
+		})
+	})
+	return output, err
+}
+
+const historyUsage = `Usage: goatpaver history [-url URL] [-xpath KEY] [-changes] [-json] DB
+
+Lists the values recorded in the history store DB (see the "history" input option), by
+URL and output key, oldest first.
+`
+
+// runHistory implements "goatpaver history".
+func runHistory(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), historyUsage) }
+	pageURL := flags.String("url", "", "only show values of this URL")
+	key := flags.String("xpath", "", "only show values of this output key")
+	changesOnly := flags.Bool("changes", false, "only show entries where the value changed")
+	asJSON := flags.Bool("json", false, "print the entries as a JSON array")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("history needs a database file")
+	}
+	db, err := openHistory(flags.Arg(0), true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	entries, err := queryHistory(db, *pageURL, *key, *changesOnly)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	}
+	for _, e := range entries {
+		fmt.Fprintf(stdout, "%s %s %s %s\n", e.Time.Format(time.RFC3339), e.URL, e.XPath, e.Value)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	run := func(content string, at time.Time) {
+		t.Helper()
+		input, err := parseInput([]byte(`{"xpaths": [{"xpath": "//span", "name": "price"}], "urls": {"http://shop.com": {"content": ` + content + `}}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := process(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := recordHistory(path, input, output, at); err != nil {
+			t.Fatalf("recordHistory returned an unexpected error: %v", err)
+		}
+	}
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	run(`"<p><span>10</span></p>"`, day)
+	run(`"<p><span>10</span></p>"`, day.AddDate(0, 0, 1))
+	run(`"<p><span>12</span></p>"`, day.AddDate(0, 0, 2))
+	run(`"<p>sold out</p>"`, day.AddDate(0, 0, 3))
+
+	var out bytes.Buffer
+	if err := runHistory([]string{"-xpath", "price", path}, &out); err != nil {
+		t.Fatalf("runHistory returned an unexpected error: %v", err)
+	}
+	expected := "2024-03-01T12:00:00Z http://shop.com price \"10\"\n" +
+		"2024-03-02T12:00:00Z http://shop.com price \"10\"\n" +
+		"2024-03-03T12:00:00Z http://shop.com price \"12\"\n" +
+		"2024-03-04T12:00:00Z http://shop.com price null\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected history.\nExpected:\n%s\nGot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	if err := runHistory([]string{"-changes", "-url", "http://shop.com", path}, &out); err != nil {
+		t.Fatalf("runHistory -changes returned an unexpected error: %v", err)
+	}
+	expected = "2024-03-01T12:00:00Z http://shop.com price \"10\"\n" +
+		"2024-03-03T12:00:00Z http://shop.com price \"12\"\n" +
+		"2024-03-04T12:00:00Z http://shop.com price null\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected changes.\nExpected:\n%s\nGot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	if err := runHistory([]string{"-url", "http://other.com", path}, &out); err != nil || out.Len() != 0 {
+		t.Errorf("runHistory for an unknown URL = %q, %v; want no entries", out.String(), err)
+	}
+	if err := runHistory([]string{filepath.Join(t.TempDir(), "missing.db")}, &out); err == nil {
+		t.Errorf("Expected an error for a missing database, but got nil")
+	}
+}
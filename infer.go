@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/user/go_goat/internal/xmlpath"
+)
+
+// --- infer Subcommand ---
+
+// inferUsage is printed for -h and argument errors.
+const inferUsage = `Usage: goatpaver infer [-max N] DOCUMENT VALUE...
+
+Prints candidate xpaths selecting each example VALUE in DOCUMENT ("-" reads stdin), most
+specific first, plus the candidates selecting all values at once for use with "mode": "all".
+`
+
+// inferCandidate is one proposed xpath. Matches is how many nodes it selects in the
+// document; fewer means more specific.
+type inferCandidate struct {
+	XPath   string `json:"xpath"`
+	Matches int    `json:"matches"`
+}
+
+// inferResult is the output of the infer subcommand.
+type inferResult struct {
+	Values map[string][]inferCandidate `json:"values"` // Candidates whose first match is the value
+	Common []inferCandidate            `json:"common"` // Candidates matching every value
+}
+
+// runInfer implements "goatpaver infer".
+func runInfer(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("infer", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), inferUsage) }
+	limit := flags.Int("max", 10, "maximum number of candidates per value")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errors.New("infer needs a document and at least one example value")
+	}
+
+	var r io.Reader = stdin
+	if name := flags.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	root, err := decode(r, &InputJson{}, flags.Arg(0), pageSource{})
+	if err != nil {
+		return fmt.Errorf("parsing document: %w", err)
+	}
+
+	result := inferPaths(root, flags.Args()[1:], *limit)
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, string(data))
+	return err
+}
+
+// inferPaths proposes xpaths for the example values. Values are compared with whitespace
+// collapsed, against the string value of elements and attributes.
+func inferPaths(root *xmlpath.Node, values []string, limit int) inferResult {
+	result := inferResult{Values: make(map[string][]inferCandidate), Common: []inferCandidate{}}
+	wanted := make(map[string]bool)
+	all := make(map[string]bool) // Every candidate, for the common check
+	for _, value := range values {
+		value = collapseSpace(value)
+		wanted[value] = true
+		candidates := []inferCandidate{}
+		seen := make(map[string]bool)
+		for _, node := range findValueNodes(root, value) {
+			for _, xpath := range candidatePaths(node) {
+				if seen[xpath] {
+					continue
+				}
+				seen[xpath] = true
+				all[xpath] = true
+				matches, first := evaluateCandidate(xpath, root)
+				if first == value {
+					candidates = append(candidates, inferCandidate{XPath: xpath, Matches: len(matches)})
+				}
+			}
+		}
+		sortCandidates(candidates, 0)
+		result.Values[value] = truncateCandidates(candidates, limit)
+	}
+
+	if len(wanted) > 1 {
+		for xpath := range all {
+			matches, _ := evaluateCandidate(xpath, root)
+			found := make(map[string]bool)
+			for _, m := range matches {
+				if wanted[m] {
+					found[m] = true
+				}
+			}
+			if len(found) == len(wanted) {
+				result.Common = append(result.Common, inferCandidate{XPath: xpath, Matches: len(matches)})
+			}
+		}
+		sortCandidates(result.Common, len(wanted))
+		result.Common = truncateCandidates(result.Common, limit)
+	}
+	return result
+}
+
+// sortCandidates ranks candidates by how close their match count is to ideal, then by
+// length, so that the tightest and simplest selectors come first.
+func sortCandidates(candidates []inferCandidate, ideal int) {
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Matches != b.Matches {
+			return abs(a.Matches-ideal) < abs(b.Matches-ideal)
+		}
+		if len(a.XPath) != len(b.XPath) {
+			return len(a.XPath) < len(b.XPath)
+		}
+		return a.XPath < b.XPath
+	})
+}
+
+func truncateCandidates(candidates []inferCandidate, limit int) []inferCandidate {
+	if limit > 0 && len(candidates) > limit {
+		return candidates[:limit]
+	}
+	return candidates
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// findValueNodes returns the innermost elements and the attributes whose value is value.
+func findValueNodes(root *xmlpath.Node, value string) []*xmlpath.Node {
+	var found []*xmlpath.Node
+	var walk func(*xmlpath.Node) bool
+	walk = func(n *xmlpath.Node) bool {
+		inner := false
+		for _, child := range n.Children() {
+			if child.Kind() == xmlpath.ElementNode && walk(child) {
+				inner = true
+			}
+		}
+		for _, attr := range n.Attrs() {
+			if collapseSpace(attr.String()) == value {
+				found = append(found, attr)
+			}
+		}
+		if !inner && n.Parent() != nil && collapseSpace(n.String()) == value {
+			found = append(found, n)
+			return true
+		}
+		return inner
+	}
+	walk(root)
+	return found
+}
+
+// candidatePaths returns selectors for node of decreasing specificity: anchored at an id,
+// positional from the root, by class, by parent and name, and by name alone.
+func candidatePaths(node *xmlpath.Node) []string {
+	suffix := ""
+	if node.Kind() == xmlpath.AttrNode {
+		suffix = "/@" + node.Name().Local
+		node = node.Parent()
+	}
+	name := node.Name().Local
+	var paths []string
+	_, located := locate(node)
+	paths = append(paths, located+suffix, positionalPath(node)+suffix)
+	class, hasClass := attrValue(node, "class")
+	hasClass = hasClass && class != "" && !strings.Contains(class, "'")
+	if hasClass {
+		paths = append(paths, "//"+name+"[@class='"+class+"']"+suffix)
+	}
+	if parent := node.Parent(); parent != nil && parent.Parent() != nil {
+		paths = append(paths, "//"+parent.Name().Local+"/"+name+suffix)
+	}
+	return append(paths, "//"+name+suffix)
+}
+
+// positionalPath returns the absolute path to n, with positions where siblings share a name.
+func positionalPath(n *xmlpath.Node) string {
+	var parts []string
+	for ; n.Parent() != nil; n = n.Parent() {
+		name := n.Name().Local
+		position, count := 0, 0
+		for _, sibling := range n.Parent().Children() {
+			if sibling.Kind() == xmlpath.ElementNode && sibling.Name().Local == name {
+				count++
+				if sibling == n {
+					position = count
+				}
+			}
+		}
+		if count > 1 {
+			name += "[" + strconv.Itoa(position) + "]"
+		}
+		parts = append(parts, name)
+	}
+	return "/" + joinReversed(parts)
+}
+
+// evaluateCandidate returns the collapsed string values of every match of xpath, and
+// that of the first match.
+func evaluateCandidate(xpath string, root *xmlpath.Node) ([]string, string) {
+	path, err := xmlpath.Compile(xpath)
+	if err != nil {
+		return nil, ""
+	}
+	var matches []string
+	for iter := path.Iter(root); iter.Next(); {
+		matches = append(matches, collapseSpace(iter.Node().String()))
+	}
+	if len(matches) == 0 {
+		return nil, ""
+	}
+	return matches, matches[0]
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const inferDocument = `<html><body>
+<div id="main"><h1>Blue Widget</h1>
+<ul class="products">
+<li><span class="name">Red Widget</span><span class="price">12.00</span></li>
+<li><span class="name">Green Widget</span><span class="price">15.00</span></li>
+</ul>
+<a href="/cart">Cart</a></div>
+</body></html>`
+
+func TestRunInfer(t *testing.T) {
+	var out bytes.Buffer
+	err := runInfer([]string{"-max", "3", "-", "Blue Widget", "/cart"}, strings.NewReader(inferDocument), &out)
+	if err != nil {
+		t.Fatalf("runInfer returned an unexpected error: %v", err)
+	}
+	var result inferResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("runInfer printed invalid JSON: %v\n%s", err, out.String())
+	}
+
+	expected := map[string][]inferCandidate{
+		"Blue Widget": {
+			{XPath: "//h1", Matches: 1},
+			{XPath: "//div/h1", Matches: 1},
+			{XPath: "/html/body/div/h1", Matches: 1},
+		},
+		"/cart": {
+			{XPath: "//a/@href", Matches: 1},
+			{XPath: "//div/a/@href", Matches: 1},
+			{XPath: "/html/body/div/a/@href", Matches: 1},
+		},
+	}
+	if !reflect.DeepEqual(expected, result.Values) {
+		t.Errorf("Unexpected candidates.\nExpected: %+v\nGot:      %+v", expected, result.Values)
+	}
+}
+
+func TestInferPaths_Common(t *testing.T) {
+	root, err := decode(strings.NewReader(inferDocument), &InputJson{}, "", pageSource{})
+	if err != nil {
+		t.Fatalf("decode returned an unexpected error: %v", err)
+	}
+	result := inferPaths(root, []string{"Red Widget", " Green  Widget "}, 2)
+
+	expectedRed := []inferCandidate{
+		{XPath: "/html/body/div/ul/li[1]/span[1]", Matches: 1},
+		{XPath: "//span[@class='name']", Matches: 2},
+	}
+	if !reflect.DeepEqual(expectedRed, result.Values["Red Widget"]) {
+		t.Errorf("Unexpected candidates for the first value.\nExpected: %+v\nGot:      %+v", expectedRed, result.Values["Red Widget"])
+	}
+	// Green Widget is never the first match of a generic path, so only positions select it
+	expectedGreen := []inferCandidate{{XPath: "/html/body/div/ul/li[2]/span[1]", Matches: 1}}
+	if !reflect.DeepEqual(expectedGreen, result.Values["Green Widget"]) {
+		t.Errorf("Unexpected candidates for the second value.\nExpected: %+v\nGot:      %+v", expectedGreen, result.Values["Green Widget"])
+	}
+	expectedCommon := []inferCandidate{
+		{XPath: "//span[@class='name']", Matches: 2},
+		{XPath: "//div[@id='main']/ul[@class='products']/li/span[@class='name']", Matches: 2},
+	}
+	if !reflect.DeepEqual(expectedCommon, result.Common) {
+		t.Errorf("Unexpected common candidates.\nExpected: %+v\nGot:      %+v", expectedCommon, result.Common)
+	}
+}
+
+func TestRunInfer_Usage(t *testing.T) {
+	var out bytes.Buffer
+	if err := runInfer([]string{"-"}, strings.NewReader(inferDocument), &out); err == nil {
+		t.Errorf("Expected an error without example values, but got nil")
+	}
+}
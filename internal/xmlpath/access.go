@@ -0,0 +1,50 @@
+package xmlpath
+
+import (
+	"encoding/xml"
+)
+
+// Kind identifies the type of a Node.
+type Kind int
+
+const (
+	ElementNode  = Kind(startNode)
+	AttrNode     = Kind(attrNode)
+	TextNode     = Kind(textNode)
+	CommentNode  = Kind(commentNode)
+	ProcInstNode = Kind(procInstNode)
+)
+
+// Kind returns the type of node. The document root is an ElementNode with an empty name.
+func (node *Node) Kind() Kind {
+	return Kind(node.kind)
+}
+
+// Name returns the name of an element or attribute node, or the target of a
+// processing instruction. The Space field holds the namespace URI, not the prefix.
+func (node *Node) Name() xml.Name {
+	return node.name
+}
+
+// Parent returns the element containing node, or nil for the document root.
+func (node *Node) Parent() *Node {
+	return node.up
+}
+
+// Children returns the element, text, comment and processing instruction
+// nodes directly below node, in document order. Attributes are not included.
+func (node *Node) Children() []*Node {
+	return node.down
+}
+
+// Attrs returns the attribute nodes of an element node, in document order.
+func (node *Node) Attrs() []*Node {
+	if node.kind != startNode {
+		return nil
+	}
+	var attrs []*Node
+	for i := node.pos + 1; i < node.end && node.nodes[i].kind == attrNode; i++ {
+		attrs = append(attrs, &node.nodes[i])
+	}
+	return attrs
+}
@@ -0,0 +1,75 @@
+package xmlpath_test
+
+import (
+	"bytes"
+
+	"github.com/user/go_goat/internal/xmlpath"
+	. "launchpad.net/gocheck"
+)
+
+var nsXml = []byte(`<feed xmlns="http://www.w3.org/2005/Atom" xmlns:m="urn:media" xmlns:o="urn:other">
+<entry><title>A</title><m:thumb url="a.png"/><o:thumb url="x.png"/></entry>
+<entry m:rank="2"><title>B</title></entry>
+</feed>`)
+
+var nsOptions = xmlpath.Options{Namespaces: map[string]string{
+	"a": "http://www.w3.org/2005/Atom",
+	"m": "urn:media",
+}}
+
+var namespaceTable = []struct{ path, result string }{
+	{"//a:entry/a:title", "A"},
+	{"//entry/title", "A"},
+	{"//a:entry/m:thumb/@url", "a.png"},
+	{"//a:entry/*/@url", "a.png"},
+	{"//a:entry[@m:rank='2']/a:title", "B"},
+	{"//child::m:*/@url", "a.png"},
+	{"//m:title", ""},
+}
+
+func (s *BasicSuite) TestNamespaces(c *C) {
+	node, err := xmlpath.Parse(bytes.NewBuffer(nsXml))
+	c.Assert(err, IsNil)
+	for _, test := range namespaceTable {
+		path, err := xmlpath.CompileOptions(test.path, nsOptions)
+		c.Assert(err, IsNil, Commentf("path: %s", test.path))
+		result, ok := path.String(node)
+		c.Assert(ok, Equals, test.result != "", Commentf("path: %s", test.path))
+		c.Assert(result, Equals, test.result, Commentf("path: %s", test.path))
+	}
+}
+
+func (s *BasicSuite) TestUnknownPrefix(c *C) {
+	_, err := xmlpath.Compile("//a:entry")
+	c.Assert(err, ErrorMatches, `.*unknown namespace prefix: "a"`)
+	_, err = xmlpath.CompileOptions("//a:entry/o:thumb", nsOptions)
+	c.Assert(err, ErrorMatches, `.*unknown namespace prefix: "o"`)
+	_, err = xmlpath.CompileOptions("//m:text()", nsOptions)
+	c.Assert(err, ErrorMatches, `.*cannot have a namespace prefix`)
+}
+
+func (s *BasicSuite) TestNodeAccessors(c *C) {
+	node, err := xmlpath.Parse(bytes.NewBuffer(nsXml))
+	c.Assert(err, IsNil)
+	iter := xmlpath.MustCompile("//thumb").Iter(node)
+	c.Assert(iter.Next(), Equals, true)
+	thumb := iter.Node()
+	c.Assert(thumb.Kind(), Equals, xmlpath.ElementNode)
+	c.Assert(thumb.Name().Space, Equals, "urn:media")
+	c.Assert(thumb.Parent().Name().Local, Equals, "entry")
+	attrs := thumb.Attrs()
+	c.Assert(len(attrs), Equals, 1)
+	c.Assert(attrs[0].Kind(), Equals, xmlpath.AttrNode)
+	c.Assert(attrs[0].String(), Equals, "a.png")
+	c.Assert(len(thumb.Parent().Children()), Equals, 3)
+}
+
+func (s *BasicSuite) TestIgnorePrefixes(c *C) {
+	node, err := xmlpath.Parse(bytes.NewBuffer(nsXml))
+	c.Assert(err, IsNil)
+	path, err := xmlpath.CompileOptions("//atom:entry/o:thumb/@url", xmlpath.Options{IgnorePrefixes: true})
+	c.Assert(err, IsNil)
+	result, ok := path.String(node)
+	c.Assert(ok, Equals, true)
+	c.Assert(result, Equals, "a.png")
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/segmentio/kafka-go"
+)
+
+// --- Kafka Sink ---
+
+// Avro schemas of the Kafka messages. Values are JSON-encoded, as in the SQL sinks.
+const (
+	kafkaPageSchema = `{"type": "record", "name": "GoatpaverPage", "fields": [
+		{"name": "url", "type": "string"},
+		{"name": "run_id", "type": "string"},
+		{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+		{"name": "fields", "type": {"type": "map", "values": "string"}}
+	]}`
+	kafkaRecordSchema = `{"type": "record", "name": "GoatpaverRecord", "fields": [
+		{"name": "url", "type": "string"},
+		{"name": "xpath", "type": "string"},
+		{"name": "value", "type": ["null", "string"]},
+		{"name": "matched", "type": "boolean"},
+		{"name": "run_id", "type": "string"},
+		{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-micros"}}
+	]}`
+)
+
+// kafkaSink produces one message per URL, or per record with ?per=record, to a topic:
+// kafka://broker:9092/TOPIC, with more brokers in ?brokers=b2:9092,b3:9092. Messages are
+// keyed by page URL, so a page's results stay in one partition, and encoded as JSON (the
+// per-URL document or a flat record) or, with ?format=avro, as plain Avro binary in the
+// schemas above.
+type kafkaSink struct {
+	writer    *kafka.Writer
+	perRecord bool
+	codec     *goavro.Codec // Avro encoder, or nil for JSON
+}
+
+func openKafkaSink(target *url.URL) (sink, error) {
+	topic := strings.Trim(target.Path, "/")
+	if target.Host == "" || topic == "" {
+		return nil, fmt.Errorf("kafka output needs a broker and a topic, e.g. kafka://localhost:9092/results")
+	}
+	brokers := []string{target.Host}
+	query := target.Query()
+	if more := query.Get("brokers"); more != "" {
+		brokers = append(brokers, strings.Split(more, ",")...)
+	}
+	s := &kafkaSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		WriteTimeout: time.Minute,
+	}}
+	switch per := query.Get("per"); per {
+	case "", "url":
+	case "record":
+		s.perRecord = true
+	default:
+		return nil, fmt.Errorf("unknown kafka per=%q (want url or record)", per)
+	}
+	switch format := query.Get("format"); format {
+	case "", "json":
+	case "avro":
+		schema := kafkaPageSchema
+		if s.perRecord {
+			schema = kafkaRecordSchema
+		}
+		codec, err := goavro.NewCodec(schema)
+		if err != nil {
+			return nil, err
+		}
+		s.codec = codec
+	default:
+		return nil, fmt.Errorf("unknown kafka format=%q (want json or avro)", format)
+	}
+	return s, nil
+}
+
+func (s *kafkaSink) write(run sinkRun) error {
+	messages, err := s.messages(run)
+	if err != nil {
+		return err
+	}
+	return s.writer.WriteMessages(context.Background(), messages...)
+}
+
+// messages encodes run as Kafka messages.
+func (s *kafkaSink) messages(run sinkRun) ([]kafka.Message, error) {
+	var messages []kafka.Message
+	add := func(key string, native map[string]interface{}, document interface{}) error {
+		var value []byte
+		var err error
+		if s.codec != nil {
+			value, err = s.codec.BinaryFromNative(nil, native)
+		} else {
+			value, err = json.Marshal(document)
+		}
+		if err != nil {
+			return err
+		}
+		messages = append(messages, kafka.Message{Key: []byte(key), Value: value})
+		return nil
+	}
+
+	at := run.Time.UTC()
+	if s.perRecord {
+		for _, r := range run.Records {
+			value, err := recordValue(r)
+			if err != nil {
+				return nil, err
+			}
+			native := map[string]interface{}{
+				"url": r.URL, "xpath": r.XPath, "value": nil, "matched": r.Matched, "run_id": run.ID, "timestamp": at,
+			}
+			if text, ok := value.(string); ok {
+				native["value"] = goavro.Union("string", text)
+			}
+			document := map[string]interface{}{
+				"url": r.URL, "xpath": r.XPath, "value": r.Value, "matched": r.Matched, "run_id": run.ID, "timestamp": at,
+			}
+			if err := add(r.URL, native, document); err != nil {
+				return nil, err
+			}
+		}
+		return messages, nil
+	}
+	for _, doc := range run.documents() {
+		fields := make(map[string]interface{}, len(doc.Fields))
+		for key, v := range doc.Fields {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = string(data)
+		}
+		native := map[string]interface{}{"url": doc.URL, "run_id": doc.RunID, "timestamp": doc.Timestamp, "fields": fields}
+		if err := add(doc.URL, native, doc); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
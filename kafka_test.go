@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+func TestKafkaMessages(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	run := sinkRun{ID: "r1", Time: at, Records: []record{
+		{URL: "http://a.com", XPath: "//h1", Value: "A", Matched: true},
+		{URL: "http://a.com", XPath: "price"},
+		{URL: "http://b.com", XPath: "//h1", Value: "B", Matched: true},
+	}}
+	open := func(target string) *kafkaSink {
+		u, err := url.Parse(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := openKafkaSink(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.(*kafkaSink)
+	}
+
+	// One JSON document per URL
+	messages, err := open("kafka://localhost:9092/results").messages(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || string(messages[0].Key) != "http://a.com" {
+		t.Fatalf("Unexpected messages %v", messages)
+	}
+	expected := `{"url":"http://a.com","run_id":"r1","timestamp":"2024-03-01T12:00:00Z","fields":{"//h1":"A"}}`
+	if string(messages[0].Value) != expected {
+		t.Errorf("Unexpected message.\nExpected: %s\nGot:      %s", expected, messages[0].Value)
+	}
+
+	// One JSON record per value
+	messages, err = open("kafka://localhost:9092/results?per=record").messages(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var second map[string]interface{}
+	if len(messages) != 3 || json.Unmarshal(messages[1].Value, &second) != nil || second["xpath"] != "price" || second["matched"] != false {
+		t.Errorf("Unexpected record messages %v", messages)
+	}
+
+	// Avro records decode with the published schema
+	s := open("kafka://localhost:9092/results?per=record&format=avro&brokers=b2:9092")
+	if messages, err = s.messages(run); err != nil {
+		t.Fatal(err)
+	}
+	codec, err := goavro.NewCodec(kafkaRecordSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	native, _, err := codec.NativeFromBinary(messages[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := native.(map[string]interface{})
+	if decoded["value"].(map[string]interface{})["string"] != `"A"` || !decoded["timestamp"].(time.Time).Equal(at) {
+		t.Errorf("Unexpected Avro record %v", decoded)
+	}
+	if native, _, err = codec.NativeFromBinary(messages[1].Value); err != nil || native.(map[string]interface{})["value"] != nil {
+		t.Errorf("Unexpected Avro record %v, %v", native, err)
+	}
+
+	// Avro pages carry JSON-encoded fields
+	if messages, err = open("kafka://localhost:9092/results?format=avro").messages(run); err != nil {
+		t.Fatal(err)
+	}
+	if codec, err = goavro.NewCodec(kafkaPageSchema); err != nil {
+		t.Fatal(err)
+	}
+	native, _, err = codec.NativeFromBinary(messages[1].Value)
+	if err != nil || native.(map[string]interface{})["fields"].(map[string]interface{})["//h1"] != `"B"` {
+		t.Errorf("Unexpected Avro page %v, %v", native, err)
+	}
+}
+
+func TestKafkaTargets(t *testing.T) {
+	for _, target := range []string{"kafka://localhost:9092", "kafka:///results", "kafka://localhost/results?per=page", "kafka://localhost/results?format=xml"} {
+		u, _ := url.Parse(target)
+		if _, err := openKafkaSink(u); err == nil {
+			t.Errorf("Expected an error for %s", target)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// --- Language Detection ---
+
+// languageInfo is the result of the language preset: the ISO 639-1 code detected from the
+// document's text, and the language the document declares in <html lang> (or a
+// Content-Language meta tag), which is often missing or wrong.
+type languageInfo struct {
+	Code     string `json:"code,omitempty"`
+	Declared string `json:"declared,omitempty"`
+}
+
+// minStopwordHits is the fewest stopwords a Latin-script text needs for a verdict;
+// shorter or stopword-free texts are reported as undetected rather than guessed.
+const minStopwordHits = 2
+
+// stopwords lists very frequent function words per language. Words shared between
+// languages count for each of them; the distinctive ones decide.
+var stopwords = map[string]map[string]bool{
+	"en": wordSet("the and of to in is that it for was on with as are be this by not or have from at which but they you we his her"),
+	"de": wordSet("der die das und ist nicht ein eine zu den von mit sich des auf für im dem auch es an werden aus er hat dass sie nach wird bei"),
+	"fr": wordSet("le la les et des est un une du en que qui dans pour pas sur au avec ce il elle sont ne se plus par être"),
+	"es": wordSet("el la los las y de que en un una es por con para no se del al lo como más pero sus le ya está"),
+	"it": wordSet("il lo la gli le di che e è un una per non con del della si sono da al nel anche come più ma"),
+	"pt": wordSet("o a os as e de que do da em um uma é para com não no na por mais dos das se ao como mas foi"),
+	"nl": wordSet("de het een en van is dat in op te zijn niet met voor er die ook aan als bij door maar wordt"),
+	"sv": wordSet("och att det som en på är av för med till den har de inte om ett var jag men så från"),
+	"pl": wordSet("i w na z się nie do jest to że o jak ale po co tak za od są przez dla jego"),
+}
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// detectLanguage returns the ISO 639-1 code of the language text is most likely written
+// in, or "" if it cannot tell. Non-Latin scripts are identified by their characters alone;
+// Latin-script languages by stopword frequency.
+func detectLanguage(text string) string {
+	counts := make(map[string]int)
+	latin := 0
+	total := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		total++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			counts["ja"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Han, r):
+			counts["zh"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["ru"]++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				counts["uk"]++
+			}
+		case unicode.Is(unicode.Greek, r):
+			counts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts["he"]++
+		case unicode.Is(unicode.Thai, r):
+			counts["th"]++
+		case unicode.Is(unicode.Devanagari, r):
+			counts["hi"]++
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	if latin*2 < total {
+		// Japanese mixes kana with Han, so any kana marks it; Ukrainian has letters Russian lacks
+		if counts["ja"] > 0 {
+			return "ja"
+		}
+		if counts["uk"] > 0 {
+			return "uk"
+		}
+		best := ""
+		for code, n := range counts {
+			if code != "uk" && (best == "" || n > counts[best] || n == counts[best] && code < best) {
+				best = code
+			}
+		}
+		return best
+	}
+
+	hits := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for code, set := range stopwords {
+			if set[word] {
+				hits[code]++
+			}
+		}
+	}
+	best := ""
+	for code, n := range hits {
+		if best == "" || n > hits[best] || n == hits[best] && code < best {
+			best = code
+		}
+	}
+	if hits[best] < minStopwordHits {
+		return ""
+	}
+	return best
+}
+
+// newLanguageStep returns a transform step replacing text with its language code.
+func newLanguageStep() transformStep {
+	return func(s string) (interface{}, bool) {
+		code := detectLanguage(s)
+		return code, code != ""
+	}
+}
+
+// extractLanguage detects the language of doc's visible text, for routing documents.
+func extractLanguage(doc *html.Node, _ *url.URL) interface{} {
+	var info languageInfo
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		case html.ElementNode:
+			switch n.Data {
+			case "script", "style", "noscript", "template":
+				return
+			case "html":
+				if lang, ok := getAttr(n, "lang"); ok && info.Declared == "" {
+					info.Declared = strings.TrimSpace(lang)
+				}
+			case "meta":
+				equiv, _ := getAttr(n, "http-equiv")
+				if content, ok := getAttr(n, "content"); ok && strings.EqualFold(equiv, "content-language") && info.Declared == "" {
+					info.Declared = strings.TrimSpace(content)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	info.Code = detectLanguage(sb.String())
+	if info.Code == "" && info.Declared == "" {
+		return nil
+	}
+	return &info
+}
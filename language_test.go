@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	cases := map[string]string{
+		"The quick brown fox jumps over the lazy dog and it is not amused by this.":      "en",
+		"Der schnelle braune Fuchs springt über den faulen Hund, und das ist nicht gut.": "de",
+		"Le renard brun saute par-dessus le chien paresseux et il ne dit rien.":          "fr",
+		"El zorro marrón salta sobre el perro perezoso y no se mueve para nada.":         "es",
+		"De snelle bruine vos springt over de luie hond en het is niet leuk.":            "nl",
+		"Быстрая коричневая лиса прыгает через ленивую собаку.":                          "ru",
+		"Швидка руда лисиця перестрибує через лінивого пса.":                             "uk",
+		"素早い茶色の狐がのろまな犬を飛び越える":                                                            "ja",
+		"빠른 갈색 여우가 게으른 개를 뛰어넘는다":                                                         "ko",
+		"敏捷的棕色狐狸跳过了懒狗":                                                                   "zh",
+		"Η γρήγορη καφέ αλεπού πηδά πάνω από το τεμπέλικο σκυλί":                         "el",
+		"Goatpaver 2.0": "",
+		"12.50 €":       "",
+	}
+	for text, expected := range cases {
+		if actual := detectLanguage(text); actual != expected {
+			t.Errorf("detectLanguage(%q) = %q, want %q", text, actual, expected)
+		}
+	}
+}
+
+func TestProcessInput_Language(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"presets": ["language"],
+		"xpaths": [{"xpath": "//p", "name": "lang", "transforms": ["language"]}],
+		"urls": {
+			"http://news.de": {
+				"content": "<html lang=\"en\"><head><script>var the = 1; var and = 2;</script></head><body><p>Das ist ein Artikel über die Stadt und den Fluss.</p></body></html>"
+			},
+			"http://short.com": {
+				"content": "<html><body><p>OK</p></body></html>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"preset:language": {"http://news.de": &languageInfo{Code: "de", Declared: "en"}},
+		"lang":            {"http://news.de": "de"},
+	}
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// --- Size Limits ---
+
+// sizeUnits are the suffixes of sizes given on the command line, in bytes.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// parseSize parses a size such as "200MB" or "4096", where KB, MB and GB are powers of
+// 1024. It returns 0 for "".
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	number, unit := strings.ToUpper(strings.TrimSpace(size)), int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(number, u.suffix) {
+			number, unit = strings.TrimSpace(strings.TrimSuffix(number, u.suffix)), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 500KB, 200MB or 1GB)", size)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// tooLargeError reports a document larger than -max-doc-size.
+type tooLargeError struct {
+	size  int64 // -1 if the size is unknown
+	limit int64
+}
+
+func (e *tooLargeError) Error() string {
+	if e.size < 0 {
+		return fmt.Sprintf("larger than -max-doc-size (%d bytes)", e.limit)
+	}
+	return fmt.Sprintf("%d bytes, larger than -max-doc-size (%d bytes)", e.size, e.limit)
+}
+
+// checkSize returns a *tooLargeError if size exceeds limit, unless the limit is 0.
+func checkSize(size, limit int64) error {
+	if limit > 0 && size > limit {
+		return &tooLargeError{size: size, limit: limit}
+	}
+	return nil
+}
+
+// warnTooLarge gives up on pageURL if err says its content is too large, telling whether
+// it was.
+func (input *InputJson) warnTooLarge(pageURL string, err error) bool {
+	var large *tooLargeError
+	if !errors.As(err, &large) {
+		return false
+	}
+	input.warnURL(warnSize, pageURL, true, "Content of URL '%s' is %v. Skipping this URL.", pageURL, large)
+	return true
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	for size, want := range map[string]int64{"": 0, "4096": 4096, "10B": 10, "500KB": 500 << 10, "200MB": 200 << 20, "1.5gb": 3 << 29, "2 MB": 2 << 20} {
+		if got, err := parseSize(size); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", size, got, err, want)
+		}
+	}
+	for _, size := range []string{"MB", "-1MB", "0", "ten", "5TB"} {
+		if _, err := parseSize(size); err == nil {
+			t.Errorf("Expected an error for %q", size)
+		}
+	}
+}
+
+func TestMaxDocSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush() // No Content-Length
+		}
+		w.Write([]byte("<h1>" + strings.Repeat("x", 100) + "</h1>"))
+	}))
+	defer server.Close()
+
+	input, err := parseInput([]byte(`{"xpaths": ["//h1"], "fetch": {}, "urls": {
+		"http://small.com": {"content": "<h1>ok</h1>"}, "http://big.com": {"content": "<h1>` + strings.Repeat("x", 100) + `</h1>"},
+		"` + server.URL + `/sized": {}, "` + server.URL + `/chunked": {}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.maxDocSize = 50
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output["//h1"]["http://small.com"] != "ok" || len(output["//h1"]) != 1 {
+		t.Errorf("Unexpected output %v", output["//h1"])
+	}
+	codes := map[string]string{}
+	for _, w := range input.status.log {
+		codes[w.Subject] = w.Code
+		if w.Subject == "http://big.com" && w.Message != "Content of URL 'http://big.com' is 109 bytes, larger than -max-doc-size (50 bytes). Skipping this URL." {
+			t.Errorf("Unexpected message %q", w.Message)
+		}
+	}
+	for _, pageURL := range []string{"http://big.com", server.URL + "/sized", server.URL + "/chunked"} {
+		if codes[pageURL] != warnSize || !input.status.skipped[pageURL] {
+			t.Errorf("Unexpected warning %q for %s", codes[pageURL], pageURL)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// --- Logging ---
+
+// Values for the -log-format flag.
+const (
+	logText = "text" // The messages alone, as "Warning: ..." lines
+	logJSON = "json" // One object per line with the time, level, message and attributes such as url
+)
+
+// logger reports what happens during a run on stderr; plain runs and workers replace it as
+// -log-level and -log-format say, tests to capture it.
+var logger = slog.New(&textLogHandler{w: os.Stderr, level: slog.LevelInfo, mu: new(sync.Mutex)})
+
+// logFlags adds -log-level and -log-format to flags, returning a function that makes the
+// logger they ask for once the flags are parsed.
+func logFlags(flags *flag.FlagSet) func() (*slog.Logger, error) {
+	level := flags.String("log-level", "info", "log messages of this level and up: debug, info, warn or error")
+	format := flags.String("log-format", logText, "log as text or json")
+	return func() (*slog.Logger, error) { return newLogger(os.Stderr, *level, *format) }
+}
+
+// newLogger returns a logger writing messages of level and up in format to w.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var min slog.Level
+	if err := min.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown -log-level %q (want debug, info, warn or error)", level)
+	}
+	switch format {
+	case logText:
+		return slog.New(&textLogHandler{w: w, level: min, mu: new(sync.Mutex)}), nil
+	case logJSON:
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: min})), nil
+	}
+	return nil, fmt.Errorf("unknown -log-format %q (want text or json)", format)
+}
+
+// textLogHandler writes the message of each record on a line of its own, after the level
+// ("Warning: ", "Error: ", "Debug: "; nothing for info, e.g. the output of script print
+// calls). Attributes are for the JSON format and left out, so messages carry any details
+// themselves.
+type textLogHandler struct {
+	w     io.Writer
+	level slog.Level
+	mu    *sync.Mutex // Shared by handlers of the same writer
+}
+
+func (h *textLogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textLogHandler) Handle(_ context.Context, r slog.Record) error {
+	prefix := ""
+	switch {
+	case r.Level >= slog.LevelError:
+		prefix = "Error: "
+	case r.Level >= slog.LevelWarn:
+		prefix = "Warning: "
+	case r.Level < slog.LevelInfo:
+		prefix = "Debug: "
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := fmt.Fprintf(h.w, "%s%s\n", prefix, r.Message)
+	return err
+}
+
+func (h *textLogHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *textLogHandler) WithGroup(string) slog.Handler      { return h }
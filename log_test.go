@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	defer func(saved *slog.Logger) { logger = saved }(logger)
+	input, err := parseInput([]byte(`{"xpaths": ["//h1"], "urls": {"http://a.com": {"content": "<h1>"}, "http://b.com": {"content": "<h1>B</h1>"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if logger, err = newLogger(&buf, "info", logText); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := process(input); err != nil {
+		t.Fatal(err)
+	}
+	if text := buf.String(); !strings.HasPrefix(text, "Warning: Failed to parse content for URL 'http://a.com'") || strings.Count(text, "\n") != 1 {
+		t.Errorf("Unexpected text log %q; want the warning alone", text)
+	}
+
+	buf.Reset()
+	if logger, err = newLogger(&buf, "debug", logJSON); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := process(input); err != nil {
+		t.Fatal(err)
+	}
+	levels := map[string]map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Unexpected log line %q: %v", line, err)
+		}
+		levels[entry["level"].(string)] = entry
+	}
+	if warning := levels["WARN"]; warning["url"] != "http://a.com" || warning["skipped"] != true {
+		t.Errorf("Unexpected warning %v", warning)
+	}
+	if debug := levels["DEBUG"]; debug["url"] != "http://b.com" || debug["bytes"] != 10.0 {
+		t.Errorf("Unexpected debug message %v", debug)
+	}
+
+	buf.Reset()
+	if logger, err = newLogger(&buf, "error", logText); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := process(input); err != nil || buf.Len() != 0 {
+		t.Errorf("Unexpected log %q at level error", buf.String())
+	}
+
+	for _, args := range [][2]string{{"loud", logText}, {"info", "xml"}} {
+		if _, err := newLogger(&buf, args[0], args[1]); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
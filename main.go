@@ -1,32 +1,310 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
-	"strings"
+	"sort"
+	"text/template"
+	"time"
 
-	"golang.org/x/net/html/charset" // For character encoding detection
-	"launchpad.net/xmlpath"        // The XPath library used by xpup
+	"github.com/user/go_goat/internal/xmlpath" // Vendored copy of the XPath library used by xpup
+	"golang.org/x/net/html/charset"            // For character encoding detection
 )
 
 // --- Input Structures ---
 
 type InputJson struct {
-	Xpaths []string          `json:"xpaths"`
-	Urls   map[string]UrlData `json:"urls"`
+	Xpaths  []Expression       `json:"xpaths"`
+	Presets []string           `json:"presets,omitempty"` // Built-in extractors, see presets.go
+	Urls    map[string]UrlData `json:"urls"`
+
+	Normalize *Normalization `json:"normalize,omitempty"` // Default text clean-up, see normalize.go
+	Entities  string         `json:"entities,omitempty"`  // Entity handling: html (default), strict or lenient
+
+	// Namespaces binds prefixes used in xpaths to namespace URIs, e.g. {"a": "http://www.w3.org/2005/Atom"}.
+	// Prefixed names only match in the bound namespace; unprefixed names match by local name in any namespace.
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+	// NamespaceAgnostic makes prefixed names match by local name too, ignoring namespaces entirely,
+	// so xpaths copied from namespaced tooling (//atom:entry/atom:title) work without bindings.
+	NamespaceAgnostic bool `json:"namespace_agnostic,omitempty"`
+
+	XInclude *XIncludeOptions   `json:"xinclude,omitempty"` // Expand xi:include elements before evaluation, see xinclude.go
+	XSLT     *XSLTOptions       `json:"xslt,omitempty"`     // Transform documents before evaluation, see external.go
+	Validate *ValidationOptions `json:"validate,omitempty"` // Check documents against a schema, see external.go
+	Embedded *EmbeddedOptions   `json:"embedded,omitempty"` // Parse markup found in comments and CDATA, see embedded.go
+	Fetch    *FetchOptions      `json:"fetch,omitempty"`    // Fetch URLs given without content, see fetch.go
+
+	Script *ScriptOptions  `json:"script,omitempty"` // Starlark hooks for transforms and per-URL processing, see script.go
+	script *starlarkScript // Script as loaded by parseInput
+
+	Template *TemplateOptions   `json:"template,omitempty"` // Render each URL through a text/template instead of JSON, see template.go
+	template *template.Template // Template as parsed by parseInput
+
+	compiled     map[string]compiledExpression // Expressions by output key as compiled by process, for the no-match policy
+	status       runStatus                     // What went wrong, collected by process; see status.go
+	progress     *progressBar                  // Shows process getting through the URLs, or nil; see progress.go
+	warnings     *json.Encoder                 // Writes each warning to the -warnings-file, or nil; see status.go
+	contentSums  map[string]checksum           // Checksums of the URLs' content, collected by process if not nil; see manifest.go
+	failFast     bool                          // Stop at the first URL that can't be read or parsed, see status.go
+	maxErrors    int                           // Stop once this many URLs have failed, keeping the output so far, or 0
+	strictXPaths bool                          // Fail instead of skipping expressions that don't compile
+	maxDocSize   int64                         // Bytes of content above which a URL is skipped, or 0
+	concurrency  int                           // Expressions matched against a document at once, see parallel.go
+	spill        *resultSpill                  // Where values go over the -max-memory budget, see spill.go
+	consume      bool                          // Drop each URL's content from Urls once process gets to it, see stream.go
+	checkpoint   *checkpoint                   // Records the URLs done, and those done in an earlier run; see checkpoint.go
+
+	Coverage bool `json:"coverage,omitempty"` // Add a "$coverage" section summarizing matches per expression, see coverage.go
+	Suggest  bool `json:"suggest,omitempty"`  // Add a "$suggestions" section with near-miss paths for empty results, see suggest.go
+	Metrics  bool `json:"metrics,omitempty"`  // Add a "$metrics" section with each URL's size and timings, see metrics.go
+
+	DedupeContent bool `json:"dedupe_content,omitempty"` // Evaluate identical content once, adding a "$duplicates" section; see dedupe.go
+
+	History     string         `json:"history,omitempty"`      // Append the results to this history store, see history.go
+	ChangesOnly *ChangeOptions `json:"changes_only,omitempty"` // Only output values that changed since an earlier run, see changes.go
+	Alerts      *AlertOptions  `json:"alerts,omitempty"`       // POST alerts to a webhook when rules fire, see alerts.go
+
+	// OnNoMatch says what an expression yields on a URL it matches nothing on, see nomatch.go.
+	// The -on-no-match flag overrides it.
+	OnNoMatch string `json:"on_no_match,omitempty"`
+
+	// RulesExitCode is the exit status when any expression's rules fail; default 1, 0 disables it.
+	RulesExitCode *int `json:"rules_exit_code,omitempty"`
+
+	// EvaluationTimeout bounds matching each expression on each URL, as a Go duration such
+	// as "5s"; see timeout.go.
+	EvaluationTimeout string        `json:"evaluation_timeout,omitempty"`
+	evaluationTimeout time.Duration // As parsed by parseInput, or 0
 }
 
+// UrlData is the page of one URL. One with neither content nor a file is fetched if the
+// input has "fetch" options, see fetch.go.
 type UrlData struct {
-	Content string `json:"content"`
+	Content documentContent `json:"content"`        // See content.go
+	File    string          `json:"file,omitempty"` // Read the content from this file or s3:// or gs:// object instead, see storage.go
+	// ContentEncoding is how Content encodes the document: base64 or gzip+base64, for
+	// binary or compressed documents; empty for the document's text. See content.go
+	ContentEncoding string `json:"content_encoding,omitempty"`
+}
+
+// Expression is one entry of the "xpaths" list. It is either a bare XPath string or an
+// object carrying the XPath together with per-expression options.
+type Expression struct {
+	XPath  string `json:"xpath"`
+	Name   string `json:"name,omitempty"`   // Output key; defaults to the XPath itself
+	Return string `json:"return,omitempty"` // text (default), outerHTML, innerHTML or c14n, see fragments.go
+	Mode   string `json:"mode,omitempty"`   // first (default) for the first match, all for a list of every match
+	Dedupe bool   `json:"dedupe,omitempty"` // Drop repeated values from list results, keeping first-seen order
+
+	Normalize *Normalization `json:"normalize,omitempty"` // Overrides the input-level normalization
+	Resolve   bool           `json:"resolve,omitempty"`   // Resolve the value as a link against the document URL
+
+	Sanitize *SanitizeOptions `json:"sanitize,omitempty"` // Allow-list filter for markup results, see sanitize.go
+
+	Transforms []Transform `json:"transforms,omitempty"` // Post-processing pipeline for the value, see transforms.go
+	Rules      *Rules      `json:"rules,omitempty"`      // Checks the value must pass, see rules.go
+}
+
+// UnmarshalJSON accepts either a plain string or an expression object.
+func (e *Expression) UnmarshalJSON(data []byte) error {
+	var xpath string
+	if err := json.Unmarshal(data, &xpath); err == nil {
+		*e = Expression{XPath: xpath}
+		return nil
+	}
+	type expressionFields Expression // Avoids recursing into this method
+	var fields expressionFields
+	if err := strictUnmarshal(data, &fields, expressionName(data)); err != nil {
+		return err
+	}
+	*e = Expression(fields)
+	return nil
+}
+
+// Key returns the output map key for the expression.
+func (e Expression) Key() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return e.XPath
+}
+
+// Values for Expression.Mode.
+const (
+	modeFirst = "first"
+	modeAll   = "all"
+)
+
+// compiledExpression pairs an input expression with its compiled XPath.
+type compiledExpression struct {
+	expr      Expression
+	fn        string // Outer XPath function such as count, or "" for a bare path; see functions.go
+	path      *xmlpath.Path
+	normalize Normalization   // Effective normalization after merging in the input-level defaults
+	sanitize  *sanitizePolicy // Filter for markup results, or nil
+	steps     []transformStep // Compiled transforms pipeline, or nil
+	rules     *compiledRules  // Checks on the value, or nil
+}
+
+// compileExpression validates the options of expr and compiles its XPath.
+// Input-level defaults for the expression's options are taken from input.
+func compileExpression(expr Expression, input *InputJson) (compiledExpression, error) {
+	if !validReturnMode(expr.Return) {
+		return compiledExpression{}, fmt.Errorf("unknown return mode %q", expr.Return)
+	}
+	policy := newSanitizePolicy(expr.Sanitize)
+	if policy != nil && expr.Return != returnOuterHTML && expr.Return != returnInnerHTML {
+		return compiledExpression{}, fmt.Errorf("sanitize requires return mode %q or %q", returnOuterHTML, returnInnerHTML)
+	}
+	if expr.Mode != "" && expr.Mode != modeFirst && expr.Mode != modeAll {
+		return compiledExpression{}, fmt.Errorf("unknown mode %q (want first or all)", expr.Mode)
+	}
+	fn, inner := splitFunctionCall(expr.XPath)
+	if fn != "" && fn != fnString && expr.Return != "" && expr.Return != returnText {
+		return compiledExpression{}, fmt.Errorf("return mode %q cannot be used with %s()", expr.Return, fn)
+	}
+	if fn != "" && expr.Mode == modeAll {
+		return compiledExpression{}, fmt.Errorf("mode %q cannot be used with %s()", modeAll, fn)
+	}
+	if len(expr.Transforms) > 0 && fn != "" && fn != fnString {
+		return compiledExpression{}, fmt.Errorf("transforms cannot be used with %s()", fn)
+	}
+	steps, err := compileTransforms(expr.Transforms, input.script)
+	if err != nil {
+		return compiledExpression{}, err
+	}
+	rules, err := expr.Rules.compile()
+	if err != nil {
+		return compiledExpression{}, err
+	}
+	path, err := xmlpath.CompileOptions(inner, xmlpath.Options{
+		Namespaces:     input.Namespaces,
+		IgnorePrefixes: input.NamespaceAgnostic,
+	})
+	if err != nil {
+		return compiledExpression{}, err
+	}
+	return compiledExpression{
+		expr:      expr,
+		fn:        fn,
+		path:      path,
+		normalize: expr.Normalize.merge(input.Normalize),
+		sanitize:  policy,
+		steps:     steps,
+		rules:     rules,
+	}, nil
+}
+
+// evaluate applies the expression to a parsed document, returning false if it produced no value.
+// Bare paths use the first match only, or every match in mode all, rendered per the
+// expression's return mode. Normalization and link resolution against base apply to text
+// results only; markup is returned as serialized. The transforms pipeline then runs on
+// either, and list results are deduplicated last if requested.
+func (c compiledExpression) evaluate(root *xmlpath.Node, base *url.URL) (interface{}, bool) {
+	value, ok := c.match(root, base, nil)
+	if !ok {
+		return nil, false
+	}
+	return c.transform(value)
+}
+
+// match applies the path or function to root, rendering what it matched. Matching stops
+// early once done is closed, with what was matched so far; nil never stops it.
+func (c compiledExpression) match(root *xmlpath.Node, base *url.URL, done <-chan struct{}) (interface{}, bool) {
+	if c.fn != "" {
+		value, ok := applyFunction(c.fn, c.path, root, done)
+		if s, isString := value.(string); isString {
+			value = c.finishText(s, base)
+		}
+		return value, ok
+	}
+	var matches []interface{}
+	for iter := c.path.IterUntil(root, done); iter.Next(); {
+		matches = append(matches, c.render(iter.Node(), base))
+		if c.expr.Mode != modeAll {
+			break
+		}
+	}
+	if matches == nil {
+		return nil, false
+	}
+	if c.expr.Mode == modeAll {
+		return matches, true
+	}
+	return matches[0], true
+}
+
+// transform runs a matched value through the transforms and de-duplication.
+func (c compiledExpression) transform(value interface{}) (interface{}, bool) {
+	value, ok := applyTransforms(c.steps, value)
+	if ok && c.expr.Dedupe {
+		value = dedupe(value)
+	}
+	return value, ok
+}
+
+// render turns one matched node into a result string.
+func (c compiledExpression) render(node *xmlpath.Node, base *url.URL) string {
+	value := renderNode(node, c.expr.Return, c.sanitize)
+	if c.expr.Return == "" || c.expr.Return == returnText {
+		value = c.finishText(value, base)
+	}
+	return value
+}
+
+// dedupe removes repeated elements from a list result, keeping the first occurrence.
+// Values are compared by their JSON encoding, so structured values like money work too.
+func dedupe(value interface{}) interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	seen := make(map[string]bool, len(list))
+	unique := make([]interface{}, 0, len(list))
+	for _, elem := range list {
+		key, err := json.Marshal(elem)
+		if err == nil && seen[string(key)] {
+			continue
+		}
+		seen[string(key)] = true
+		unique = append(unique, elem)
+	}
+	return unique
+}
+
+// finishText applies the expression's text post-processing to a string result.
+func (c compiledExpression) finishText(s string, base *url.URL) string {
+	s = c.normalize.apply(s)
+	if c.expr.Resolve {
+		s = resolveLink(base, s)
+	}
+	return s
+}
+
+// baseHrefPath finds the <base href> that overrides the document URL for link resolution.
+var baseHrefPath = xmlpath.MustCompile("//base/@href")
+
+// xmlDocumentBase returns the URL that relative links in the parsed document resolve against.
+func xmlDocumentBase(root *xmlpath.Node, pageURL string) *url.URL {
+	href, found := baseHrefPath.String(root)
+	return resolveBase(pageURL, href, found)
 }
 
 // --- Output Structures ---
 
 // Output format: map[xpath]map[url]result
-type OutputJson map[string]map[string]string
+// Keys starting with "$" are report sections rather than extraction results, e.g. "$validation".
+// Xpath results are strings, or booleans/numbers for boolean(), count() and number() expressions
+// (mode all and transforms may also produce lists, transforms numbers and objects);
+// preset results (keyed "preset:<name>") are structured values.
+type OutputJson map[string]map[string]interface{}
 
 // --- Helper Functions ---
 
@@ -35,9 +313,41 @@ func fatalf(format string, a ...interface{}) {
 	os.Exit(2)
 }
 
+// Values for InputJson.Entities, controlling how the XML decoder treats entity references.
+const (
+	entitiesHTML    = "html"    // XML's predefined entities plus the HTML 4 table (&nbsp;, &copy;, ...)
+	entitiesStrict  = "strict"  // Only XML's predefined entities; anything else is a parse error
+	entitiesLenient = "lenient" // As html, and unknown entities are kept as literal text
+)
+
 // decode reads from the reader, attempts to detect charset, and parses XML
-func decode(r io.Reader) (*xmlpath.Node, error) {
+// Entities are resolved according to input.Entities; see the constants above.
+// If input.XInclude is set, xi:include elements are expanded relative to source's file or
+// pageURL, and if input.Embedded is set, markup hidden in comments or text is parsed too.
+func decode(r io.Reader, input *InputJson, pageURL string, source pageSource) (*xmlpath.Node, error) {
+	decoder := newDecoder(r, input.Entities)
+	if input.XInclude != nil {
+		decoder = newXIncludeDecoder(decoder, input, pageURL, source)
+	}
+	if input.Embedded != nil {
+		decoder = newEmbeddedDecoder(decoder, input)
+	}
+	return xmlpath.ParseDecoder(decoder)
+}
+
+// newDecoder returns an XML decoder for r configured for the given entities mode.
+func newDecoder(r io.Reader, entities string) *xml.Decoder {
 	decoder := xml.NewDecoder(r)
+	switch entities {
+	case entitiesStrict:
+	case entitiesLenient:
+		// Non-strict mode is the only way to get encoding/xml to pass unknown entities
+		// through; it also tolerates unquoted attribute values and stray end tags.
+		decoder.Strict = false
+		decoder.Entity = xml.HTMLEntity
+	default:
+		decoder.Entity = xml.HTMLEntity
+	}
 	// Use charset reader similar to xpup to handle different encodings
 	decoder.CharsetReader = func(chset string, input io.Reader) (io.Reader, error) {
 		// xmlpath doesn't seem to expose the underlying reader easily after parsing starts,
@@ -45,50 +355,291 @@ func decode(r io.Reader) (*xmlpath.Node, error) {
 		// If charset is empty, it might try to auto-detect or default to UTF-8.
 		return charset.NewReader(input, chset)
 	}
-	return xmlpath.ParseDecoder(decoder)
+	return decoder
 }
 
 // --- Processing Logic ---
 
 // processInput takes raw input bytes, processes them, and returns the result map or an error.
 func processInput(inputBytes []byte) (OutputJson, error) {
+	input, err := parseInput(inputBytes)
+	if err != nil {
+		return nil, err
+	}
+	return process(input)
+}
+
+// parseInput deserializes the input and checks its input-level options, loading the
+// script and template it refers to.
+func parseInput(inputBytes []byte) (*InputJson, error) {
+	return readInput(bytes.NewReader(inputBytes))
+}
+
+// readInput is parseInput for an input document read from r, see stream.go.
+func readInput(r io.Reader) (*InputJson, error) {
 	// 1. Deserialize input
-	var input InputJson
-	err := json.Unmarshal(inputBytes, &input)
+	input, err := decodeInput(r)
 	if err != nil {
 		// Return an error instead of exiting
 		return nil, fmt.Errorf("error unmarshalling input JSON: %w", err)
 	}
 
+	for pageURL, urlData := range input.Urls {
+		if len(urlData.Content) > 0 && urlData.File != "" {
+			return nil, fmt.Errorf("URL %s has both content and a file", pageURL)
+		}
+		if err := checkContentEncoding(urlData); err != nil {
+			return nil, fmt.Errorf("URL %s: %w", pageURL, err)
+		}
+	}
+
+	if err := checkNoMatch(input.OnNoMatch); err != nil {
+		return nil, err
+	}
+
+	switch input.Entities {
+	case "", entitiesHTML, entitiesStrict, entitiesLenient:
+	default:
+		return nil, fmt.Errorf("unknown entities mode %q (want html, strict or lenient)", input.Entities)
+	}
+
+	if input.XSLT != nil {
+		if err := input.XSLT.check(); err != nil {
+			return nil, err
+		}
+	}
+	if input.Validate != nil {
+		if err := input.Validate.check(); err != nil {
+			return nil, err
+		}
+	}
+	if input.Fetch != nil {
+		if err := input.Fetch.check(); err != nil {
+			return nil, err
+		}
+	}
+	if input.XInclude != nil {
+		if err := input.XInclude.check(input.Fetch, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+	if input.evaluationTimeout, err = parseEvaluationTimeout(input.EvaluationTimeout); err != nil {
+		return nil, err
+	}
+	if input.Alerts != nil {
+		if err := input.Alerts.check(); err != nil {
+			return nil, err
+		}
+	}
+	if input.Script != nil {
+		if input.script, err = input.Script.load(); err != nil {
+			return nil, err
+		}
+	}
+	if input.Template != nil {
+		if input.template, err = input.Template.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return input, nil
+}
+
+// process evaluates the expressions and presets of a parsed input against its URLs.
+func process(input *InputJson) (OutputJson, error) {
+
 	// 2. Initialize Output and Compile XPaths
+	input.status = runStatus{started: time.Now()}
 	output := make(OutputJson)
-	compiledPaths := make(map[string]*xmlpath.Path) // Store compiled XPaths
+	compiledPaths := make(map[string]compiledExpression) // Store compiled XPaths by output key
+	needsBase := false                                   // Whether any expression resolves links
+	hasRules := false                                    // Whether any expression has validation rules
 
-	for _, xpathStr := range input.Xpaths {
+	var invalid []error // With -strict-xpaths, compile failures stop the run
+	for _, expr := range input.Xpaths {
 		// Initialize the inner map for this XPath in the output
-		output[xpathStr] = make(map[string]string)
+		output[expr.Key()] = make(map[string]interface{})
 
 		// Compile XPath expression
-		path, err := xmlpath.Compile(xpathStr)
-		if err != nil {
+		compiled, err := compileExpression(expr, input)
+		if err != nil && input.strictXPaths {
+			invalid = append(invalid, fmt.Errorf("XPath '%s': %w", expr.XPath, err))
+		} else if err != nil {
 			// Log warning, but don't stop processing other paths/URLs
-			fmt.Fprintf(os.Stderr, "Warning: Failed to compile XPath '%s': %v. Skipping this XPath for all URLs.\n", xpathStr, err)
+			input.warn(warnXPath, expr.Key(), "Failed to compile XPath '%s': %v. Skipping this XPath for all URLs.", expr.XPath, err)
 			// We skip adding it to compiledPaths, so it won't be processed.
 		} else {
-			compiledPaths[xpathStr] = path
+			compiledPaths[expr.Key()] = compiled
+			needsBase = needsBase || expr.Resolve
+			hasRules = hasRules || compiled.rules != nil
+		}
+	}
+
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("-strict-xpaths: %w", errors.Join(invalid...))
+	}
+	input.compiled = compiledPaths
+
+	// Initialize the inner maps for known presets; unknown presets are skipped with a warning
+	var activePresets []string
+	for _, name := range input.Presets {
+		if _, ok := presets[name]; !ok {
+			input.warn(warnPreset, name, "Unknown preset '%s'. Skipping this preset for all URLs.", name)
+			continue
 		}
+		output[presetKeyPrefix+name] = make(map[string]interface{})
+		activePresets = append(activePresets, name)
+	}
+
+	if input.Validate != nil {
+		output[validationKey] = make(map[string]interface{})
+	}
+	if hasRules {
+		output[rulesKey] = make(map[string]interface{})
+	}
+	if input.Suggest {
+		output[suggestionsKey] = make(map[string]interface{})
+	}
+	if input.Metrics {
+		output[metricsKey] = make(map[string]interface{})
+	}
+	if input.Fetch != nil {
+		output[responsesKey] = make(map[string]interface{})
 	}
 
+	// Values of URLs done in an earlier run, see checkpoint.go
+	input.checkpoint.resume(output)
+	contents := newContentIndex(input, needsBase || len(activePresets) > 0 || input.XInclude != nil)
+
 	// 3. Process URLs and Apply Compiled XPaths
-	for url, urlData := range input.Urls {
+	reached := 0 // URLs taken on, to tell how many a stopped run left
+	for pageURL, urlData := range input.Urls {
+		if input.status.abort != nil || input.status.stopped {
+			break
+		}
+		reached++
+		// Counted at the start, since URLs are given up on at many points below
+		input.progress.advance()
+		if input.consume && len(urlData.Content) > 0 {
+			input.Urls[pageURL] = UrlData{File: urlData.File, ContentEncoding: urlData.ContentEncoding}
+		}
+		if input.checkpoint.skips(pageURL) {
+			continue
+		}
+		metrics := &urlMetrics{}
+		start := time.Now()
+		localFile := "" // The file the document was read from, which it may include files beside
+		if urlData.File != "" {
+			data, err := readObject(context.Background(), urlData.File)
+			if err != nil {
+				input.warnURL(warnRead, pageURL, true, "Failed to read content for URL '%s': %v. Skipping this URL.", pageURL, err)
+				continue
+			}
+			urlData.Content = data
+			if _, _, _, ok := splitObjectURI(urlData.File); !ok {
+				localFile = urlData.File
+			}
+		} else if len(urlData.Content) == 0 && input.Fetch != nil {
+			data, response, err := input.Fetch.fetch(pageURL, input.maxDocSize)
+			if response != nil {
+				output[responsesKey][pageURL] = response
+			}
+			if input.warnTooLarge(pageURL, err) {
+				continue
+			}
+			if err != nil {
+				input.warnURL(warnFetch, pageURL, true, "Failed to fetch URL '%s': %v. Skipping this URL.", pageURL, err)
+				continue
+			}
+			urlData.Content = data
+			if u, err := url.Parse(pageURL); err == nil && u.Scheme == "file" {
+				localFile, _ = fileURLPath(u)
+			}
+		}
+		if urlData.ContentEncoding != "" {
+			data, err := decodeContent(urlData.Content, urlData.ContentEncoding, input.maxDocSize)
+			if input.warnTooLarge(pageURL, err) {
+				continue
+			}
+			if err != nil {
+				input.warnURL(warnDecode, pageURL, true, "Failed to decode the %s content of URL '%s': %v. Skipping this URL.", urlData.ContentEncoding, pageURL, err)
+				continue
+			}
+			urlData.Content = data
+		}
+		if input.warnTooLarge(pageURL, checkSize(int64(len(urlData.Content)), input.maxDocSize)) {
+			continue
+		}
+		metrics.Bytes, metrics.FetchMS = len(urlData.Content), elapsedMS(start)
+		input.status.bytes += len(urlData.Content)
+		if input.Metrics {
+			// Filled in as the URL is processed, and kept for URLs skipped midway
+			output[metricsKey][pageURL] = metrics
+		}
+		if input.contentSums != nil {
+			input.contentSums[pageURL] = newChecksum(urlData.Content)
+		}
+		contentKey := contents.key(pageURL, urlData.Content)
+		if contents.duplicate(contentKey, pageURL) {
+			continue // Its values are filled in after the loop, see dedupe.go
+		}
+
+		// Validate the document as received; problems are reported rather than silently skipped
+		start = time.Now()
+		if input.Validate != nil {
+			problems, err := input.Validate.validate(urlData.Content)
+			if err != nil {
+				input.warnURL(warnValidate, pageURL, false, "Failed to validate content for URL '%s': %v.", pageURL, err)
+			} else if problems != nil {
+				output[validationKey][pageURL] = problems
+				if input.Validate.SkipInvalid {
+					metrics.ParseMS = elapsedMS(start)
+					continue
+				}
+			}
+		}
+
+		// Presets use their own lenient HTML parse, so they run even if strict XML parsing fails below
+		metrics.ParseMS = elapsedMS(start)
+		if len(activePresets) > 0 {
+			start = time.Now()
+			err := recovered(func() error { return applyPresets(output, activePresets, pageURL, urlData.Content) })
+			if input.warnPanicked(pageURL, "Applying presets to", err) {
+				for _, name := range activePresets {
+					delete(output[presetKeyPrefix+name], pageURL)
+				}
+				continue
+			}
+			if err != nil {
+				input.warnURL(warnPresets, pageURL, false, "Failed to parse HTML for URL '%s': %v. Skipping presets for this URL.", pageURL, err)
+			}
+			metrics.EvaluateMS = elapsedMS(start)
+		}
+
 		// Create a reader for the HTML/XML content string
-		contentReader := strings.NewReader(urlData.Content)
+		start = time.Now()
+		contentReader := bytes.NewReader(urlData.Content)
+		if input.XSLT != nil {
+			transformed, err := input.XSLT.transform(urlData.Content)
+			if err != nil {
+				input.warnURL(warnXSLT, pageURL, true, "Failed to apply XSLT for URL '%s': %v. Skipping this URL.", pageURL, err)
+				continue
+			}
+			contentReader = bytes.NewReader(transformed)
+		}
 
 		// Decode the content *once* per URL
-		root, err := decode(contentReader)
+		var root *xmlpath.Node
+		err := recovered(func() (err error) {
+			root, err = decode(contentReader, input, pageURL, pageSource{file: localFile, size: int64(len(urlData.Content))})
+			return err
+		})
+		metrics.ParseMS += elapsedMS(start)
+		if input.warnPanicked(pageURL, "Parsing", err) {
+			continue
+		}
 		if err != nil {
 			// Log warning and skip this URL entirely if parsing fails
-			fmt.Fprintf(os.Stderr, "Warning: Failed to parse content for URL '%s': %v. Skipping this URL.\n", url, err)
+			input.warnURL(warnParse, pageURL, true, "Failed to parse content for URL '%s': %v. Skipping this URL.", pageURL, err)
 			continue // Skip to the next URL
 		}
 
@@ -96,47 +647,444 @@ func processInput(inputBytes []byte) (OutputJson, error) {
 		// xmlpath.ParseDecoder usually returns EOF for empty input, caught above.
 		// This check handles edge cases where parsing succeeds but yields no root.
 		if root == nil {
-			fmt.Fprintf(os.Stderr, "Warning: Parsed content for URL '%s' resulted in nil root node. Skipping this URL.\n", url)
+			input.warnURL(warnParse, pageURL, true, "Parsed content for URL '%s' resulted in nil root node. Skipping this URL.", pageURL)
 			continue // Skip to the next URL
 		}
 
+		// Links are only resolved on request, so only look up the document base when needed
+		var base *url.URL
+		if needsBase {
+			base = xmlDocumentBase(root, pageURL)
+		}
+
 		// Apply each valid, compiled XPath to this URL's content
-		for xpathStr, path := range compiledPaths {
-			// Evaluate the XPath on the parsed root
-			resultBytes, ok := path.Bytes(root)
-			// Only add the entry if the XPath matched and returned bytes
-			if ok {
-				output[xpathStr][url] = string(resultBytes)
+		start = time.Now()
+		var failures []ruleFailure
+		scriptFailures := 0 // Script transforms report their own failures
+		if input.script != nil {
+			scriptFailures = input.script.failures
+		}
+		suggestions := make(map[string][]string)
+		err = recovered(func() error {
+			// Match every XPath on the parsed root, concurrently with -xpath-concurrency
+			matches := matchAll(compiledPaths, root, base, input.evaluationTimeout, input.concurrency)
+			for key, compiled := range compiledPaths {
+				// Only add the entry if the XPath produced a value
+				match := matches[key]
+				value, ok, err := match.value, match.ok, match.err
+				if err == nil && ok {
+					value, ok = compiled.transform(value)
+				}
+				if errors.Is(err, errEvaluationTimeout) {
+					input.warnURL(warnTimeout, pageURL, false, "Evaluating '%s' on URL '%s' timed out after %s. Skipping it for this URL.", compiled.expr.XPath, pageURL, input.evaluationTimeout)
+					continue
+				} else if err != nil {
+					return err // A panic
+				}
+				if ok {
+					output[key][pageURL] = value
+				}
+				// If there is no match, do nothing - omit the entry; finishRun applies the no-match policy
+				if !ok && input.Suggest && (compiled.fn == "" || compiled.fn == fnString) {
+					if paths := suggestPaths(compiled.expr.XPath, root); len(paths) > 0 {
+						suggestions[key] = paths
+					}
+				}
+				if compiled.rules != nil {
+					failures = append(failures, compiled.rules.check(key, value, ok)...)
+				}
+			}
+			return nil
+		})
+		if input.warnPanicked(pageURL, "Evaluating XPaths on", err) {
+			for key := range compiledPaths {
+				delete(output[key], pageURL)
 			}
-			// If 'ok' is false (no match or non-byte result), do nothing - omit the entry.
+			continue
+		}
+		if input.script != nil && input.script.failures > scriptFailures {
+			// The script has warned about each failure itself
+			input.status.warnedOn(pageURL, false)
+			input.record(runWarning{Code: warnScript, Subject: pageURL, Message: "Starlark functions failed on this URL.", URL: pageURL})
+		}
+		if len(failures) > 0 {
+			// Map iteration order is random; report failures in a stable order
+			sort.SliceStable(failures, func(i, j int) bool { return failures[i].Expression < failures[j].Expression })
+			output[rulesKey][pageURL] = failures
+		}
+		if len(suggestions) > 0 {
+			output[suggestionsKey][pageURL] = suggestions
+		}
+		metrics.EvaluateMS += elapsedMS(start)
+		logger.Debug(fmt.Sprintf("Processed URL '%s': %d bytes, %.1f ms", pageURL, metrics.Bytes, metrics.FetchMS+metrics.ParseMS+metrics.EvaluateMS),
+			"url", pageURL, "bytes", metrics.Bytes)
+		contents.evaluated(contentKey, pageURL)
+		input.completed(pageURL, output)
+		if err := input.spillIfOver(output); err != nil {
+			return nil, err
 		}
 	}
 
+	input.progress.clear()
+	if err := input.spill.merge(output); err != nil {
+		return nil, err
+	}
+	contents.fanOut(output)
+	input.saveCheckpoint(output)
+	if input.status.abort != nil {
+		return nil, input.status.abort
+	}
+	if input.status.left = len(input.Urls) - reached; input.status.left > 0 {
+		input.warn(warnStopped, "", "Stopping after %d failed URLs (-max-errors). %d URLs were not processed.", len(input.status.skipped), input.status.left)
+	}
+
+	// The per-URL hook sees everything extracted for the URL, including presets
+	if input.script != nil {
+		for pageURL := range input.Urls {
+			if err := input.script.process(output, pageURL); err != nil {
+				input.warnURL(warnScript, pageURL, false, "Script failed for URL '%s': %v. Keeping its results unprocessed.", pageURL, err)
+			}
+		}
+	}
+
+	if input.Coverage {
+		output[coverageKey] = coverageReport(input, output)
+	}
+
 	return output, nil // Return the populated map and nil error if successful so far
 }
 
+// finishRun relates the output of a run finished at at to earlier runs: it sends alerts,
+// appends the output to the history store and reduces it to the changes, as configured.
+// It also applies the no-match policy, which reports and history don't see.
+func finishRun(input *InputJson, output OutputJson, at time.Time) (OutputJson, error) {
+	if err := input.checkMatches(output); err != nil {
+		return nil, err
+	}
+
+	// Earlier runs are loaded before this one is recorded, which would otherwise replace them
+	var previous OutputJson
+	var err error
+	if input.ChangesOnly != nil {
+		if previous, err = input.previousOutput(input.ChangesOnly.Previous); err != nil {
+			return nil, fmt.Errorf("loading previous output: %w", err)
+		}
+	}
+	if input.Alerts != nil {
+		var alertPrevious OutputJson
+		if input.Alerts.needsPrevious() {
+			if alertPrevious, err = input.previousOutput(input.Alerts.Previous); err != nil {
+				return nil, fmt.Errorf("loading previous output: %w", err)
+			}
+		}
+		// A failing webhook shouldn't lose the run's output
+		if err := input.Alerts.send(input.Alerts.evaluate(input, alertPrevious, output)); err != nil {
+			input.warn(warnAlerts, "", "Failed to send alerts: %v", err)
+		}
+	}
+	if input.History != "" {
+		if err := recordHistory(input.History, input, output, at); err != nil {
+			return nil, fmt.Errorf("recording history: %w", err)
+		}
+	}
+	if previous != nil {
+		output = changedOnly(input, previous, output)
+	} else {
+		input.fillNoMatch(output)
+	}
+	return output, nil
+}
+
 // --- Main Function ---
 
 func main() {
-	// 1. Read stdin
-	inputBytes, err := io.ReadAll(os.Stdin)
-	if err != nil {
-		fatalf("Error reading stdin: %v\n", err) // Use fatalf for I/O errors in main
+	// Subcommands; without one, goatpaver processes an input document from stdin
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "infer":
+			if err := runInfer(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+				fatalf("Error: %v\n", err)
+			}
+			return
+		case "diff":
+			if err := runDiff(os.Args[2:], os.Stdout); err != nil {
+				if errors.Is(err, errDifferent) {
+					os.Exit(1)
+				}
+				fatalf("Error: %v\n", err)
+			}
+			return
+		case "history":
+			if err := runHistory(os.Args[2:], os.Stdout); err != nil {
+				fatalf("Error: %v\n", err)
+			}
+			return
+		case "worker":
+			if err := runWorker(os.Args[2:], os.Stdout); err != nil {
+				fatalf("Error: %v\n", err)
+			}
+			return
+		case "validate":
+			if err := runValidate(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+				if errors.Is(err, errInvalid) {
+					os.Exit(1)
+				}
+				fatalf("Error: %v\n", err)
+			}
+			return
+		case "pave", "goat":
+			pave(os.Args[2:], os.Args[1] == "goat")
+			return
+		case "bench":
+			if err := runBench(os.Args[2:], os.Stdout); err != nil {
+				fatalf("Error: %v\n", err)
+			}
+			return
+		case "completion":
+			if err := runCompletion(os.Args[2:], os.Stdout); err != nil {
+				fatalf("Error: %v\n", err)
+			}
+			return
+		case "version":
+			if err := runVersion(os.Args[2:], os.Stdout); err != nil {
+				fatalf("Error: %v\n", err)
+			}
+			return
+		case "test":
+			if err := runTest(os.Args[2:], os.Stdout); err != nil {
+				if errors.Is(err, errDrift) {
+					os.Exit(1)
+				}
+				fatalf("Error: %v\n", err)
+			}
+			return
+		}
 	}
 
-	// 2. Process Input using the dedicated function
-	output, err := processInput(inputBytes)
+	pave(os.Args[1:], invokedAsLegacy(os.Args[0]))
+}
+
+// pave implements a plain run with the flags args, as "goatpaver pave" or, with legacy,
+// "goatpaver goat" and go_goat (see compat.go). It exits on errors and with the run's
+// exit status.
+func pave(args []string, legacy bool) {
+	opts, err := parseFlags(args)
+	if err != nil {
+		fatalf("Error: %v\n", err)
+	}
+	logger = opts.logger
+	if legacy {
+		opts.legacy()
+	}
+	if opts.watch {
+		if err := opts.watchInput(); err != nil {
+			fatalf("Error: %v\n", err)
+		}
+		return
+	}
+	stopProfiles, err := opts.profiles.start()
+	if err != nil {
+		fatalf("Error: %v\n", err)
+	}
+	code, err := run(opts)
+	// Exiting skips deferred calls, so the profiles are written first
+	if err := stopProfiles(); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to write profiles: %v", err))
+	}
 	if err != nil {
-		// Handle fatal errors from processing (e.g., JSON parsing)
-		fatalf("Error processing input: %v\n", err)
+		fatalf("Error: %v\n", err)
+	}
+	code = opts.exitStatus(code)
+	// Signal failed URLs and validation rules through the exit status, see status.go
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// run makes a plain run with opts and returns its exit status, or an error for one that
+// had to stop.
+func run(opts runOptions) (int, error) {
+	// 1. Read stdin, or the -input document, decoding it as it is read (see stream.go)
+	started := time.Now()
+	var source io.ReadCloser = io.NopCloser(os.Stdin)
+	var err error
+	toolCommands = opts.commands
+	if opts.tls != nil || opts.pins != nil {
+		// For https:// input documents; fetches get them below
+		if inputClient, err = httpClient(opts.tls, opts.pins, time.Minute); err != nil {
+			return 0, fmt.Errorf("reading input: %w", err)
+		}
+	}
+	inputFormat := opts.inputFormat
+	if files := opts.inputFiles(); len(files) > 1 || len(files) == 1 && isYAML(files[0]) {
+		// Merged, or converted from YAML, into the JSON document that is read (see merge.go)
+		merged, err := mergeInputs(context.Background(), files, opts.inputFormat)
+		if err != nil {
+			return 0, fmt.Errorf("reading input: %w", err)
+		}
+		source, inputFormat = io.NopCloser(bytes.NewReader(merged)), formatJSON
+	} else if opts.input != "" {
+		if source, err = openInput(context.Background(), opts.input); err != nil {
+			return 0, fmt.Errorf("reading input: %w", err)
+		}
 	}
+	defer source.Close()
+	read := newChecksumReader(source)
 
-	// 3. Serialize output
-	outputJsonBytes, err := json.MarshalIndent(output, "", "  ") // Use indent for readability
+	// 2. Process Input using the dedicated functions
+	var input *InputJson
+	var document checksum // Of the JSON document, which for protobuf input isn't what was read
+	if inputFormat == formatProtobuf {
+		inputBytes, err := io.ReadAll(read)
+		if err != nil {
+			return 0, fmt.Errorf("reading input: %w", err)
+		}
+		decoded, err := decodeProtoInput(inputBytes)
+		if err != nil {
+			return 0, fmt.Errorf("processing input: %w", err)
+		}
+		document = newChecksum(decoded)
+		input, err = parseInput(decoded)
+	} else {
+		input, err = readInput(read)
+		document = read.sum()
+	}
+	if read.err != nil {
+		return 0, fmt.Errorf("reading input: %w", read.err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("processing input: %w", err)
+	}
+	if opts.onNoMatch != "" {
+		input.OnNoMatch = opts.onNoMatch
+	}
+	if (opts.tls != nil || opts.resolve != nil) && input.XInclude != nil {
+		// Before the fetch options take in the flags below
+		if err := input.XInclude.check(input.Fetch, opts.tls, opts.resolve); err != nil {
+			return 0, fmt.Errorf("processing input: %w", err)
+		}
+	}
+	if (opts.tls != nil || opts.resolve != nil) && input.Fetch != nil {
+		input.Fetch.TLS = opts.tls.over(input.Fetch.TLS)
+		// After the input's, so that the flag's pins win
+		input.Fetch.Resolve = append(input.Fetch.Resolve[:len(input.Fetch.Resolve):len(input.Fetch.Resolve)], opts.resolve...)
+		if err := input.Fetch.check(); err != nil {
+			return 0, fmt.Errorf("processing input: %w", err)
+		}
+	}
+	opts.selectURLs(input)
+	if opts.dryRun {
+		plan, err := opts.plan(input)
+		if err == nil {
+			var encoded []byte
+			if encoded, err = encodeOutput(formatJSON, opts.indentPrinted(), plan); err == nil {
+				_, err = os.Stdout.Write(encoded)
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("printing the plan: %w", err)
+		}
+		return 0, nil
+	}
+	if opts.manifest != "" {
+		input.contentSums = make(map[string]checksum)
+	}
+	if (opts.manifest != "" || opts.envelope) && opts.runID == "" {
+		// The manifest, the envelope and the sink share the run ID
+		opts.runID = newRunID()
+	}
+	input.progress = opts.newProgressBar(len(input.Urls))
+	input.failFast = opts.failFast
+	input.strictXPaths = opts.strictXPaths
+	input.maxDocSize = opts.maxDocSize
+	input.concurrency = opts.concurrency
+	input.consume = true // Nothing reads the content after process
+	if opts.maxMemory > 0 {
+		input.spill = &resultSpill{budget: opts.maxMemory}
+	}
+	if path := opts.checkpointPath(); path != "" {
+		if input.checkpoint, err = newCheckpoint(path, opts.resume, document); err != nil {
+			return 0, err
+		}
+	}
+	input.maxErrors = opts.maxErrors
+	if opts.warnings != "" {
+		warnings, err := os.Create(opts.warnings)
+		if err != nil {
+			return 0, err
+		}
+		defer warnings.Close() // Written unbuffered, so nothing is lost if the run stops early
+		input.warnings = json.NewEncoder(warnings)
+	}
+	var output OutputJson
+	if opts.workers != nil {
+		output, err = input.distribute(opts.workers, opts.batchSize)
+	} else {
+		output, err = process(input)
+	}
 	if err != nil {
-		fatalf("Error marshalling output JSON: %v\n", err) // Use fatalf for marshalling errors
+		return 0, fmt.Errorf("processing input: %w", err)
+	}
+	if opts.errorValues {
+		output[errorsKey] = input.errorSection()
+	}
+	finished := time.Now()
+	stats := input.newRunStats(output)
+	report := opts.newReport(input, output, stats)
+	if output, err = finishRun(input, output, finished); err != nil {
+		return 0, err
 	}
+	runManifest := opts.newManifest(input, read.sum(), started, finished)
 
-	// 4. Print to stdout
-	fmt.Println(string(outputJsonBytes))
+	// A template replaces the JSON output entirely
+	if input.template != nil {
+		printed, err := opts.printTo(func(w io.Writer) error {
+			if err := renderTemplate(w, input.template, output, input.Urls); err != nil {
+				return fmt.Errorf("rendering template: %w", err)
+			}
+			return nil
+		})
+		if err == nil {
+			err = runManifest.save(printed, nil)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("writing output: %w", err)
+		}
+		if err := opts.finishStats(stats, report, started); err != nil {
+			return 0, fmt.Errorf("writing report: %w", err)
+		}
+		return input.exitCode(output, opts.strict), nil
+	}
+
+	// 3. Serialize output, or write it to per-URL files and keep only the reports
+	printed := opts.format(input, output)
+	var files map[string]checksum
+	if opts.outTemplate != nil {
+		if files, err = opts.writeFiles(input, output); err != nil {
+			return 0, fmt.Errorf("writing output files: %w", err)
+		}
+		printed = reportSections(output)
+	}
+	if opts.output != nil {
+		if err := opts.writeSink(input, output, finished); err != nil {
+			return 0, fmt.Errorf("writing to %s: %w", opts.output.Redacted(), err)
+		}
+		printed = reportSections(output)
+	}
+
+	// 4. Print to stdout as it is encoded (see encoding.go), and record the run
+	doc := opts.document(input, output, printed, finished)
+	written, err := opts.printTo(func(w io.Writer) error {
+		return writeOutput(w, opts.encoding, opts.indentPrinted(), doc)
+	})
+	if err == nil {
+		err = runManifest.save(written, files)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("writing output: %w", err)
+	}
+	if err := opts.finishStats(stats, report, started); err != nil {
+		return 0, fmt.Errorf("writing report: %w", err)
+	}
+	return input.exitCode(output, opts.strict), nil
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json" // Import encoding/json for test output formatting
 	"reflect"       // Import reflect package for DeepEqual
+	"strings"
 	"testing"
 )
 
@@ -113,3 +114,192 @@ func TestProcessInput_InvalidXPath(t *testing.T) {
 		t.Errorf("Unexpected output for invalid XPath.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
 	}
 }
+
+func TestProcessInput_StrictXPaths(t *testing.T) {
+	input, err := parseInput([]byte(`{"xpaths": ["//p", "[invalid-xpath", "//["], "urls": {"http://example.com": {"content": "<p>Hello</p>"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.strictXPaths = true
+	_, err = process(input)
+	if err == nil || !strings.Contains(err.Error(), "XPath '[invalid-xpath'") || !strings.Contains(err.Error(), "XPath '//['") {
+		t.Errorf("Unexpected error %v; want both XPaths named", err)
+	}
+	if len(input.status.log) != 0 {
+		t.Errorf("Unexpected warnings %v", input.status.log)
+	}
+}
+
+// Test case for HTML entities in otherwise well-formed documents
+func TestProcessInput_Entities(t *testing.T) {
+	input := func(mode string) []byte {
+		return []byte(`{
+			"entities": "` + mode + `",
+			"xpaths": ["//p"],
+			"urls": {
+				"http://nbsp.com": {"content": "<p>a&nbsp;b &copy; c</p>"},
+				"http://unknown.com": {"content": "<p>a &bogus; b</p>"}
+			}
+		}`)
+	}
+
+	cases := map[string]OutputJson{
+		"": {"//p": {
+			"http://nbsp.com": "a\u00a0b © c",
+		}},
+		"strict": {"//p": {}},
+		"lenient": {"//p": {
+			"http://nbsp.com":    "a\u00a0b © c",
+			"http://unknown.com": "a &bogus; b",
+		}},
+	}
+	for mode, expectedOutput := range cases {
+		actualOutput, err := processInput(input(mode))
+		if err != nil {
+			t.Fatalf("processInput(%q) returned an unexpected error: %v", mode, err)
+		}
+		if !reflect.DeepEqual(expectedOutput, actualOutput) {
+			t.Errorf("Unexpected output for entities mode %q.\nExpected: %#v\nGot:      %#v", mode, expectedOutput, actualOutput)
+		}
+	}
+
+	if _, err := processInput(input("loose")); err == nil {
+		t.Errorf("Expected an error for an unknown entities mode, but got nil")
+	}
+}
+
+// Test case for resolving extracted links against the page URL and <base href>
+func TestProcessInput_ResolveLinks(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"xpaths": [
+			{"xpath": "//a/@href", "resolve": true},
+			{"xpath": "//img/@src", "resolve": true},
+			"//link/@href"
+		],
+		"urls": {
+			"https://example.com/blog/post.html": {
+				"content": "<html><head><link href=\"style.css\"/></head><body><a href=\"../about\">About</a><img src=\" /logo.png \"/></body></html>"
+			},
+			"https://mirror.example.com/x/": {
+				"content": "<html><head><base href=\"https://cdn.example.net/assets/\"/></head><body><a href=\"page?id=1#top\">P</a></body></html>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"//a/@href": {
+			"https://example.com/blog/post.html": "https://example.com/about",
+			"https://mirror.example.com/x/":      "https://cdn.example.net/assets/page?id=1#top",
+		},
+		"//img/@src": {
+			"https://example.com/blog/post.html": "https://example.com/logo.png",
+		},
+		"//link/@href": {
+			"https://example.com/blog/post.html": "style.css",
+		},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		expectedJson, _ := json.MarshalIndent(expectedOutput, "", "  ")
+		actualJson, _ := json.MarshalIndent(actualOutput, "", "  ")
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
+	}
+}
+
+// Test case for namespace prefixes bound in the input
+func TestProcessInput_Namespaces(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"namespaces": {"a": "http://www.w3.org/2005/Atom", "s": "http://www.sitemaps.org/schemas/sitemap/0.9"},
+		"xpaths": ["//a:entry/a:title", "//s:loc", "//x:unbound"],
+		"urls": {
+			"http://feed.com": {
+				"content": "<feed xmlns=\"http://www.w3.org/2005/Atom\"><entry><title>First</title></entry></feed>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"//a:entry/a:title": {"http://feed.com": "First"},
+		"//s:loc":           {},
+		"//x:unbound":       {},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+}
+
+// Test case for namespace-agnostic matching of prefixed names
+func TestProcessInput_NamespaceAgnostic(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"namespace_agnostic": true,
+		"xpaths": ["//atom:entry/atom:title", "//entry/title"],
+		"urls": {
+			"http://feed.com": {
+				"content": "<feed xmlns=\"http://www.w3.org/2005/Atom\"><entry><title>First</title></entry></feed>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"//atom:entry/atom:title": {"http://feed.com": "First"},
+		"//entry/title":           {"http://feed.com": "First"},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+}
+
+// Test case for returning every match, with and without deduplication
+func TestProcessInput_ModeAll(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"xpaths": [
+			{"xpath": "//a/@href", "name": "links", "mode": "all"},
+			{"xpath": "//a/@href", "name": "unique", "mode": "all", "dedupe": true, "resolve": true},
+			{"xpath": "//span", "name": "tags", "mode": "all", "dedupe": true, "transforms": [{"type": "split", "separator": ","}]},
+			{"xpath": "//nav", "name": "none", "mode": "all"},
+			{"xpath": "//a/@href", "name": "first", "mode": "first"},
+			{"xpath": "count(//a)", "name": "bad-function", "mode": "all"},
+			{"xpath": "//a", "name": "bad-mode", "mode": "some"}
+		],
+		"urls": {
+			"http://example.com/": {
+				"content": "<html><body><a href=\"/a\">A</a><a href=\"/b\">B</a><a href=\"http://example.com/a\">A again</a><span>x,y</span><span>y,z</span></body></html>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"links":        {"http://example.com/": []interface{}{"/a", "/b", "http://example.com/a"}},
+		"unique":       {"http://example.com/": []interface{}{"http://example.com/a", "http://example.com/b"}},
+		"tags":         {"http://example.com/": []interface{}{"x", "y", "z"}},
+		"none":         {},
+		"first":        {"http://example.com/": "/a"},
+		"bad-function": {},
+		"bad-mode":     {},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		expectedJson, _ := json.MarshalIndent(expectedOutput, "", "  ")
+		actualJson, _ := json.MarshalIndent(actualOutput, "", "  ")
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"strings"
+	"time"
+)
+
+// --- Run Manifest ---
+
+// checksum identifies the contents of a document.
+type checksum struct {
+	SHA256 string `json:"sha256"`
+	Bytes  int    `json:"bytes"`
+}
+
+func newChecksum(data []byte) checksum {
+	sum := sha256.Sum256(data)
+	return checksum{SHA256: hex.EncodeToString(sum[:]), Bytes: len(data)}
+}
+
+// runningChecksum is the checksum of data that goes by a piece at a time.
+type runningChecksum struct {
+	hash  hash.Hash
+	bytes int
+}
+
+func newRunningChecksum() runningChecksum {
+	return runningChecksum{hash: sha256.New()}
+}
+
+func (c *runningChecksum) add(p []byte) {
+	c.hash.Write(p)
+	c.bytes += len(p)
+}
+
+// sum returns the checksum of the data so far.
+func (c *runningChecksum) sum() checksum {
+	return checksum{SHA256: hex.EncodeToString(c.hash.Sum(nil)), Bytes: c.bytes}
+}
+
+// checksumWriter sums up what is written through it, for the checksum of output that is
+// never held whole.
+type checksumWriter struct {
+	w io.Writer
+	runningChecksum
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.add(p[:n])
+	return n, err
+}
+
+// manifest records how a run was made and what it read and wrote, so it can be audited and
+// repeated: -manifest writes it next to the results.
+type manifest struct {
+	RunID      string              `json:"run_id"`  // Also given to the -output sink
+	Version    string              `json:"version"` // goatpaver's module version, or the VCS revision of a development build
+	Parameters map[string]string   `json:"parameters"`
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt time.Time           `json:"finished_at"`
+	Input      manifestInput       `json:"input"`
+	URLs       map[string]checksum `json:"urls"`            // Content of each URL that could be read
+	Output     checksum            `json:"output"`          // What was printed, as printed (compressed with -compress)
+	Files      map[string]checksum `json:"files,omitempty"` // -out-template files, as written
+	Sink       string              `json:"sink,omitempty"`  // -output, without credentials
+
+	location string // Where the manifest is written
+}
+
+type manifestInput struct {
+	Location string `json:"location"` // The -input location, or "stdin"
+	checksum
+}
+
+// newManifest starts the manifest of a run, or returns nil without -manifest. inputSum is
+// the checksum of the input as read; the URL checksums are collected by process.
+func (opts runOptions) newManifest(input *InputJson, inputSum checksum, started, finished time.Time) *manifest {
+	if opts.manifest == "" {
+		return nil
+	}
+	m := &manifest{
+		RunID:      opts.runID,
+		Version:    toolVersion(),
+		Parameters: opts.params,
+		StartedAt:  started.UTC(),
+		FinishedAt: finished.UTC(),
+		Input:      manifestInput{Location: strings.Join(opts.inputFiles(), ","), checksum: inputSum},
+		URLs:       input.contentSums,
+		location:   opts.manifest,
+	}
+	if m.Input.Location == "" {
+		m.Input.Location = "stdin"
+	}
+	if opts.output != nil {
+		m.Sink = opts.output.Redacted()
+	}
+	return m
+}
+
+// save completes m with the checksum of what the run printed and the files it wrote and
+// stores it at the -manifest location, a local file or an s3:// or gs:// object. It does
+// nothing if m is nil.
+func (m *manifest) save(printed checksum, files map[string]checksum) error {
+	if m == nil {
+		return nil
+	}
+	m.Output, m.Files = printed, files
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeObject(context.Background(), m.location, "application/json", append(data, '\n'))
+}
+
+// toolVersion describes the running build of goatpaver.
+func toolVersion() string {
+	info, ok := readBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && (version == "" || version == "(devel)") {
+			version = setting.Value
+		}
+	}
+	if version == "" {
+		return "unknown"
+	}
+	return version
+}
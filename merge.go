@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Merging Inputs ---
+
+// A plain run can be given several input files, say one per site, that are merged into one
+// document before it is parsed. Their xpaths and presets are put together in order, repeats
+// left out, and so are their URLs. Everything else must agree: a URL two files give
+// different data, an output key two files define differently or an option two files set to
+// different values is a conflict, and the run stops with all of them listed rather than
+// pick one. Files ending in .yaml or .yml are read as YAML, alone or merged.
+
+// maxConflicts is how many conflicts the error lists.
+const maxConflicts = 10
+
+// isYAML tells whether the input document at location is YAML, by its extension.
+func isYAML(location string) bool {
+	if u, err := url.Parse(location); err == nil && u.Scheme == "https" {
+		location = u.Path // Without the query
+	}
+	ext := strings.ToLower(path.Ext(location))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// readInputFile reads the input document at location, a file, an s3:// or gs:// object or
+// an https:// URL, and returns it as JSON: YAML is converted, and protobuf decoded when
+// format says so.
+func readInputFile(ctx context.Context, location, format string) ([]byte, error) {
+	r, err := openInput(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := readAll(r)
+	switch {
+	case err != nil:
+		return nil, err
+	case isYAML(location):
+		return yamlToJSON(data)
+	case format == formatProtobuf:
+		return decodeProtoInput(data)
+	}
+	return data, nil
+}
+
+// yamlToJSON converts a YAML document to JSON.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonValue(value))
+}
+
+// jsonValue replaces the maps with keys other than strings in a decoded YAML value, which
+// JSON can't encode, by maps with the keys as strings.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+	}
+	return value
+}
+
+// inputMerge is the document input files are merged into, with where each part came from.
+type inputMerge struct {
+	options    map[string]json.RawMessage // By field name, as the first file to set it has it
+	xpaths     []json.RawMessage
+	presets    []string
+	urls       map[string]json.RawMessage
+	from       map[string]string // The file each option, output key, preset and URL came from
+	canonical  map[string]string // The canonical JSON of each, to tell repeats from conflicts
+	conflicts  []string
+	haveXPaths bool // Whether any file has xpaths, which an empty list must be kept for
+}
+
+// mergeInputs reads the input documents at locations and merges them into one JSON
+// document, or returns the conflicts between them as an error.
+func mergeInputs(ctx context.Context, locations []string, format string) ([]byte, error) {
+	m := &inputMerge{
+		options:   make(map[string]json.RawMessage),
+		urls:      make(map[string]json.RawMessage),
+		from:      make(map[string]string),
+		canonical: make(map[string]string),
+	}
+	for _, location := range locations {
+		data, err := readInputFile(ctx, location, format)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.add(location, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", location, err)
+		}
+	}
+	if len(m.conflicts) > 0 {
+		sort.Strings(m.conflicts)
+		listed := m.conflicts
+		if len(listed) > maxConflicts {
+			listed = append(listed[:maxConflicts:maxConflicts], fmt.Sprintf("and %d more", len(m.conflicts)-maxConflicts))
+		}
+		return nil, fmt.Errorf("the input files conflict: %s", strings.Join(listed, "; "))
+	}
+	return m.document()
+}
+
+// add merges the input document data of the file location into m.
+func (m *inputMerge) add(location string, data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return fmt.Errorf("the input must be a JSON object")
+	}
+	for name, value := range fields {
+		// Field names match case-insensitively, as when the input is parsed
+		switch strings.ToLower(name) {
+		case "xpaths":
+			var xpaths []json.RawMessage
+			if err := json.Unmarshal(value, &xpaths); err != nil {
+				return fmt.Errorf(`"xpaths" must be a list: %w`, err)
+			}
+			m.haveXPaths = true
+			for _, xpath := range xpaths {
+				var expr Expression
+				if err := json.Unmarshal(xpath, &expr); err != nil {
+					return fmt.Errorf("xpath %s: %w", xpath, err)
+				}
+				// Compared as parsed, so "//h1" repeats {"xpath": "//h1"}
+				parsed, _ := json.Marshal(expr)
+				if m.seen("xpath:"+expr.Key(), location, parsed, "output key %q is defined differently in %s and %s", expr.Key()) {
+					m.xpaths = append(m.xpaths, xpath)
+				}
+			}
+		case "presets":
+			var presets []string
+			if err := json.Unmarshal(value, &presets); err != nil {
+				return fmt.Errorf(`"presets" must be a list of names: %w`, err)
+			}
+			for _, preset := range presets {
+				if _, ok := m.from["preset:"+preset]; !ok {
+					m.from["preset:"+preset] = location
+					m.presets = append(m.presets, preset)
+				}
+			}
+		case "urls":
+			var urls map[string]json.RawMessage
+			if err := json.Unmarshal(value, &urls); err != nil {
+				return fmt.Errorf(`"urls" must be an object of URLs: %w`, err)
+			}
+			for pageURL, urlData := range urls {
+				if m.seen("url:"+pageURL, location, urlData, "URL %q is given different data in %s and %s", pageURL) {
+					m.urls[pageURL] = urlData
+				}
+			}
+		default:
+			key := strings.ToLower(name)
+			if m.seen("option:"+key, location, value, "option %q is set differently in %s and %s", name) {
+				m.options[name] = value
+			}
+		}
+	}
+	return nil
+}
+
+// seen records that the file location has value for key and tells whether it is the first
+// to; a later file with another value is a conflict, reported with conflict, its args and
+// the two files.
+func (m *inputMerge) seen(key, location string, value json.RawMessage, conflict string, args ...interface{}) bool {
+	canonical := canonicalJSON(value)
+	first, ok := m.from[key]
+	if !ok {
+		m.from[key], m.canonical[key] = location, canonical
+		return true
+	}
+	if m.canonical[key] != canonical {
+		m.conflicts = append(m.conflicts, fmt.Sprintf(conflict, append(args, first, location)...))
+	}
+	return false
+}
+
+// canonicalJSON returns value with its object keys sorted and without spaces, so that
+// equal values compare equal.
+func canonicalJSON(value json.RawMessage) string {
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber() // So that large numbers don't round to equal
+	if err := decoder.Decode(&decoded); err != nil {
+		return string(value)
+	}
+	data, _ := json.Marshal(decoded)
+	return string(data)
+}
+
+// document returns the merged input document.
+func (m *inputMerge) document() ([]byte, error) {
+	fields := make(map[string]interface{}, len(m.options)+3)
+	for name, value := range m.options {
+		fields[name] = value
+	}
+	if m.haveXPaths {
+		fields["xpaths"] = append([]json.RawMessage{}, m.xpaths...)
+	}
+	if len(m.presets) > 0 {
+		fields["presets"] = m.presets
+	}
+	fields["urls"] = m.urls
+	return json.Marshal(fields)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeInputs writes each document to a file of its name in a temporary directory and
+// returns their paths, in the order given.
+func writeInputs(t *testing.T, documents ...string) []string {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < len(documents); i += 2 {
+		path := filepath.Join(dir, documents[i])
+		if err := os.WriteFile(path, []byte(documents[i+1]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestMergeInputs(t *testing.T) {
+	paths := writeInputs(t,
+		"a.json", `{"xpaths": ["//h1", {"xpath": "//a/@href", "name": "links", "mode": "all"}], "presets": ["opengraph"],
+			"normalize": {"collapse": true}, "urls": {"https://a.example.com/": {"content": "<h1>A</h1>"}}}`,
+		"b.json", `{"xpaths": [{"xpath": "//h1"}, "//title"], "presets": ["opengraph", "jsonld"],
+			"Normalize": {"collapse": true}, "urls": {"https://b.example.com/": {"content": "<h1>B</h1>"},
+			"https://a.example.com/": {"content": "<h1>A</h1>"}}}`,
+		"c.yaml", "xpaths:\n  - //h2\nurls:\n  https://c.example.com/:\n    content: <h2>C</h2>\n")
+	merged, err := mergeInputs(context.Background(), paths, formatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := parseInput(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, expr := range input.Xpaths {
+		keys = append(keys, expr.Key())
+	}
+	if !reflect.DeepEqual(keys, []string{"//h1", "links", "//title", "//h2"}) {
+		t.Errorf("Unexpected xpaths %q", keys)
+	}
+	if !reflect.DeepEqual(input.Presets, []string{"opengraph", "jsonld"}) {
+		t.Errorf("Unexpected presets %q", input.Presets)
+	}
+	if len(input.Urls) != 3 || string(input.Urls["https://c.example.com/"].Content) != "<h2>C</h2>" {
+		t.Errorf("Unexpected URLs %v", input.Urls)
+	}
+	if input.Normalize == nil || input.Normalize.Collapse == nil || !*input.Normalize.Collapse {
+		t.Errorf("Unexpected normalization %+v", input.Normalize)
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	paths := writeInputs(t,
+		"a.json", `{"xpaths": [{"xpath": "//h1", "name": "title"}], "entities": "strict",
+			"urls": {"https://example.com/": {"content": "<h1>A</h1>"}}}`,
+		"b.json", `{"xpaths": [{"xpath": "//title", "name": "title"}], "entities": "lenient",
+			"urls": {"https://example.com/": {"content": "<h1>B</h1>"}}}`)
+	_, err := mergeInputs(context.Background(), paths, formatJSON)
+	if err == nil {
+		t.Fatal("Merged conflicting inputs")
+	}
+	for _, conflict := range []string{
+		`output key "title" is defined differently in ` + paths[0] + " and " + paths[1],
+		`option "entities" is set differently`,
+		`URL "https://example.com/" is given different data`,
+	} {
+		if !strings.Contains(err.Error(), conflict) {
+			t.Errorf("Error %q doesn't report %q", err, conflict)
+		}
+	}
+
+	bad := writeInputs(t, "list.json", `[]`, "broken.yaml", "xpaths: [")
+	if _, err := mergeInputs(context.Background(), bad[:1], formatJSON); err == nil || !strings.Contains(err.Error(), "must be a JSON object") {
+		t.Errorf("Unexpected error %v for a list", err)
+	}
+	if _, err := mergeInputs(context.Background(), bad[1:], formatJSON); err == nil {
+		t.Error("Read broken YAML")
+	}
+}
+
+func TestInputArguments(t *testing.T) {
+	one, err := parseFlags([]string{"-compact", "in.yaml"})
+	if err != nil || one.input != "in.yaml" || one.inputs != nil {
+		t.Errorf("Unexpected input %q and inputs %q: %v", one.input, one.inputs, err)
+	}
+	several, err := parseFlags([]string{"a.json", "b.json"})
+	if err != nil || !reflect.DeepEqual(several.inputFiles(), []string{"a.json", "b.json"}) {
+		t.Errorf("Unexpected inputs %q: %v", several.inputs, err)
+	}
+	if _, err := parseFlags([]string{"-input", "a.json", "b.json"}); err == nil {
+		t.Error("Combined -input with input arguments")
+	}
+	if files := (runOptions{}).inputFiles(); files != nil {
+		t.Errorf("Unexpected input files %q for stdin", files)
+	}
+}
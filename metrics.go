@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+// --- Per-URL Metrics ---
+
+// metricsKey is the output section with the size of each URL's document and the time
+// spent on it, for finding the documents that slow a big batch down.
+const metricsKey = "$metrics"
+
+// urlMetrics are the size and timings of one URL. A URL skipped midway, e.g. because it
+// doesn't parse, has the timings up to that point.
+type urlMetrics struct {
+	Bytes      int     `json:"bytes"`       // Size of the content as read
+	FetchMS    float64 `json:"fetch_ms"`    // Reading the content from its file or object or fetching it; about 0 for inline content
+	ParseMS    float64 `json:"parse_ms"`    // Validation, XSLT and parsing the document
+	EvaluateMS float64 `json:"evaluate_ms"` // Presets, expressions, rules and suggestions
+}
+
+// elapsedMS returns the time since start in milliseconds, to the microsecond.
+func elapsedMS(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
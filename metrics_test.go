@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestMetrics(t *testing.T) {
+	output, err := processInput([]byte(`{
+		"xpaths": ["//h1"],
+		"urls": {
+			"http://a.com": {"content": "<h1>A</h1>"},
+			"http://b.com": {"content": "<h1>"},
+			"http://c.com": {"file": "missing.html"}
+		},
+		"metrics": true
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := output[metricsKey]
+	if len(metrics) != 2 {
+		t.Fatalf("Unexpected metrics %v; want the URLs that could be read", metrics)
+	}
+	a, b := metrics["http://a.com"].(*urlMetrics), metrics["http://b.com"].(*urlMetrics)
+	if a.Bytes != 10 || b.Bytes != 4 {
+		t.Errorf("Unexpected sizes %+v, %+v", a, b)
+	}
+	for _, m := range []*urlMetrics{a, b} {
+		if m.FetchMS < 0 || m.ParseMS < 0 || m.EvaluateMS < 0 {
+			t.Errorf("Unexpected timings %+v", m)
+		}
+	}
+
+	output, err = processInput([]byte(`{"xpaths": ["//h1"], "urls": {"http://a.com": {"content": "<h1>A</h1>"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := output[metricsKey]; found {
+		t.Error("Expected no metrics unless asked for")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --- Money Transform ---
+
+// money is the result of the money transform. Currency is an ISO 4217 code, or empty if
+// neither the text nor the transform's default names one.
+type money struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency,omitempty"`
+}
+
+// currencySymbols maps symbols and local abbreviations to ISO 4217 codes. Longer entries
+// are matched first, so "US$" wins over "$". A bare "$" is read as US dollars, by far its
+// most common use, but "kr" is shared by the Swedish, Norwegian, Danish and Icelandic
+// krona and maps to no currency. An ISO code in the text, or the transform's currency,
+// settles such cases.
+var currencySymbols = map[string]string{
+	"€": "EUR", "$": "USD", "US$": "USD", "C$": "CAD", "CA$": "CAD", "A$": "AUD", "AU$": "AUD",
+	"NZ$": "NZD", "HK$": "HKD", "S$": "SGD", "R$": "BRL", "MX$": "MXN", "£": "GBP", "¥": "JPY",
+	"円": "JPY", "元": "CNY", "₹": "INR", "₽": "RUB", "₩": "KRW", "₺": "TRY", "₪": "ILS",
+	"₴": "UAH", "₫": "VND", "฿": "THB", "zł": "PLN", "kč": "CZK", "kr": "", "fr.": "CHF",
+	"sfr": "CHF", "lei": "RON", "ft": "HUF", "r": "ZAR",
+}
+
+// currencySymbolOrder lists the keys of currencySymbols longest first, and in byte order
+// among equally long ones, so that the match doesn't depend on map iteration order.
+var currencySymbolOrder = func() []string {
+	symbols := make([]string, 0, len(currencySymbols))
+	for symbol := range currencySymbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if len(symbols[i]) != len(symbols[j]) {
+			return len(symbols[i]) > len(symbols[j])
+		}
+		return symbols[i] < symbols[j]
+	})
+	return symbols
+}()
+
+// currencyCodes are the ISO 4217 codes recognized when written out, e.g. "EUR 12.00".
+var currencyCodes = map[string]bool{
+	"EUR": true, "USD": true, "GBP": true, "JPY": true, "CHF": true, "CAD": true, "AUD": true,
+	"NZD": true, "CNY": true, "HKD": true, "SGD": true, "SEK": true, "NOK": true, "DKK": true,
+	"PLN": true, "CZK": true, "HUF": true, "RON": true, "BGN": true, "RUB": true, "UAH": true,
+	"TRY": true, "ILS": true, "INR": true, "KRW": true, "BRL": true, "MXN": true, "ZAR": true,
+	"THB": true, "VND": true, "IDR": true, "MYR": true, "PHP": true, "AED": true, "SAR": true,
+}
+
+var (
+	// moneyAmount finds the number: digits grouped by dots, commas, apostrophes or spaces
+	// (including no-break and thin spaces), with an optional sign.
+	moneyAmount   = regexp.MustCompile(`[-−]?\d[\d.,'’\x{00a0}\x{202f}\x{2009} ]*`)
+	currencyToken = regexp.MustCompile(`[A-Za-z]{3}`)
+)
+
+// newMoneyStep returns a transform step parsing prices; fallback is the currency used
+// when the text has none.
+func newMoneyStep(fallback string) transformStep {
+	return func(s string) (interface{}, bool) {
+		m, ok := parseMoney(s)
+		if !ok {
+			return nil, false
+		}
+		if m.Currency == "" {
+			m.Currency = strings.ToUpper(fallback)
+		}
+		return m, true
+	}
+}
+
+// parseMoney reads strings like "1.299,00 €", "$1,299.00", "CHF 1'299.–" or "EUR -5".
+func parseMoney(s string) (money, bool) {
+	loc := moneyAmount.FindStringIndex(s)
+	if loc == nil {
+		return money{}, false
+	}
+	amount, ok := parseAmount(strings.TrimRight(s[loc[0]:loc[1]], ".,'’ \u00a0\u202f\u2009"))
+	if !ok {
+		return money{}, false
+	}
+	return money{Amount: amount, Currency: findCurrency(s[:loc[0]] + " " + s[loc[1]:])}, true
+}
+
+// parseAmount interprets the separators in a number. When both dots and commas occur the
+// last one is the decimal mark. A single kind of mark is a decimal mark only if it occurs
+// once and is not followed by exactly three digits, so "1.299" and "1,299" both read as
+// 1299 while "12,50" reads as 12.5.
+func parseAmount(num string) (float64, bool) {
+	negative := strings.HasPrefix(num, "-") || strings.HasPrefix(num, "−")
+	num = strings.TrimLeft(num, "-−")
+	num = strings.NewReplacer("'", "", "’", "", " ", "", "\u00a0", "", "\u202f", "", "\u2009", "").Replace(num)
+
+	decimal := byte(0)
+	lastDot, lastComma := strings.LastIndexByte(num, '.'), strings.LastIndexByte(num, ',')
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		decimal = '.'
+		if lastComma > lastDot {
+			decimal = ','
+		}
+	case lastDot >= 0 || lastComma >= 0:
+		mark := byte('.')
+		last := lastDot
+		if lastComma >= 0 {
+			mark, last = ',', lastComma
+		}
+		if strings.Count(num, string(mark)) == 1 && len(num)-last-1 != 3 {
+			decimal = mark
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(num); i++ {
+		switch c := num[i]; {
+		case c == decimal:
+			sb.WriteByte('.')
+		case c >= '0' && c <= '9':
+			sb.WriteByte(c)
+		}
+	}
+	amount, err := strconv.ParseFloat(sb.String(), 64)
+	if err != nil {
+		return 0, false
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, true
+}
+
+// findCurrency looks for an ISO code first, then for the longest known symbol. An
+// ambiguous symbol yields no currency.
+func findCurrency(rest string) string {
+	for _, token := range currencyToken.FindAllString(rest, -1) {
+		if code := strings.ToUpper(token); currencyCodes[code] && token == code {
+			return code
+		}
+	}
+	lower := strings.ToLower(rest)
+	for _, symbol := range currencySymbolOrder {
+		if !strings.Contains(lower, strings.ToLower(symbol)) {
+			continue
+		}
+		if isLetters(symbol) && !hasWord(lower, symbol) {
+			continue // "kr" must not match inside "krone", nor "r" inside any word
+		}
+		return currencySymbols[symbol]
+	}
+	return ""
+}
+
+// isLetters reports whether s consists of ASCII letters (and dots) only.
+func isLetters(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// hasWord reports whether word occurs in s delimited by non-letters.
+func hasWord(s, word string) bool {
+	for i := 0; ; {
+		j := strings.Index(s[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		if (start == 0 || !isLetters(s[start-1:start])) && (end == len(s) || !isLetters(s[end:end+1])) {
+			return true
+		}
+		i = start + 1
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := map[string]money{
+		"1.299,00 €":            {Amount: 1299, Currency: "EUR"},
+		"$1,299.00":             {Amount: 1299, Currency: "USD"},
+		"US$ 12.50":             {Amount: 12.5, Currency: "USD"},
+		"CHF 1'299.–":           {Amount: 1299, Currency: "CHF"},
+		"12,50 €":               {Amount: 12.5, Currency: "EUR"},
+		"1\u00a0299,99\u00a0zł": {Amount: 1299.99, Currency: "PLN"},
+		"£0.99":                 {Amount: 0.99, Currency: "GBP"},
+		"EUR -5":                {Amount: -5, Currency: "EUR"},
+		"1.299":                 {Amount: 1299},
+		"Preis: 99 kr":          {Amount: 99}, // Shared by several kronor
+		"99 kr (NOK)":           {Amount: 99, Currency: "NOK"},
+		"5 € / 5,40 $":          {Amount: 5, Currency: "EUR"}, // The longer symbol, every time
+		"R$ 1.234.567,89":       {Amount: 1234567.89, Currency: "BRL"},
+		"Price: 42 (incl.)":     {Amount: 42},
+		"1,000,000 JPY":         {Amount: 1000000, Currency: "JPY"},
+		"only 3 left, hurry":    {Amount: 3},
+	}
+	for in, expected := range cases {
+		actual, ok := parseMoney(in)
+		if !ok || actual != expected {
+			t.Errorf("parseMoney(%q) = %+v, %v; want %+v", in, actual, ok, expected)
+		}
+	}
+	if m, ok := parseMoney("Price on request"); ok {
+		t.Errorf("parseMoney without a number = %+v, want no value", m)
+	}
+}
+
+func TestProcessInput_MoneyTransform(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"xpaths": [
+			{"xpath": "//span[@class='price']", "name": "price", "transforms": ["money"]},
+			{"xpath": "//span[@class='bare']", "name": "bare", "transforms": [{"type": "money", "currency": "eur"}]}
+		],
+		"urls": {
+			"http://shop.de": {"content": "<html><body><span class=\"price\">1.299,00 €</span><span class=\"bare\">19,90</span></body></html>"}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"price": {"http://shop.de": money{Amount: 1299, Currency: "EUR"}},
+		"bare":  {"http://shop.de": money{Amount: 19.9, Currency: "EUR"}},
+	}
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+}
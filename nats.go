@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// --- NATS ---
+
+// natsFetchWait bounds how long a receive waits for messages, so the worker notices
+// interruptions.
+var natsFetchWait = 5 * time.Second
+
+// natsFlushTimeout bounds how long publishing a result waits for the server.
+const natsFlushTimeout = 10 * time.Second
+
+// natsConnect connects to the server of a nats:// target and returns the rest of its path.
+func natsConnect(target string) (*nats.Conn, string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, "", err
+	}
+	path := strings.Trim(u.Path, "/")
+	u.Path, u.RawQuery = "", ""
+	conn, err := nats.Connect(u.String(), nats.Name("goatpaver"))
+	if err != nil {
+		return nil, "", fmt.Errorf("connecting to %s: %w", u.Redacted(), err)
+	}
+	return conn, path, nil
+}
+
+// natsQueue takes jobs from a JetStream durable pull consumer, created with explicit acks
+// if it doesn't exist: nats://HOST:4222/STREAM/CONSUMER. Acknowledged jobs are acked,
+// returned ones are nak'ed for immediate redelivery, and jobs neither acked nor nak'ed
+// within the consumer's ack wait are redelivered by the server.
+type natsQueue struct {
+	conn     *nats.Conn
+	consumer jetstream.Consumer
+}
+
+func openNATSQueue(target string) (jobQueue, error) {
+	conn, path, err := natsConnect(target)
+	if err != nil {
+		return nil, err
+	}
+	stream, name, ok := strings.Cut(path, "/")
+	if !ok || stream == "" || name == "" || strings.Contains(name, "/") {
+		conn.Close()
+		return nil, fmt.Errorf("nats queue %q needs the form nats://HOST:4222/STREAM/CONSUMER", target)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ctx := context.Background()
+	consumer, err := js.Consumer(ctx, stream, name)
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		consumer, err = js.CreateConsumer(ctx, stream, jetstream.ConsumerConfig{Durable: name, AckPolicy: jetstream.AckExplicitPolicy})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("opening consumer %s on stream %s: %w", name, stream, err)
+	}
+	return &natsQueue{conn: conn, consumer: consumer}, nil
+}
+
+func (q *natsQueue) receive(ctx context.Context) ([]job, error) {
+	batch, err := q.consumer.Fetch(10, jetstream.FetchMaxWait(natsFetchWait))
+	if err != nil {
+		return nil, err
+	}
+	var jobs []job
+	for m := range batch.Messages() {
+		id := ""
+		if meta, err := m.Metadata(); err == nil {
+			id = strconv.FormatUint(meta.Sequence.Stream, 10)
+		}
+		jobs = append(jobs, job{
+			ID:   id,
+			Body: m.Data(),
+			ack:  func(ctx context.Context) error { return m.DoubleAck(ctx) },
+			nack: func(context.Context) error { return m.Nak() },
+		})
+	}
+	if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+		return jobs, err
+	}
+	return jobs, nil
+}
+
+func (q *natsQueue) Close() error {
+	q.conn.Close()
+	return nil
+}
+
+// natsPublisher publishes results to a subject: nats://HOST:4222/SUBJECT. Each publish
+// is flushed, so a result counts as published once the server has it.
+type natsPublisher struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func openNATSPublisher(target string) (resultPublisher, error) {
+	conn, subject, err := natsConnect(target)
+	if err != nil {
+		return nil, err
+	}
+	if subject == "" || strings.Contains(subject, "/") {
+		conn.Close()
+		return nil, fmt.Errorf("nats results %q need the form nats://HOST:4222/SUBJECT", target)
+	}
+	return &natsPublisher{conn: conn, subject: subject}, nil
+}
+
+func (p *natsPublisher) publish(ctx context.Context, jobID string, result []byte) error {
+	if err := p.conn.Publish(p.subject, result); err != nil {
+		return err
+	}
+	return p.conn.FlushTimeout(natsFlushTimeout)
+}
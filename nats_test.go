@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestNATSWorker(t *testing.T) {
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Shutdown()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	defer func(wait time.Duration) { natsFetchWait = wait }(natsFetchWait)
+	natsFetchWait = 50 * time.Millisecond
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	js, err := conn.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "JOBS", Subjects: []string{"jobs"}}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := conn.SubscribeSync("results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{
+		`{"xpaths": ["//h1"], "urls": {"http://a.com": {"content": "<h1>A</h1>"}}}`,
+		`{"xpaths": ["//h1"], "urls": {"http://b.com": {"content": "<h1>B</h1>"}}}`,
+	} {
+		if _, err := js.Publish("jobs", []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queue, err := openNATSQueue(srv.ClientURL() + "/JOBS/goatpaver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	publisher, err := openNATSPublisher(srv.ClientURL() + "/results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- work(ctx, queue, publisher, 2, false) }()
+
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		m, err := results.NextMsg(5 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r jobResult
+		if err := json.Unmarshal(m.Data, &r); err != nil {
+			t.Fatal(err)
+		}
+		for pageURL := range r.Output["//h1"] {
+			seen[pageURL] = true
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !seen["http://a.com"] || !seen["http://b.com"] {
+		t.Errorf("Results covered %v; want both jobs", seen)
+	}
+
+	// Both jobs were acknowledged, so the consumer has nothing pending
+	info, err := js.ConsumerInfo("JOBS", "goatpaver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.NumAckPending != 0 || info.NumPending != 0 {
+		t.Errorf("Consumer has %d unacknowledged and %d pending jobs; want none", info.NumAckPending, info.NumPending)
+	}
+
+	if _, err := openNATSQueue(srv.ClientURL() + "/JOBS"); err == nil {
+		t.Error("Expected an error for a queue without a consumer")
+	}
+}
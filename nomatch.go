@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// --- No-Match Policy ---
+
+// Values for InputJson.OnNoMatch, what an expression yields on a URL it matches nothing
+// on: omit (the default) leaves the URL out, empty gives "" ([] in mode all), null gives
+// null and error fails the run. The policy covers every input URL but the ones that could
+// not be read or parsed, which are left out with a warning, and not expressions that
+// failed to compile. It is applied
+// last, so coverage, alerts and history only count real matches, and change-only output is
+// left as it is: a URL missing there has not changed.
+const (
+	noMatchOmit  = "omit"
+	noMatchEmpty = "empty"
+	noMatchNull  = "null"
+	noMatchError = "error"
+)
+
+// checkNoMatch validates a no-match policy.
+func checkNoMatch(policy string) error {
+	switch policy {
+	case "", noMatchOmit, noMatchEmpty, noMatchNull, noMatchError:
+		return nil
+	}
+	return fmt.Errorf("unknown no-match policy %q (want omit, empty, null or error)", policy)
+}
+
+// checkMatches fails under the error policy if any expression matched nothing on a URL
+// that was processed, naming the first such pair in order.
+func (input *InputJson) checkMatches(output OutputJson) error {
+	if input.OnNoMatch != noMatchError {
+		return nil
+	}
+	var misses []string
+	for key := range input.compiled {
+		for pageURL := range input.Urls {
+			if _, found := output[key][pageURL]; !found && !input.status.skipped[pageURL] {
+				misses = append(misses, fmt.Sprintf("%s on %s", key, pageURL))
+			}
+		}
+	}
+	if len(misses) == 0 {
+		return nil
+	}
+	sort.Strings(misses)
+	return fmt.Errorf("%d expression(s) matched nothing, starting with %s", len(misses), misses[0])
+}
+
+// fillNoMatch adds what the empty and null policies give for every URL an expression
+// matched nothing on, leaving out the URLs given up on.
+func (input *InputJson) fillNoMatch(output OutputJson) {
+	if input.OnNoMatch != noMatchEmpty && input.OnNoMatch != noMatchNull {
+		return
+	}
+	for key, compiled := range input.compiled {
+		if output[key] == nil {
+			output[key] = make(map[string]interface{})
+		}
+		for pageURL := range input.Urls {
+			if _, found := output[key][pageURL]; found || input.status.skipped[pageURL] {
+				continue
+			}
+			var missing interface{} // null
+			if input.OnNoMatch == noMatchEmpty {
+				missing = ""
+				if compiled.expr.Mode == modeAll {
+					missing = []interface{}{}
+				}
+			}
+			output[key][pageURL] = missing
+		}
+	}
+}
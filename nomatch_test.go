@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNoMatchPolicy(t *testing.T) {
+	run := func(policy string) (OutputJson, error) {
+		input, err := parseInput([]byte(`{
+			"xpaths": ["//h1", {"xpath": "//li", "mode": "all"}, "[invalid"],
+			"urls": {
+				"http://a.com": {"content": "<h1>A</h1><li>1</li>"},
+				"http://b.com": {"content": "<p>B</p>"},
+				"http://broken.com": {"content": "<p>"}
+			},
+			"coverage": true,
+			"on_no_match": "` + policy + `"
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := process(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return finishRun(input, output, time.Now())
+	}
+
+	for policy, expected := range map[string]map[string]interface{}{
+		"":           {"//h1": map[string]interface{}{"http://a.com": "A"}, "//li": map[string]interface{}{"http://a.com": []interface{}{"1"}}},
+		noMatchOmit:  {"//h1": map[string]interface{}{"http://a.com": "A"}, "//li": map[string]interface{}{"http://a.com": []interface{}{"1"}}},
+		noMatchEmpty: {"//h1": map[string]interface{}{"http://a.com": "A", "http://b.com": ""}, "//li": map[string]interface{}{"http://a.com": []interface{}{"1"}, "http://b.com": []interface{}{}}},
+		noMatchNull:  {"//h1": map[string]interface{}{"http://a.com": "A", "http://b.com": nil}, "//li": map[string]interface{}{"http://a.com": []interface{}{"1"}, "http://b.com": nil}},
+	} {
+		output, err := run(policy)
+		if err != nil {
+			t.Fatalf("%q: %v", policy, err)
+		}
+		for key, values := range expected {
+			if !reflect.DeepEqual(output[key], values) {
+				t.Errorf("%q: %s = %#v, want %#v", policy, key, output[key], values)
+			}
+		}
+		// URLs that failed to parse and expressions that failed to compile are not filled in, and
+		// coverage counts real matches
+		if len(output["[invalid"]) != 0 {
+			t.Errorf("%q: invalid expression got values %v", policy, output["[invalid"])
+		}
+		if coverage := output[coverageKey]["//h1"].(coverageEntry); coverage.Matched != 1 {
+			t.Errorf("%q: coverage %+v, want one match", policy, coverage)
+		}
+	}
+
+	if _, err := run(noMatchError); err == nil || !strings.Contains(err.Error(), "2 expression(s) matched nothing, starting with //h1 on http://b.com") {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := parseInput([]byte(`{"xpaths": [], "urls": {}, "on_no_match": "skip"}`)); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// --- Text Normalization ---
+
+// Normalization selects clean-up steps applied to text results. It can be set for the
+// whole input and per expression; fields left unset in an expression fall back to the
+// input-level value, so an expression can turn off a single global step.
+type Normalization struct {
+	Trim           *bool `json:"trim,omitempty"`             // Remove leading and trailing whitespace
+	Collapse       *bool `json:"collapse,omitempty"`         // Replace internal whitespace runs with one space
+	StripZeroWidth *bool `json:"strip_zero_width,omitempty"` // Remove zero-width spaces, joiners and BOMs
+	DecodeEntities *bool `json:"decode_entities,omitempty"`  // Decode HTML entities left in the text
+}
+
+// merge returns n with every unset field taken from defaults. Either side may be nil.
+func (n *Normalization) merge(defaults *Normalization) Normalization {
+	var merged Normalization
+	if defaults != nil {
+		merged = *defaults
+	}
+	if n == nil {
+		return merged
+	}
+	if n.Trim != nil {
+		merged.Trim = n.Trim
+	}
+	if n.Collapse != nil {
+		merged.Collapse = n.Collapse
+	}
+	if n.StripZeroWidth != nil {
+		merged.StripZeroWidth = n.StripZeroWidth
+	}
+	if n.DecodeEntities != nil {
+		merged.DecodeEntities = n.DecodeEntities
+	}
+	return merged
+}
+
+func isSet(b *bool) bool {
+	return b != nil && *b
+}
+
+// isZeroWidth reports whether r is an invisible formatting character that commonly
+// sneaks into scraped text.
+func isZeroWidth(r rune) bool {
+	switch r {
+	case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff':
+		return true
+	}
+	return false
+}
+
+// apply runs the enabled steps on s. Entities are decoded first so that, for example,
+// a decoded &nbsp; is then collapsed and trimmed like any other whitespace.
+func (n Normalization) apply(s string) string {
+	if isSet(n.DecodeEntities) {
+		s = html.UnescapeString(s)
+	}
+	if isSet(n.StripZeroWidth) {
+		s = strings.Map(func(r rune) rune {
+			if isZeroWidth(r) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	if isSet(n.Collapse) {
+		buf := getBuffer()
+		inSpace := false
+		for _, r := range s {
+			if unicode.IsSpace(r) {
+				if !inSpace {
+					buf.WriteByte(' ')
+				}
+				inSpace = true
+				continue
+			}
+			inSpace = false
+			buf.WriteRune(r)
+		}
+		s = buf.String()
+		putBuffer(buf)
+	}
+	if isSet(n.Trim) {
+		s = strings.TrimFunc(s, unicode.IsSpace)
+	}
+	return s
+}
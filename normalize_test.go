@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProcessInput_Normalization(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"normalize": {"trim": true, "collapse": true},
+		"xpaths": [
+			"//p",
+			{"xpath": "//p", "name": "raw", "normalize": {"trim": false, "collapse": false}},
+			{"xpath": "//p", "name": "clean", "normalize": {"strip_zero_width": true, "decode_entities": true}},
+			{"xpath": "//p", "name": "markup", "return": "outerHTML"}
+		],
+		"urls": {
+			"http://example.com": {
+				"content": "<html><body><p>\n  Fish &amp;amp;\u200b  chips  </p></body></html>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"//p":    {"http://example.com": "Fish &amp;\u200b chips"},
+		"raw":    {"http://example.com": "\n  Fish &amp;\u200b  chips  "},
+		"clean":  {"http://example.com": "Fish & chips"},
+		"markup": {"http://example.com": "<p>\n  Fish &amp;amp;\u200b  chips  </p>"},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		expectedJson, _ := json.MarshalIndent(expectedOutput, "", "  ")
+		actualJson, _ := json.MarshalIndent(actualOutput, "", "  ")
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// --- Output Order ---
+
+// Output keys are listed in the order of the input: expressions as in "xpaths", then
+// presets as in "presets", then anything else (report sections, keys added by scripts)
+// sorted. URLs are sorted. JSON, MessagePack and CBOR output keep that order, so the
+// output of two runs diffs cleanly; protobuf maps have no order.
+
+// outputRank returns the position of each expression and preset key of input.
+func (input *InputJson) outputRank() map[string]int {
+	rank := make(map[string]int, len(input.Xpaths)+len(input.Presets))
+	add := func(key string) {
+		if _, seen := rank[key]; !seen {
+			rank[key] = len(rank)
+		}
+	}
+	for _, expr := range input.Xpaths {
+		add(expr.Key())
+	}
+	for _, name := range input.Presets {
+		add(presetKeyPrefix + name)
+	}
+	return rank
+}
+
+// sortKeys sorts keys by rank, putting keys without one last in lexical order.
+func sortKeys(keys []string, rank map[string]int) {
+	sort.Slice(keys, func(i, j int) bool {
+		ri, iRanked := rank[keys[i]]
+		rj, jRanked := rank[keys[j]]
+		if iRanked != jRanked {
+			return iRanked
+		}
+		if iRanked {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+}
+
+// outputKeys returns the keys of output other than report sections in output order.
+func (input *InputJson) outputKeys(output OutputJson) []string {
+	var keys []string
+	for key := range output {
+		if !strings.HasPrefix(key, "$") {
+			keys = append(keys, key)
+		}
+	}
+	sortKeys(keys, input.outputRank())
+	return keys
+}
+
+// orderedDocument is an output document to be encoded in output order: the keys of its
+// first two levels, which hold output keys and URLs in either grouping, are ordered and
+// values below them are encoded as they are.
+type orderedDocument struct {
+	value interface{} // OutputJson, the values of one URL, or records, which are in order already
+	rank  map[string]int
+}
+
+// ordered wraps v to be encoded in the output order of input.
+func (input *InputJson) ordered(v interface{}) orderedDocument {
+	return orderedDocument{value: v, rank: input.outputRank()}
+}
+
+// tree returns the document with its maps replaced by orderedMaps.
+func (d orderedDocument) tree() interface{} {
+	switch v := d.value.(type) {
+	case OutputJson:
+		top := orderedMap{values: make(map[string]interface{}, len(v))}
+		for key, values := range v {
+			top.keys = append(top.keys, key)
+			top.values[key] = d.orderMap(values)
+		}
+		sortKeys(top.keys, d.rank)
+		return top
+	case map[string]interface{}:
+		return d.orderMap(v)
+	}
+	return d.value
+}
+
+func (d orderedDocument) orderMap(m map[string]interface{}) orderedMap {
+	ordered := orderedMap{keys: make([]string, 0, len(m)), values: m}
+	for key := range m {
+		ordered.keys = append(ordered.keys, key)
+	}
+	sortKeys(ordered.keys, d.rank)
+	return ordered
+}
+
+func (d orderedDocument) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.tree())
+}
+
+func (d orderedDocument) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.Encode(d.tree())
+}
+
+func (d orderedDocument) MarshalCBOR() ([]byte, error) {
+	return cborMode.Marshal(d.tree())
+}
+
+// orderedMap is a map encoded with its keys in the given order.
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (m orderedMap) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if err := enc.EncodeMapLen(len(m.keys)); err != nil {
+		return err
+	}
+	for _, key := range m.keys {
+		if err := enc.EncodeString(key); err != nil {
+			return err
+		}
+		if err := enc.Encode(m.values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m orderedMap) MarshalCBOR() ([]byte, error) {
+	// A map header (major type 5) with the number of pairs, then the pairs
+	var buf bytes.Buffer
+	switch n := uint64(len(m.keys)); {
+	case n < 24:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= 0xff:
+		buf.Write([]byte{0xb8, byte(n)})
+	case n <= 0xffff:
+		buf.WriteByte(0xb9)
+		binary.Write(&buf, binary.BigEndian, uint16(n))
+	case n <= 0xffffffff:
+		buf.WriteByte(0xba)
+		binary.Write(&buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(0xbb)
+		binary.Write(&buf, binary.BigEndian, n)
+	}
+	for _, key := range m.keys {
+		for _, v := range []interface{}{key, m.values[key]} {
+			data, err := cborMode.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(data)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// cborMode encodes CBOR with map keys sorted, like JSON and MessagePack output.
+var cborMode = func() cbor.EncMode {
+	mode, err := cbor.EncOptions{Sort: cbor.SortBytewiseLexical}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return mode
+}()
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOutputOrder(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//z", {"xpath": "//h1", "name": "m"}, "//a"],
+		"presets": ["seo"],
+		"urls": {
+			"http://b.com": {"content": "<html><body><z>1</z><h1>2</h1><a>3</a></body></html>"},
+			"http://a.com": {"content": "<html><body><z>4</z><a>5</a></body></html>"}
+		},
+		"coverage": true
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys in input order, then presets and report sections; URLs sorted
+	inOrder := func(data []byte, keys ...string) bool {
+		at := -1
+		for _, key := range keys {
+			i := bytes.Index(data[at+1:], []byte(key))
+			if i < 0 {
+				return false
+			}
+			at += 1 + i
+		}
+		return true
+	}
+	for _, c := range []struct {
+		opts runOptions
+		keys []string
+	}{
+		{runOptions{encoding: formatJSON}, []string{`"//z"`, `"http://a.com"`, `"http://b.com"`, `"m"`, `"//a"`, `"preset:seo"`, `"$coverage"`, `"//z"`, `"m"`, `"//a"`}},
+		{runOptions{encoding: formatJSON, groupBy: groupByURL}, []string{`"$coverage"`, `"http://a.com"`, `"//z"`, `"//a"`, `"http://b.com"`, `"//z"`, `"m"`, `"//a"`, `"preset:seo"`}},
+		{runOptions{encoding: formatJSON, shape: shapeFlat}, []string{`"http://a.com","xpath":"//z"`, `"http://b.com","xpath":"//z"`, `"http://a.com","xpath":"m"`, `"http://b.com","xpath":"m"`, `"http://a.com","xpath":"//a"`}},
+		{runOptions{encoding: formatMsgpack}, []string{"//z", "http://a.com", "http://b.com", "m", "//a", "preset:seo", "$coverage"}},
+		{runOptions{encoding: formatCBOR}, []string{"//z", "http://a.com", "http://b.com", "m", "//a", "preset:seo", "$coverage"}},
+	} {
+		var first []byte
+		for i := 0; i < 10; i++ {
+			data, err := encodeOutput(c.opts.encoding, false, input.ordered(c.opts.format(input, output)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first == nil {
+				first = data
+			} else if !bytes.Equal(data, first) {
+				t.Fatalf("%+v: output differs between encodings", c.opts)
+			}
+		}
+		if !inOrder(first, c.keys...) {
+			t.Errorf("%+v: keys not in order %s in %q", c.opts, strings.Join(c.keys, ", "), first)
+		}
+	}
+}
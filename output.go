@@ -0,0 +1,703 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// --- Output Options ---
+
+const usage = `Usage: goatpaver [-group-by xpath|url] [-output-shape nested|flat] [-out-template PATH]
+                 [-output URL] [-run-id ID] [-input FILE] [-compress gzip]
+                 [-input-format json|protobuf] [-output-format json|msgpack|cbor|protobuf]
+                 [-compact|-pretty] [-on-no-match omit|empty|null|error] [-empty-on-no-match]
+                 [-error-values] [-strict] [-strict-xpaths]
+                 [-envelope] [-stats text|json] [-report PATH]
+                 [-manifest PATH] [-quiet] [-log-level LEVEL] [-log-format text|json]
+                 [-warnings-file PATH] [-dry-run] [-fail-fast] [-max-errors N]
+                 [-max-doc-size SIZE] [-max-memory SIZE] [-xpath-concurrency N]
+                 [-include-url REGEXP] [-exclude-url REGEXP] [-sample P%] [-limit N]
+                 [-shard K/N] [-checkpoint PATH] [-resume PATH] [-watch]
+                 [-workers URL,...] [-batch-size N] [-tls-ca FILE] [-tls-cert FILE]
+                 [-tls-key FILE] [-tls-insecure-skip-verify] [-resolve HOST:PORT:ADDR,...]
+                 [-xslt-command PATH] [-validate-command PATH] [-cpuprofile FILE]
+                 [-memprofile FILE] [FILE...] < INPUT
+       goatpaver pave|goat [FLAGS] [FILE...] < INPUT
+       goatpaver infer|diff|history|test|validate|worker|bench|completion|version ...
+
+Reads an input document from stdin, or from the -input file, s3://BUCKET/KEY,
+gs://BUCKET/OBJECT or https:// URL, and prints the extracted values as JSON, keyed by
+xpath and then URL; -group-by url keys them by URL first. -output-shape flat prints an array of
+{"url", "xpath", "value", "matched"} records instead, ordered the same way.
+Input files can be given as arguments instead of -input, and several are merged into one
+document: their xpaths, presets and URLs are put together in order, repeats left out. A
+URL given different data in two files, an output key defined differently or an option set
+to different values is a conflict, and the run stops listing them. Files ending in .yaml
+or .yml are read as YAML, as arguments or with -input.
+An expression that matches nothing on a URL is left out for it; -on-no-match empty gives
+"" instead ([] in mode all), null gives null, and error fails the run. It overrides the
+input's "on_no_match"; -empty-on-no-match is short for -on-no-match empty. A URL that
+can't be read or parsed is left out too, with a warning; -error-values also adds an
+"$errors" section with the warning's code and message for each such URL.
+-output-format msgpack or cbor encodes the output as MessagePack or CBOR instead of JSON,
+the same maps and arrays in a compact binary form, and protobuf as the messages in
+schemas/goatpaver.proto, which -input-format protobuf reads the input document as too.
+
+-out-template writes each URL's values to its own file instead, named by a text/template
+such as 'results/{{.Host}}/{{.Slug}}.json' (fields URL, Host, Path and Slug); stdout
+then only has the report sections. -output stores the values elsewhere instead, tagged
+with the -run-id (random by default):
+
+  sqlite://FILE[?table=NAME]
+  postgres://DSN[?table=NAME]          postgres:// alone reads $GOATPAVER_POSTGRES_DSN
+  parquet://FILE                       the flat shape
+  elasticsearch://HOST/INDEX           one document per URL, also opensearch://; INDEX
+                                       may use {{.Date}}, {{.RunID}} and {{.Host}}
+  bigquery://PROJECT/DATASET/TABLE     [?credentials=KEY.json]
+  kafka://BROKER/TOPIC                 keyed by URL, [?per=record][&format=avro]
+  https://ENDPOINT                     webhook for the run, or each URL with ?per=url,
+                                       signed with $GOATPAVER_WEBHOOK_SECRET
+  s3://BUCKET/KEY, gs://BUCKET/OBJECT  the output as printed, one object per run; KEY
+                                       may use {{timestamp}}, {{date}} and {{run_id}}
+
+JSON is indented when printed to a terminal and compact otherwise; -pretty and -compact
+choose. Files and objects are indented unless -compact is given. -compress gzip
+compresses the output. -output-format, -compact and -compress apply alike to what is
+printed, the -out-template files and s3:// and gs:// objects; files and objects named
+*.gz are compressed either way.
+
+-envelope wraps the output in {"run": {...}, "results": OUTPUT}, where the run has the
+goatpaver version, the output's "schema_version", the run ID, "started_at" and
+"finished_at" times, the exit status, whether the run was "complete" (no URL failed)
+and counts of URLs, failed URLs, output keys, values and warnings. It applies to what is
+printed and to s3:// and gs:// objects, but not to templates or -out-template files.
+
+-stats writes a summary of the run to stderr, as text or one line of JSON: how many URLs
+were processed and failed, the bytes of content read, the time taken and the share of
+URLs each expression and preset matched.
+
+-report writes a standalone HTML page about the run to a file or s3:// or gs:// object,
+for sharing: the share of URLs each expression matched, the warnings and failed URLs, and
+a few of the values each expression extracted.
+
+While processing, the URLs done, the rate and the time left are shown on stderr if it is
+a terminal, unless -quiet is given.
+
+Warnings go to stderr as "Warning: ..." lines; -log-format json logs one JSON object per
+line instead, with the level, message and details such as the URL. -log-level debug also
+logs each URL processed, and warn or error hides messages below that level.
+-warnings-file also writes each warning to a file as it happens, one JSON object per
+line: {"code": ..., "subject": ..., "message": ..., "skipped": ...}, where the subject is
+the URL, or the XPath or preset for xpath_invalid and preset_unknown; see status.go for
+the codes. skipped tells whether the URL was given up on.
+
+-fail-fast stops the run at the first URL that can't be read, fetched or parsed, and
+exits with 2 without printing or storing any output, for checks where partial output is
+worse than none. -max-errors stops it once N URLs have failed instead, with the output of
+the URLs processed so far and a run_stopped warning; it exits with 3.
+
+-max-doc-size skips URLs whose content is larger than SIZE, such as 50MB, with a
+too_large warning; fetched bodies are not read past it. -max-memory keeps the heap near
+SIZE while processing by spilling the values extracted so far to a temporary file when
+it grows past it; they are read back once all URLs are done. It can't be combined with
+-checkpoint or -resume. -xpath-concurrency matches up to N xpaths against each document
+at once, which pays off for inputs with hundreds of them; transforms still run one at a
+time.
+
+-include-url only processes the URLs matching a regular expression (RE2 syntax, matching
+anywhere in the URL unless anchored), and -exclude-url leaves out those matching one, e.g.
+-include-url '^https://shop\.example\.com/'. -shard 3/10 splits the URLs into 10 shards
+by a hash of the URL and only processes the third, so that a large input can be run on
+10 machines, each given the same input and its own shard, without coordinating them.
+-sample 5% then processes about 5% of the URLs, the same ones each run as they are also
+chosen by a hash of the URL, and -limit N only the first N in order, to try changed
+xpaths quickly. All of them apply before anything else, including -dry-run.
+
+-checkpoint writes the URLs done so far, with their values, to a file every 10 seconds
+and at the end of the run. -resume continues a run that was interrupted from its
+checkpoint file: the URLs in it are skipped, their values come from the checkpoint, and
+the output is that of the whole run. URLs that failed are tried again. The input document
+must be the same; -resume keeps writing the checkpoint unless -checkpoint names another.
+
+-workers spreads the URLs over workers started with "goatpaver worker -listen ADDR" on
+other hosts, for corpora too large for one: they are sent -batch-size at a time (100 by
+default) to whichever worker is idle, over HTTP, and the values and warnings each worker
+answers with are merged into the run's output, as if it had processed them itself.
+Workers read URL files and fetch URLs themselves, so files must be object URLs or on a
+file system they share. A worker that fails is left out of the rest of the run and its
+batch given to another, three times at most. With $GOATPAVER_WORKER_TOKEN set, workers only
+take batches sent with the same token. -workers can't be combined with -checkpoint,
+-resume or -max-memory.
+
+-tls-ca trusts the CA certificates in a PEM file besides the system's, and -tls-cert and
+-tls-key present a client certificate, for fetching and for https:// input documents, as
+for internal services behind a private CA. -tls-insecure-skip-verify accepts any server
+certificate, which lets connections be intercepted; it is warned about on each run. They
+take precedence over the input's "fetch": {"tls": {"ca", "cert", "key",
+"insecure_skip_verify"}}.
+
+-resolve connects to ADDR for HOST:PORT instead of where DNS says, like curl's --resolve,
+so that a staging environment can be scraped under the production hostnames without
+editing /etc/hosts. The Host header, SNI and certificate checks still use HOST. It applies
+to fetching and to https:// input documents, adds to the input's "fetch": {"resolve":
+["HOST:PORT:ADDR", ...]} and wins where they pin the same HOST:PORT.
+
+-xslt-command runs another xsltproc-compatible processor than xsltproc for the input's
+"xslt" stylesheet, and -validate-command another xmllint-compatible validator than
+xmllint for its "validate" schema. Only the flags choose them, so an input document can't
+run a program of its own. Both get --nonet, and the processor --novalid, so documents
+can't make them load DTDs or reach the network; documents declaring external entities
+aren't transformed.
+
+-watch runs again whenever an input file changes, or a file it refers to: URL content
+files and the files they xi:include, the script, template, XSLT stylesheet and validation
+schema. Each run writes its output as usual, and a run that fails is logged instead of
+ending goatpaver, until it is interrupted.
+
+-cpuprofile and -memprofile write a CPU profile of the run and a heap profile at its end,
+for "go tool pprof". They can't be combined with -watch; "goatpaver worker" takes them
+too, and -pprof to serve profiles while it runs. "goatpaver bench" times each stage of a
+run on a synthetic corpus or an input document, to compare releases.
+
+-dry-run prints the plan of the run as JSON instead of running it: each expression and
+preset, with the error that would skip it, where each URL's content would come from and
+the -out-template file it would go to, and what the run would write to. Nothing is read,
+fetched or written.
+
+Every flag can also be set by an environment variable: GOATPAVER_ and its name in capitals
+with underscores, e.g. GOATPAVER_OUTPUT_FORMAT=cbor or GOATPAVER_STRICT=true. Flags on
+the command line take precedence. Credentials come from the environment as well:
+$GOATPAVER_POSTGRES_DSN, $GOATPAVER_WEBHOOK_SECRET, $GOATPAVER_INPUT_TOKEN (sent as a
+bearer token to https:// inputs) and the usual AWS and Google Cloud variables, and
+requests go through $HTTPS_PROXY and $HTTP_PROXY when set.
+"goatpaver completion bash", zsh or fish prints a script completing the subcommands and
+flags in that shell, and "goatpaver version" the version and supported features.
+
+"goatpaver pave" is the same as goatpaver without a subcommand. "goatpaver goat", like
+goatpaver invoked as go_goat (the name "go build" gives the binary), behaves as go_goat
+builds did: JSON is always indented unless -compact is given, and failed URLs leave the
+exit status 0. Both make the same run otherwise.
+
+Exit status: 0 when all went well; 1 (or the input's "rules_exit_code") when rules
+failed; 2 on errors that stop the run; 3 when some URLs could not be read or parsed and
+4 when none could. -strict counts warnings as failures: a URL with any warning has
+failed, and a warning about the run, such as an XPath that doesn't compile, makes it 3.
+-strict-xpaths fails the run with 2 instead if any XPath doesn't compile, naming them
+all, rather than skipping them with an empty result.
+
+-manifest writes a JSON record of the run to a file or s3:// or gs:// object: its flags,
+run ID, timestamps and goatpaver version, and the SHA-256 of the input document, of each
+URL's content and of the output, so a run can be audited and repeated.
+`
+
+// Values for the -group-by flag.
+const (
+	groupByXPath = "xpath"
+	groupByURL   = "url"
+)
+
+// Values for the -output-shape flag.
+const (
+	shapeNested = "nested"
+	shapeFlat   = "flat"
+)
+
+// Values for the -output-format flag.
+const (
+	formatJSON     = "json"
+	formatMsgpack  = "msgpack"
+	formatCBOR     = "cbor"
+	formatProtobuf = "protobuf" // Also for -input-format
+)
+
+// compressGzip is the one value of the -compress flag.
+const compressGzip = "gzip"
+
+// runOptions are the command-line flags of a plain run.
+type runOptions struct {
+	groupBy      string
+	shape        string
+	outTemplate  *template.Template // Per-URL output file names, or nil to print everything
+	output       *url.URL           // Sink for the values, or nil; see sinks.go
+	runID        string
+	input        string            // Input document location, or "" for stdin
+	inputFormat  string            // formatJSON or formatProtobuf
+	encoding     string            // -output-format
+	compress     string            // "" or compressGzip
+	onNoMatch    string            // Overrides the input's no-match policy unless ""
+	strict       bool              // Count warnings as failures in the exit status
+	strictXPaths bool              // Fail the run on XPaths that don't compile
+	compact      bool              // Never indent JSON
+	pretty       bool              // Indent printed JSON even if stdout is not a terminal
+	envelope     bool              // Wrap the output in run metadata, see envelope.go
+	stats        string            // "", statsText or statsJSON; see stats.go
+	report       string            // Where to write the HTML report, or ""; see report.go
+	quiet        bool              // Never show progress
+	logger       *slog.Logger      // As -log-level and -log-format say
+	warnings     string            // File to write warnings to as JSON lines, or ""
+	dryRun       bool              // Print the plan instead of running, see plan.go
+	failFast     bool              // Stop at the first URL that fails, see status.go
+	maxErrors    int               // Stop once this many URLs have failed, or 0
+	maxDocSize   int64             // Skip URLs with more content than this, or 0; see limits.go
+	maxMemory    int64             // Heap budget before values are spilled, or 0; see spill.go
+	concurrency  int               // Expressions matched against a document at once, see parallel.go
+	includeURL   *regexp.Regexp    // Only process the URLs matching, if not nil; see select.go
+	excludeURL   *regexp.Regexp    // Leave out the URLs matching, if not nil
+	shard        int               // The shard of the URLs to process, from 1 to shards
+	shards       int               // Number of shards the URLs are split into, or 0 for none
+	sample       float64           // Percentage of the URLs to process, or 0 for all
+	limit        int               // Number of URLs to process at most, or 0 for all
+	checkpoint   string            // Where to write checkpoints, or ""; see checkpoint.go
+	resume       string            // Checkpoint to resume the run from, or ""
+	inputs       []string          // Input files given as arguments, if more than one; see merge.go
+	watch        bool              // Run again on changes to the input, see watch.go
+	tls          *TLSOptions       // The -tls-* flags, or nil; see tls.go
+	resolve      []string          // The -resolve entries, "HOST:PORT:ADDR"; see resolve.go
+	pins         map[string]string // resolve as parsed, or nil
+	commands     externalCommands  // The external tools to run, see external.go
+	workers      []string          // Workers to distribute the URLs to, or nil; see distributed.go
+	batchSize    int               // URLs sent to a worker at a time
+	errorValues  bool              // Add the "$errors" section, see compat.go
+	legacyExit   bool              // Invoked as go_goat: failed URLs don't change the exit status
+	profiles     *profiles         // -cpuprofile and -memprofile, see profile.go
+	manifest     string            // Where to write the run manifest, or ""; see manifest.go
+	params       map[string]string // The flags given, for the manifest; -output without credentials
+}
+
+// inputFiles returns the input files of the run, none for stdin.
+func (opts runOptions) inputFiles() []string {
+	if opts.inputs != nil {
+		return opts.inputs
+	}
+	if opts.input != "" {
+		return []string{opts.input}
+	}
+	return nil
+}
+
+// parseFlags parses the command line of a plain run.
+func parseFlags(args []string) (runOptions, error) {
+	var opts runOptions
+	flags := flag.NewFlagSet("goatpaver", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	flags.StringVar(&opts.groupBy, "group-by", groupByXPath, "key the output by xpath or url first")
+	flags.StringVar(&opts.shape, "output-shape", shapeNested, "nested maps or a flat list of records")
+	outTemplate := flags.String("out-template", "", "write each URL's values to the file named by this template")
+	output := flags.String("output", "", "store the values in this database, e.g. sqlite://results.db or postgres://host/db")
+	flags.StringVar(&opts.runID, "run-id", "", "identifies the run in -output rows; default random")
+	flags.StringVar(&opts.input, "input", "", "read the input document from this file, s3:// or gs:// object or https:// URL")
+	flags.StringVar(&opts.inputFormat, "input-format", formatJSON, "read the input document as json or protobuf")
+	flags.StringVar(&opts.encoding, "output-format", formatJSON, "encode the output as json, msgpack, cbor or protobuf")
+	flags.StringVar(&opts.compress, "compress", "", "gzip to compress the output")
+	flags.StringVar(&opts.onNoMatch, "on-no-match", "", "what expressions matching nothing yield: omit, empty, null or error")
+	emptyOnNoMatch := flags.Bool("empty-on-no-match", false, "same as -on-no-match empty")
+	flags.BoolVar(&opts.errorValues, "error-values", false, "add an \"$errors\" section saying why each failed URL failed")
+	flags.BoolVar(&opts.strict, "strict", false, "count warnings as failures in the exit status")
+	flags.BoolVar(&opts.strictXPaths, "strict-xpaths", false, "fail the run if any XPath doesn't compile")
+	flags.BoolVar(&opts.compact, "compact", false, "print JSON without indentation")
+	flags.BoolVar(&opts.pretty, "pretty", false, "indent printed JSON, even when not printing to a terminal")
+	flags.BoolVar(&opts.envelope, "envelope", false, "wrap the output in an envelope with run metadata and counts")
+	flags.StringVar(&opts.stats, "stats", "", "write a summary of the run to stderr as text or json")
+	flags.StringVar(&opts.report, "report", "", "write an HTML report of the run to this file")
+	flags.BoolVar(&opts.quiet, "quiet", false, "don't show progress on stderr")
+	newRunLogger := logFlags(flags)
+	opts.profiles = profileFlags(flags)
+	flags.StringVar(&opts.warnings, "warnings-file", "", "also write each warning to this file as a JSON line")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "print what the run would do instead of running it")
+	flags.BoolVar(&opts.failFast, "fail-fast", false, "stop at the first URL that can't be read, fetched or parsed")
+	flags.IntVar(&opts.maxErrors, "max-errors", 0, "stop once this many URLs have failed, keeping the output so far")
+	maxDocSize := flags.String("max-doc-size", "", "skip URLs whose content is larger than this, e.g. 50MB")
+	maxMemory := flags.String("max-memory", "", "spill values to a temporary file when the heap grows past this, e.g. 1GB")
+	flags.IntVar(&opts.concurrency, "xpath-concurrency", 1, "match up to this many xpaths against a document at once")
+	includeURL := flags.String("include-url", "", "only process URLs matching this regular expression")
+	excludeURL := flags.String("exclude-url", "", "leave out URLs matching this regular expression")
+	flags.StringVar(&opts.checkpoint, "checkpoint", "", "write the URLs done, with their values, to this file as the run goes")
+	flags.StringVar(&opts.resume, "resume", "", "continue the run from this checkpoint file")
+	flags.BoolVar(&opts.watch, "watch", false, "run again whenever the -input file or a file it refers to changes")
+	tlsOptions := tlsFlags(flags)
+	commands := externalFlags(flags)
+	resolve := flags.String("resolve", "", "connect to ADDR for HOST:PORT when fetching, HOST:PORT:ADDR entries comma-separated")
+	workers := flags.String("workers", "", "distribute the URLs to these worker URLs, comma-separated")
+	flags.IntVar(&opts.batchSize, "batch-size", 100, "send this many URLs to a worker at a time")
+	shard := flags.String("shard", "", "only process the K-th of N shards of the URLs, e.g. 3/10")
+	sample := flags.String("sample", "", "only process this percentage of the URLs, e.g. 5%")
+	flags.IntVar(&opts.limit, "limit", 0, "only process the first N URLs")
+	flags.StringVar(&opts.manifest, "manifest", "", "write a manifest of the run, with checksums, to this file")
+	if err := setFlagsFromEnv(flags); err != nil {
+		return opts, err
+	}
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	switch {
+	case flags.NArg() > 0 && opts.input != "":
+		flags.Usage()
+		return opts, fmt.Errorf("-input cannot be combined with input files as arguments")
+	case flags.NArg() == 1:
+		opts.input = flags.Arg(0)
+	case flags.NArg() > 1:
+		opts.inputs = flags.Args()
+	}
+	switch opts.groupBy {
+	case groupByXPath, groupByURL:
+	default:
+		return opts, fmt.Errorf("unknown -group-by %q (want xpath or url)", opts.groupBy)
+	}
+	switch opts.shape {
+	case shapeNested, shapeFlat:
+	default:
+		return opts, fmt.Errorf("unknown -output-shape %q (want nested or flat)", opts.shape)
+	}
+	switch opts.inputFormat {
+	case formatJSON, formatProtobuf:
+	default:
+		return opts, fmt.Errorf("unknown -input-format %q (want json or protobuf)", opts.inputFormat)
+	}
+	switch opts.encoding {
+	case formatJSON, formatMsgpack, formatCBOR, formatProtobuf:
+	default:
+		return opts, fmt.Errorf("unknown -output-format %q (want json, msgpack, cbor or protobuf)", opts.encoding)
+	}
+	if *emptyOnNoMatch {
+		if opts.onNoMatch != "" && opts.onNoMatch != noMatchEmpty {
+			return opts, fmt.Errorf("-empty-on-no-match and -on-no-match %s cannot be combined", opts.onNoMatch)
+		}
+		opts.onNoMatch = noMatchEmpty
+	}
+	if err := checkNoMatch(opts.onNoMatch); err != nil {
+		return opts, fmt.Errorf("-on-no-match: %w", err)
+	}
+	if opts.maxErrors < 0 {
+		return opts, fmt.Errorf("-max-errors must not be negative")
+	}
+	var err error
+	if opts.logger, err = newRunLogger(); err != nil {
+		return opts, err
+	}
+	switch opts.stats {
+	case "", statsText, statsJSON:
+	default:
+		return opts, fmt.Errorf("unknown -stats %q (want text or json)", opts.stats)
+	}
+	if opts.compact && opts.pretty {
+		return opts, fmt.Errorf("-compact and -pretty cannot be combined")
+	}
+	if opts.compress != "" && opts.compress != compressGzip {
+		return opts, fmt.Errorf("unknown -compress %q (want gzip)", opts.compress)
+	}
+	if opts.includeURL, err = compileURLPattern("include-url", *includeURL); err != nil {
+		return opts, err
+	}
+	if opts.excludeURL, err = compileURLPattern("exclude-url", *excludeURL); err != nil {
+		return opts, err
+	}
+	if opts.maxDocSize, err = parseSize(*maxDocSize); err != nil {
+		return opts, fmt.Errorf("-max-doc-size: %w", err)
+	}
+	if opts.maxMemory, err = parseSize(*maxMemory); err != nil {
+		return opts, fmt.Errorf("-max-memory: %w", err)
+	}
+	if opts.watch && (opts.profiles.cpu != "" || opts.profiles.mem != "") {
+		return opts, fmt.Errorf("-cpuprofile and -memprofile cannot be combined with -watch")
+	}
+	if opts.maxMemory > 0 && opts.checkpointPath() != "" {
+		return opts, fmt.Errorf("-max-memory cannot be combined with -checkpoint or -resume")
+	}
+	opts.tls = tlsOptions()
+	opts.commands = *commands
+	if *resolve != "" {
+		opts.resolve = strings.Split(*resolve, ",")
+		if opts.pins, err = parseResolve(opts.resolve); err != nil {
+			return opts, fmt.Errorf("-resolve: %w", err)
+		}
+	}
+	if opts.workers, err = parseWorkers(*workers); err != nil {
+		return opts, err
+	}
+	if opts.workers != nil && (opts.maxMemory > 0 || opts.checkpointPath() != "") {
+		return opts, fmt.Errorf("-workers cannot be combined with -checkpoint, -resume or -max-memory")
+	}
+	if opts.batchSize < 1 {
+		return opts, fmt.Errorf("-batch-size must be at least 1")
+	}
+	if opts.concurrency < 1 {
+		return opts, fmt.Errorf("-xpath-concurrency must be at least 1")
+	}
+	if opts.shard, opts.shards, err = parseShard(*shard); err != nil {
+		return opts, err
+	}
+	if opts.sample, err = parseSample(*sample); err != nil {
+		return opts, err
+	}
+	if opts.limit < 0 {
+		return opts, fmt.Errorf("-limit must not be negative")
+	}
+	if *outTemplate != "" {
+		tmpl, err := template.New("out-template").Option("missingkey=error").Parse(*outTemplate)
+		if err != nil {
+			return opts, fmt.Errorf("parsing -out-template: %w", err)
+		}
+		opts.outTemplate = tmpl
+	}
+	if *output != "" {
+		target, err := parseSinkTarget(*output)
+		if err != nil {
+			return opts, err
+		}
+		opts.output = target
+	}
+	opts.params = make(map[string]string)
+	flags.Visit(func(f *flag.Flag) { opts.params[f.Name] = f.Value.String() })
+	if opts.output != nil {
+		opts.params["output"] = opts.output.Redacted()
+	}
+	return opts, nil
+}
+
+// format returns output in the form selected by the flags, ready to be encoded as JSON.
+func (opts runOptions) format(input *InputJson, output OutputJson) interface{} {
+	if opts.shape == shapeFlat {
+		return flatRecords(input, output, opts.groupBy == groupByURL)
+	}
+	if opts.groupBy == groupByURL {
+		return groupOutputByURL(input, output)
+	}
+	return output
+}
+
+// groupOutputByURL turns output around into map[url]map[xpath]value. Every input URL gets
+// an entry, even if nothing matched on it; report sections ("$" keys, which cannot clash
+// with URLs) are kept as they are.
+func groupOutputByURL(input *InputJson, output OutputJson) OutputJson {
+	grouped := make(OutputJson, len(input.Urls))
+	for pageURL := range input.Urls {
+		grouped[pageURL] = make(map[string]interface{})
+	}
+	for key, results := range output {
+		if strings.HasPrefix(key, "$") {
+			grouped[key] = results
+			continue
+		}
+		for pageURL, value := range results {
+			if grouped[pageURL] == nil {
+				grouped[pageURL] = make(map[string]interface{})
+			}
+			grouped[pageURL][key] = value
+		}
+	}
+	return grouped
+}
+
+// record is one value of the flat output shape.
+type record struct {
+	URL     string      `json:"url"`
+	XPath   string      `json:"xpath"` // Output key, which is the expression's name if it has one
+	Value   interface{} `json:"value"`
+	Matched bool        `json:"matched"` // False if the expression produced nothing; Value is null then
+}
+
+// flatRecords lists output as records, one per output key and input URL, in output order
+// (see order.go) and then by URL, or by URL first with byURL. With change-only output,
+// only the reported changes are listed. Report sections have no place in the flat shape
+// and are left out.
+func flatRecords(input *InputJson, output OutputJson, byURL bool) []record {
+	urls := make([]string, 0, len(input.Urls))
+	for pageURL := range input.Urls {
+		urls = append(urls, pageURL)
+	}
+	sort.Strings(urls)
+
+	records := []record{}
+	for _, key := range input.outputKeys(output) {
+		for _, pageURL := range urls {
+			value, found := output[key][pageURL]
+			if !found && input.ChangesOnly != nil {
+				continue
+			}
+			records = append(records, record{URL: pageURL, XPath: key, Value: value, Matched: found && value != nil})
+		}
+	}
+	if byURL {
+		sort.SliceStable(records, func(i, j int) bool { return records[i].URL < records[j].URL })
+	}
+	return records
+}
+
+// --- Per-URL Output Files ---
+
+// outFileData is what the -out-template sees for one URL.
+type outFileData struct {
+	URL  string
+	Host string // Host and port, or "" for URLs without one
+	Path string
+	Slug string // Path and query as a file name, e.g. "products-widget-1"; "index" for the root
+}
+
+func newOutFileData(pageURL string) outFileData {
+	data := outFileData{URL: pageURL, Slug: slugify(pageURL)}
+	if u, err := url.Parse(pageURL); err == nil {
+		data.Host, data.Path = u.Host, u.Path
+		if u.Host != "" || u.Scheme != "" {
+			data.Slug = slugify(strings.TrimPrefix(u.RequestURI(), "/"))
+		}
+	}
+	return data
+}
+
+// slugify lowercases s and turns every run of characters other than letters and digits
+// into a single dash.
+func slugify(s string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if sb.Len() == 0 {
+		return "index"
+	}
+	return sb.String()
+}
+
+// writeFiles writes the values of each input URL to the file named by the -out-template,
+// in the selected output shape, creating directories as needed. Two URLs mapping to the
+// same file is an error, since one would silently replace the other. It returns the
+// checksums of the files by name.
+func (opts runOptions) writeFiles(input *InputJson, output OutputJson) (map[string]checksum, error) {
+	grouped := groupOutputByURL(input, output)
+	records := flatRecords(input, output, true)
+	written := make(map[string]string) // File name to URL
+	sums := make(map[string]checksum)
+	urls := make([]string, 0, len(input.Urls))
+	for pageURL := range input.Urls {
+		urls = append(urls, pageURL)
+	}
+	sort.Strings(urls)
+
+	for _, pageURL := range urls {
+		var name strings.Builder
+		if err := opts.outTemplate.Execute(&name, newOutFileData(pageURL)); err != nil {
+			return nil, err
+		}
+		path := filepath.Clean(name.String())
+		if other, taken := written[path]; taken {
+			return nil, fmt.Errorf("URLs %s and %s both map to %s", other, pageURL, path)
+		}
+		written[path] = pageURL
+
+		var values interface{} = grouped[pageURL]
+		if opts.shape == shapeFlat {
+			own := []record{}
+			for _, r := range records {
+				if r.URL == pageURL {
+					own = append(own, r)
+				}
+			}
+			values = own
+		}
+		data, err := encodeOutput(opts.encoding, !opts.compact, input.ordered(values))
+		if err != nil {
+			return nil, err
+		}
+		if opts.compressed(path) {
+			if data, err = gzipData(data); err != nil {
+				return nil, err
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return nil, err
+		}
+		sums[path] = newChecksum(data)
+	}
+	return sums, nil
+}
+
+// encodeOutput encodes v in the -output-format encoding; JSON ends in a newline and is
+// indented with indent. MessagePack and CBOR use the JSON field names; see proto.go for
+// protobuf.
+func encodeOutput(encoding string, indent bool, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeOutput(&buf, encoding, indent, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stdoutIsTerminal tells whether stdout is a terminal rather than a file or pipe; tests
+// replace it.
+var stdoutIsTerminal = func() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// indentPrinted tells whether printed JSON is indented: for people reading a terminal, or
+// as -pretty and -compact say.
+func (opts runOptions) indentPrinted() bool {
+	if opts.compact || opts.pretty {
+		return opts.pretty
+	}
+	return stdoutIsTerminal()
+}
+
+// mediaType is the media type of output encoded as encoding.
+func mediaType(encoding string) string {
+	switch encoding {
+	case formatMsgpack:
+		return "application/vnd.msgpack"
+	case formatCBOR:
+		return "application/cbor"
+	case formatProtobuf:
+		return "application/x-protobuf"
+	}
+	return "application/json"
+}
+
+// compressed tells whether the file or object called name is to be gzipped.
+func (opts runOptions) compressed(name string) bool {
+	return opts.compress == compressGzip || strings.HasSuffix(name, ".gz")
+}
+
+// gzipData compresses data.
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// reportSections returns just the report sections ("$" keys) of output.
+func reportSections(output OutputJson) OutputJson {
+	sections := make(OutputJson)
+	for key, results := range output {
+		if strings.HasPrefix(key, "$") {
+			sections[key] = results
+		}
+	}
+	return sections
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestParseFlags(t *testing.T) {
+	opts, err := parseFlags(nil)
+	if err != nil || opts.groupBy != groupByXPath || opts.shape != shapeNested {
+		t.Errorf("parseFlags() = %+v, %v; want nested output grouped by xpath", opts, err)
+	}
+	opts, err = parseFlags([]string{"--group-by", "url"})
+	if err != nil || opts.groupBy != groupByURL {
+		t.Errorf("parseFlags(--group-by url) = %+v, %v; want grouping by url", opts, err)
+	}
+	for _, args := range [][]string{{"-group-by", "host"}, {"-output-shape", "csv"}, {"-compress", "zstd"}, {"-output-format", "xml"}, {"-compact", "-pretty"}, {"-on-no-match", "skip"}, {"-stats", "yaml"}, {"-log-level", "loud"}, {"-input", "a.json", "extra"}, {"-unknown"}} {
+		if _, err := parseFlags(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
+
+func TestGroupOutputByURL(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", "//span"],
+		"urls": {
+			"http://a.com": {"content": "<p><h1>A</h1><span>12</span></p>"},
+			"http://b.com": {"content": "<p><h1>B</h1></p>"},
+			"http://c.com": {"content": "<p></p>"}
+		},
+		"coverage": true
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grouped := runOptions{groupBy: groupByURL}.format(input, output).(OutputJson)
+	expected := OutputJson{
+		"http://a.com": {"//h1": "A", "//span": "12"},
+		"http://b.com": {"//h1": "B"},
+		"http://c.com": {},
+		coverageKey:    output[coverageKey],
+	}
+	if !reflect.DeepEqual(expected, grouped) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expected, grouped)
+	}
+
+	if shaped := (runOptions{groupBy: groupByXPath}).format(input, output); !reflect.DeepEqual(shaped, output) {
+		t.Errorf("Grouping by xpath changed the output: %#v", shaped)
+	}
+}
+
+func TestFlatRecords(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", {"xpath": "//span", "name": "price", "mode": "all"}],
+		"urls": {
+			"http://a.com": {"content": "<p><h1>A</h1><span>12</span><span>13</span></p>"},
+			"http://b.com": {"content": "<p><h1>B</h1></p>"}
+		},
+		"coverage": true
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []record{
+		{URL: "http://a.com", XPath: "//h1", Value: "A", Matched: true},
+		{URL: "http://b.com", XPath: "//h1", Value: "B", Matched: true},
+		{URL: "http://a.com", XPath: "price", Value: []interface{}{"12", "13"}, Matched: true},
+		{URL: "http://b.com", XPath: "price"},
+	}
+	if actual := (runOptions{shape: shapeFlat}).format(input, output); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Unexpected records.\nExpected: %#v\nGot:      %#v", expected, actual)
+	}
+
+	byURL := flatRecords(input, output, true)
+	if byURL[0].XPath != "//h1" || byURL[1].XPath != "price" || byURL[1].URL != "http://a.com" {
+		t.Errorf("Records are not ordered by URL: %#v", byURL)
+	}
+
+	// Change-only output lists just the reported changes
+	input.ChangesOnly = &ChangeOptions{}
+	changed := OutputJson{"//h1": {"http://b.com": "B"}, "price": {"http://a.com": nil}}
+	expected = []record{
+		{URL: "http://b.com", XPath: "//h1", Value: "B", Matched: true},
+		{URL: "http://a.com", XPath: "price"},
+	}
+	if actual := flatRecords(input, changed, false); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Unexpected change records.\nExpected: %#v\nGot:      %#v", expected, actual)
+	}
+}
+
+func TestOutFileData(t *testing.T) {
+	for pageURL, expected := range map[string]outFileData{
+		"http://shop.com/products/Widget_1?color=red": {Host: "shop.com", Path: "/products/Widget_1", Slug: "products-widget-1-color-red"},
+		"https://shop.com:8080/":                      {Host: "shop.com:8080", Path: "/", Slug: "index"},
+		"pages/about.html":                            {Path: "pages/about.html", Slug: "pages-about-html"},
+	} {
+		expected.URL = pageURL
+		if actual := newOutFileData(pageURL); actual != expected {
+			t.Errorf("newOutFileData(%q) = %+v; want %+v", pageURL, actual, expected)
+		}
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1"],
+		"urls": {
+			"http://a.com/x": {"content": "<h1>A</h1>"},
+			"http://b.com/x": {"content": "<p></p>"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	opts, err := parseFlags([]string{"-out-template", dir + "/{{.Host}}/{{.Slug}}.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := opts.writeFiles(input, output); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{
+		"a.com/x.json": "{\n  \"//h1\": \"A\"\n}\n",
+		"b.com/x.json": "{}\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("Unexpected %s.\nExpected: %q\nGot:      %q", name, expected, data)
+		}
+	}
+
+	opts.shape = shapeFlat
+	if _, err := opts.writeFiles(input, output); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "b.com/x.json"))
+	var records []record
+	if err := json.Unmarshal(data, &records); err != nil || len(records) != 1 || records[0].Matched {
+		t.Errorf("Unexpected flat file %s", data)
+	}
+
+	// Both URLs have the same slug, so dropping the host makes them collide
+	if opts, err = parseFlags([]string{"-out-template", dir + "/{{.Slug}}.json"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := opts.writeFiles(input, output); err == nil {
+		t.Error("Expected an error for colliding file names")
+	}
+	if _, err := parseFlags([]string{"-out-template", "{{.Nope"}); err == nil {
+		t.Error("Expected an error for a malformed template")
+	}
+
+	// Compressed by name, or all of them with -compress
+	for _, args := range [][]string{
+		{"-out-template", dir + "/gz/{{.Host}}.json.gz"},
+		{"-out-template", dir + "/gz/{{.Host}}.json", "-compress", "gzip"},
+	} {
+		if opts, err = parseFlags(args); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := opts.writeFiles(input, output); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a.com.json.gz", "a.com.json"} {
+		f, err := os.Open(filepath.Join(dir, "gz", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if data, err := io.ReadAll(zr); err != nil || string(data) != "{\n  \"//h1\": \"A\"\n}\n" {
+			t.Errorf("Unexpected %s: %q, %v", name, data, err)
+		}
+	}
+}
+
+func TestReportSections(t *testing.T) {
+	output := OutputJson{"//h1": {"http://a.com": "A"}, rulesKey: {"http://a.com": "failed"}}
+	if sections := reportSections(output); len(sections) != 1 || sections[rulesKey] == nil {
+		t.Errorf("Unexpected report sections %#v", sections)
+	}
+}
+
+func TestEncodeOutput(t *testing.T) {
+	output := OutputJson{"//h1": {"http://a.com": "A", "http://b.com": []interface{}{"x", "y"}}}
+	records := []record{{URL: "http://a.com", XPath: "//h1", Value: "A", Matched: true}}
+	want := map[string]interface{}{"//h1": map[string]interface{}{"http://a.com": "A", "http://b.com": []interface{}{"x", "y"}}}
+	wantRecords := []interface{}{map[string]interface{}{"url": "http://a.com", "xpath": "//h1", "value": "A", "matched": true}}
+
+	decoders := map[string]func([]byte, interface{}) error{
+		formatJSON:    json.Unmarshal,
+		formatMsgpack: msgpack.Unmarshal,
+		formatCBOR: func(data []byte, v interface{}) error {
+			// Decode maps with string keys, as the other decoders do
+			dm, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}{})}.DecMode()
+			if err != nil {
+				return err
+			}
+			return dm.Unmarshal(data, v)
+		},
+	}
+	for encoding, decode := range decoders {
+		data, err := encodeOutput(encoding, true, output)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		var got map[string]interface{}
+		if err := decode(data, &got); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: decoded %#v, %v; want %#v", encoding, got, err, want)
+		}
+
+		// Records keep their JSON field names
+		if data, err = encodeOutput(encoding, true, records); err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		var gotRecords []interface{}
+		if err := decode(data, &gotRecords); err != nil || !reflect.DeepEqual(gotRecords, wantRecords) {
+			t.Errorf("%s: decoded records %#v, %v; want %#v", encoding, gotRecords, err, wantRecords)
+		}
+	}
+}
+
+func TestIndentPrinted(t *testing.T) {
+	oldTerminal := stdoutIsTerminal
+	defer func() { stdoutIsTerminal = oldTerminal }()
+
+	for _, c := range []struct {
+		args     []string
+		terminal bool
+		indent   bool
+	}{
+		{nil, true, true},
+		{nil, false, false},
+		{[]string{"-compact"}, true, false},
+		{[]string{"-pretty"}, false, true},
+	} {
+		stdoutIsTerminal = func() bool { return c.terminal }
+		opts, err := parseFlags(c.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := opts.indentPrinted(); got != c.indent {
+			t.Errorf("indentPrinted() with %q on a terminal=%v = %v, want %v", c.args, c.terminal, got, c.indent)
+		}
+	}
+
+	data, err := encodeOutput(formatJSON, false, OutputJson{"//h1": {"http://a.com": "A"}})
+	if err != nil || string(data) != "{\"//h1\":{\"http://a.com\":\"A\"}}\n" {
+		t.Errorf("Unexpected compact output %q, %v", data, err)
+	}
+}
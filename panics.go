@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// --- Panic Isolation ---
+
+// A document may make the parser or the XPath library panic. That is a bug to fix, but it
+// shouldn't lose the rest of a batch: process gives up on the URL with a warnPanic
+// warning instead, and logs the stack at debug level.
+
+// panicError is a panic turned into an error.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// recovered calls f, returning a *panicError if it panics.
+func recovered(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{value: r, stack: debug.Stack()}
+		}
+	}()
+	return f()
+}
+
+// warnPanicked gives up on pageURL if err is a panic while doing what, telling whether it
+// was one.
+func (input *InputJson) warnPanicked(pageURL, what string, err error) bool {
+	var p *panicError
+	if !errors.As(err, &p) {
+		return false
+	}
+	input.warnURL(warnPanic, pageURL, true, "%s URL '%s' panicked: %v. Skipping this URL.", what, pageURL, p.value)
+	logger.Debug(fmt.Sprintf("Stack of the panic on URL '%s':\n%s", pageURL, p.stack), "url", pageURL)
+	return true
+}
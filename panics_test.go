@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRecovered(t *testing.T) {
+	err := recovered(func() error { panic("boom") })
+	var p *panicError
+	if !errors.As(err, &p) || p.value != "boom" || !strings.Contains(string(p.stack), "TestRecovered") {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := recovered(func() error { return errors.New("plain") }); err == nil || errors.As(err, &p) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestProcessPanic(t *testing.T) {
+	presets["panics"] = func(doc *html.Node, base *url.URL) interface{} {
+		if strings.Contains(base.Path, "bad") {
+			var m map[string]int
+			m["x"] = 1 // Panics on a nil map
+		}
+		return "ok"
+	}
+	defer delete(presets, "panics")
+
+	input, err := parseInput([]byte(`{"xpaths": ["//h1"], "presets": ["panics"], "urls": {
+		"http://a.com/good": {"content": "<h1>A</h1>"}, "http://a.com/bad": {"content": "<h1>B</h1>"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output["//h1"]["http://a.com/good"] != "A" || output["//h1"]["http://a.com/bad"] != nil {
+		t.Errorf("Unexpected output %v", output)
+	}
+	if len(input.status.log) != 1 || input.status.log[0].Code != warnPanic || !input.status.skipped["http://a.com/bad"] {
+		t.Errorf("Unexpected warnings %+v", input.status.log)
+	}
+	if !strings.HasPrefix(input.status.log[0].Message, "Applying presets to URL 'http://a.com/bad' panicked: assignment to entry in nil map") {
+		t.Errorf("Unexpected message %q", input.status.log[0].Message)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/user/go_goat/internal/xmlpath"
+)
+
+// --- Concurrent Matching ---
+
+// With -xpath-concurrency N, the expressions are matched against a parsed document up to
+// N at a time, for inputs with hundreds of expressions per page. Parsed documents aren't
+// changed by matching, so the expressions can share one. Only matching is concurrent:
+// transforms, which may call the script, rules and suggestions run one expression at a
+// time afterwards, as do the warnings.
+
+// matchResult is what matching one expression gave.
+type matchResult struct {
+	value interface{}
+	ok    bool
+	err   error // errEvaluationTimeout, or a *panicError
+}
+
+// matchAll matches each expression in compiled against root as matchWithin does, up to
+// workers at a time, and returns the results by output key.
+func matchAll(compiled map[string]compiledExpression, root *xmlpath.Node, base *url.URL, timeout time.Duration, workers int) map[string]matchResult {
+	results := make(map[string]matchResult, len(compiled))
+	if workers <= 1 || len(compiled) <= 1 {
+		for key, c := range compiled {
+			results[key] = matchOne(c, root, base, timeout)
+		}
+		return results
+	}
+
+	keys := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(compiled)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				r := matchOne(compiled[key], root, base, timeout)
+				mu.Lock()
+				results[key] = r
+				mu.Unlock()
+			}
+		}()
+	}
+	for key := range compiled {
+		keys <- key
+	}
+	close(keys)
+	wg.Wait()
+	return results
+}
+
+// matchOne matches c against root, returning a panic as the result's error.
+func matchOne(c compiledExpression, root *xmlpath.Node, base *url.URL, timeout time.Duration) matchResult {
+	var r matchResult
+	err := recovered(func() (err error) {
+		r.value, r.ok, err = c.matchWithin(root, base, timeout)
+		return err
+	})
+	if err != nil {
+		return matchResult{err: err}
+	}
+	return r
+}
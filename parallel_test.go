@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchAll(t *testing.T) {
+	var xpaths []string
+	for i := range 50 {
+		xpaths = append(xpaths, fmt.Sprintf(`"//li[%d]"`, i+1), fmt.Sprintf(`{"xpath": "//li[%d]", "name": "replaced %d", "transforms": [{"type": "replace", "pattern": "x", "with": "y"}]}`, i+1, i))
+	}
+	document := fmt.Sprintf(`{"xpaths": [%s], "urls": {"a": {"content": "<ul>%s</ul>"}}}`,
+		strings.Join(xpaths, ", "), strings.Repeat("<li>x</li>", 40))
+
+	var outputs []OutputJson
+	for _, concurrency := range []int{1, 8} {
+		input, err := parseInput([]byte(document))
+		if err != nil {
+			t.Fatal(err)
+		}
+		input.concurrency = concurrency
+		output, err := process(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, output)
+	}
+	if !reflect.DeepEqual(outputs[0], outputs[1]) {
+		t.Errorf("Concurrent matching gave %v, want %v", outputs[1], outputs[0])
+	}
+	if outputs[1]["replaced 0"]["a"] != "y" || len(outputs[1]["//li[41]"]) != 0 {
+		t.Errorf("Unexpected output %v", outputs[1])
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// --- Parquet Sink ---
+
+// parquetRow is one record as stored in Parquet; the columns match the SQL sinks.
+type parquetRow struct {
+	URL       string    `parquet:"url,dict"`
+	XPath     string    `parquet:"xpath,dict"`
+	Value     *string   `parquet:"value,optional"` // JSON encoding, null when nothing matched
+	Matched   bool      `parquet:"matched"`
+	RunID     string    `parquet:"run_id,dict"`
+	Timestamp time.Time `parquet:"timestamp,timestamp(microsecond)"`
+}
+
+// parquetSink writes the records of a run to a Snappy-compressed Parquet file:
+// parquet://results.parquet, or parquet:///data/lake/run.parquet for an absolute path.
+// Each run replaces the file, so a data lake wants one file name per run.
+type parquetSink struct {
+	path string
+}
+
+func openParquetSink(target *url.URL) (sink, error) {
+	path := target.Host + target.Path
+	if path == "" {
+		return nil, fmt.Errorf("parquet output needs a file name")
+	}
+	return &parquetSink{path: path}, nil
+}
+
+func (s *parquetSink) write(run sinkRun) error {
+	rows := make([]parquetRow, len(run.Records))
+	for i, r := range run.Records {
+		value, err := recordValue(r)
+		if err != nil {
+			return err
+		}
+		rows[i] = parquetRow{URL: r.URL, XPath: r.XPath, Matched: r.Matched, RunID: run.ID, Timestamp: run.Time.UTC()}
+		if text, ok := value.(string); ok {
+			rows[i].Value = &text
+		}
+	}
+
+	f, err := os.Create(s.path)
+	if err != nil {
+		return err
+	}
+	w := parquet.NewGenericWriter[parquetRow](f, parquet.Compression(&parquet.Snappy))
+	if _, err := w.Write(rows); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *parquetSink) Close() error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestParquetSink(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", {"xpath": "//span", "name": "price", "mode": "all"}],
+		"urls": {
+			"http://a.com": {"content": "<p><h1>A</h1><span>12</span><span>13</span></p>"},
+			"http://b.com": {"content": "<p><h1>B</h1></p>"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "run.parquet")
+	opts, err := parseFlags([]string{"-output", "parquet://" + path, "-run-id", "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := opts.writeSink(input, output, at); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := parquet.ReadFile[parquetRow](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func(s string) *string { return &s }
+	expected := []parquetRow{
+		{URL: "http://a.com", XPath: "//h1", Value: str(`"A"`), Matched: true},
+		{URL: "http://a.com", XPath: "price", Value: str(`["12","13"]`), Matched: true},
+		{URL: "http://b.com", XPath: "//h1", Value: str(`"B"`), Matched: true},
+		{URL: "http://b.com", XPath: "price"},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("Got %d rows, want %d", len(rows), len(expected))
+	}
+	for i, want := range expected {
+		got := rows[i]
+		if got.URL != want.URL || got.XPath != want.XPath || got.Matched != want.Matched ||
+			(got.Value == nil) != (want.Value == nil) || got.Value != nil && *got.Value != *want.Value ||
+			got.RunID != "r1" || !got.Timestamp.Equal(at) {
+			t.Errorf("Row %d = %+v; want %+v", i, got, want)
+		}
+	}
+}
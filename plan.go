@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// --- Dry Run ---
+
+// runPlan is what -dry-run prints instead of running: what would be evaluated, where each
+// URL would come from and what the run would write. Nothing is read, fetched or written
+// to make it.
+type runPlan struct {
+	Expressions []plannedExpression `json:"expressions"`
+	Presets     []plannedPreset     `json:"presets,omitempty"`
+	URLs        []plannedURL        `json:"urls"`
+	Output      string              `json:"output"`           // "stdout" or the -output sink, without credentials
+	Writes      []string            `json:"writes,omitempty"` // Everything else the run would write or send to
+}
+
+type plannedExpression struct {
+	Key   string `json:"key"`
+	XPath string `json:"xpath"`
+	Error string `json:"error,omitempty"` // Why it would be skipped
+}
+
+type plannedPreset struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// plannedURL is where a URL's content would come from.
+type plannedURL struct {
+	URL      string `json:"url"`
+	Source   string `json:"source"`             // content, file, fetch or none, for a URL that would fail
+	Location string `json:"location,omitempty"` // The file or object to read
+	Bytes    int    `json:"bytes,omitempty"`    // Size of inline content
+	File     string `json:"file,omitempty"`     // The -out-template file its values would go to
+}
+
+// plan returns the plan of a run of input with opts.
+func (opts runOptions) plan(input *InputJson) (*runPlan, error) {
+	p := &runPlan{Expressions: []plannedExpression{}, URLs: []plannedURL{}, Output: "stdout"}
+	for _, expr := range input.Xpaths {
+		planned := plannedExpression{Key: expr.Key(), XPath: expr.XPath}
+		if _, err := compileExpression(expr, input); err != nil {
+			planned.Error = err.Error()
+		}
+		p.Expressions = append(p.Expressions, planned)
+	}
+	for _, name := range input.Presets {
+		planned := plannedPreset{Name: name}
+		if _, ok := presets[name]; !ok {
+			planned.Error = "unknown preset"
+		}
+		p.Presets = append(p.Presets, planned)
+	}
+
+	urls := make([]string, 0, len(input.Urls))
+	for pageURL := range input.Urls {
+		urls = append(urls, pageURL)
+	}
+	sort.Strings(urls)
+	for _, pageURL := range urls {
+		urlData := input.Urls[pageURL]
+		planned := plannedURL{URL: pageURL, Source: "content", Bytes: len(urlData.Content)}
+		switch {
+		case urlData.File != "":
+			planned.Source, planned.Location = "file", urlData.File
+		case len(urlData.Content) == 0 && input.Fetch != nil:
+			planned.Source = "fetch"
+		case len(urlData.Content) == 0:
+			planned.Source = "none"
+		}
+		if opts.outTemplate != nil {
+			var name strings.Builder
+			if err := opts.outTemplate.Execute(&name, newOutFileData(pageURL)); err != nil {
+				return nil, err
+			}
+			planned.File = name.String()
+		}
+		p.URLs = append(p.URLs, planned)
+	}
+
+	if opts.output != nil {
+		p.Output = opts.output.Redacted()
+	}
+	for _, write := range []struct{ what, where string }{
+		{"history", input.History},
+		{"manifest", opts.manifest},
+		{"report", opts.report},
+		{"warnings-file", opts.warnings},
+		{"checkpoint", opts.checkpointPath()},
+	} {
+		if write.where != "" {
+			p.Writes = append(p.Writes, write.what+" "+write.where)
+		}
+	}
+	if input.Alerts != nil {
+		p.Writes = append(p.Writes, "alerts "+redactURL(input.Alerts.Webhook))
+	}
+	return p, nil
+}
+
+// redactURL returns rawURL with any password replaced, like url.URL.Redacted.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
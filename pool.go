@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// --- Buffer Pooling ---
+
+// A large run renders, normalizes and reads content into buffers for every value of every
+// URL, and the garbage collector ends up spending much of the run on them. Those buffers
+// come from bufferPool instead and go back once their contents have been copied out. The
+// XML decoders can't be reused, as encoding/xml has no way to reset one, but reading the
+// content into a pooled buffer saves them the growing copies of io.ReadAll.
+
+// maxPooledBuffer is the capacity above which a buffer isn't put back, so that one huge
+// document doesn't keep its buffer for the rest of the run.
+const maxPooledBuffer = 8 << 20
+
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buf to the pool; nothing may use it or what it returned afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// readAll is io.ReadAll, reading into a pooled buffer and allocating only the result.
+func readAll(r io.Reader) ([]byte, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
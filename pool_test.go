@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	buf := getBuffer()
+	buf.WriteString("left over")
+	putBuffer(buf)
+	if buf := getBuffer(); buf.Len() != 0 {
+		t.Errorf("Pooled buffer not empty: %q", buf.String())
+	}
+
+	huge := bytes.NewBuffer(make([]byte, 0, maxPooledBuffer+1))
+	putBuffer(huge)
+	if huge.Cap() != maxPooledBuffer+1 {
+		t.Error("Buffer over the limit was reset")
+	}
+
+	data, err := readAll(strings.NewReader("<h1>A</h1>"))
+	if err != nil || string(data) != "<h1>A</h1>" {
+		t.Errorf("readAll = %q, %v", data, err)
+	}
+	// What was read must not change when the buffer is used again
+	if again, _ := readAll(strings.NewReader("<p>C</p>.....")); string(data) != "<h1>A</h1>" || string(again) != "<p>C</p>....." {
+		t.Errorf("Results share pooled memory: %q", data)
+	}
+}
+
+func TestPooledRendering(t *testing.T) {
+	input, err := parseInput([]byte(`{"xpaths": [{"xpath": "//p", "return": "outerHTML", "mode": "all"}, {"xpath": "//p", "name": "text", "normalize": {"collapse": true}}],
+		"urls": {"a": {"content": "<div><p>one  <b>x</b></p><p>two</p></div>"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"<p>one  <b>x</b></p>", "<p>two</p>"}
+	if got, ok := output["//p"]["a"].([]interface{}); !ok || len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Unexpected fragments %#v", output["//p"]["a"])
+	}
+	if output["text"]["a"] != "one x" {
+		t.Errorf("Unexpected text %q", output["text"]["a"])
+	}
+}
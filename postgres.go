@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// --- PostgreSQL Sink ---
+
+// postgresDSNEnv holds the connection string for -output postgres:// without one; if it
+// is unset too, the standard PGHOST, PGUSER, ... variables apply.
+const postgresDSNEnv = "GOATPAVER_POSTGRES_DSN"
+
+// postgresBatchSize is the number of rows sent to the server at a time.
+const postgresBatchSize = 500
+
+// postgresSink upserts records into a PostgreSQL table, created if missing. The -output
+// URL is the connection string, such as postgres://user@db.example.com/extraction, plus an
+// optional ?table= parameter (default "results", may be schema-qualified). Like the SQLite
+// sink, rows are keyed by run, URL and xpath; values are stored as jsonb.
+type postgresSink struct {
+	conn  *pgx.Conn
+	table string
+}
+
+func openPostgresSink(target *url.URL) (sink, error) {
+	dsn, table, err := postgresTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+		url       text NOT NULL,
+		xpath     text NOT NULL,
+		value     jsonb,
+		matched   boolean NOT NULL,
+		run_id    text NOT NULL,
+		timestamp timestamptz NOT NULL,
+		PRIMARY KEY (run_id, url, xpath)
+	)`)
+	if err != nil {
+		conn.Close(ctx)
+		return nil, fmt.Errorf("creating table %s: %w", table, err)
+	}
+	return &postgresSink{conn: conn, table: table}, nil
+}
+
+// postgresTarget splits an -output URL into the connection string and the table name.
+func postgresTarget(target *url.URL) (string, string, error) {
+	dsn := *target
+	query := dsn.Query()
+	table := query.Get("table")
+	if table == "" {
+		table = "results"
+	}
+	for _, part := range strings.Split(table, ".") {
+		if !sqlIdentifier.MatchString(part) {
+			return "", "", fmt.Errorf("invalid postgres table name %q", table)
+		}
+	}
+	query.Del("table")
+	dsn.RawQuery = query.Encode()
+	if dsn.Host == "" && dsn.Path == "" && dsn.User == nil {
+		return os.Getenv(postgresDSNEnv), table, nil
+	}
+	return dsn.String(), table, nil
+}
+
+func (s *postgresSink) write(run sinkRun) error {
+	ctx := context.Background()
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	insert := `INSERT INTO ` + s.table + ` (url, xpath, value, matched, run_id, timestamp)
+		VALUES ($1, $2, $3::jsonb, $4, $5, $6)
+		ON CONFLICT (run_id, url, xpath) DO UPDATE SET
+			value = excluded.value, matched = excluded.matched, timestamp = excluded.timestamp`
+	for start := 0; start < len(run.Records); start += postgresBatchSize {
+		end := min(start+postgresBatchSize, len(run.Records))
+		batch := &pgx.Batch{}
+		for _, r := range run.Records[start:end] {
+			value, err := recordValue(r)
+			if err != nil {
+				return err
+			}
+			batch.Queue(insert, r.URL, r.XPath, value, r.Matched, run.ID, run.Time)
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *postgresSink) Close() error {
+	return s.conn.Close(context.Background())
+}
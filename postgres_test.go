@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestPostgresTarget(t *testing.T) {
+	t.Setenv(postgresDSNEnv, "host=db.internal dbname=extraction")
+	for target, expected := range map[string][2]string{
+		"postgres://u:p@db.example.com:5432/extraction?sslmode=require&table=pages": {"postgres://u:p@db.example.com:5432/extraction?sslmode=require", "pages"},
+		"postgresql://db.example.com/extraction":                                    {"postgresql://db.example.com/extraction", "results"},
+		"postgres://?table=analytics.pages":                                         {"host=db.internal dbname=extraction", "analytics.pages"},
+		"postgres:":                                                                 {"host=db.internal dbname=extraction", "results"},
+	} {
+		u, err := parseSinkTarget(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dsn, table, err := postgresTarget(u)
+		if err != nil || dsn != expected[0] || table != expected[1] {
+			t.Errorf("postgresTarget(%s) = %q, %q, %v; want %q, %q", target, dsn, table, err, expected[0], expected[1])
+		}
+	}
+	u, _ := url.Parse("postgres://db/x?table=pages-x")
+	if _, _, err := postgresTarget(u); err == nil {
+		t.Error("Expected an error for an invalid table name")
+	}
+}
+
+// TestPostgresSink needs a database to write to, named by GOATPAVER_TEST_POSTGRES_DSN.
+func TestPostgresSink(t *testing.T) {
+	dsn := os.Getenv("GOATPAVER_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("GOATPAVER_TEST_POSTGRES_DSN not set")
+	}
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1"],
+		"urls": {
+			"http://a.com": {"content": "<h1>A</h1>"},
+			"http://b.com": {"content": "<p></p>"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("table", "goatpaver_test_results")
+	u.RawQuery = q.Encode()
+	opts := runOptions{output: u, runID: "r1"}
+	for i := 0; i < 2; i++ {
+		if err := opts.writeSink(input, output, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, err := pgx.Connect(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+	defer conn.Exec(context.Background(), `DROP TABLE goatpaver_test_results`)
+	var rows, matched int
+	err = conn.QueryRow(context.Background(),
+		`SELECT count(*), count(*) FILTER (WHERE matched) FROM goatpaver_test_results WHERE run_id = 'r1'`).Scan(&rows, &matched)
+	if err != nil || rows != 2 || matched != 1 {
+		t.Errorf("Got %d rows (%d matched), %v; want 2 rows, 1 matched", rows, matched, err)
+	}
+}
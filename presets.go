@@ -0,0 +1,638 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// --- Preset Extractors ---
+
+// presetKeyPrefix is prepended to a preset's name to form its key in the output map,
+// keeping preset results apart from plain xpath results.
+const presetKeyPrefix = "preset:"
+
+// presetFunc extracts a structured value from a parsed HTML document.
+// base is the URL relative links in the document resolve against, or nil if unknown.
+// Returning nil means the preset found nothing and the URL is omitted for it.
+type presetFunc func(doc *html.Node, base *url.URL) interface{}
+
+// presets is the registry of built-in extractors selectable via the "presets" input field.
+var presets = map[string]presetFunc{
+	"microdata":   extractMicrodata,
+	"opengraph":   extractOpenGraph,
+	"readability": extractArticle,
+	"forms":       extractForms,
+	"images":      extractImages,
+	"seo":         extractSEO,
+	"rdfa":        extractRDFa,
+	"language":    extractLanguage,
+}
+
+// parseHTML parses content leniently as HTML, detecting the charset from any <meta> declaration.
+// Presets use this tree rather than the strict XML one so they work on real-world markup.
+func parseHTML(r io.Reader) (*html.Node, error) {
+	utf8Reader, err := charset.NewReader(r, "")
+	if err != nil {
+		return nil, err
+	}
+	return html.Parse(utf8Reader)
+}
+
+// applyPresets runs each requested preset against the content of a single URL
+// and stores any non-nil results in the output map.
+func applyPresets(output OutputJson, names []string, pageURL string, content []byte) error {
+	doc, err := parseHTML(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	base := documentBase(doc, pageURL)
+	for _, name := range names {
+		preset, ok := presets[name]
+		if !ok {
+			continue // Unknown presets are reported once, when the input is read
+		}
+		if result := preset(doc, base); result != nil {
+			output[presetKeyPrefix+name][pageURL] = result
+		}
+	}
+	return nil
+}
+
+// documentBase returns the URL that relative links in doc resolve against;
+// see resolveBase for how the page URL and <base href> combine.
+func documentBase(doc *html.Node, pageURL string) *url.URL {
+	var href string
+	var found bool
+	walkElements(doc, func(n *html.Node) {
+		if n.Data == "base" && !found {
+			href, found = getAttr(n, "href")
+		}
+	})
+	return resolveBase(pageURL, href, found)
+}
+
+// resolveBase returns the page URL, overridden by the document's first <base href> if
+// hasHref is set. It returns nil if the page URL is not an absolute URL and there is no
+// absolute base.
+func resolveBase(pageURL string, href string, hasHref bool) *url.URL {
+	base, err := url.Parse(pageURL)
+	if err != nil || !base.IsAbs() {
+		base = nil
+	}
+	if hasHref {
+		if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			if base != nil {
+				return base.ResolveReference(ref)
+			}
+			if ref.IsAbs() {
+				return ref
+			}
+		}
+	}
+	return base
+}
+
+// resolveLink resolves a possibly relative link against base, returning it unchanged
+// if there is no base or the link does not parse.
+func resolveLink(base *url.URL, link string) string {
+	link = strings.TrimSpace(link)
+	if base == nil || link == "" {
+		return link
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// --- HTML Helpers ---
+
+// getAttr returns the value of the named attribute on n, if present.
+func getAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// walkElements calls fn for every element node in the subtree rooted at n, in document order.
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkElements(c, fn)
+	}
+}
+
+// textContent returns the concatenated text of all descendant text nodes of n.
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(sb.String())
+}
+
+// --- Microdata and RDFa ---
+
+// structuredItem is a typed item found in microdata or RDFa markup.
+// Property values are either strings or nested *structuredItem values.
+type structuredItem struct {
+	Type       []string                 `json:"type,omitempty"`
+	ID         string                   `json:"id,omitempty"`
+	Properties map[string][]interface{} `json:"properties"`
+}
+
+func (item *structuredItem) add(names string, value interface{}) {
+	for _, name := range strings.Fields(names) {
+		item.Properties[name] = append(item.Properties[name], value)
+	}
+}
+
+// extractMicrodata returns all top-level microdata items (itemscope without itemprop) in doc.
+func extractMicrodata(doc *html.Node, _ *url.URL) interface{} {
+	ids := make(map[string]*html.Node)
+	var items []*structuredItem
+	walkElements(doc, func(n *html.Node) {
+		if id, ok := getAttr(n, "id"); ok {
+			ids[id] = n
+		}
+	})
+	walkElements(doc, func(n *html.Node) {
+		_, scoped := getAttr(n, "itemscope")
+		_, prop := getAttr(n, "itemprop")
+		if scoped && !prop {
+			items = append(items, microdataItem(n, ids, map[*html.Node]bool{}))
+		}
+	})
+
+	if len(items) == 0 {
+		return nil
+	}
+	return items
+}
+
+// microdataItem builds the item rooted at scope, following itemref references through ids.
+// The visiting set guards against itemref cycles.
+func microdataItem(scope *html.Node, ids map[string]*html.Node, visiting map[*html.Node]bool) *structuredItem {
+	visiting[scope] = true
+	defer delete(visiting, scope)
+
+	item := &structuredItem{Properties: make(map[string][]interface{})}
+	if t, ok := getAttr(scope, "itemtype"); ok {
+		item.Type = strings.Fields(t)
+	}
+	item.ID, _ = getAttr(scope, "itemid")
+
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			names, isProp := getAttr(c, "itemprop")
+			_, isScope := getAttr(c, "itemscope")
+			if isProp {
+				if isScope {
+					if !visiting[c] {
+						item.add(names, microdataItem(c, ids, visiting))
+					}
+				} else {
+					item.add(names, microdataValue(c))
+				}
+			}
+			if !isScope {
+				collect(c)
+			}
+		}
+	}
+	collect(scope)
+
+	if refs, ok := getAttr(scope, "itemref"); ok {
+		for _, ref := range strings.Fields(refs) {
+			target, ok := ids[ref]
+			if !ok || visiting[target] {
+				continue
+			}
+			if names, isProp := getAttr(target, "itemprop"); isProp {
+				if _, isScope := getAttr(target, "itemscope"); isScope {
+					item.add(names, microdataItem(target, ids, visiting))
+				} else {
+					item.add(names, microdataValue(target))
+				}
+			}
+		}
+	}
+	return item
+}
+
+// microdataValue returns the property value of a non-item element, per the HTML microdata rules.
+func microdataValue(n *html.Node) string {
+	var attr string
+	switch n.Data {
+	case "meta":
+		attr = "content"
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		attr = "src"
+	case "a", "area", "link":
+		attr = "href"
+	case "object":
+		attr = "data"
+	case "data", "meter":
+		attr = "value"
+	case "time":
+		attr = "datetime"
+	}
+	if attr != "" {
+		if v, ok := getAttr(n, attr); ok {
+			return v
+		}
+	}
+	return textContent(n)
+}
+
+// extractRDFa returns all top-level RDFa Lite items (elements with typeof) in doc.
+// Types are expanded against the nearest vocab declaration.
+func extractRDFa(doc *html.Node, _ *url.URL) interface{} {
+	var items []*structuredItem
+	var walk func(n *html.Node, vocab string, current *structuredItem)
+	walk = func(n *html.Node, vocab string, current *structuredItem) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			childVocab := vocab
+			if v, ok := getAttr(c, "vocab"); ok {
+				childVocab = v
+			}
+			props, hasProp := getAttr(c, "property")
+			if typeOf, ok := getAttr(c, "typeof"); ok {
+				item := &structuredItem{Properties: make(map[string][]interface{})}
+				for _, t := range strings.Fields(typeOf) {
+					item.Type = append(item.Type, expandRDFaTerm(childVocab, t))
+				}
+				item.ID, _ = getAttr(c, "resource")
+				if item.ID == "" {
+					item.ID, _ = getAttr(c, "about")
+				}
+				if hasProp && current != nil {
+					current.add(props, item)
+				} else {
+					items = append(items, item)
+				}
+				walk(c, childVocab, item)
+				continue
+			}
+			if hasProp && current != nil {
+				current.add(props, rdfaValue(c))
+			}
+			walk(c, childVocab, current)
+		}
+	}
+	walk(doc, "", nil)
+
+	if len(items) == 0 {
+		return nil
+	}
+	return items
+}
+
+// expandRDFaTerm prefixes a bare term with the active vocabulary; CURIEs and absolute IRIs are kept as-is.
+func expandRDFaTerm(vocab, term string) string {
+	if vocab == "" || strings.Contains(term, ":") {
+		return term
+	}
+	return vocab + term
+}
+
+// rdfaValue returns the value of a property element, preferring explicit content over links and text.
+func rdfaValue(n *html.Node) string {
+	for _, attr := range []string{"content", "resource", "href", "src"} {
+		if v, ok := getAttr(n, attr); ok {
+			return v
+		}
+	}
+	return textContent(n)
+}
+
+// --- Open Graph / Twitter Card ---
+
+// extractOpenGraph returns the og:* and twitter:* meta tags of doc as a map from property to content.
+// Open Graph uses the property attribute and Twitter Cards the name attribute, but sites mix them up,
+// so both are checked. When a property repeats (e.g. several og:image tags) the first one wins.
+func extractOpenGraph(doc *html.Node, _ *url.URL) interface{} {
+	tags := make(map[string]string)
+	walkElements(doc, func(n *html.Node) {
+		if n.Data != "meta" {
+			return
+		}
+		content, ok := getAttr(n, "content")
+		if !ok {
+			return
+		}
+		for _, attr := range []string{"property", "name"} {
+			key, _ := getAttr(n, attr)
+			key = strings.ToLower(strings.TrimSpace(key))
+			if !strings.HasPrefix(key, "og:") && !strings.HasPrefix(key, "twitter:") {
+				continue
+			}
+			if _, seen := tags[key]; !seen {
+				tags[key] = content
+			}
+			break
+		}
+	})
+
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+// --- SEO Metadata ---
+
+// seoMetadata is the result of the seo preset. All h1 headings are kept,
+// since more than one is itself worth flagging in an SEO audit.
+type seoMetadata struct {
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Canonical   string   `json:"canonical,omitempty"`
+	Robots      string   `json:"robots,omitempty"`
+	H1          []string `json:"h1,omitempty"`
+}
+
+// extractSEO collects the on-page SEO signals of doc; the first occurrence of each tag wins.
+func extractSEO(doc *html.Node, _ *url.URL) interface{} {
+	var seo seoMetadata
+	walkElements(doc, func(n *html.Node) {
+		switch n.Data {
+		case "title":
+			if seo.Title == "" {
+				seo.Title = collapseSpace(textContent(n))
+			}
+		case "meta":
+			name, _ := getAttr(n, "name")
+			content, _ := getAttr(n, "content")
+			switch strings.ToLower(name) {
+			case "description":
+				if seo.Description == "" {
+					seo.Description = strings.TrimSpace(content)
+				}
+			case "robots":
+				if seo.Robots == "" {
+					seo.Robots = strings.TrimSpace(content)
+				}
+			}
+		case "link":
+			rel, _ := getAttr(n, "rel")
+			for _, r := range strings.Fields(rel) {
+				if strings.EqualFold(r, "canonical") && seo.Canonical == "" {
+					seo.Canonical, _ = getAttr(n, "href")
+				}
+			}
+		case "h1":
+			if text := collapseSpace(textContent(n)); text != "" {
+				seo.H1 = append(seo.H1, text)
+			}
+		}
+	})
+
+	if seo.Title == "" && seo.Description == "" && seo.Canonical == "" && seo.Robots == "" && len(seo.H1) == 0 {
+		return nil
+	}
+	return &seo
+}
+
+// --- Images ---
+
+// imageRecord is one <img> found by the images preset. URLs are resolved against the document base.
+type imageRecord struct {
+	Src    string            `json:"src,omitempty"`
+	Srcset []srcsetCandidate `json:"srcset,omitempty"`
+	Alt    *string           `json:"alt,omitempty"` // nil when absent, "" for decorative images
+	Width  string            `json:"width,omitempty"`
+	Height string            `json:"height,omitempty"`
+}
+
+// srcsetCandidate is one entry of a srcset attribute, with its width (w) or density (x) descriptor.
+type srcsetCandidate struct {
+	URL     string  `json:"url"`
+	Width   int     `json:"width,omitempty"`
+	Density float64 `json:"density,omitempty"`
+}
+
+// extractImages returns every <img> in doc. Candidates from <source srcset> siblings inside
+// a <picture> are listed before the image's own srcset, mirroring browser selection order.
+func extractImages(doc *html.Node, base *url.URL) interface{} {
+	var images []imageRecord
+	walkElements(doc, func(n *html.Node) {
+		if n.Data != "img" {
+			return
+		}
+		var img imageRecord
+		if src, ok := getAttr(n, "src"); ok {
+			img.Src = resolveLink(base, src)
+		}
+		if n.Parent != nil && n.Parent.Type == html.ElementNode && n.Parent.Data == "picture" {
+			for s := n.Parent.FirstChild; s != nil; s = s.NextSibling {
+				if s.Type == html.ElementNode && s.Data == "source" {
+					srcset, _ := getAttr(s, "srcset")
+					img.Srcset = append(img.Srcset, parseSrcset(srcset, base)...)
+				}
+			}
+		}
+		srcset, _ := getAttr(n, "srcset")
+		img.Srcset = append(img.Srcset, parseSrcset(srcset, base)...)
+		if alt, ok := getAttr(n, "alt"); ok {
+			img.Alt = &alt
+		}
+		img.Width, _ = getAttr(n, "width")
+		img.Height, _ = getAttr(n, "height")
+		images = append(images, img)
+	})
+
+	if len(images) == 0 {
+		return nil
+	}
+	return images
+}
+
+// parseSrcset splits a srcset attribute into candidates, following the HTML parsing rules
+// closely enough to cope with commas inside URLs. Invalid descriptors drop the candidate.
+func parseSrcset(srcset string, base *url.URL) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' }
+	i := 0
+	for i < len(srcset) {
+		for i < len(srcset) && (isSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+		start := i
+		for i < len(srcset) && !isSpace(srcset[i]) {
+			i++
+		}
+		link := srcset[start:i]
+		if link == "" {
+			break
+		}
+		var descriptors string
+		if strings.HasSuffix(link, ",") {
+			link = strings.TrimRight(link, ",")
+		} else {
+			start = i
+			depth := 0
+			for i < len(srcset) && (srcset[i] != ',' || depth > 0) {
+				switch srcset[i] {
+				case '(':
+					depth++
+				case ')':
+					depth--
+				}
+				i++
+			}
+			descriptors = srcset[start:i]
+		}
+
+		candidate := srcsetCandidate{URL: resolveLink(base, link)}
+		valid := true
+		for _, d := range strings.Fields(descriptors) {
+			value := d[:len(d)-1]
+			switch d[len(d)-1] {
+			case 'w':
+				w, err := strconv.Atoi(value)
+				valid = valid && err == nil && w > 0 && candidate.Width == 0
+				candidate.Width = w
+			case 'x':
+				x, err := strconv.ParseFloat(value, 64)
+				valid = valid && err == nil && x >= 0 && candidate.Density == 0
+				candidate.Density = x
+			default:
+				// Height descriptors ("h") and unknown descriptors are ignored
+			}
+		}
+		if valid {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// --- Forms ---
+
+// formRecord is one <form> found by the forms preset.
+type formRecord struct {
+	ID     string      `json:"id,omitempty"`
+	Name   string      `json:"name,omitempty"`
+	Action string      `json:"action"`
+	Method string      `json:"method"`
+	Fields []formField `json:"fields"`
+}
+
+// formField is an input, select, textarea or button inside a form, with its default value.
+type formField struct {
+	Name    string `json:"name,omitempty"`
+	Type    string `json:"type"`
+	Value   string `json:"value,omitempty"`
+	Checked bool   `json:"checked,omitempty"` // Only set for checkbox and radio inputs
+}
+
+// extractForms returns every <form> in doc. A missing action submits to the document itself,
+// so it resolves to the base URL; a missing or unknown method is GET.
+func extractForms(doc *html.Node, base *url.URL) interface{} {
+	var forms []formRecord
+	walkElements(doc, func(n *html.Node) {
+		if n.Data != "form" {
+			return
+		}
+		form := formRecord{Fields: []formField{}}
+		form.ID, _ = getAttr(n, "id")
+		form.Name, _ = getAttr(n, "name")
+		action, _ := getAttr(n, "action")
+		form.Action = resolveLink(base, action)
+		if form.Action == "" && base != nil {
+			form.Action = base.String()
+		}
+		form.Method = "GET"
+		if method, _ := getAttr(n, "method"); strings.EqualFold(method, "post") || strings.EqualFold(method, "dialog") {
+			form.Method = strings.ToUpper(method)
+		}
+
+		walkElements(n, func(e *html.Node) {
+			field := formField{Type: e.Data}
+			field.Name, _ = getAttr(e, "name")
+			switch e.Data {
+			case "input":
+				field.Type = "text"
+				if t, ok := getAttr(e, "type"); ok && t != "" {
+					field.Type = strings.ToLower(t)
+				}
+				field.Value, _ = getAttr(e, "value")
+				if field.Type == "checkbox" || field.Type == "radio" {
+					_, field.Checked = getAttr(e, "checked")
+				}
+			case "button":
+				field.Type = "submit"
+				if t, ok := getAttr(e, "type"); ok && t != "" {
+					field.Type = strings.ToLower(t)
+				}
+				field.Value, _ = getAttr(e, "value")
+			case "textarea":
+				field.Value = textContent(e)
+			case "select":
+				field.Value = selectDefault(e)
+			default:
+				return
+			}
+			form.Fields = append(form.Fields, field)
+		})
+		forms = append(forms, form)
+	})
+
+	if len(forms) == 0 {
+		return nil
+	}
+	return forms
+}
+
+// selectDefault returns the value of the first selected option, or of the first option if none is selected.
+func selectDefault(sel *html.Node) string {
+	var first, selected *html.Node
+	walkElements(sel, func(n *html.Node) {
+		if n.Data != "option" {
+			return
+		}
+		if first == nil {
+			first = n
+		}
+		if _, ok := getAttr(n, "selected"); ok && selected == nil {
+			selected = n
+		}
+	})
+	if selected == nil {
+		selected = first
+	}
+	if selected == nil {
+		return ""
+	}
+	if v, ok := getAttr(selected, "value"); ok {
+		return v
+	}
+	return collapseSpace(textContent(selected))
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProcessInput_MicrodataAndRDFa(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"xpaths": [],
+		"presets": ["microdata", "rdfa", "nosuchpreset"],
+		"urls": {
+			"http://product.com": {
+				"content": "<html><body><div itemscope itemtype=\"https://schema.org/Product\"><span itemprop=\"name\">Widget</span><img itemprop=\"image\" src=\"/w.png\"><div itemprop=\"offers\" itemscope itemtype=\"https://schema.org/Offer\"><meta itemprop=\"price\" content=\"9.99\"></div></div></body></html>"
+			},
+			"http://person.com": {
+				"content": "<div vocab=\"https://schema.org/\" typeof=\"Person\"><span property=\"name\">Ada</span><a property=\"url\" href=\"http://ada.example\">home</a></div>"
+			},
+			"http://plain.com": {
+				"content": "<p>No structured data"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"preset:microdata": {
+			"http://product.com": []*structuredItem{{
+				Type: []string{"https://schema.org/Product"},
+				Properties: map[string][]interface{}{
+					"name":  {"Widget"},
+					"image": {"/w.png"},
+					"offers": {&structuredItem{
+						Type:       []string{"https://schema.org/Offer"},
+						Properties: map[string][]interface{}{"price": {"9.99"}},
+					}},
+				},
+			}},
+		},
+		"preset:rdfa": {
+			"http://person.com": []*structuredItem{{
+				Type: []string{"https://schema.org/Person"},
+				Properties: map[string][]interface{}{
+					"name": {"Ada"},
+					"url":  {"http://ada.example"},
+				},
+			}},
+		},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		expectedJson, _ := json.MarshalIndent(expectedOutput, "", "  ")
+		actualJson, _ := json.MarshalIndent(actualOutput, "", "  ")
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
+	}
+}
+
+func TestExtractMicrodata_ItemRef(t *testing.T) {
+	doc, err := parseHTML(strings.NewReader(`<div itemscope itemref="extra"><span itemprop="name">A</span></div><p id="extra" itemprop="note">B</p>`))
+	if err != nil {
+		t.Fatalf("parseHTML failed: %v", err)
+	}
+	items, ok := extractMicrodata(doc, nil).([]*structuredItem)
+	if !ok || len(items) != 1 {
+		t.Fatalf("Expected one item, got %#v", extractMicrodata(doc, nil))
+	}
+	want := map[string][]interface{}{"name": {"A"}, "note": {"B"}}
+	if !reflect.DeepEqual(want, items[0].Properties) {
+		t.Errorf("Unexpected properties: %#v", items[0].Properties)
+	}
+}
+
+func TestExtractOpenGraph(t *testing.T) {
+	doc, err := parseHTML(strings.NewReader(`<html><head>
+		<meta property="og:title" content="Hello">
+		<meta property="og:image" content="/a.png">
+		<meta property="og:image" content="/b.png">
+		<meta name="twitter:card" content="summary">
+		<meta name="description" content="ignored">
+	</head></html>`))
+	if err != nil {
+		t.Fatalf("parseHTML failed: %v", err)
+	}
+	want := map[string]string{"og:title": "Hello", "og:image": "/a.png", "twitter:card": "summary"}
+	if got := extractOpenGraph(doc, nil); !reflect.DeepEqual(want, got) {
+		t.Errorf("Unexpected tags: %#v", got)
+	}
+}
+
+func TestExtractSEO(t *testing.T) {
+	doc, err := parseHTML(strings.NewReader(`<html><head>
+		<title> Shoes  | Shop </title>
+		<meta name="Description" content="Buy shoes.">
+		<meta name="robots" content="noindex, follow">
+		<link rel="canonical" href="https://shop.example/shoes">
+	</head><body><h1>Shoes</h1><h1>More shoes</h1></body></html>`))
+	if err != nil {
+		t.Fatalf("parseHTML failed: %v", err)
+	}
+	want := &seoMetadata{
+		Title:       "Shoes | Shop",
+		Description: "Buy shoes.",
+		Canonical:   "https://shop.example/shoes",
+		Robots:      "noindex, follow",
+		H1:          []string{"Shoes", "More shoes"},
+	}
+	if got := extractSEO(doc, nil); !reflect.DeepEqual(want, got) {
+		t.Errorf("Unexpected SEO metadata: %#v", got)
+	}
+}
+
+func TestExtractImages(t *testing.T) {
+	doc, err := parseHTML(strings.NewReader(`<html><head><base href="/assets/"></head><body>
+		<img src="logo.png" alt="Logo" width="120" height="40">
+		<picture>
+			<source srcset="hero.webp 1x, hero@2x.webp 2x" type="image/webp">
+			<img src="hero.jpg" srcset="hero-480.jpg 480w, data:image/png;base64,AA== 800w" alt="">
+		</picture>
+		<img src="/spacer.gif">
+	</body></html>`))
+	if err != nil {
+		t.Fatalf("parseHTML failed: %v", err)
+	}
+	base := documentBase(doc, "https://example.com/page/index.html")
+
+	logoAlt, heroAlt := "Logo", ""
+	want := []imageRecord{
+		{Src: "https://example.com/assets/logo.png", Alt: &logoAlt, Width: "120", Height: "40"},
+		{
+			Src: "https://example.com/assets/hero.jpg",
+			Srcset: []srcsetCandidate{
+				{URL: "https://example.com/assets/hero.webp", Density: 1},
+				{URL: "https://example.com/assets/hero@2x.webp", Density: 2},
+				{URL: "https://example.com/assets/hero-480.jpg", Width: 480},
+				{URL: "data:image/png;base64,AA==", Width: 800},
+			},
+			Alt: &heroAlt,
+		},
+		{Src: "https://example.com/spacer.gif"},
+	}
+	if got := extractImages(doc, base); !reflect.DeepEqual(want, got) {
+		gotJson, _ := json.MarshalIndent(got, "", "  ")
+		t.Errorf("Unexpected images:\n%s", gotJson)
+	}
+}
+
+func TestExtractForms(t *testing.T) {
+	doc, err := parseHTML(strings.NewReader(`<body>
+		<form id="login" action="/session" method="post">
+			<input name="user">
+			<input type="password" name="pass">
+			<input type="checkbox" name="remember" value="1" checked>
+			<select name="lang"><option value="en">English</option><option value="de" selected>Deutsch</option></select>
+			<button>Sign in</button>
+		</form>
+		<form name="search"><textarea name="q">shoes</textarea></form>
+	</body>`))
+	if err != nil {
+		t.Fatalf("parseHTML failed: %v", err)
+	}
+	base := documentBase(doc, "https://example.com/account/")
+
+	want := []formRecord{
+		{
+			ID: "login", Action: "https://example.com/session", Method: "POST",
+			Fields: []formField{
+				{Name: "user", Type: "text"},
+				{Name: "pass", Type: "password"},
+				{Name: "remember", Type: "checkbox", Value: "1", Checked: true},
+				{Name: "lang", Type: "select", Value: "de"},
+				{Type: "submit"},
+			},
+		},
+		{
+			Name: "search", Action: "https://example.com/account/", Method: "GET",
+			Fields: []formField{{Name: "q", Type: "textarea", Value: "shoes"}},
+		},
+	}
+	if got := extractForms(doc, base); !reflect.DeepEqual(want, got) {
+		gotJson, _ := json.MarshalIndent(got, "", "  ")
+		t.Errorf("Unexpected forms:\n%s", gotJson)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+)
+
+// --- Profiling ---
+
+// profiles are the -cpuprofile and -memprofile files of a plain run or a worker, for
+// "go tool pprof". The CPU profile covers the whole run; the heap profile is taken at its
+// end, after a garbage collection, and has the allocations of the whole run as well.
+type profiles struct {
+	cpu string
+	mem string
+}
+
+// profileFlags adds -cpuprofile and -memprofile to flags.
+func profileFlags(flags *flag.FlagSet) *profiles {
+	p := &profiles{}
+	flags.StringVar(&p.cpu, "cpuprofile", "", "write a CPU profile of the run to this file")
+	flags.StringVar(&p.mem, "memprofile", "", "write a heap profile to this file at the end of the run")
+	return p
+}
+
+// start starts the CPU profile and returns the function that stops it and writes the
+// heap profile.
+func (p *profiles) start() (stop func() error, err error) {
+	var cpu *os.File
+	if p.cpu != "" {
+		if cpu, err = os.Create(p.cpu); err != nil {
+			return nil, err
+		}
+		if err := runtimepprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("starting the CPU profile: %w", err)
+		}
+	}
+	return func() error {
+		var errs []error
+		if cpu != nil {
+			runtimepprof.StopCPUProfile()
+			errs = append(errs, cpu.Close())
+		}
+		if p.mem != "" {
+			errs = append(errs, writeHeapProfile(p.mem))
+		}
+		return errors.Join(errs...)
+	}, nil
+}
+
+// writeHeapProfile writes the heap profile to path.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC() // For up to date statistics of what is live
+	err = runtimepprof.Lookup("heap").WriteTo(f, 0)
+	return errors.Join(err, f.Close())
+}
+
+// servePprof serves the net/http/pprof handlers under /debug/pprof/ on addr, for looking
+// into a running worker, until the listener it returns is closed.
+func servePprof(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	go http.Serve(listener, mux)
+	logger.Info(fmt.Sprintf("Serving pprof on http://%s/debug/pprof/", listener.Addr()), "addr", listener.Addr().String())
+	return listener, nil
+}
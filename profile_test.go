@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	dir := t.TempDir()
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	p := profileFlags(flags)
+	cpu, mem := filepath.Join(dir, "cpu.pprof"), filepath.Join(dir, "mem.pprof")
+	if err := flags.Parse([]string{"-cpuprofile", cpu, "-memprofile", mem}); err != nil {
+		t.Fatal(err)
+	}
+	stop, err := p.start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := processInput([]byte(`{"xpaths": ["//h1"], "urls": {"a": {"content": "<h1>A</h1>"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{cpu, mem} {
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("Profile %s not written: %v", path, err)
+		}
+	}
+
+	// Without the flags, nothing is profiled
+	stop, err = (&profiles{}).start()
+	if err != nil || stop() != nil {
+		t.Errorf("Profiling without files failed: %v", err)
+	}
+	if _, err := (&profiles{cpu: filepath.Join(dir, "missing", "cpu.pprof")}).start(); err == nil {
+		t.Error("Started a CPU profile in a missing directory")
+	}
+}
+
+func TestServePprof(t *testing.T) {
+	listener, err := servePprof("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	resp, err := http.Get("http://" + listener.Addr().String() + "/debug/pprof/cmdline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), os.Args[0]) {
+		t.Errorf("Unexpected pprof response %s: %q", resp.Status, body)
+	}
+}
+
+func TestProfilesWithWatch(t *testing.T) {
+	if _, err := parseFlags([]string{"-watch", "-input", "in.json", "-cpuprofile", "cpu.pprof"}); err == nil || !strings.Contains(err.Error(), "-watch") {
+		t.Errorf("Profiling accepted with -watch: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// --- Progress ---
+
+// progressInterval is how often the progress line is redrawn at most.
+const progressInterval = 200 * time.Millisecond
+
+// progressBar shows how far process is through the URLs on one line of stderr, which it
+// redraws in place: URLs done out of total, the rate and the time left. Warnings clear
+// the line before they are printed.
+type progressBar struct {
+	w       io.Writer
+	total   int
+	done    int
+	started time.Time
+	drawn   time.Time // When the line was last drawn, zero if it isn't showing
+}
+
+// stderrIsTerminal tells whether stderr is a terminal; tests replace it.
+var stderrIsTerminal = func() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// newProgressBar returns a progress bar for total URLs on stderr if it is a terminal and
+// -quiet wasn't given, or nil.
+func (opts runOptions) newProgressBar(total int) *progressBar {
+	if opts.quiet || !stderrIsTerminal() {
+		return nil
+	}
+	return &progressBar{w: os.Stderr, total: total, started: time.Now()}
+}
+
+// advance counts one more URL done. Calls on a nil bar do nothing, like the others.
+func (p *progressBar) advance() {
+	p.add(1)
+}
+
+// add counts n more URLs done, as a batch of a distributed run.
+func (p *progressBar) add(n int) {
+	if p == nil {
+		return
+	}
+	p.done += n
+	if now := time.Now(); now.Sub(p.drawn) >= progressInterval || p.done == p.total {
+		p.draw(now)
+	}
+}
+
+func (p *progressBar) draw(now time.Time) {
+	line := fmt.Sprintf("%d/%d URLs", p.done, p.total)
+	if elapsed := now.Sub(p.started).Seconds(); elapsed > 0 && p.done > 0 {
+		rate := float64(p.done) / elapsed
+		left := time.Duration(float64(p.total-p.done) / rate * float64(time.Second))
+		line += fmt.Sprintf("  %.1f/s  ETA %s", rate, left.Round(time.Second))
+	}
+	fmt.Fprintf(p.w, "\r\033[K%s", line)
+	p.drawn = now
+}
+
+// clear removes the progress line, if showing, so other output starts on a clean line;
+// the next advance draws it again.
+func (p *progressBar) clear() {
+	if p == nil || p.drawn.IsZero() {
+		return
+	}
+	fmt.Fprint(p.w, "\r\033[K")
+	p.drawn = time.Time{}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressBar(t *testing.T) {
+	defer func(isTerminal func() bool) { stderrIsTerminal = isTerminal }(stderrIsTerminal)
+	stderrIsTerminal = func() bool { return true }
+	if (runOptions{quiet: true}).newProgressBar(3) != nil || (runOptions{}).newProgressBar(3) == nil {
+		t.Error("Expected progress on a terminal unless -quiet")
+	}
+	stderrIsTerminal = func() bool { return false }
+	if (runOptions{}).newProgressBar(3) != nil {
+		t.Error("Expected no progress when stderr isn't a terminal")
+	}
+
+	var buf bytes.Buffer
+	p := &progressBar{w: &buf, total: 4, started: time.Now().Add(-2 * time.Second)}
+	p.advance()
+	if line := buf.String(); line != "\r\033[K1/4 URLs  0.5/s  ETA 6s" {
+		t.Errorf("Unexpected progress line %q", line)
+	}
+	p.advance() // Too soon to redraw
+	p.clear()
+	p.clear()
+	if got := strings.Count(buf.String(), "\r\033[K"); got != 2 {
+		t.Errorf("Unexpected output %q; want one line, cleared once", buf.String())
+	}
+	p.advance()
+	p.advance()
+	if !strings.HasSuffix(buf.String(), "4/4 URLs  2.0/s  ETA 0s") {
+		t.Errorf("Unexpected output %q; want the last URL drawn", buf.String())
+	}
+
+	var none *progressBar
+	none.advance()
+	none.clear()
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// --- Protocol Buffers ---
+
+// The messages are defined in schemas/goatpaver.proto. Input is turned into the JSON input
+// document it stands for, so it is checked exactly like JSON input, and output is built
+// from the same values the JSON output has; only google.protobuf.Struct and Value, which
+// carry free-form options and values, go through generated code.
+
+// protoField is one field of an encoded message.
+type protoField struct {
+	num    protowire.Number
+	varint uint64 // Value of varint fields
+	bytes  []byte // Value of length-delimited fields
+}
+
+// protoFields calls field for each varint and length-delimited field of the message in
+// data, skipping fields of other wire types.
+func protoFields(data []byte, field func(protoField) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		f := protoField{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := field(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protoMapEntry decodes a map field entry with a string key.
+func protoMapEntry(data []byte) (key string, value []byte, err error) {
+	err = protoFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			key = string(f.bytes)
+		case 2:
+			value = f.bytes
+		}
+		return nil
+	})
+	return key, value, err
+}
+
+// protoStruct decodes a google.protobuf.Struct and copies its fields into into, keeping
+// any already there.
+func protoStruct(data []byte, into map[string]interface{}) error {
+	var options structpb.Struct
+	if err := proto.Unmarshal(data, &options); err != nil {
+		return err
+	}
+	for key, value := range options.AsMap() {
+		if _, taken := into[key]; !taken {
+			into[key] = value
+		}
+	}
+	return nil
+}
+
+// decodeProtoInput turns an encoded goatpaver.v1.Input into the JSON input document.
+func decodeProtoInput(data []byte) ([]byte, error) {
+	xpaths := []interface{}{}
+	urls := map[string]interface{}{}
+	document := map[string]interface{}{"urls": urls}
+	var options []byte
+	err := protoFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			expr, err := decodeProtoExpression(f.bytes)
+			if err != nil {
+				return fmt.Errorf("xpaths: %w", err)
+			}
+			xpaths = append(xpaths, expr)
+		case 2:
+			pageURL, value, err := protoMapEntry(f.bytes)
+			if err != nil {
+				return fmt.Errorf("urls: %w", err)
+			}
+			urlData := map[string]interface{}{}
+			err = protoFields(value, func(f protoField) error {
+				switch f.num {
+				case 1:
+					urlData["content"] = string(f.bytes)
+				case 2:
+					urlData["file"] = string(f.bytes)
+				case 3:
+					urlData["content_encoding"] = string(f.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("urls: %w", err)
+			}
+			urls[pageURL] = urlData
+		case 3:
+			options = f.bytes
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decoding protobuf input: %w", err)
+	}
+	document["xpaths"] = xpaths
+	if err := protoStruct(options, document); err != nil {
+		return nil, fmt.Errorf("decoding protobuf input options: %w", err)
+	}
+	return json.Marshal(document)
+}
+
+// decodeProtoExpression turns an encoded goatpaver.v1.Expression into its JSON object.
+func decodeProtoExpression(data []byte) (map[string]interface{}, error) {
+	expr := map[string]interface{}{}
+	names := map[protowire.Number]string{1: "xpath", 2: "name", 3: "return", 4: "mode", 5: "dedupe", 6: "resolve"}
+	var options []byte
+	err := protoFields(data, func(f protoField) error {
+		switch f.num {
+		case 1, 2, 3, 4:
+			expr[names[f.num]] = string(f.bytes)
+		case 5, 6:
+			expr[names[f.num]] = protowire.DecodeBool(f.varint)
+		case 7:
+			options = f.bytes
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := expr["xpath"]; !ok {
+		expr["xpath"] = ""
+	}
+	return expr, protoStruct(options, expr)
+}
+
+// encodeProto encodes output values as the message for their shape: a nested output as
+// goatpaver.v1.Output, the values of one URL as Results, flat records as RecordList and
+// an -envelope as Envelope.
+func encodeProto(v interface{}) ([]byte, error) {
+	var b []byte
+	switch v := v.(type) {
+	case orderedDocument:
+		return encodeProto(v.value)
+	case envelope:
+		return encodeProtoEnvelope(v)
+	case OutputJson:
+		for _, key := range sortedKeys(v) {
+			results, err := encodeProtoResults(v[key])
+			if err != nil {
+				return nil, err
+			}
+			b = appendProtoMapEntry(b, 1, key, results)
+		}
+	case map[string]interface{}:
+		return encodeProtoResults(v)
+	case []record:
+		for _, r := range v {
+			value, err := encodeProtoValue(r.Value)
+			if err != nil {
+				return nil, err
+			}
+			var rec []byte
+			rec = protowire.AppendTag(rec, 1, protowire.BytesType)
+			rec = protowire.AppendString(rec, r.URL)
+			rec = protowire.AppendTag(rec, 2, protowire.BytesType)
+			rec = protowire.AppendString(rec, r.XPath)
+			rec = protowire.AppendTag(rec, 3, protowire.BytesType)
+			rec = protowire.AppendBytes(rec, value)
+			if r.Matched {
+				rec = protowire.AppendTag(rec, 4, protowire.VarintType)
+				rec = protowire.AppendVarint(rec, 1)
+			}
+			b = protowire.AppendTag(b, 1, protowire.BytesType)
+			b = protowire.AppendBytes(b, rec)
+		}
+	default:
+		return nil, fmt.Errorf("no protobuf message for %T", v)
+	}
+	return b, nil
+}
+
+// encodeProtoResults encodes values by key as goatpaver.v1.Results.
+func encodeProtoResults(values map[string]interface{}) ([]byte, error) {
+	var b []byte
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := encodeProtoValue(values[key])
+		if err != nil {
+			return nil, err
+		}
+		b = appendProtoMapEntry(b, 1, key, value)
+	}
+	return b, nil
+}
+
+// encodeProtoValue encodes v as a google.protobuf.Value, converting it as its JSON form.
+func encodeProtoValue(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value structpb.Value
+	if err := protojson.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(&value)
+}
+
+// appendProtoMapEntry appends the entry key: value of the map field num to b.
+func appendProtoMapEntry(b []byte, num protowire.Number, key string, value []byte) []byte {
+	var entry []byte
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, key)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, value)
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, entry)
+}
+
+// sortedKeys returns the keys of output in order, report sections included.
+func sortedKeys(output OutputJson) []string {
+	keys := make([]string, 0, len(output))
+	for key := range output {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
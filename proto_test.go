@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protoSchema compiles schemas/goatpaver.proto, so the hand-written wire format can be
+// checked against the published messages.
+func protoSchema(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{"schemas"}}),
+	}
+	files, err := compiler.Compile(context.Background(), "goatpaver.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files[0]
+}
+
+// protoMessage returns an empty message of the schema by name.
+func protoMessage(t *testing.T, schema protoreflect.FileDescriptor, name protoreflect.Name) *dynamicpb.Message {
+	t.Helper()
+	desc := schema.Messages().ByName(name)
+	if desc == nil {
+		t.Fatalf("no message %s", name)
+	}
+	return dynamicpb.NewMessage(desc)
+}
+
+func TestDecodeProtoInput(t *testing.T) {
+	schema := protoSchema(t)
+	message := protoMessage(t, schema, "Input")
+	err := protojson.Unmarshal([]byte(`{
+		"xpaths": [
+			{"xpath": "//h1"},
+			{"xpath": "//a/@href", "name": "links", "mode": "all", "dedupe": true, "resolve": true,
+			 "options": {"transforms": [{"type": "uppercase"}]}}
+		],
+		"urls": {"http://a.com/": {"content": "<h1>A</h1><a href='x'/><a href='x'/>"}, "http://b.com/": {"file": "b.html"},
+			"http://c.com/": {"content": "PGgxPkM8L2gxPg==", "contentEncoding": "base64"}},
+		"options": {"coverage": true}
+	}`), message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := decodeProtoInput(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := parseInput(document)
+	if err != nil {
+		t.Fatalf("parseInput(%s): %v", document, err)
+	}
+	expected := []Expression{
+		{XPath: "//h1"},
+		{XPath: "//a/@href", Name: "links", Mode: modeAll, Dedupe: true, Resolve: true, Transforms: input.Xpaths[1].Transforms},
+	}
+	if !reflect.DeepEqual(input.Xpaths, expected) || len(input.Xpaths[1].Transforms) != 1 {
+		t.Errorf("Unexpected xpaths %+v", input.Xpaths)
+	}
+	if len(input.Urls["http://a.com/"].Content) == 0 || input.Urls["http://b.com/"].File != "b.html" || input.Urls["http://c.com/"].ContentEncoding != "base64" || !input.Coverage {
+		t.Errorf("Unexpected input %s", document)
+	}
+
+	if _, err := decodeProtoInput([]byte{0x0a, 0x05}); err == nil {
+		t.Error("Expected an error for truncated input")
+	}
+}
+
+func TestEncodeProto(t *testing.T) {
+	schema := protoSchema(t)
+	output := OutputJson{
+		"//h1":      {"http://a.com": "A", "http://b.com": nil},
+		"links":     {"http://a.com": []interface{}{"x", "y"}},
+		"$coverage": {"//h1": map[string]interface{}{"matched": 1}},
+	}
+	records := []record{{URL: "http://a.com", XPath: "//h1", Value: "A", Matched: true}, {URL: "http://b.com", XPath: "//h1"}}
+
+	for _, c := range []struct {
+		name     protoreflect.Name
+		value    interface{}
+		expected string
+	}{
+		{"Output", output, `{"results": {
+			"//h1": {"values": {"http://a.com": "A", "http://b.com": null}},
+			"links": {"values": {"http://a.com": ["x", "y"]}},
+			"$coverage": {"values": {"//h1": {"matched": 1}}}
+		}}`},
+		{"Results", map[string]interface{}{"//h1": "A"}, `{"values": {"//h1": "A"}}`},
+		{"RecordList", records, `{"records": [
+			{"url": "http://a.com", "xpath": "//h1", "value": "A", "matched": true},
+			{"url": "http://b.com", "xpath": "//h1", "value": null}
+		]}`},
+	} {
+		data, err := encodeOutput(formatProtobuf, true, c.value)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		message := protoMessage(t, schema, c.name)
+		if err := proto.Unmarshal(data, message); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		decoded, err := protojson.Marshal(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, want interface{}
+		json.Unmarshal(decoded, &got)
+		json.Unmarshal([]byte(c.expected), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s decoded as %s\nwant %s", c.name, decoded, c.expected)
+		}
+	}
+
+	if _, err := encodeProto("text"); err == nil {
+		t.Error("Expected an error for a value with no message")
+	}
+}
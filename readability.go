@@ -0,0 +1,212 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// --- Readability Preset ---
+
+// article is the result of the readability preset.
+type article struct {
+	Title  string `json:"title,omitempty"`
+	Byline string `json:"byline,omitempty"`
+	Text   string `json:"text"`
+}
+
+var (
+	// Class/id hints used to weight candidate containers, as in Mozilla's Readability.
+	positiveHint = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|post|text|blog|story`)
+	negativeHint = regexp.MustCompile(`(?i)combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget|nav|menu|banner|ad-|advert`)
+	bylineHint   = regexp.MustCompile(`(?i)byline|author|dateline|writtenby`)
+)
+
+// unlikelyElements never contain main content and are skipped entirely when scoring.
+var unlikelyElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "nav": true, "header": true,
+	"footer": true, "aside": true, "form": true, "iframe": true, "button": true,
+	"select": true, "template": true, "svg": true,
+}
+
+// minParagraphLength is the shortest paragraph that counts towards a container's score.
+const minParagraphLength = 25
+
+// extractArticle applies a readability heuristic to doc: paragraphs are scored by length and
+// comma count, the scores bubble up to their parent (fully) and grandparent (half), and the
+// best-scoring container, adjusted by class/id hints, is taken as the main content.
+func extractArticle(doc *html.Node, _ *url.URL) interface{} {
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && unlikelyElements[n.Data] {
+			return
+		}
+		if n.Type == html.ElementNode && (n.Data == "p" || n.Data == "pre" || n.Data == "td") {
+			text := textContent(n)
+			if len(text) >= minParagraphLength {
+				score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+				for i, ancestor := 0, n.Parent; i < 2 && ancestor != nil && ancestor.Type == html.ElementNode; i, ancestor = i+1, ancestor.Parent {
+					if _, seen := scores[ancestor]; !seen {
+						scores[ancestor] = classWeight(ancestor)
+						candidates = append(candidates, ancestor)
+					}
+					if i == 0 {
+						scores[ancestor] += score
+					} else {
+						scores[ancestor] += score / 2
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var best *html.Node
+	for _, c := range candidates { // Candidates are in document order, so ties go to the first one
+		if best == nil || scores[c]*(1-linkDensity(c)) > scores[best]*(1-linkDensity(best)) {
+			best = c
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	var paragraphs []string
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && unlikelyElements[n.Data] {
+			return
+		}
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "p", "pre", "li", "blockquote", "h2", "h3", "h4", "h5", "h6", "td":
+				if text := collapseSpace(textContent(n)); text != "" {
+					paragraphs = append(paragraphs, text)
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(best)
+
+	return &article{
+		Title:  articleTitle(doc),
+		Byline: articleByline(doc),
+		Text:   strings.Join(paragraphs, "\n\n"),
+	}
+}
+
+// classWeight scores an element's class and id against the positive/negative hints.
+func classWeight(n *html.Node) float64 {
+	var weight float64
+	for _, attr := range []string{"class", "id"} {
+		v, _ := getAttr(n, attr)
+		if v == "" {
+			continue
+		}
+		if negativeHint.MatchString(v) {
+			weight -= 25
+		}
+		if positiveHint.MatchString(v) {
+			weight += 25
+		}
+	}
+	switch n.Data {
+	case "article", "main":
+		weight += 10
+	case "div":
+		weight += 5
+	}
+	return weight
+}
+
+// linkDensity returns the fraction of n's text that sits inside links.
+func linkDensity(n *html.Node) float64 {
+	total := len(textContent(n))
+	if total == 0 {
+		return 0
+	}
+	var linked int
+	walkElements(n, func(e *html.Node) {
+		if e.Data == "a" {
+			linked += len(textContent(e))
+		}
+	})
+	// Nested links would be counted twice; cap to keep the factor non-negative
+	return min(float64(linked)/float64(total), 1)
+}
+
+// articleTitle prefers og:title, then the first h1, then <title>.
+func articleTitle(doc *html.Node) string {
+	var ogTitle, h1, title string
+	walkElements(doc, func(n *html.Node) {
+		switch n.Data {
+		case "meta":
+			if p, _ := getAttr(n, "property"); p == "og:title" && ogTitle == "" {
+				ogTitle, _ = getAttr(n, "content")
+			}
+		case "h1":
+			if h1 == "" {
+				h1 = collapseSpace(textContent(n))
+			}
+		case "title":
+			if title == "" {
+				title = collapseSpace(textContent(n))
+			}
+		}
+	})
+	for _, t := range []string{ogTitle, h1, title} {
+		if t = strings.TrimSpace(t); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// articleByline prefers <meta name="author">, then rel=author links, then byline-like class/id hints.
+func articleByline(doc *html.Node) string {
+	var meta, rel, hinted string
+	walkElements(doc, func(n *html.Node) {
+		if n.Data == "meta" {
+			if name, _ := getAttr(n, "name"); strings.EqualFold(name, "author") && meta == "" {
+				meta, _ = getAttr(n, "content")
+			}
+			return
+		}
+		if r, _ := getAttr(n, "rel"); r == "author" && rel == "" {
+			rel = collapseSpace(textContent(n))
+		}
+		if hinted == "" {
+			class, _ := getAttr(n, "class")
+			id, _ := getAttr(n, "id")
+			itemprop, _ := getAttr(n, "itemprop")
+			if bylineHint.MatchString(class+" "+id) || itemprop == "author" {
+				if text := collapseSpace(textContent(n)); text != "" && len(text) < 100 {
+					hinted = text
+				}
+			}
+		}
+	})
+	for _, b := range []string{meta, rel, hinted} {
+		if b = strings.TrimSpace(b); b != "" {
+			return b
+		}
+	}
+	return ""
+}
+
+// collapseSpace replaces every run of whitespace in s with a single space and trims the ends.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
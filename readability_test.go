@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractArticle(t *testing.T) {
+	doc, err := parseHTML(strings.NewReader(`<html><head><title>Site | Story</title><meta name="author" content="Jane Doe"></head><body>
+		<nav><p>Home, About, Contact, Blog, Shop, Help, Careers, Press</p></nav>
+		<div class="sidebar"><p>Related stories you might enjoy, and more, and more.</p></div>
+		<article class="post-content">
+			<h1>The Story</h1>
+			<p>It was a bright cold day in April, and the clocks were striking thirteen.</p>
+			<p>Winston Smith, his chin nuzzled into his breast, slipped quickly through the doors.</p>
+		</article>
+		<footer><p>Copyright notice, terms, privacy, cookies, and so on.</p></footer>
+	</body></html>`))
+	if err != nil {
+		t.Fatalf("parseHTML failed: %v", err)
+	}
+
+	got, ok := extractArticle(doc, nil).(*article)
+	if !ok {
+		t.Fatalf("Expected an article, got %#v", extractArticle(doc, nil))
+	}
+	if got.Title != "The Story" {
+		t.Errorf("Unexpected title: %q", got.Title)
+	}
+	if got.Byline != "Jane Doe" {
+		t.Errorf("Unexpected byline: %q", got.Byline)
+	}
+	if !strings.HasPrefix(got.Text, "It was a bright cold day") || !strings.Contains(got.Text, "\n\nWinston Smith") {
+		t.Errorf("Unexpected text: %q", got.Text)
+	}
+	if strings.Contains(got.Text, "Related stories") || strings.Contains(got.Text, "Copyright") {
+		t.Errorf("Boilerplate leaked into text: %q", got.Text)
+	}
+}
+
+func TestExtractArticle_NoContent(t *testing.T) {
+	doc, _ := parseHTML(strings.NewReader(`<p>short</p>`))
+	if got := extractArticle(doc, nil); got != nil {
+		t.Errorf("Expected nil for a page without paragraphs, got %#v", got)
+	}
+}
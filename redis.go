@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --- Redis ---
+
+// redisPollTimeout bounds how long a receive blocks waiting for a job, so the worker
+// notices interruptions.
+var redisPollTimeout = 5 * time.Second
+
+// redisProcessingSuffix names the list holding the jobs taken but not yet acknowledged.
+const redisProcessingSuffix = ":processing"
+
+// redisConnect connects to the server of a redis:// target ([user:password@]HOST:PORT,
+// database from ?db=) and returns the list named by its path.
+func redisConnect(target string) (*redis.Client, string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, "", err
+	}
+	list := strings.Trim(u.Path, "/")
+	if u.Host == "" || list == "" || strings.Contains(list, "/") {
+		return nil, "", fmt.Errorf("redis target %q needs the form redis://HOST:6379/LIST", u.Redacted())
+	}
+	opts := &redis.Options{Addr: u.Host, Username: u.User.Username()}
+	opts.Password, _ = u.User.Password()
+	if db := u.Query().Get("db"); db != "" {
+		if opts.DB, err = strconv.Atoi(db); err != nil {
+			return nil, "", fmt.Errorf("redis target %q: invalid db %q", u.Redacted(), db)
+		}
+	}
+	return redis.NewClient(opts), list, nil
+}
+
+// redisQueue takes jobs from a Redis list, using the reliable queue pattern: producers
+// LPUSH jobs onto LIST, and the worker atomically moves each one to LIST:processing while
+// it runs. Acknowledged jobs are removed from there; returned ones go back to LIST to be
+// taken next. Jobs of a worker that died stay in LIST:processing for inspection or
+// requeueing.
+type redisQueue struct {
+	client *redis.Client
+	list   string
+}
+
+func openRedisQueue(target string) (jobQueue, error) {
+	client, list, err := redisConnect(target)
+	if err != nil {
+		return nil, err
+	}
+	return &redisQueue{client: client, list: list}, nil
+}
+
+func (q *redisQueue) receive(ctx context.Context) ([]job, error) {
+	processing := q.list + redisProcessingSuffix
+	body, err := q.client.BLMove(ctx, q.list, processing, "RIGHT", "LEFT", redisPollTimeout).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Jobs carry no ID of their own; a hash of the payload identifies them in logs
+	sum := sha256.Sum256([]byte(body))
+	return []job{{
+		ID:   hex.EncodeToString(sum[:8]),
+		Body: []byte(body),
+		ack: func(ctx context.Context) error {
+			return q.client.LRem(ctx, processing, 1, body).Err()
+		},
+		nack: func(ctx context.Context) error {
+			_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.LRem(ctx, processing, 1, body)
+				pipe.RPush(ctx, q.list, body)
+				return nil
+			})
+			return err
+		},
+	}}, nil
+}
+
+func (q *redisQueue) Close() error {
+	return q.client.Close()
+}
+
+// redisPublisher pushes results onto a list with LPUSH, so they can be consumed in order
+// from the other end like jobs: redis://HOST:6379/LIST.
+type redisPublisher struct {
+	client *redis.Client
+	list   string
+}
+
+func openRedisPublisher(target string) (resultPublisher, error) {
+	client, list, err := redisConnect(target)
+	if err != nil {
+		return nil, err
+	}
+	return &redisPublisher{client: client, list: list}, nil
+}
+
+func (p *redisPublisher) publish(ctx context.Context, jobID string, result []byte) error {
+	return p.client.LPush(ctx, p.list, result).Err()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisQueue(t *testing.T) {
+	server := miniredis.RunT(t)
+	defer func(timeout time.Duration) { redisPollTimeout = timeout }(redisPollTimeout)
+	redisPollTimeout = 10 * time.Millisecond
+
+	queue, err := openRedisQueue("redis://" + server.Addr() + "/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	ctx := context.Background()
+	server.Lpush("jobs", "first")
+	server.Lpush("jobs", "second")
+
+	jobs, err := queue.receive(ctx)
+	if err != nil || len(jobs) != 1 || string(jobs[0].Body) != "first" {
+		t.Fatalf("receive = %v, %v; want the first job", jobs, err)
+	}
+	if list, _ := server.List("jobs:processing"); len(list) != 1 || list[0] != "first" {
+		t.Errorf("processing = %v; want the first job", list)
+	}
+	// A returned job is taken again next
+	if err := jobs[0].nack(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err = queue.receive(ctx); err != nil || len(jobs) != 1 || string(jobs[0].Body) != "first" {
+		t.Fatalf("receive after nack = %v, %v; want the first job again", jobs, err)
+	}
+	if err := jobs[0].ack(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := server.List("jobs:processing"); len(list) != 0 {
+		t.Errorf("processing = %v after ack; want it empty", list)
+	}
+	if jobs, err = queue.receive(ctx); err != nil || string(jobs[0].Body) != "second" {
+		t.Fatalf("receive = %v, %v; want the second job", jobs, err)
+	}
+	if jobs, err = queue.receive(ctx); err != nil || len(jobs) != 0 {
+		t.Errorf("receive on an empty list = %v, %v; want nothing", jobs, err)
+	}
+
+	results, err := openRedisPublisher("redis://" + server.Addr() + "/results?db=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := results.publish(ctx, "1", []byte(`{"job":"1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := server.List("results"); len(list) != 1 || list[0] != `{"job":"1"}` {
+		t.Errorf("results = %v", list)
+	}
+
+	for _, bad := range []string{"redis://localhost", "redis://localhost/a/b", "redis://localhost/jobs?db=x"} {
+		if _, err := openRedisQueue(bad); err == nil {
+			t.Errorf("Expected an error for %s", bad)
+		}
+	}
+}
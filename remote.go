@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Remote Inputs ---
+
+// The input document can also be an https:// URL, so that scheduled runs on many hosts
+// take their xpaths and URLs from one place, a config server or a file published with the
+// rest of a site. Plain http:// is refused, since the document decides what goatpaver
+// reads, runs and writes. Files it refers to are still local paths or objects.
+
+// inputTokenEnv is the environment variable with a token sent as "Authorization: Bearer
+// TOKEN" when reading input documents over https, if set.
+const inputTokenEnv = "GOATPAVER_INPUT_TOKEN"
+
+// inputClient reads https:// input documents; tests replace it.
+var inputClient = &http.Client{Timeout: time.Minute}
+
+// openInput opens the input document at location: an https:// URL, or what openObject
+// opens.
+func openInput(ctx context.Context, location string) (io.ReadCloser, error) {
+	scheme, _, _ := strings.Cut(location, "://")
+	switch scheme {
+	case "https":
+		return openHTTPS(ctx, location)
+	case "http":
+		return nil, fmt.Errorf("reading %s: input documents are only read over https", location)
+	}
+	return openObject(ctx, location)
+}
+
+// openHTTPS GETs the document at location.
+func openHTTPS(ctx context.Context, location string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "goatpaver/"+toolVersion())
+	if token := os.Getenv(inputTokenEnv); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := inputClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", location, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("reading %s: %s", location, resp.Status)
+	}
+	return resp.Body, nil
+}
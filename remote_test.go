@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenInput(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer central" {
+			http.Error(w, "who are you", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/config.json":
+			w.Write([]byte(`{"xpaths": ["//h1"], "urls": {"a": {"content": "<h1>Remote</h1>"}}}`))
+		case "/config.yaml":
+			w.Write([]byte("xpaths: [//h2]\nurls:\n  b:\n    content: <h2>YAML</h2>\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := inputClient
+	defer func() { inputClient = client }()
+	inputClient = server.Client()
+
+	if _, err := readInputFile(context.Background(), server.URL+"/config.json", formatJSON); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Unexpected error %v without the token", err)
+	}
+	t.Setenv(inputTokenEnv, "central")
+	data, err := readInputFile(context.Background(), server.URL+"/config.json", formatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := processInput(data)
+	if err != nil || output["//h1"]["a"] != "Remote" {
+		t.Errorf("Unexpected output %v: %v", output, err)
+	}
+
+	// YAML is told by the path, whatever the query
+	data, err = readInputFile(context.Background(), server.URL+"/config.yaml?v=2", formatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output, err := processInput(data); err != nil || output["//h2"]["b"] != "YAML" {
+		t.Errorf("Unexpected output %v: %v", output, err)
+	}
+
+	if _, err := openInput(context.Background(), server.URL+"/missing.json"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Unexpected error %v for a missing document", err)
+	}
+	if _, err := openInput(context.Background(), "http://config.example.com/input.json"); err == nil || !strings.Contains(err.Error(), "only read over https") {
+		t.Errorf("Unexpected error %v over http", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"sort"
+	"time"
+)
+
+// --- HTML Report ---
+
+// reportSamples is how many values the report shows per output key.
+const reportSamples = 5
+
+// reportValueLength is where the report cuts sampled values off, in characters.
+const reportValueLength = 200
+
+// htmlReport is what -report shows: a standalone page with the match rate of every
+// expression, the URLs that failed and a few values each expression extracted, for
+// people who won't read the JSON.
+type htmlReport struct {
+	Time     time.Time
+	Stats    *runStats
+	Warnings []runWarning
+	Samples  []reportSample
+
+	location string // Where the report is written
+}
+
+// reportSample is a value extracted for one URL.
+type reportSample struct {
+	Key   string
+	URL   string
+	Value string
+}
+
+// newReport starts the report of a run with stats, taking the samples from output as
+// process produced it; it returns nil without -report.
+func (opts runOptions) newReport(input *InputJson, output OutputJson, stats *runStats) *htmlReport {
+	if opts.report == "" {
+		return nil
+	}
+	r := &htmlReport{Stats: stats, Warnings: input.status.log, location: opts.report}
+	for _, key := range input.outputKeys(output) {
+		urls := make([]string, 0, len(output[key]))
+		for pageURL := range output[key] {
+			urls = append(urls, pageURL)
+		}
+		sort.Strings(urls)
+		if len(urls) > reportSamples {
+			urls = urls[:reportSamples]
+		}
+		for _, pageURL := range urls {
+			r.Samples = append(r.Samples, reportSample{Key: key, URL: pageURL, Value: sampleText(output[key][pageURL])})
+		}
+	}
+	return r
+}
+
+// sampleText renders a value for the report: strings as they are, anything else as JSON,
+// cut off at reportValueLength.
+func sampleText(value interface{}) string {
+	text, ok := value.(string)
+	if !ok {
+		data, _ := json.Marshal(value)
+		text = string(data)
+	}
+	if runes := []rune(text); len(runes) > reportValueLength {
+		text = string(runes[:reportValueLength]) + "…"
+	}
+	return text
+}
+
+// save renders r for the run finished at finished and stores it at the -report location,
+// a local file or an s3:// or gs:// object. It does nothing if r is nil.
+func (r *htmlReport) save(finished time.Time) error {
+	if r == nil {
+		return nil
+	}
+	r.Time = finished.UTC()
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, r); err != nil {
+		return err
+	}
+	return writeObject(context.Background(), r.location, "text/html; charset=utf-8", buf.Bytes())
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>goatpaver report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; }
+td.number { text-align: right; }
+.bar { background: #4a8; height: 0.8em; }
+.skipped { color: #b22; }
+</style>
+</head>
+<body>
+<h1>goatpaver report</h1>
+<p>{{.Time.Format "2006-01-02 15:04:05 MST"}}: {{.Stats.URLs}} URLs, {{.Stats.Processed}} processed, {{.Stats.Failed}} failed; {{.Stats.Bytes}} bytes in {{printf "%.0f" .Stats.WallMS}} ms.</p>
+
+<h2>Matches</h2>
+<table>
+<tr><th>Expression</th><th>Matched</th><th>URLs</th><th>Rate</th><th></th></tr>
+{{- range .Stats.Keys}}
+<tr><td><code>{{.Key}}</code></td><td class="number">{{.Matched}}</td><td class="number">{{.Total}}</td><td class="number">{{printf "%.1f%%" .Percent}}</td><td style="width: 10em"><div class="bar" style="width: {{printf "%.0f" .Percent}}%"></div></td></tr>
+{{- end}}
+</table>
+
+<h2>Failures</h2>
+{{- if .Warnings}}
+<table>
+<tr><th>URL</th><th>Problem</th></tr>
+{{- range .Warnings}}
+<tr><td>{{if .URL}}{{.URL}}{{else}}(run){{end}}</td><td{{if .Skipped}} class="skipped"{{end}}>{{.Message}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>None.</p>
+{{- end}}
+
+<h2>Sample values</h2>
+{{- if .Samples}}
+<table>
+<tr><th>Expression</th><th>URL</th><th>Value</th></tr>
+{{- range .Samples}}
+<tr><td><code>{{.Key}}</code></td><td>{{.URL}}</td><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>Nothing was extracted.</p>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.html")
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", "count(//p)"],
+		"urls": {"http://a.com": {"content": "<h1>A &lt;b&gt;</h1>"}, "http://b.com": {"content": "<h1>"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := runOptions{report: path}
+	stats := input.newRunStats(output)
+	report := opts.newReport(input, output, stats)
+	if err := opts.finishStats(stats, report, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		"2 URLs, 1 processed, 1 failed",
+		"<td><code>//h1</code></td><td class=\"number\">1</td><td class=\"number\">2</td><td class=\"number\">50.0%</td>",
+		"<td>http://b.com</td><td class=\"skipped\">Failed to parse content",
+		"<td><code>//h1</code></td><td>http://a.com</td><td>A &lt;b&gt;</td>",
+		"<td><code>count(//p)</code></td><td>http://a.com</td><td>0</td>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Report lacks %q:\n%s", want, page)
+		}
+	}
+
+	if (runOptions{}).newReport(input, output, stats) != nil {
+		t.Error("Expected no report without -report")
+	}
+	if long := sampleText(strings.Repeat("é", 300)); len([]rune(long)) != reportValueLength+1 {
+		t.Errorf("sampleText kept %d characters, want %d and an ellipsis", len([]rune(long)), reportValueLength)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Resolve ---
+
+// To scrape a staging environment under the production hostnames, the "resolve" fetch
+// options, and the -resolve flag adding to them, pin HOST:PORT to an address, as curl's
+// --resolve does: connections to it go to ADDR instead of where DNS says, while the
+// request's Host header, SNI and certificate verification still use HOST. The pins apply
+// to https:// input documents too. Connections through a proxy go to the proxy as usual.
+
+// parseResolve parses "HOST:PORT:ADDR" entries into the address to dial for each
+// "host:port", with IPv6 addresses in brackets like "[::1]".
+func parseResolve(entries []string) (map[string]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	pins := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		host, rest, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		port, addr, _ := strings.Cut(rest, ":")
+		addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		if n, err := strconv.Atoi(port); host == "" || err != nil || n < 1 || n > 65535 || net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid resolve %q (want HOST:PORT:ADDR, e.g. example.com:443:10.0.0.5)", entry)
+		}
+		pins[net.JoinHostPort(strings.ToLower(host), port)] = net.JoinHostPort(addr, port)
+	}
+	return pins, nil
+}
+
+// httpClient returns a client connecting with the TLS options, if not nil, and to the
+// pinned addresses, through the usual proxies.
+func httpClient(options *TLSOptions, pins map[string]string, timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options != nil {
+		config, err := options.config()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = config
+	}
+	if len(pins) > 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second} // As http.DefaultTransport
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if err == nil {
+				if pinned, ok := pins[net.JoinHostPort(strings.ToLower(host), port)]; ok {
+					addr = pinned
+				}
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		w.Write([]byte("<html><h1>Staging</h1></html>"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	o := &FetchOptions{Resolve: []string{"www.Example.test:" + port + ":127.0.0.1", "other.test:1:[::1]"}}
+	if err := o.check(); err != nil {
+		t.Fatal(err)
+	}
+	body, _, err := o.fetch("http://www.example.test:"+port+"/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "<html><h1>Staging</h1></html>" || host != "www.example.test:"+port {
+		t.Errorf("Unexpected body %q for host %q", body, host)
+	}
+
+	// Certificates are checked against the pinned host
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	_, tlsPort, _ := net.SplitHostPort(tlsServer.Listener.Addr().String())
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	if err := os.WriteFile(ca, cert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for pinned, valid := range map[string]bool{"example.com": true, "staging.test": false} {
+		o := &FetchOptions{TLS: &TLSOptions{CA: ca}, Resolve: []string{pinned + ":" + tlsPort + ":127.0.0.1"}}
+		if err := o.check(); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := o.fetch("https://"+pinned+":"+tlsPort+"/", 0); (err == nil) != valid {
+			t.Errorf("Unexpected error %v fetching %s", err, pinned)
+		}
+	}
+
+	for _, entry := range []string{"example.com:443", "example.com:https:10.0.0.1", ":443:10.0.0.1", "example.com:443:staging.test", "example.com:0:10.0.0.1"} {
+		if err := (&FetchOptions{Resolve: []string{entry}}).check(); err == nil {
+			t.Errorf("Expected an error for %q", entry)
+		}
+	}
+}
+
+func TestResolveFlag(t *testing.T) {
+	opts, err := parseFlags([]string{"-resolve", "example.com:443:10.0.0.5, example.com:80:[2001:db8::1]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.pins) != 2 || opts.pins["example.com:443"] != "10.0.0.5:443" || opts.pins["example.com:80"] != "[2001:db8::1]:80" {
+		t.Errorf("Unexpected pins %v", opts.pins)
+	}
+	if _, err := parseFlags([]string{"-resolve", "example.com:10.0.0.5"}); err == nil {
+		t.Error("Expected an error for a -resolve without a port")
+	}
+}
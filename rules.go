@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// --- Validation Rules ---
+
+// rulesKey is the output section listing rule failures per URL.
+const rulesKey = "$rules"
+
+// defaultRulesExitCode is the exit status when rules fail and the input sets no other.
+// It stays clear of the status 2 used for fatal errors.
+const defaultRulesExitCode = 1
+
+// Rules are checks an expression's value must pass. Failures don't remove the value; they
+// are listed in the "$rules" output section and make the run exit non-zero.
+// Length and pattern checks apply to strings, range checks to numbers (including numeric
+// strings and money amounts). Each element of a list is checked on its own.
+type Rules struct {
+	Required  bool     `json:"required,omitempty"`   // The expression must produce a value
+	Pattern   string   `json:"pattern,omitempty"`    // RE2 regular expression the value must match
+	MinLength *int     `json:"min_length,omitempty"` // Minimum length in characters
+	MaxLength *int     `json:"max_length,omitempty"` // Maximum length in characters
+	Min       *float64 `json:"min,omitempty"`        // Smallest allowed number
+	Max       *float64 `json:"max,omitempty"`        // Largest allowed number
+}
+
+// ruleFailure is one entry of the "$rules" section.
+type ruleFailure struct {
+	Expression string `json:"expression"` // Output key of the expression
+	Rule       string `json:"rule"`       // Name of the failed rule, as in the input
+	Message    string `json:"message"`
+}
+
+// compiledRules are Rules with their pattern compiled.
+type compiledRules struct {
+	Rules
+	pattern *regexp.Regexp
+}
+
+// compile checks the rules, returning nil if there are none.
+func (r *Rules) compile() (*compiledRules, error) {
+	if r == nil {
+		return nil, nil
+	}
+	compiled := &compiledRules{Rules: *r}
+	if r.Pattern != "" {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rules: %w", err)
+		}
+		compiled.pattern = re
+	}
+	return compiled, nil
+}
+
+// check returns the rules value violates; found is false if the expression produced
+// no value at all.
+func (r *compiledRules) check(key string, value interface{}, found bool) []ruleFailure {
+	if !found {
+		if r.Required {
+			return []ruleFailure{{Expression: key, Rule: "required", Message: "no value"}}
+		}
+		return nil
+	}
+	if list, ok := value.([]interface{}); ok {
+		var failures []ruleFailure
+		if r.Required && len(list) == 0 {
+			failures = append(failures, ruleFailure{Expression: key, Rule: "required", Message: "empty list"})
+		}
+		for _, elem := range list {
+			failures = append(failures, r.check(key, elem, true)...)
+		}
+		return failures
+	}
+
+	var failures []ruleFailure
+	fail := func(rule, format string, a ...interface{}) {
+		failures = append(failures, ruleFailure{Expression: key, Rule: rule, Message: fmt.Sprintf(format, a...)})
+	}
+	if s, ok := value.(string); ok {
+		if r.Required && s == "" {
+			fail("required", "empty value")
+		}
+		if r.pattern != nil && !r.pattern.MatchString(s) {
+			fail("pattern", "%q does not match %s", s, r.Pattern)
+		}
+		if n := utf8.RuneCountInString(s); r.MinLength != nil && n < *r.MinLength {
+			fail("min_length", "%q is %d characters, want at least %d", s, n, *r.MinLength)
+		} else if r.MaxLength != nil && n > *r.MaxLength {
+			fail("max_length", "%q is %d characters, want at most %d", s, n, *r.MaxLength)
+		}
+	}
+	if r.Min == nil && r.Max == nil {
+		return failures
+	}
+	number, ok := numericValue(value)
+	switch {
+	case !ok && r.Min != nil:
+		fail("min", "%v is not a number", value)
+	case !ok:
+		fail("max", "%v is not a number", value)
+	case r.Min != nil && number < *r.Min:
+		fail("min", "%v is less than %v", number, *r.Min)
+	case r.Max != nil && number > *r.Max:
+		fail("max", "%v is greater than %v", number, *r.Max)
+	}
+	return failures
+}
+
+// numericValue returns the number a result stands for.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case money:
+		return v.Amount, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// rulesExitCode returns the exit status for a run whose output has rule failures, or
+// 0 if the rules passed.
+func (input *InputJson) rulesExitCode(output OutputJson) int {
+	if len(output[rulesKey]) == 0 {
+		return 0
+	}
+	if input.RulesExitCode != nil {
+		return *input.RulesExitCode
+	}
+	return defaultRulesExitCode
+}
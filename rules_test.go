@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProcessInput_Rules(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"xpaths": [
+			{"xpath": "//h1", "name": "title", "rules": {"required": true, "min_length": 3, "pattern": "^[A-Z]"}},
+			{"xpath": "//span", "name": "price", "transforms": ["money"], "rules": {"min": 1, "max": 1000}},
+			{"xpath": "//em", "name": "tags", "transforms": [{"type": "split", "separator": ","}], "rules": {"max_length": 4}},
+			{"xpath": "//h1", "name": "bad", "rules": {"pattern": "("}}
+		],
+		"urls": {
+			"http://good.com": {"content": "<html><body><h1>Widget</h1><span>$12.50</span><em>red,blue</em></body></html>"},
+			"http://bad.com": {"content": "<html><body><h1>ok</h1><span>$1,299.00</span><em>red,purple</em></body></html>"},
+			"http://empty.com": {"content": "<html><body></body></html>"}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"title": {"http://good.com": "Widget", "http://bad.com": "ok"},
+		"price": {
+			"http://good.com": money{Amount: 12.5, Currency: "USD"},
+			"http://bad.com":  money{Amount: 1299, Currency: "USD"},
+		},
+		"tags": {
+			"http://good.com": []interface{}{"red", "blue"},
+			"http://bad.com":  []interface{}{"red", "purple"},
+		},
+		"bad": {},
+		rulesKey: {
+			"http://bad.com": []ruleFailure{
+				{Expression: "price", Rule: "max", Message: "1299 is greater than 1000"},
+				{Expression: "tags", Rule: "max_length", Message: `"purple" is 6 characters, want at most 4`},
+				{Expression: "title", Rule: "pattern", Message: `"ok" does not match ^[A-Z]`},
+				{Expression: "title", Rule: "min_length", Message: `"ok" is 2 characters, want at least 3`},
+			},
+			"http://empty.com": []ruleFailure{
+				{Expression: "title", Rule: "required", Message: "no value"},
+			},
+		},
+	}
+
+	input, err := parseInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("parseInput returned an unexpected error: %v", err)
+	}
+	actualOutput, err := process(input)
+	if err != nil {
+		t.Fatalf("process returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		expectedJson, _ := json.MarshalIndent(expectedOutput, "", "  ")
+		actualJson, _ := json.MarshalIndent(actualOutput, "", "  ")
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
+	}
+
+	if code := input.rulesExitCode(actualOutput); code != defaultRulesExitCode {
+		t.Errorf("rulesExitCode = %d, want %d", code, defaultRulesExitCode)
+	}
+	custom := 0
+	input.RulesExitCode = &custom
+	if code := input.rulesExitCode(actualOutput); code != 0 {
+		t.Errorf("rulesExitCode with rules_exit_code 0 = %d, want 0", code)
+	}
+	if code := input.rulesExitCode(OutputJson{rulesKey: {}}); code != 0 {
+		t.Errorf("rulesExitCode without failures = %d, want 0", code)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/user/go_goat/internal/xmlpath"
+)
+
+// --- Fragment Sanitization ---
+
+// SanitizeOptions restricts outerHTML/innerHTML results to an allow-list of elements and
+// attributes, so fragments can be embedded into other pages. In the input it is either
+// true (use the default lists), false, or an object overriding either list.
+type SanitizeOptions struct {
+	Tags       []string `json:"tags,omitempty"`       // Allowed elements; others are unwrapped, keeping their text
+	Attributes []string `json:"attributes,omitempty"` // Allowed attributes, on any allowed element
+
+	disabled bool // Set by "sanitize": false
+}
+
+// UnmarshalJSON accepts true, false or an options object.
+func (o *SanitizeOptions) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*o = SanitizeOptions{disabled: !enabled}
+		return nil
+	}
+	type sanitizeFields SanitizeOptions // Avoids recursing into this method
+	var fields sanitizeFields
+	if err := strictUnmarshal(data, &fields, "sanitize options"); err != nil {
+		return err
+	}
+	*o = SanitizeOptions(fields)
+	return nil
+}
+
+// defaultSanitizeTags are formatting and structural elements that can't run script or load
+// active content.
+var defaultSanitizeTags = []string{
+	"a", "abbr", "article", "b", "blockquote", "br", "caption", "cite", "code", "dd", "del",
+	"div", "dl", "dt", "em", "figcaption", "figure", "h1", "h2", "h3", "h4", "h5", "h6", "hr",
+	"i", "img", "ins", "kbd", "li", "mark", "ol", "p", "pre", "q", "s", "section", "small",
+	"span", "strong", "sub", "sup", "table", "tbody", "td", "tfoot", "th", "thead", "time",
+	"tr", "u", "ul",
+}
+
+// defaultSanitizeAttributes excludes event handlers, style and class, which carry
+// script or break the embedding page's layout.
+var defaultSanitizeAttributes = []string{
+	"alt", "cite", "colspan", "datetime", "dir", "height", "href", "lang", "rowspan",
+	"src", "title", "width",
+}
+
+// dropWithContent are elements whose content is never useful as text, so they are
+// removed entirely rather than unwrapped.
+var dropWithContent = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true,
+	"noscript": true, "template": true, "svg": true, "math": true, "head": true,
+}
+
+// urlAttributes hold links and are dropped unless their scheme is safe.
+var urlAttributes = map[string]bool{"href": true, "src": true, "cite": true}
+
+// sanitizePolicy is the compiled form of SanitizeOptions.
+type sanitizePolicy struct {
+	tags  map[string]bool
+	attrs map[string]bool
+}
+
+// newSanitizePolicy compiles o, returning nil if sanitization is off.
+func newSanitizePolicy(o *SanitizeOptions) *sanitizePolicy {
+	if o == nil || o.disabled {
+		return nil
+	}
+	tags, attrs := o.Tags, o.Attributes
+	if tags == nil {
+		tags = defaultSanitizeTags
+	}
+	if attrs == nil {
+		attrs = defaultSanitizeAttributes
+	}
+	p := &sanitizePolicy{tags: make(map[string]bool), attrs: make(map[string]bool)}
+	for _, t := range tags {
+		p.tags[strings.ToLower(t)] = true
+	}
+	for _, a := range attrs {
+		p.attrs[strings.ToLower(a)] = true
+	}
+	return p
+}
+
+func (p *sanitizePolicy) allowElement(n *xmlpath.Node) bool {
+	space := n.Name().Space
+	return (space == "" || space == "http://www.w3.org/1999/xhtml") && p.tags[strings.ToLower(n.Name().Local)]
+}
+
+// dropContent reports whether a disallowed element should take its content with it.
+func (p *sanitizePolicy) dropContent(n *xmlpath.Node) bool {
+	return dropWithContent[strings.ToLower(n.Name().Local)]
+}
+
+func (p *sanitizePolicy) allowAttr(attr *xmlpath.Node) bool {
+	name := attr.Name()
+	local := strings.ToLower(name.Local)
+	if name.Space != "" || !p.attrs[local] {
+		return false
+	}
+	return !urlAttributes[local] || safeURL(attr.String())
+}
+
+// safeURL reports whether a link is relative or uses a scheme that can't execute script.
+// Inline images are allowed as data: URLs; other data: types are not.
+func safeURL(link string) bool {
+	// Browsers ignore whitespace and control characters inside schemes ("java\tscript:")
+	link = strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, link))
+	colon := strings.IndexByte(link, ':')
+	if colon < 0 || strings.ContainsAny(link[:colon], "/?#") {
+		return true // No scheme, so relative
+	}
+	switch scheme := link[:colon]; scheme {
+	case "http", "https", "mailto", "tel":
+		return true
+	case "data":
+		return strings.HasPrefix(link, "data:image/") && !strings.HasPrefix(link, "data:image/svg")
+	}
+	return false
+}
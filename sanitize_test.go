@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProcessInput_Sanitize(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"xpaths": [
+			{"xpath": "//div", "name": "default", "return": "innerHTML", "sanitize": true},
+			{"xpath": "//div", "name": "custom", "return": "outerHTML", "sanitize": {"tags": ["div", "b"], "attributes": ["class"]}},
+			{"xpath": "//div", "name": "off", "return": "innerHTML", "sanitize": false},
+			{"xpath": "//div", "name": "text", "sanitize": true}
+		],
+		"urls": {
+			"http://example.com": {
+				"content": "<html><body><div class=\"x\"><p onclick=\"evil()\" title=\"t\">Hi <b>there</b></p><script>evil()</script><a href=\" JaVa&#9;script:evil()\">bad</a><a href=\"/ok\">ok</a><img src=\"data:image/png;base64,AA==\"/><blink>old</blink><!-- c --></div></body></html>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"default": {
+			"http://example.com": `<p title="t">Hi <b>there</b></p><a>bad</a><a href="/ok">ok</a><img src="data:image/png;base64,AA=="/>old`,
+		},
+		"custom": {
+			"http://example.com": `<div class="x">Hi <b>there</b>badokold</div>`,
+		},
+		"off": {
+			"http://example.com": `<p onclick="evil()" title="t">Hi <b>there</b></p><script>evil()</script><a href=" JaVa&#x9;script:evil()">bad</a><a href="/ok">ok</a><img src="data:image/png;base64,AA=="/><blink>old</blink><!-- c -->`,
+		},
+		"text": {},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		expectedJson, _ := json.MarshalIndent(expectedOutput, "", "  ")
+		actualJson, _ := json.MarshalIndent(actualOutput, "", "  ")
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
+	}
+}
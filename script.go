@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// --- Starlark Scripts ---
+
+// ScriptOptions supplies a Starlark (https://github.com/bazelbuild/starlark) module whose
+// functions customize extraction:
+//
+//   - A transform step {"type": "starlark", "function": "f"} calls f(value) and uses the
+//     result; returning None drops the value.
+//   - If the module defines process(url, fields), it is called once per URL after all
+//     expressions and presets ran, with a dict of that URL's results keyed like the output
+//     (report sections such as "$validation" are left out).
+//     The dict it returns replaces them: a key mapped to None is removed, and new keys
+//     become new output entries.
+type ScriptOptions struct {
+	Source string `json:"source,omitempty"` // Module source code
+	File   string `json:"file,omitempty"`   // Path of a file holding the module, instead of Source
+}
+
+// processFunction is the name of the optional per-URL hook.
+const processFunction = "process"
+
+// maxScriptSteps bounds a single call, so a runaway loop cannot stall a whole run.
+const maxScriptSteps = 10000000
+
+// starlarkScript is a loaded module.
+type starlarkScript struct {
+	name     string
+	globals  starlark.StringDict
+	failures int // Failed transform calls, which only warn
+}
+
+// load executes the module and returns its globals, which are frozen from then on.
+func (s *ScriptOptions) load() (*starlarkScript, error) {
+	if (s.Source == "") == (s.File == "") {
+		return nil, errors.New("script needs exactly one of source and file")
+	}
+	name, src := "script.star", s.Source
+	if s.File != "" {
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return nil, fmt.Errorf("reading script: %w", err)
+		}
+		name, src = s.File, string(data)
+	}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, newThread(name), name, src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("loading script: %w", scriptError(err))
+	}
+	return &starlarkScript{name: name, globals: globals}, nil
+}
+
+// function looks up a callable global.
+func (s *starlarkScript) function(name string) (starlark.Callable, bool) {
+	fn, ok := s.globals[name].(starlark.Callable)
+	return fn, ok
+}
+
+// call invokes fn with Go arguments and converts the result back.
+func (s *starlarkScript) call(fn starlark.Callable, args ...interface{}) (interface{}, error) {
+	values := make(starlark.Tuple, len(args))
+	for i, arg := range args {
+		v, err := toStarlark(arg)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	result, err := starlark.Call(newThread(s.name), fn, values, nil)
+	if err != nil {
+		return nil, scriptError(err)
+	}
+	return fromStarlark(result)
+}
+
+// process runs the per-URL hook, if defined, over the results of pageURL in output.
+func (s *starlarkScript) process(output OutputJson, pageURL string) error {
+	fn, ok := s.function(processFunction)
+	if !ok {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	for key, results := range output {
+		if strings.HasPrefix(key, "$") {
+			continue // Report sections are not results
+		}
+		if value, found := results[pageURL]; found {
+			fields[key] = value
+		}
+	}
+	result, err := s.call(fn, pageURL, fields)
+	if err != nil {
+		return err
+	}
+	processed, ok := result.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s() returned %T, want a dict", processFunction, result)
+	}
+	for key := range fields {
+		if _, kept := processed[key]; !kept {
+			delete(output[key], pageURL)
+		}
+	}
+	for key, value := range processed {
+		if value == nil {
+			if output[key] != nil {
+				delete(output[key], pageURL)
+			}
+			continue
+		}
+		if output[key] == nil {
+			output[key] = make(map[string]interface{})
+		}
+		output[key][pageURL] = value
+	}
+	return nil
+}
+
+// transformStep returns a pipeline step calling the named function of the module.
+func (s *starlarkScript) transformStep(name string) (transformStep, error) {
+	fn, ok := s.function(name)
+	if !ok {
+		return nil, fmt.Errorf("script defines no function %q", name)
+	}
+	return func(value string) (interface{}, bool) {
+		result, err := s.call(fn, value)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Starlark function '%s' failed: %v. Dropping the value.", name, err), "function", name)
+			s.failures++
+			return nil, false
+		}
+		return result, result != nil
+	}, nil
+}
+
+func newThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name:  name,
+		Print: func(_ *starlark.Thread, msg string) { logger.Info(msg, "script", name) },
+	}
+	thread.SetMaxExecutionSteps(maxScriptSteps)
+	return thread
+}
+
+// scriptError adds the Starlark backtrace to evaluation errors.
+func scriptError(err error) error {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return errors.New(evalErr.Backtrace())
+	}
+	return err
+}
+
+// toStarlark converts a result value. Structured preset results are converted through
+// their JSON form, so scripts see the same shape as the output.
+func toStarlark(v interface{}) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case string:
+		return starlark.String(v), nil
+	case bool:
+		return starlark.Bool(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case []interface{}:
+		list := make([]starlark.Value, len(v))
+		for i, elem := range v {
+			sv, err := toStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = sv
+		}
+		return starlark.NewList(list), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys) // Deterministic iteration order for scripts
+		dict := starlark.NewDict(len(v))
+		for _, key := range keys {
+			sv, err := toStarlark(v[key])
+			if err != nil {
+				return nil, err
+			}
+			dict.SetKey(starlark.String(key), sv)
+		}
+		return dict, nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return nil, err
+		}
+		return toStarlark(generic)
+	}
+}
+
+// fromStarlark converts a value returned by a script. Integers become int when they fit,
+// matching count() results.
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return int(i), nil
+		}
+		f, _ := starlark.AsFloat(v)
+		return f, nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.Indexable: // list and tuple
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			elem, err := fromStarlark(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = elem
+		}
+		return list, nil
+	case *starlark.Dict:
+		m := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict key %s is not a string", item[0])
+			}
+			value, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			m[string(key)] = value
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a result", v.Type())
+	}
+}
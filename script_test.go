@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProcessInput_Script(t *testing.T) {
+	input := map[string]interface{}{
+		"script": map[string]string{"source": `
+def shout(value):
+    return value.upper() + "!"
+
+def skip_sale(value):
+    if value == "Sale":
+        return None
+    return value
+
+def process(url, fields):
+    fields["summary"] = "%s (%d links)" % (fields["title"], fields["links"])
+    fields.pop("raw", None)
+    return fields
+`},
+		"xpaths": []interface{}{
+			map[string]interface{}{"xpath": "//h1", "name": "title", "transforms": []interface{}{
+				map[string]string{"type": "starlark", "function": "shout"},
+			}},
+			map[string]interface{}{"xpath": "//h1", "name": "filtered", "transforms": []interface{}{
+				map[string]string{"type": "starlark", "function": "skip_sale"},
+			}},
+			map[string]interface{}{"xpath": "//h1", "name": "missing", "transforms": []interface{}{
+				map[string]string{"type": "starlark", "function": "nope"},
+			}},
+			map[string]interface{}{"xpath": "count(//a)", "name": "links"},
+			map[string]interface{}{"xpath": "//p", "name": "raw"},
+		},
+		"urls": map[string]interface{}{
+			"http://shop.com": map[string]string{
+				"content": "<html><body><h1>Sale</h1><p>x</p><a href=\"/a\">a</a><a href=\"/b\">b</a></body></html>",
+			},
+		},
+	}
+	inputJsonBytes, _ := json.Marshal(input)
+
+	expectedOutput := OutputJson{
+		"title":    {"http://shop.com": "SALE!"},
+		"filtered": {},
+		"missing":  {},
+		"links":    {"http://shop.com": 2},
+		"raw":      {},
+		"summary":  {"http://shop.com": "SALE! (2 links)"},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		expectedJson, _ := json.MarshalIndent(expectedOutput, "", "  ")
+		actualJson, _ := json.MarshalIndent(actualOutput, "", "  ")
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
+	}
+}
+
+func TestProcessInput_ScriptErrors(t *testing.T) {
+	cases := map[string]string{
+		"syntax":      `{"script": {"source": "def broken(:"}, "xpaths": [], "urls": {}}`,
+		"both":        `{"script": {"source": "x = 1", "file": "x.star"}, "xpaths": [], "urls": {}}`,
+		"load failed": `{"script": {"source": "fail('nope')"}, "xpaths": [], "urls": {}}`,
+	}
+	for name, input := range cases {
+		if _, err := processInput([]byte(input)); err == nil {
+			t.Errorf("%s: expected an error, but got nil", name)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --- URL Selection ---
+
+// URLs can be selected from the input on the command line, to run a shared input document
+// for part of its URLs without editing it.
+
+// selectURLs drops the URLs of input that the flags leave out: those not matching
+// -include-url, those matching -exclude-url, those of other shards than -shard's, those
+// not in the -sample and those past the -limit, in that order.
+func (opts runOptions) selectURLs(input *InputJson) {
+	total := len(input.Urls)
+	for pageURL := range input.Urls {
+		if opts.includeURL != nil && !opts.includeURL.MatchString(pageURL) ||
+			opts.excludeURL != nil && opts.excludeURL.MatchString(pageURL) ||
+			opts.shards > 0 && shardOf(pageURL, opts.shards) != opts.shard ||
+			opts.sample > 0 && !inSample(pageURL, opts.sample) {
+			delete(input.Urls, pageURL)
+		}
+	}
+	if opts.limit > 0 && len(input.Urls) > opts.limit {
+		// The first URLs in order, so that the same ones are processed each time
+		urls := make([]string, 0, len(input.Urls))
+		for pageURL := range input.Urls {
+			urls = append(urls, pageURL)
+		}
+		sort.Strings(urls)
+		for _, pageURL := range urls[opts.limit:] {
+			delete(input.Urls, pageURL)
+		}
+	}
+	if len(input.Urls) < total {
+		logger.Debug(fmt.Sprintf("Selected %d of %d URLs", len(input.Urls), total), "urls", len(input.Urls), "total", total)
+	}
+}
+
+// compileURLPattern compiles the value of the URL selection flag name, or returns nil if
+// it is empty.
+func compileURLPattern(name, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("-%s: %w", name, err)
+	}
+	return re, nil
+}
+
+// inSample tells whether pageURL is in a sample of percent of all URLs. The sample is
+// chosen by a hash of the URL rather than at random, so successive runs sample the same
+// URLs and their outputs can be compared.
+func inSample(pageURL string, percent float64) bool {
+	h := fnv.New32a()
+	h.Write([]byte(pageURL))
+	return float64(h.Sum32()%10000) < percent*100
+}
+
+// shardOf returns which of shards shards pageURL is in, from 1 to shards. Like samples,
+// shards are chosen by a hash of the URL, so every machine given the same input and shard
+// count agrees on them without talking to the others; the hash is another than the
+// sample's, so that sampling a shard doesn't favour some URLs.
+func shardOf(pageURL string, shards int) int {
+	h := fnv.New64a()
+	h.Write([]byte(pageURL))
+	return int(h.Sum64()%uint64(shards)) + 1
+}
+
+// parseShard parses a -shard value such as "3/10", returning the shard and the number of
+// shards, or zeros if value is empty.
+func parseShard(value string) (shard, shards int, err error) {
+	if value == "" {
+		return 0, 0, nil
+	}
+	k, n, found := strings.Cut(value, "/")
+	shard, errK := strconv.Atoi(k)
+	shards, errN := strconv.Atoi(n)
+	if !found || errK != nil || errN != nil || shard < 1 || shard > shards {
+		return 0, 0, fmt.Errorf("invalid -shard %q (want K/N with K from 1 to N, such as 3/10)", value)
+	}
+	return shard, shards, nil
+}
+
+// parseSample parses a -sample value such as "5%" or "0.5%", returning the percentage.
+func parseSample(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || !strings.HasSuffix(value, "%") || percent <= 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid -sample %q (want a percentage such as 5%%)", value)
+	}
+	return percent, nil
+}
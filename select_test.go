@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSelectURLs(t *testing.T) {
+	document := `{"xpaths": ["//h1"], "urls": {
+		"https://shop.example.com/a": {}, "https://shop.example.com/b": {},
+		"https://blog.example.com/a": {}, "https://other.org/": {}}}`
+	for _, c := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"https://blog.example.com/a", "https://other.org/", "https://shop.example.com/a", "https://shop.example.com/b"}},
+		{[]string{"-include-url", `example\.com`}, []string{"https://blog.example.com/a", "https://shop.example.com/a", "https://shop.example.com/b"}},
+		{[]string{"-exclude-url", `/a$`}, []string{"https://other.org/", "https://shop.example.com/b"}},
+		{[]string{"-include-url", `^https://shop\.`, "-exclude-url", `/b`}, []string{"https://shop.example.com/a"}},
+	} {
+		opts, err := parseFlags(c.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input, err := parseInput([]byte(document))
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.selectURLs(input)
+		got := []string{}
+		for pageURL := range input.Urls {
+			got = append(got, pageURL)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q selected %v; want %v", c.args, got, c.want)
+		}
+	}
+
+	if _, err := parseFlags([]string{"-include-url", "("}); err == nil || err.Error()[:13] != "-include-url:" {
+		t.Errorf("Unexpected error %v for an invalid pattern", err)
+	}
+}
+
+func TestSampleAndLimit(t *testing.T) {
+	urls := make(map[string]UrlData)
+	for i := 0; i < 1000; i++ {
+		urls[fmt.Sprintf("https://example.com/%d", i)] = UrlData{}
+	}
+	sampled := func(args ...string) map[string]UrlData {
+		opts, err := parseFlags(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input := &InputJson{Urls: make(map[string]UrlData)}
+		for pageURL, urlData := range urls {
+			input.Urls[pageURL] = urlData
+		}
+		opts.selectURLs(input)
+		return input.Urls
+	}
+
+	sample := sampled("-sample", "10%")
+	if len(sample) < 70 || len(sample) > 130 {
+		t.Errorf("Sampled %d of 1000 URLs; want about 100", len(sample))
+	}
+	if again := sampled("-sample", "10%"); !reflect.DeepEqual(again, sample) {
+		t.Error("Sampled different URLs the second time")
+	}
+	if all := sampled("-sample", "100%"); len(all) != 1000 {
+		t.Errorf("Sampled %d of 1000 URLs at 100%%", len(all))
+	}
+
+	limited := sampled("-limit", "3")
+	if !reflect.DeepEqual(limited, map[string]UrlData{"https://example.com/0": {}, "https://example.com/1": {}, "https://example.com/10": {}}) {
+		t.Errorf("Unexpected limited URLs %v", limited)
+	}
+	if both := sampled("-sample", "10%", "-limit", "5"); len(both) != 5 {
+		t.Errorf("Unexpected sampled and limited URLs %v", both)
+	} else {
+		for pageURL := range both {
+			if _, ok := sample[pageURL]; !ok {
+				t.Errorf("Limited URL %s is not in the sample", pageURL)
+			}
+		}
+	}
+
+	for _, args := range [][]string{{"-sample", "5"}, {"-sample", "0%"}, {"-sample", "150%"}, {"-sample", "x%"}, {"-limit", "-1"}} {
+		if _, err := parseFlags(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
+
+func TestShards(t *testing.T) {
+	input := &InputJson{Urls: make(map[string]UrlData)}
+	for i := 0; i < 1000; i++ {
+		input.Urls[fmt.Sprintf("https://example.com/%d", i)] = UrlData{}
+	}
+	seen := make(map[string]int)
+	for shard := 1; shard <= 4; shard++ {
+		opts, err := parseFlags([]string{"-shard", fmt.Sprintf("%d/4", shard)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected := &InputJson{Urls: make(map[string]UrlData)}
+		for pageURL, urlData := range input.Urls {
+			selected.Urls[pageURL] = urlData
+		}
+		opts.selectURLs(selected)
+		if n := len(selected.Urls); n < 200 || n > 300 {
+			t.Errorf("Shard %d/4 has %d of 1000 URLs; want about 250", shard, n)
+		}
+		for pageURL := range selected.Urls {
+			seen[pageURL]++
+		}
+	}
+	// Every URL is in exactly one shard
+	for pageURL := range input.Urls {
+		if seen[pageURL] != 1 {
+			t.Errorf("URL %s is in %d shards", pageURL, seen[pageURL])
+		}
+	}
+	if shardOf("https://example.com/1", 1) != 1 {
+		t.Error("One shard doesn't hold every URL")
+	}
+
+	for _, value := range []string{"3", "0/4", "5/4", "-1/4", "1/0", "a/b", "1/4/2"} {
+		if _, err := parseFlags([]string{"-shard", value}); err == nil {
+			t.Errorf("Expected an error for -shard %q", value)
+		}
+	}
+}
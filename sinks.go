@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// --- Output Sinks ---
+
+// sink stores the results of a run somewhere other than stdout, see the -output flag.
+type sink interface {
+	write(run sinkRun) error
+	Close() error
+}
+
+// sinkRun is one run as handed to a sink.
+type sinkRun struct {
+	ID      string     // From -run-id, or generated
+	Time    time.Time  // When the run finished
+	Output  OutputJson // The values in the nested shape, with report sections
+	Records []record   // The values in the flat shape, ordered by URL
+
+	Document interface{} // The values as they would have been printed, in the chosen shape and -envelope
+	Encoding string      // -output-format
+	Compress bool        // -compress gzip was given
+	Compact  bool        // -compact was given
+}
+
+// urlDocument holds all values of one URL, for sinks storing a document per page.
+type urlDocument struct {
+	URL       string                 `json:"url"`
+	RunID     string                 `json:"run_id"`
+	Timestamp time.Time              `json:"timestamp"`
+	Fields    map[string]interface{} `json:"fields"` // Values by output key; keys without a value are left out
+}
+
+// documents groups the records of run by URL.
+func (run sinkRun) documents() []urlDocument {
+	var documents []urlDocument
+	for _, r := range run.Records {
+		if len(documents) == 0 || documents[len(documents)-1].URL != r.URL {
+			documents = append(documents, urlDocument{URL: r.URL, RunID: run.ID, Timestamp: run.Time.UTC(), Fields: map[string]interface{}{}})
+		}
+		if r.Matched {
+			documents[len(documents)-1].Fields[r.XPath] = r.Value
+		}
+	}
+	return documents
+}
+
+// sinkOpener connects to the sink described by an -output URL.
+type sinkOpener func(target *url.URL) (sink, error)
+
+// sinks is the registry of -output targets by URL scheme.
+var sinks = map[string]sinkOpener{
+	"sqlite":        openSQLiteSink,
+	"postgres":      openPostgresSink,
+	"postgresql":    openPostgresSink,
+	"parquet":       openParquetSink,
+	"elasticsearch": openESSink,
+	"opensearch":    openESSink,
+	"bigquery":      openBigQuerySink,
+	"kafka":         openKafkaSink,
+	"http":          openWebhookSink,
+	"https":         openWebhookSink,
+	"s3":            openObjectSink,
+	"gs":            openObjectSink,
+}
+
+// sqlIdentifier matches the table names sinks accept, so they can be spliced into queries.
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseSinkTarget checks an -output URL against the registered sinks.
+func parseSinkTarget(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("parsing -output: %w", err)
+	}
+	if _, ok := sinks[u.Scheme]; !ok {
+		return nil, fmt.Errorf("unknown -output %q (want sqlite://FILE, postgres://DSN, parquet://FILE, elasticsearch://HOST/INDEX, bigquery://PROJECT/DATASET/TABLE, kafka://BROKER/TOPIC, s3://BUCKET/KEY, gs://BUCKET/OBJECT or an https:// webhook)", target)
+	}
+	return u, nil
+}
+
+// writeSink stores the values of a run finishing at at in the -output sink.
+func (opts runOptions) writeSink(input *InputJson, output OutputJson, at time.Time) error {
+	s, err := sinks[opts.output.Scheme](opts.output)
+	if err != nil {
+		return err
+	}
+	id := opts.runID
+	if id == "" {
+		id = newRunID()
+	}
+	err = s.write(sinkRun{
+		ID: id, Time: at, Output: output, Records: flatRecords(input, output, true),
+		Document: opts.document(input, output, opts.format(input, output), at),
+		Encoding: opts.encoding, Compress: opts.compress == compressGzip, Compact: opts.compact,
+	})
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// newRunID returns a random identifier for a run.
+func newRunID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// recordValue returns the value of r as JSON text, or nil for SQL NULL if it has none.
+func recordValue(r record) (interface{}, error) {
+	if !r.Matched {
+		return nil, nil
+	}
+	data, err := json.Marshal(r.Value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// --- test Subcommand ---
+
+const testUsage = `Usage: goatpaver test [-update] CONFIG DIR
+
+Runs the selectors in CONFIG (an input document; its "urls" are ignored) against every
+document under DIR and compares the results with the golden file next to each document,
+NAME.golden.json. Prints a diff and exits 1 if any result drifted; -update rewrites the
+golden files instead.
+`
+
+// goldenSuffix is appended to a document's file name to form its golden file.
+const goldenSuffix = ".golden.json"
+
+// errDrift reports that results differ from the golden files.
+var errDrift = errors.New("results differ from golden files")
+
+// runTest implements "goatpaver test".
+func runTest(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), testUsage) }
+	update := flags.Bool("update", false, "rewrite golden files with the current results")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("test needs a config file and a document directory")
+	}
+	config, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	dir := flags.Arg(1)
+
+	documents, err := snapshotDocuments(dir)
+	if err != nil {
+		return err
+	}
+	if len(documents) == 0 {
+		return fmt.Errorf("no documents found in %s", dir)
+	}
+	drifted := 0
+	for _, name := range documents {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		actual, err := snapshotResults(config, name, string(content))
+		if err != nil {
+			return err
+		}
+		goldenPath := filepath.Join(dir, filepath.FromSlash(name)+goldenSuffix)
+		if *update {
+			data, _ := json.MarshalIndent(actual, "", "  ")
+			if err := os.WriteFile(goldenPath, append(data, '\n'), 0o644); err != nil {
+				return err
+			}
+			continue
+		}
+
+		expected := map[string]interface{}{}
+		data, err := os.ReadFile(goldenPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &expected); err != nil {
+				return fmt.Errorf("reading %s: %w", goldenPath, err)
+			}
+		}
+		if diff := snapshotDiff(expected, actual); diff != "" {
+			drifted++
+			fmt.Fprintf(stdout, "--- %s\n%s", name, diff)
+		}
+	}
+	if *update {
+		fmt.Fprintf(stdout, "Updated %d golden files\n", len(documents))
+		return nil
+	}
+	if drifted > 0 {
+		fmt.Fprintf(stdout, "FAIL: %d of %d documents drifted\n", drifted, len(documents))
+		return errDrift
+	}
+	fmt.Fprintf(stdout, "ok: %d documents match\n", len(documents))
+	return nil
+}
+
+// snapshotDocuments lists the documents under dir as slash-separated relative paths,
+// skipping golden files and hidden files.
+func snapshotDocuments(dir string) ([]string, error) {
+	var documents []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), goldenSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(documents)
+	return documents, err
+}
+
+// snapshotResults runs config against one document, returning its results by output key
+// in their JSON form. The document's relative path stands in for its URL.
+func snapshotResults(config []byte, name, content string) (map[string]interface{}, error) {
+	input, err := parseInput(config)
+	if err != nil {
+		return nil, err
+	}
+	input.Urls = map[string]UrlData{name: {Content: documentContent(content)}}
+	output, err := process(input)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]interface{})
+	for key, values := range output {
+		if value, found := values[name]; found && !strings.HasPrefix(key, "$") {
+			results[key] = value
+		}
+	}
+	// Round-trip through JSON so results compare equal to decoded golden files
+	data, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]interface{}
+	err = json.Unmarshal(data, &normalized)
+	return normalized, err
+}
+
+// snapshotDiff describes the differences between two result sets, one line per
+// removed (-) or added (+) value, or "" if they are equal.
+func snapshotDiff(expected, actual map[string]interface{}) string {
+	keys := make(map[string]bool)
+	for key := range expected {
+		keys[key] = true
+	}
+	for key := range actual {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var sb strings.Builder
+	for _, key := range sorted {
+		want, hadWant := expected[key]
+		got, hadGot := actual[key]
+		if hadWant == hadGot && reflect.DeepEqual(want, got) {
+			continue
+		}
+		if hadWant {
+			fmt.Fprintf(&sb, "- %s: %s\n", key, compactJSON(want))
+		}
+		if hadGot {
+			fmt.Fprintf(&sb, "+ %s: %s\n", key, compactJSON(got))
+		}
+	}
+	return sb.String()
+}
+
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
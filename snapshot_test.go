@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunTest(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "selectors.json")
+	docs := filepath.Join(dir, "docs")
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(config, `{"xpaths": [{"xpath": "//h1", "name": "title"}, "count(//li)"]}`)
+	write(filepath.Join(docs, "a.html"), "<html><body><h1>A</h1><ul><li>1</li></ul></body></html>")
+	write(filepath.Join(docs, "shop", "b.html"), "<html><body><h1>B</h1></body></html>")
+
+	var out bytes.Buffer
+	if err := runTest([]string{"-update", config, docs}, &out); err != nil {
+		t.Fatalf("runTest -update returned an unexpected error: %v", err)
+	}
+	golden, err := os.ReadFile(filepath.Join(docs, "shop", "b.html"+goldenSuffix))
+	if err != nil {
+		t.Fatalf("golden file was not written: %v", err)
+	}
+	if expected := "{\n  \"count(//li)\": 0,\n  \"title\": \"B\"\n}\n"; string(golden) != expected {
+		t.Errorf("Unexpected golden file.\nExpected:\n%s\nGot:\n%s", expected, golden)
+	}
+
+	out.Reset()
+	if err := runTest([]string{config, docs}, &out); err != nil {
+		t.Fatalf("runTest returned an unexpected error: %v\n%s", err, out.String())
+	}
+
+	write(filepath.Join(docs, "a.html"), "<html><body><h2>A</h2><ul><li>1</li><li>2</li></ul></body></html>")
+	out.Reset()
+	err = runTest([]string{config, docs}, &out)
+	if !errors.Is(err, errDrift) {
+		t.Fatalf("runTest after drift returned %v, want errDrift", err)
+	}
+	expectedDiff := "--- a.html\n" +
+		"- count(//li): 1\n" +
+		"+ count(//li): 2\n" +
+		"- title: \"A\"\n" +
+		"FAIL: 1 of 2 documents drifted\n"
+	if out.String() != expectedDiff {
+		t.Errorf("Unexpected diff.\nExpected:\n%s\nGot:\n%s", expectedDiff, out.String())
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/metrics"
+)
+
+// --- Memory Budget ---
+
+// With -max-memory, process keeps an eye on the heap after each URL. Once it is over the
+// budget, the values extracted so far are spilled to a temporary file as JSON lines and
+// dropped from memory, and at the end of the URLs they are read back into the output in
+// one pass, when the documents are no longer held. The output is still assembled in
+// memory then, but not next to the input's documents and their parse trees.
+
+// heapLive returns the bytes of live heap objects as of the last garbage collection;
+// tests replace it.
+var heapLive = func() int64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
+
+// resultSpill is the temporary file values are spilled to.
+type resultSpill struct {
+	budget  int64
+	file    *os.File // Created on the first spill
+	w       *bufio.Writer
+	spills  int
+	records int
+}
+
+// spilledValue is one line of the spill file.
+type spilledValue struct {
+	Key   string          `json:"key"`
+	URL   string          `json:"url"`
+	Value json.RawMessage `json:"value"`
+}
+
+// spillIfOver spills the values in output if the heap is over the budget.
+func (input *InputJson) spillIfOver(output OutputJson) error {
+	s := input.spill
+	if s == nil || heapLive() <= s.budget {
+		return nil
+	}
+	held := 0
+	for _, values := range output {
+		held += len(values)
+	}
+	if held == 0 {
+		return nil
+	}
+	if err := s.write(output); err != nil {
+		// The values spilled so far are lost with the file
+		if s.file != nil {
+			s.file.Close()
+			os.Remove(s.file.Name())
+		}
+		return fmt.Errorf("spilling values: %w", err)
+	}
+	s.spills++
+	logger.Debug(fmt.Sprintf("Spilled %d values to %s", held, s.file.Name()), "values", held, "file", s.file.Name())
+	runtime.GC() // So the next look at the heap sees what was freed
+	return nil
+}
+
+// write appends the values in output to the spill file and drops them from output.
+func (s *resultSpill) write(output OutputJson) error {
+	if s.file == nil {
+		file, err := os.CreateTemp("", "goatpaver-spill-*.jsonl")
+		if err != nil {
+			return err
+		}
+		s.file, s.w = file, bufio.NewWriter(file)
+	}
+	encoder := json.NewEncoder(s.w)
+	for key, values := range output {
+		for pageURL, value := range values {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			if err := encoder.Encode(spilledValue{Key: key, URL: pageURL, Value: data}); err != nil {
+				return err
+			}
+			delete(values, pageURL)
+			s.records++
+		}
+	}
+	return s.w.Flush()
+}
+
+// merge reads the spilled values back into output and removes the spill file.
+func (s *resultSpill) merge(output OutputJson) error {
+	if s == nil || s.file == nil {
+		return nil
+	}
+	defer os.Remove(s.file.Name())
+	defer s.file.Close()
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bufio.NewReader(s.file))
+	for {
+		var spilled spilledValue
+		if err := decoder.Decode(&spilled); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("reading spilled values: %w", err)
+		}
+		value, err := decodeSpilledValue(spilled.Value)
+		if err != nil {
+			return fmt.Errorf("reading spilled values: %w", err)
+		}
+		if output[spilled.Key] == nil {
+			output[spilled.Key] = make(map[string]interface{})
+		}
+		output[spilled.Key][spilled.URL] = value
+	}
+	s.file = nil
+	return nil
+}
+
+// decodeSpilledValue decodes a spilled value, turning whole numbers back into integers so
+// that counts stay integers in MessagePack and CBOR output.
+func decodeSpilledValue(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return numbersOf(value), nil
+}
+
+// numbersOf replaces the json.Numbers in value by int64 or float64.
+func numbersOf(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = numbersOf(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = numbersOf(v[key])
+		}
+	}
+	return value
+}
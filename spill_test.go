@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSpill(t *testing.T) {
+	defer func(saved func() int64) { heapLive = saved }(heapLive)
+	heapLive = func() int64 { return 1 << 40 } // Always over budget
+
+	input, err := parseInput([]byte(`{"xpaths": ["//h1", "count(//li)"],
+		"urls": {"a": {"content": "<h1>A</h1><li>1</li><li>2</li>"}, "b": {"content": "<h1>B</h1>"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.spill = &resultSpill{budget: 1 << 20}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.spill.spills != 2 || input.spill.file != nil {
+		t.Errorf("Unexpected spill %+v", input.spill)
+	}
+	if output["//h1"]["a"] != "A" || output["//h1"]["b"] != "B" {
+		t.Errorf("Unexpected output %v", output)
+	}
+	// Counts stay integers, as they would have without spilling
+	if count, ok := output["count(//li)"]["a"].(int64); !ok || count != 2 {
+		t.Errorf("Unexpected count %#v", output["count(//li)"]["a"])
+	}
+}
+
+func TestSpillMerge(t *testing.T) {
+	var none *resultSpill
+	if err := none.merge(OutputJson{}); err != nil {
+		t.Error(err)
+	}
+
+	defer func(saved func() int64) { heapLive = saved }(heapLive)
+	heapLive = func() int64 { return 100 }
+	input := &InputJson{spill: &resultSpill{budget: 100}}
+	output := OutputJson{"//h1": {"a": "A"}}
+	if err := input.spillIfOver(output); err != nil || input.spill.file != nil {
+		t.Fatalf("Spilled within the budget: %v", err)
+	}
+
+	heapLive = func() int64 { return 101 }
+	if err := input.spillIfOver(output); err != nil {
+		t.Fatal(err)
+	}
+	name := input.spill.file.Name()
+	if len(output["//h1"]) != 0 {
+		t.Errorf("Values kept after spilling: %v", output)
+	}
+	if err := input.spill.merge(output); err != nil {
+		t.Fatal(err)
+	}
+	if output["//h1"]["a"] != "A" {
+		t.Errorf("Unexpected merged output %v", output)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Spill file %s left behind: %v", name, err)
+	}
+}
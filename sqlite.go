@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure Go driver, registered as "sqlite"
+)
+
+// --- SQLite Sink ---
+
+// sqliteSink upserts records into a table of an SQLite database, created if missing:
+// sqlite://results.db, or sqlite:///var/lib/results.db for an absolute path. The table is
+// "results" unless a ?table= parameter names another. Rows are keyed by run, URL and
+// xpath, so repeating a run with the same -run-id replaces its rows.
+type sqliteSink struct {
+	db    *sql.DB
+	table string
+}
+
+func openSQLiteSink(target *url.URL) (sink, error) {
+	path := target.Host + target.Path
+	if path == "" {
+		return nil, fmt.Errorf("sqlite output needs a database file")
+	}
+	table := target.Query().Get("table")
+	if table == "" {
+		table = "results"
+	}
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("invalid sqlite table name %q", table)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + table + ` (
+		url       TEXT NOT NULL,
+		xpath     TEXT NOT NULL,
+		value     TEXT,
+		matched   INTEGER NOT NULL,
+		run_id    TEXT NOT NULL,
+		timestamp TEXT NOT NULL,
+		PRIMARY KEY (run_id, url, xpath)
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating table %s in %s: %w", table, path, err)
+	}
+	return &sqliteSink{db: db, table: table}, nil
+}
+
+func (s *sqliteSink) write(run sinkRun) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT INTO ` + s.table + ` (url, xpath, value, matched, run_id, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (run_id, url, xpath) DO UPDATE SET
+			value = excluded.value, matched = excluded.matched, timestamp = excluded.timestamp`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	stamp := run.Time.UTC().Format(time.RFC3339Nano)
+	for _, r := range run.Records {
+		value, err := recordValue(r)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(r.URL, r.XPath, value, r.Matched, run.ID, stamp); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteSink) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteSink(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", {"xpath": "//span", "name": "price", "mode": "all"}],
+		"urls": {
+			"http://a.com": {"content": "<p><h1>A</h1><span>12</span><span>13</span></p>"},
+			"http://b.com": {"content": "<p><h1>B</h1></p>"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "results.db")
+	opts, err := parseFlags([]string{"-output", "sqlite://" + path + "?table=pages", "-run-id", "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := opts.writeSink(input, output, at); err != nil {
+		t.Fatal(err)
+	}
+	// The same run again replaces its rows instead of adding to them
+	output["//h1"]["http://b.com"] = "B2"
+	if err := opts.writeSink(input, output, at.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT url, xpath, value, matched, run_id, timestamp FROM pages ORDER BY url, xpath`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type row struct {
+		url, xpath string
+		value      sql.NullString
+		matched    bool
+		runID      string
+		timestamp  string
+	}
+	stamp := "2024-03-01T12:01:00Z"
+	expected := []row{
+		{"http://a.com", "//h1", sql.NullString{String: `"A"`, Valid: true}, true, "r1", stamp},
+		{"http://a.com", "price", sql.NullString{String: `["12","13"]`, Valid: true}, true, "r1", stamp},
+		{"http://b.com", "//h1", sql.NullString{String: `"B2"`, Valid: true}, true, "r1", stamp},
+		{"http://b.com", "price", sql.NullString{}, false, "r1", stamp},
+	}
+	var actual []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.url, &r.xpath, &r.value, &r.matched, &r.runID, &r.timestamp); err != nil {
+			t.Fatal(err)
+		}
+		actual = append(actual, r)
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Got %d rows, want %d: %v", len(actual), len(expected), actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("Row %d = %v; want %v", i, actual[i], expected[i])
+		}
+	}
+}
+
+func TestSinkTargets(t *testing.T) {
+	for _, target := range []string{"mysql://db", "results.db", "sqlite://x.db?table=my-table"} {
+		opts, err := parseFlags([]string{"-output", target})
+		if err == nil {
+			_, err = sinks[opts.output.Scheme](opts.output)
+		}
+		if err == nil {
+			t.Errorf("Expected an error for -output %s", target)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// --- SQS and SNS ---
+
+// The parts of the AWS clients the worker uses.
+type (
+	sqsAPI interface {
+		ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+		DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+		ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+		SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	}
+	snsAPI interface {
+		Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+	}
+)
+
+// awsConfig loads the standard AWS configuration (environment, shared files, instance
+// roles), in region unless it is "".
+var awsConfig = func(region string) (aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	return config.LoadDefaultConfig(context.Background(), opts...)
+}
+
+// newSQSClient and newSNSClient connect to the services; tests replace them.
+var (
+	newSQSClient = func(region string) (sqsAPI, error) {
+		cfg, err := awsConfig(region)
+		if err != nil {
+			return nil, err
+		}
+		return sqs.NewFromConfig(cfg), nil
+	}
+	newSNSClient = func(region string) (snsAPI, error) {
+		cfg, err := awsConfig(region)
+		if err != nil {
+			return nil, err
+		}
+		return sns.NewFromConfig(cfg), nil
+	}
+)
+
+// sqsQueueURL turns sqs://sqs.REGION.amazonaws.com/ACCOUNT/QUEUE into the queue's HTTPS
+// URL and region.
+func sqsQueueURL(target string) (string, string, error) {
+	rest := strings.TrimPrefix(target, "sqs://")
+	host, path, _ := strings.Cut(rest, "/")
+	if host == "" || strings.Count(path, "/") != 1 {
+		return "", "", fmt.Errorf("sqs target %q needs the form sqs://sqs.REGION.amazonaws.com/ACCOUNT/QUEUE", target)
+	}
+	region := ""
+	if parts := strings.Split(host, "."); len(parts) > 2 && parts[0] == "sqs" {
+		region = parts[1]
+	}
+	return "https://" + rest, region, nil
+}
+
+// sqsWaitSeconds is how long a receive call long-polls for messages.
+const sqsWaitSeconds = 20
+
+// sqsQueue takes jobs from an SQS queue. Jobs are deleted when acknowledged and made
+// visible again right away when returned; jobs that are never acknowledged come back
+// after the queue's visibility timeout, and a redrive policy can park repeat failures.
+type sqsQueue struct {
+	client sqsAPI
+	url    string
+}
+
+func openSQSQueue(target string) (jobQueue, error) {
+	queueURL, region, err := sqsQueueURL(target)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newSQSClient(region)
+	if err != nil {
+		return nil, err
+	}
+	return &sqsQueue{client: client, url: queueURL}, nil
+}
+
+func (q *sqsQueue) receive(ctx context.Context) ([]job, error) {
+	out, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.url),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     sqsWaitSeconds,
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]job, len(out.Messages))
+	for i, m := range out.Messages {
+		receipt := m.ReceiptHandle
+		jobs[i] = job{
+			ID:   aws.ToString(m.MessageId),
+			Body: []byte(aws.ToString(m.Body)),
+			ack: func(ctx context.Context) error {
+				_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(q.url), ReceiptHandle: receipt})
+				return err
+			},
+			nack: func(ctx context.Context) error {
+				_, err := q.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+					QueueUrl: aws.String(q.url), ReceiptHandle: receipt, VisibilityTimeout: 0,
+				})
+				return err
+			},
+		}
+	}
+	return jobs, nil
+}
+
+func (q *sqsQueue) Close() error {
+	return nil
+}
+
+// sqsPublisher sends results as messages to an SQS queue.
+type sqsPublisher struct {
+	client sqsAPI
+	url    string
+}
+
+func openSQSPublisher(target string) (resultPublisher, error) {
+	queueURL, region, err := sqsQueueURL(target)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newSQSClient(region)
+	if err != nil {
+		return nil, err
+	}
+	return &sqsPublisher{client: client, url: queueURL}, nil
+}
+
+func (p *sqsPublisher) publish(ctx context.Context, jobID string, result []byte) error {
+	_, err := p.client.SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(p.url), MessageBody: aws.String(string(result))})
+	return err
+}
+
+// snsPublisher publishes results to an SNS topic, given as sns://arn:aws:sns:REGION:ACCOUNT:TOPIC.
+type snsPublisher struct {
+	client snsAPI
+	arn    string
+}
+
+func openSNSPublisher(target string) (resultPublisher, error) {
+	arn := strings.TrimPrefix(target, "sns://")
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" {
+		return nil, fmt.Errorf("sns target %q needs the form sns://arn:aws:sns:REGION:ACCOUNT:TOPIC", target)
+	}
+	client, err := newSNSClient(parts[3])
+	if err != nil {
+		return nil, err
+	}
+	return &snsPublisher{client: client, arn: arn}, nil
+}
+
+func (p *snsPublisher) publish(ctx context.Context, jobID string, result []byte) error {
+	_, err := p.client.Publish(ctx, &sns.PublishInput{TopicArn: aws.String(p.arn), Message: aws.String(string(result))})
+	return err
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// fakeSQS records calls against one queue holding messages.
+type fakeSQS struct {
+	messages  []types.Message
+	deleted   []string
+	returned  []string
+	sent      []string
+	queueURLs map[string]bool
+}
+
+func (f *fakeSQS) ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	f.queueURLs[aws.ToString(in.QueueUrl)] = true
+	messages := f.messages
+	f.messages = nil
+	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func (f *fakeSQS) DeleteMessage(ctx context.Context, in *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(in.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(ctx context.Context, in *sqs.ChangeMessageVisibilityInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	f.returned = append(f.returned, aws.ToString(in.ReceiptHandle))
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (f *fakeSQS) SendMessage(ctx context.Context, in *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.queueURLs[aws.ToString(in.QueueUrl)] = true
+	f.sent = append(f.sent, aws.ToString(in.MessageBody))
+	return &sqs.SendMessageOutput{}, nil
+}
+
+type fakeSNS struct {
+	topic, message string
+}
+
+func (f *fakeSNS) Publish(ctx context.Context, in *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.topic, f.message = aws.ToString(in.TopicArn), aws.ToString(in.Message)
+	return &sns.PublishOutput{}, nil
+}
+
+func TestSQSQueue(t *testing.T) {
+	fake := &fakeSQS{queueURLs: map[string]bool{}, messages: []types.Message{
+		{MessageId: aws.String("m1"), ReceiptHandle: aws.String("r1"), Body: aws.String(`{"xpaths": []}`)},
+		{MessageId: aws.String("m2"), ReceiptHandle: aws.String("r2"), Body: aws.String(`{}`)},
+	}}
+	fakeTopic := &fakeSNS{}
+	var regions []string
+	defer func(sqsClient func(string) (sqsAPI, error), snsClient func(string) (snsAPI, error)) {
+		newSQSClient, newSNSClient = sqsClient, snsClient
+	}(newSQSClient, newSNSClient)
+	newSQSClient = func(region string) (sqsAPI, error) { regions = append(regions, region); return fake, nil }
+	newSNSClient = func(region string) (snsAPI, error) { regions = append(regions, region); return fakeTopic, nil }
+
+	queue, err := openSQSQueue("sqs://sqs.eu-west-1.amazonaws.com/123456789012/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := queue.receive(context.Background())
+	if err != nil || len(jobs) != 2 || jobs[0].ID != "m1" || string(jobs[1].Body) != `{}` {
+		t.Fatalf("receive = %v, %v", jobs, err)
+	}
+	jobs[0].ack(context.Background())
+	jobs[1].nack(context.Background())
+	if len(fake.deleted) != 1 || fake.deleted[0] != "r1" || len(fake.returned) != 1 || fake.returned[0] != "r2" {
+		t.Errorf("deleted %v, returned %v; want r1 deleted and r2 returned", fake.deleted, fake.returned)
+	}
+	if !fake.queueURLs["https://sqs.eu-west-1.amazonaws.com/123456789012/jobs"] {
+		t.Errorf("Unexpected queue URLs %v", fake.queueURLs)
+	}
+
+	results, err := openSQSPublisher("sqs://sqs.eu-west-1.amazonaws.com/123456789012/results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := results.publish(context.Background(), "m1", []byte(`{"job":"m1"}`)); err != nil || len(fake.sent) != 1 {
+		t.Errorf("publish to SQS = %v, sent %v", err, fake.sent)
+	}
+	topic, err := openSNSPublisher("sns://arn:aws:sns:us-east-2:123456789012:results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := topic.publish(context.Background(), "m1", []byte(`{"job":"m1"}`)); err != nil || fakeTopic.topic != "arn:aws:sns:us-east-2:123456789012:results" {
+		t.Errorf("publish to SNS = %v, topic %q", err, fakeTopic.topic)
+	}
+	if regions[0] != "eu-west-1" || regions[2] != "us-east-2" {
+		t.Errorf("Unexpected regions %v", regions)
+	}
+
+	for _, bad := range []string{"sqs://", "sqs://sqs.eu-west-1.amazonaws.com/jobs"} {
+		if _, err := openSQSQueue(bad); err == nil {
+			t.Errorf("Expected an error for %s", bad)
+		}
+	}
+	if _, err := openSNSPublisher("sns://results"); err == nil {
+		t.Error("Expected an error for a topic without an ARN")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// --- Run Statistics ---
+
+// Values for the -stats flag.
+const (
+	statsText = "text"
+	statsJSON = "json"
+)
+
+// runStats summarizes a run for -stats.
+type runStats struct {
+	URLs      int               `json:"urls"`
+	Processed int               `json:"processed"` // URLs read and parsed
+	Failed    int               `json:"failed"`    // URLs that could not be read or parsed
+	Bytes     int               `json:"bytes"`     // Content read, over all URLs
+	WallMS    float64           `json:"wall_ms"`   // From reading the input to writing the output
+	Keys      []expressionStats `json:"expressions"`
+}
+
+// expressionStats is the match rate of one output key, an expression or preset.
+type expressionStats struct {
+	Key     string  `json:"key"`
+	Matched int     `json:"matched"` // URLs with a value
+	Total   int     `json:"total"`   // URLs in the input
+	Percent float64 `json:"percent"` // 0 when there are no URLs
+}
+
+// newRunStats summarizes output as process produced it, before the no-match policy and
+// change-only output alter what counts as matched; WallMS is left for the end of the run.
+func (input *InputJson) newRunStats(output OutputJson) *runStats {
+	s := &runStats{URLs: len(input.Urls), Failed: len(input.status.skipped), Bytes: input.status.bytes}
+	s.Processed = s.URLs - s.Failed - input.status.left
+	for _, key := range input.outputKeys(output) {
+		entry := expressionStats{Key: key, Matched: len(output[key]), Total: s.URLs}
+		if entry.Total > 0 {
+			entry.Percent = 100 * float64(entry.Matched) / float64(entry.Total)
+		}
+		s.Keys = append(s.Keys, entry)
+	}
+	return s
+}
+
+// write writes s to w in the -stats format.
+func (s *runStats) write(w io.Writer, format string) error {
+	if format == statsJSON {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d URLs: %d processed, %d failed; %d bytes in %s\n",
+		s.URLs, s.Processed, s.Failed, s.Bytes, time.Duration(s.WallMS*float64(time.Millisecond)).Round(time.Millisecond))
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	for _, entry := range s.Keys {
+		fmt.Fprintf(tw, "  %s\t%d/%d\t%.1f%%\n", entry.Key, entry.Matched, entry.Total, entry.Percent)
+	}
+	tw.Flush()
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeStats writes s to stderr if -stats was given.
+func (opts runOptions) writeStats(s *runStats) {
+	if opts.stats == "" {
+		return
+	}
+	if err := s.write(os.Stderr, opts.stats); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to write statistics: %v", err))
+	}
+}
+
+// finishStats completes s with the time since started, then writes it with -stats and
+// the report with -report.
+func (opts runOptions) finishStats(s *runStats, report *htmlReport, started time.Time) error {
+	s.WallMS = elapsedMS(started)
+	opts.writeStats(s)
+	return report.save(time.Now())
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunStats(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h2", "//h1"],
+		"urls": {"http://a.com": {"content": "<h1>A</h1>"}, "http://b.com": {"content": "<h1>B</h1>"}, "http://c.com": {"content": "<h1>"}},
+		"on_no_match": "null"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := input.newRunStats(output)
+	if _, err := finishRun(input, output, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	stats.WallMS = 1000
+	if err := stats.write(&buf, statsJSON); err != nil {
+		t.Fatal(err)
+	}
+	var got runStats
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.URLs != 3 || got.Processed != 2 || got.Failed != 1 || got.Bytes != 24 || got.WallMS != 1000 {
+		t.Errorf("Unexpected stats %s", buf.Bytes())
+	}
+	// Values the no-match policy adds don't count as matches
+	expected := []expressionStats{{Key: "//h2", Total: 3}, {Key: "//h1", Matched: 2, Total: 3, Percent: 200.0 / 3}}
+	if len(got.Keys) != 2 || got.Keys[0] != expected[0] || got.Keys[1] != expected[1] {
+		t.Errorf("Unexpected expression stats %+v, want %+v", got.Keys, expected)
+	}
+
+	buf.Reset()
+	if err := stats.write(&buf, statsText); err != nil {
+		t.Fatal(err)
+	}
+	if text := buf.String(); !strings.HasPrefix(text, "3 URLs: 2 processed, 1 failed; 24 bytes in 1s\n") || !strings.Contains(text, "//h1  2/3  66.7%") {
+		t.Errorf("Unexpected summary:\n%s", text)
+	}
+}
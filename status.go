@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// --- Run Status ---
+
+// Exit statuses of a plain run, besides the one for failed rules (1 by default, see
+// rules.go) and 2 for errors that stop the run. A run where some URLs could not be read or
+// parsed exits with exitPartial, and one where none could with exitFailed; both outrank
+// failed rules. With -strict, warnings count too: a URL with any warning has failed, and
+// a warning about the run as a whole, such as an XPath that doesn't compile, makes it
+// partial at least.
+const (
+	exitPartial = 3
+	exitFailed  = 4
+)
+
+// runStatus is what went wrong in a run, collected by process and finishRun.
+type runStatus struct {
+	started  time.Time       // When process began
+	skipped  map[string]bool // URLs given up on
+	warned   map[string]bool // URLs with other warnings
+	warnings int             // Warnings about the run as a whole
+	bytes    int             // Content read, over all URLs
+	log      []runWarning    // Every warning, in order
+	abort    error           // Why a -fail-fast run stops, or nil
+	stopped  bool            // -max-errors URLs have failed
+	left     int             // URLs not processed because the run stopped
+}
+
+// Codes of warnings, as written to the -warnings-file. The subject of a warning is the URL
+// it is about, or the XPath or preset for warnXPath and warnPreset, and empty for
+// warnAlerts and warnStopped.
+const (
+	warnXPath      = "xpath_invalid"      // An expression doesn't compile and is skipped
+	warnPreset     = "preset_unknown"     // A preset doesn't exist and is skipped
+	warnRead       = "read_failed"        // The URL's file or object could not be read
+	warnFetch      = "fetch_failed"       // The URL could not be fetched
+	warnSize       = "too_large"          // The URL's content is larger than -max-doc-size
+	warnDecode     = "decode_failed"      // The URL's content is not valid for its content_encoding
+	warnValidate   = "validate_failed"    // The schema validator failed on the URL
+	warnPresets    = "presets_failed"     // The URL's HTML could not be parsed for presets
+	warnXSLT       = "xslt_failed"        // The stylesheet failed on the URL
+	warnParse      = "parse_failed"       // The URL's content could not be parsed
+	warnScript     = "script_failed"      // Script functions or the per-URL hook failed on the URL
+	warnPanic      = "panicked"           // Processing the URL panicked, see panics.go
+	warnTimeout    = "evaluation_timeout" // Matching an expression on the URL took too long, see timeout.go
+	warnAlerts     = "alerts_failed"      // Alerts could not be sent
+	warnStopped    = "run_stopped"        // -max-errors URLs failed and the rest were left
+	warnCheckpoint = "checkpoint_failed"  // The checkpoint could not be written; its subject is the file
+	warnWorker     = "worker_failed"      // No -workers worker could process the URL, see distributed.go
+)
+
+// runWarning is a warning as reported, for the -report and -warnings-file.
+type runWarning struct {
+	Code    string `json:"code"`
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+	Skipped bool   `json:"skipped"` // The URL was given up on
+	URL     string `json:"-"`       // "" for warnings about the run as a whole
+}
+
+// warn logs a problem that isn't about one URL.
+func (input *InputJson) warn(code, subject, format string, a ...interface{}) {
+	message := fmt.Sprintf(format, a...)
+	input.progress.clear()
+	logger.Warn(message, "code", code, "subject", subject)
+	input.status.warnings++
+	input.record(runWarning{Code: code, Subject: subject, Message: message})
+}
+
+// warnURL logs a problem with pageURL; skipped tells whether the URL was given up on.
+func (input *InputJson) warnURL(code, pageURL string, skipped bool, format string, a ...interface{}) {
+	message := fmt.Sprintf(format, a...)
+	input.progress.clear()
+	logger.Warn(message, "code", code, "url", pageURL, "skipped", skipped)
+	input.status.warnedOn(pageURL, skipped)
+	input.record(runWarning{Code: code, Subject: pageURL, Message: message, Skipped: skipped, URL: pageURL})
+	if input.failFast && failFastCodes[code] && input.status.abort == nil {
+		input.status.abort = fmt.Errorf("stopping at URL '%s' (-fail-fast): %s", pageURL, code)
+	}
+	if skipped && input.maxErrors > 0 && len(input.status.skipped) >= input.maxErrors {
+		input.status.stopped = true
+	}
+}
+
+// failFastCodes are the warnings that stop a run with -fail-fast: URLs whose content could
+// not be read, fetched, decoded or parsed, or that panicked.
+var failFastCodes = map[string]bool{warnRead: true, warnFetch: true, warnDecode: true, warnXSLT: true, warnParse: true, warnPanic: true}
+
+// record keeps a warning that has been logged, writing it to the -warnings-file as well.
+func (input *InputJson) record(w runWarning) {
+	input.status.log = append(input.status.log, w)
+	if input.warnings != nil {
+		// A broken warnings file shouldn't fail the run it reports on
+		if err := input.warnings.Encode(w); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to write to the warnings file: %v", err))
+			input.warnings = nil
+		}
+	}
+}
+
+// warnedOn records a warning about pageURL that has already been reported.
+func (s *runStatus) warnedOn(pageURL string, skipped bool) {
+	if s.skipped == nil {
+		s.skipped, s.warned = make(map[string]bool), make(map[string]bool)
+	}
+	if skipped {
+		s.skipped[pageURL] = true
+	} else {
+		s.warned[pageURL] = true
+	}
+}
+
+// exitCode returns the exit status of a run with output, see exitPartial; strict counts
+// warnings as failures.
+func (input *InputJson) exitCode(output OutputJson, strict bool) int {
+	failed := len(input.status.skipped)
+	if strict {
+		for pageURL := range input.status.warned {
+			if !input.status.skipped[pageURL] {
+				failed++
+			}
+		}
+	}
+	switch {
+	case len(input.Urls) > 0 && failed == len(input.Urls):
+		return exitFailed
+	case failed > 0 || strict && input.status.warnings > 0:
+		return exitPartial
+	}
+	return input.rulesExitCode(output)
+}
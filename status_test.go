@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, c := range []struct {
+		name           string
+		input          string
+		normal, strict int
+	}{
+		{"all ok", `{"xpaths": ["//h1"], "urls": {"a": {"content": "<h1>A</h1>"}, "b": {"content": "<h1>B</h1>"}}}`, 0, 0},
+		{"no urls", `{"xpaths": ["//h1"], "urls": {}}`, 0, 0},
+		{"one fails", `{"xpaths": ["//h1"], "urls": {"a": {"content": "<h1>A</h1>"}, "b": {"file": "testdata/missing.html"}}}`, exitPartial, exitPartial},
+		{"all fail", `{"xpaths": ["//h1"], "urls": {"a": {"file": "testdata/missing.html"}}}`, exitFailed, exitFailed},
+		{"failure outranks rules", `{"xpaths": [{"xpath": "//h2", "rules": {"required": true}}], "urls": {"a": {"content": "<h1>A</h1>"}, "b": {"file": "testdata/missing.html"}}}`, exitPartial, exitPartial},
+		{"rules", `{"xpaths": [{"xpath": "//h2", "rules": {"required": true}}], "urls": {"a": {"content": "<h1>A</h1>"}}}`, defaultRulesExitCode, defaultRulesExitCode},
+		{"bad xpath", `{"xpaths": ["//h1", "[bad"], "urls": {"a": {"content": "<h1>A</h1>"}}}`, 0, exitPartial},
+		{"script transform fails", `{
+			"script": {"source": "def boom(v):\n    fail('boom')"},
+			"xpaths": [{"xpath": "//h1", "transforms": [{"type": "starlark", "function": "boom"}]}],
+			"urls": {"a": {"content": "<h1>A</h1>"}, "b": {"content": "<p></p>"}}
+		}`, 0, exitPartial},
+	} {
+		input, err := parseInput([]byte(c.input))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		output, err := process(input)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if code := input.exitCode(output, false); code != c.normal {
+			t.Errorf("%s: exit code %d, want %d", c.name, code, c.normal)
+		}
+		if code := input.exitCode(output, true); code != c.strict {
+			t.Errorf("%s: strict exit code %d, want %d", c.name, code, c.strict)
+		}
+	}
+}
+
+func TestWarningsFile(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xpaths": ["//h1", {"xpath": "[bad", "name": "bad"}],
+		"presets": ["nope"],
+		"urls": {"http://a.com": {"content": "<h1>"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	input.warnings = json.NewEncoder(&buf)
+	if _, err := process(input); err != nil {
+		t.Fatal(err)
+	}
+	var got []runWarning
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var w runWarning
+		if err := json.Unmarshal([]byte(line), &w); err != nil {
+			t.Fatalf("Unexpected line %q: %v", line, err)
+		}
+		w.Message = strings.SplitN(w.Message, " ", 2)[0]
+		got = append(got, w)
+	}
+	expected := []runWarning{
+		{Code: warnXPath, Subject: "bad", Message: "Failed"},
+		{Code: warnPreset, Subject: "nope", Message: "Unknown"},
+		{Code: warnParse, Subject: "http://a.com", Message: "Failed", Skipped: true},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected warnings %+v, want %+v", got, expected)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	document := `{"xpaths": ["//h1"], "urls": {"a": {"content": "<h1>A</h1>"}, "b": {"content": "<h1>"}, "c": {"file": "testdata/missing.html"}}}`
+	input, err := parseInput([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.failFast = true
+	if _, err := process(input); err == nil || !strings.Contains(err.Error(), "(-fail-fast)") {
+		t.Errorf("Unexpected error %v; want the run stopped", err)
+	}
+	if len(input.status.skipped) != 1 {
+		t.Errorf("Processed past the first failure: %v", input.status.skipped)
+	}
+
+	// Other warnings don't stop the run
+	input, err = parseInput([]byte(`{"xpaths": ["//h1", "//["], "urls": {"a": {"content": "<h1>A</h1>"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.failFast = true
+	if output, err := process(input); err != nil || output["//h1"]["a"] != "A" {
+		t.Errorf("Unexpected output %v and error %v", output, err)
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	document := `{"xpaths": ["//h1"], "urls": {"a": {"content": "<h1>"}, "b": {"content": "<h1>"}, "c": {"content": "<h1>"}, "d": {"content": "<h1>"}}}`
+	input, err := parseInput([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.maxErrors = 2
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(input.status.skipped) != 2 || input.status.left != 2 || output["//h1"] == nil {
+		t.Errorf("Unexpected status %+v and output %v", input.status, output)
+	}
+	if last := input.status.log[len(input.status.log)-1]; last.Code != warnStopped || last.Message != "Stopping after 2 failed URLs (-max-errors). 2 URLs were not processed." {
+		t.Errorf("Unexpected last warning %+v", last)
+	}
+	if code := input.exitCode(output, false); code != exitPartial {
+		t.Errorf("Unexpected exit code %d; want %d", code, exitPartial)
+	}
+	if stats := input.newRunStats(output); stats.Processed != 0 || stats.Failed != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Reaching the limit on the last URL leaves nothing
+	input.maxErrors = 4
+	if _, err := process(input); err != nil || input.status.left != 0 || input.status.log[len(input.status.log)-1].Code == warnStopped {
+		t.Errorf("Unexpected status %+v", input.status)
+	}
+}
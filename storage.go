@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/oauth2/google"
+)
+
+// --- Object Storage ---
+
+// Input documents and per-URL content files can live in object storage, named
+// s3://BUCKET/KEY or gs://BUCKET/OBJECT, and are read with the standard credentials of
+// each cloud: the AWS configuration chain and Google Application Default Credentials.
+// Results can be written there too, see objectSink.
+
+// s3API is the part of the S3 client goatpaver uses.
+type s3API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	manager.UploadAPIClient
+}
+
+// newS3Client connects to S3; tests replace it.
+var newS3Client = func() (s3API, error) {
+	cfg, err := awsConfig("")
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// gcsEndpoint is the root of the Cloud Storage JSON API.
+var gcsEndpoint = "https://storage.googleapis.com"
+
+// gcsClient returns an HTTP client authorized for Cloud Storage; tests replace it.
+var gcsClient = func(ctx context.Context) (*http.Client, error) {
+	return google.DefaultClient(ctx, gcsScope)
+}
+
+// splitObjectURI splits s3://BUCKET/KEY and gs://BUCKET/OBJECT locations; ok is false
+// for anything else, such as local paths.
+func splitObjectURI(location string) (scheme, bucket, key string, ok bool) {
+	scheme, rest, found := strings.Cut(location, "://")
+	if !found || scheme != "s3" && scheme != "gs" {
+		return "", "", "", false
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	return scheme, bucket, key, true
+}
+
+// openObject opens the document at location: an object in S3 or Cloud Storage, or a
+// local file.
+func openObject(ctx context.Context, location string) (io.ReadCloser, error) {
+	scheme, bucket, key, ok := splitObjectURI(location)
+	if !ok {
+		return os.Open(location)
+	}
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("%s needs the form %s://BUCKET/OBJECT", location, scheme)
+	}
+	if scheme == "s3" {
+		client, err := newS3Client()
+		if err != nil {
+			return nil, err
+		}
+		out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", location, err)
+		}
+		return out.Body, nil
+	}
+
+	client, err := gcsClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		gcsEndpoint+"/storage/v1/b/"+url.PathEscape(bucket)+"/o/"+url.PathEscape(key)+"?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", location, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("reading %s: %s", location, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// readObject returns the contents of the document at location, see openObject.
+func readObject(ctx context.Context, location string) ([]byte, error) {
+	r, err := openObject(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readAll(r)
+}
+
+// writeObject stores data at location: an object in S3 or Cloud Storage, or a local file.
+func writeObject(ctx context.Context, location, contentType string, data []byte) error {
+	scheme, bucket, key, ok := splitObjectURI(location)
+	if !ok {
+		return os.WriteFile(location, data, 0o644)
+	}
+	if bucket == "" || key == "" {
+		return fmt.Errorf("%s needs the form %s://BUCKET/OBJECT", location, scheme)
+	}
+	var err error
+	if scheme == "s3" {
+		err = uploadS3(ctx, bucket, key, contentType, data)
+	} else {
+		err = uploadGCS(ctx, bucket, key, contentType, data)
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", location, err)
+	}
+	return nil
+}
+
+// gcsChunkSize is the size of the pieces a resumable Cloud Storage upload is sent in; it
+// must be a multiple of 256 KiB.
+var gcsChunkSize = 8 << 20
+
+// objectSink writes the results of a run, as they would have been printed, to one object
+// per run: s3://BUCKET/KEY or gs://BUCKET/OBJECT. The name is a text/template with
+// .Timestamp (the run's time, 20060102T150405Z), .Date (2006-01-02) and .RunID, also
+// spelled {{timestamp}}, {{date}} and {{run_id}}, e.g.
+// s3://results/daily/run-{{timestamp}}.json. Large results go up in parts: an S3
+// multipart upload, or a resumable upload to Cloud Storage. With -compress gzip or a name
+// ending in .gz, the object is gzipped.
+type objectSink struct {
+	scheme, bucket string
+	key            *template.Template
+}
+
+// objectKeyData is what the object name template sees.
+type objectKeyData struct {
+	Timestamp string
+	Date      string
+	RunID     string
+}
+
+// objectKeyFuncs are the function spellings of objectKeyData; they are bound to the run
+// when the name is rendered.
+var objectKeyFuncs = template.FuncMap{
+	"timestamp": func() string { return "" },
+	"date":      func() string { return "" },
+	"run_id":    func() string { return "" },
+}
+
+func openObjectSink(target *url.URL) (sink, error) {
+	key := strings.TrimPrefix(target.Path, "/")
+	if target.Host == "" || key == "" {
+		return nil, fmt.Errorf("%s output needs a bucket and an object name, e.g. %s://results/run-{{timestamp}}.json", target.Scheme, target.Scheme)
+	}
+	tmpl, err := template.New("key").Option("missingkey=error").Funcs(objectKeyFuncs).Parse(key)
+	if err != nil {
+		return nil, fmt.Errorf("parsing object name: %w", err)
+	}
+	return &objectSink{scheme: target.Scheme, bucket: target.Host, key: tmpl}, nil
+}
+
+func (s *objectSink) write(run sinkRun) error {
+	at := run.Time.UTC()
+	data := objectKeyData{Timestamp: at.Format("20060102T150405Z"), Date: at.Format("2006-01-02"), RunID: run.ID}
+	var key strings.Builder
+	err := s.key.Funcs(template.FuncMap{
+		"timestamp": func() string { return data.Timestamp },
+		"date":      func() string { return data.Date },
+		"run_id":    func() string { return data.RunID },
+	}).Execute(&key, data)
+	if err != nil {
+		return err
+	}
+	body, err := encodeOutput(run.Encoding, !run.Compact, run.Document)
+	if err != nil {
+		return err
+	}
+	contentType := mediaType(run.Encoding)
+	if run.Compress || strings.HasSuffix(key.String(), ".gz") {
+		if body, err = gzipData(body); err != nil {
+			return err
+		}
+		contentType = "application/gzip"
+	}
+	return writeObject(context.Background(), s.scheme+"://"+s.bucket+"/"+key.String(), contentType, body)
+}
+
+func (s *objectSink) Close() error {
+	return nil
+}
+
+// uploadS3 stores body as an object, in a multipart upload if it is larger than one part.
+func uploadS3(ctx context.Context, bucket, key, contentType string, body []byte) error {
+	client, err := newS3Client()
+	if err != nil {
+		return err
+	}
+	_, err = manager.NewUploader(client).Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+// uploadGCS stores body as an object in a resumable upload, sent in gcsChunkSize pieces.
+func uploadGCS(ctx context.Context, bucket, object, contentType string, body []byte) error {
+	client, err := gcsClient(ctx)
+	if err != nil {
+		return err
+	}
+	start := url.Values{"uploadType": {"resumable"}, "name": {object}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		gcsEndpoint+"/upload/storage/v1/b/"+url.PathEscape(bucket)+"/o?"+start.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Upload-Content-Type", contentType)
+	req.Header.Set("X-Upload-Content-Length", strconv.Itoa(len(body)))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	session := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusOK || session == "" {
+		return fmt.Errorf("starting upload: %s", resp.Status)
+	}
+
+	for offset := 0; ; {
+		end := min(offset+gcsChunkSize, len(body))
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, session, bytes.NewReader(body[offset:end]))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, end-1, len(body)))
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusCreated:
+			return nil
+		case http.StatusPermanentRedirect:
+			// The server says how much it has; carry on from there
+			offset = 0
+			if _, last, ok := strings.Cut(resp.Header.Get("Range"), "-"); ok {
+				if n, err := strconv.Atoi(last); err == nil {
+					offset = n + 1
+				}
+			}
+			if offset >= len(body) {
+				return fmt.Errorf("upload not finalized after %d bytes", offset)
+			}
+		default:
+			return fmt.Errorf("uploading: %s", resp.Status)
+		}
+	}
+}
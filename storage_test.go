@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeStore holds the objects of both fake clouds by "BUCKET/KEY".
+type fakeStore struct {
+	mu        sync.Mutex
+	objects   map[string]string
+	parts     map[string]map[int32]string // Multipart uploads in progress by ID
+	multipart int                         // Completed multipart uploads
+	chunks    int                         // Chunks received by resumable uploads
+}
+
+func (f *fakeStore) get(name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, ok := f.objects[name]
+	return body, ok
+}
+
+func (f *fakeStore) put(name, body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[name] = body
+}
+
+// fakeS3 serves a fakeStore through the S3 API.
+type fakeS3 struct {
+	*fakeStore
+}
+
+func (f fakeS3) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := f.get(aws.ToString(in.Bucket) + "/" + aws.ToString(in.Key))
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func (f fakeS3) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.put(aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key), string(body))
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f fakeS3) CreateMultipartUpload(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := aws.ToString(in.Bucket) + "/" + aws.ToString(in.Key)
+	f.parts[id] = map[int32]string{}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(id)}, nil
+}
+
+func (f fakeS3) UploadPart(ctx context.Context, in *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	body, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.parts[aws.ToString(in.UploadId)][aws.ToInt32(in.PartNumber)] = string(body)
+	return &s3.UploadPartOutput{ETag: aws.String("etag")}, nil
+}
+
+func (f fakeS3) CompleteMultipartUpload(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var body strings.Builder
+	for _, part := range in.MultipartUpload.Parts {
+		body.WriteString(f.parts[aws.ToString(in.UploadId)][aws.ToInt32(part.PartNumber)])
+	}
+	f.objects[aws.ToString(in.UploadId)] = body.String()
+	f.multipart++
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f fakeS3) AbortMultipartUpload(ctx context.Context, in *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// fakeObjectStorage replaces both clouds with a store holding objects for the duration
+// of a test.
+func fakeObjectStorage(t *testing.T, objects map[string]string) *fakeStore {
+	t.Helper()
+	oldS3, oldEndpoint, oldClient := newS3Client, gcsEndpoint, gcsClient
+	t.Cleanup(func() { newS3Client, gcsEndpoint, gcsClient = oldS3, oldEndpoint, oldClient })
+
+	store := &fakeStore{objects: objects, parts: map[string]map[int32]string{}}
+	newS3Client = func() (s3API, error) { return fakeS3{store}, nil }
+	uploads := map[string][]byte{} // Resumable uploads in progress by session
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.EscapedPath()
+		switch {
+		case r.Method == http.MethodPost && strings.HasPrefix(path, "/upload/storage/v1/b/"):
+			bucket, _, _ := strings.Cut(strings.TrimPrefix(path, "/upload/storage/v1/b/"), "/")
+			if r.URL.Query().Get("uploadType") != "resumable" {
+				http.Error(w, "want a resumable upload", http.StatusBadRequest)
+				return
+			}
+			session := "/session/" + bucket + "/" + url.PathEscape(r.URL.Query().Get("name"))
+			uploads[session] = []byte{}
+			w.Header().Set("Location", server.URL+session)
+		case r.Method == http.MethodPut && strings.HasPrefix(path, "/session/"):
+			var first, last, total int
+			fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &first, &last, &total)
+			chunk, _ := io.ReadAll(r.Body)
+			if first != len(uploads[path]) || last-first+1 != len(chunk) {
+				http.Error(w, "bad Content-Range "+r.Header.Get("Content-Range"), http.StatusBadRequest)
+				return
+			}
+			uploads[path] = append(uploads[path], chunk...)
+			store.mu.Lock()
+			store.chunks++
+			store.mu.Unlock()
+			if len(uploads[path]) < total {
+				w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", last))
+				w.WriteHeader(http.StatusPermanentRedirect)
+				return
+			}
+			name, _ := url.PathUnescape(strings.TrimPrefix(path, "/session/"))
+			store.put(name, string(uploads[path]))
+		default:
+			name, ok := strings.CutPrefix(path, "/storage/v1/b/")
+			bucket, object, _ := strings.Cut(name, "/o/")
+			object, _ = url.PathUnescape(object)
+			body, found := store.get(bucket + "/" + object)
+			if !ok || !found || r.URL.Query().Get("alt") != "media" {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, body)
+		}
+	}))
+	t.Cleanup(server.Close)
+	gcsEndpoint = server.URL
+	gcsClient = func(context.Context) (*http.Client, error) { return server.Client(), nil }
+	return store
+}
+
+func TestReadObject(t *testing.T) {
+	fakeObjectStorage(t, map[string]string{
+		"corpus/input.json":     "from s3",
+		"corpus/pages/a b.html": "from gcs",
+	})
+	local := filepath.Join(t.TempDir(), "input.json")
+	if err := os.WriteFile(local, []byte("from disk"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for location, want := range map[string]string{
+		local:                        "from disk",
+		"s3://corpus/input.json":     "from s3",
+		"gs://corpus/pages/a b.html": "from gcs",
+	} {
+		data, err := readObject(context.Background(), location)
+		if err != nil {
+			t.Errorf("readObject(%q): %v", location, err)
+		} else if string(data) != want {
+			t.Errorf("readObject(%q) = %q, want %q", location, data, want)
+		}
+	}
+
+	for _, location := range []string{"s3://corpus", "gs:///input.json", "s3://corpus/missing", "gs://corpus/missing", local + ".missing"} {
+		if _, err := readObject(context.Background(), location); err == nil {
+			t.Errorf("readObject(%q) succeeded, want an error", location)
+		}
+	}
+}
+
+func TestProcessInput_ContentFiles(t *testing.T) {
+	fakeObjectStorage(t, map[string]string{"corpus/a.html": "<p>A</p>"})
+
+	output, err := processInput([]byte(`{
+		"xpaths": ["//p"],
+		"urls": {
+			"http://a.com": {"file": "s3://corpus/a.html"},
+			"http://b.com": {"file": "gs://corpus/missing.html"},
+			"http://c.com": {"content": "<p>C</p>"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"http://a.com": "A", "http://c.com": "C"}
+	if len(output["//p"]) != len(want) || output["//p"]["http://a.com"] != "A" || output["//p"]["http://c.com"] != "C" {
+		t.Errorf("got %v, want %v with the unreadable URL skipped", output["//p"], want)
+	}
+
+	if _, err := processInput([]byte(`{"xpaths": ["//p"], "urls": {"http://a.com": {"content": "<p>A</p>", "file": "a.html"}}}`)); err == nil {
+		t.Error("expected an error for a URL with both content and a file")
+	}
+}
+
+func TestObjectSink(t *testing.T) {
+	store := fakeObjectStorage(t, map[string]string{})
+	oldChunkSize := gcsChunkSize
+	gcsChunkSize = 16
+	defer func() { gcsChunkSize = oldChunkSize }()
+
+	at := time.Date(2024, 3, 1, 12, 30, 5, 0, time.UTC)
+	input := &InputJson{Urls: map[string]UrlData{"http://a.com": {}}}
+	output := OutputJson{"//h1": {"http://a.com": "Title"}}
+	for _, target := range []string{
+		"s3://results/daily/run-{{timestamp}}.json",
+		"gs://results/{{.Date}}/{{run_id}}.json",
+	} {
+		u, err := parseSinkTarget(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := runOptions{output: u, runID: "r1", groupBy: groupByURL}
+		if err := opts.writeSink(input, output, at); err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+	}
+
+	want := "{\n  \"http://a.com\": {\n    \"//h1\": \"Title\"\n  }\n}\n"
+	for _, name := range []string{"results/daily/run-20240301T123005Z.json", "results/2024-03-01/r1.json"} {
+		if got, ok := store.get(name); !ok {
+			t.Errorf("%s not written; have %v", name, store.objects)
+		} else if got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if store.chunks < 2 {
+		t.Errorf("gs upload took %d chunks, want it sent in pieces", store.chunks)
+	}
+
+	u, _ := parseSinkTarget("gs://results/run.json.gz")
+	if err := (runOptions{output: u, runID: "r1"}).writeSink(input, output, at); err != nil {
+		t.Fatal(err)
+	}
+	compressed, _ := store.get("results/run.json.gz")
+	if zr, err := gzip.NewReader(strings.NewReader(compressed)); err != nil {
+		t.Errorf("run.json.gz is not gzipped: %v", err)
+	} else if data, _ := io.ReadAll(zr); string(data) != "{\n  \"//h1\": {\n    \"http://a.com\": \"Title\"\n  }\n}\n" {
+		t.Errorf("Unexpected run.json.gz %q", data)
+	}
+
+	for _, target := range []string{"s3://results", "gs:///run.json", "s3://results/{{.Nope}}.json"} {
+		u, err := parseSinkTarget(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := (runOptions{output: u}).writeSink(input, output, at); err == nil {
+			t.Errorf("%s: expected an error", target)
+		}
+	}
+}
+
+func TestUploadS3_Multipart(t *testing.T) {
+	store := fakeObjectStorage(t, map[string]string{})
+	body := bytes.Repeat([]byte("goatpaver"), 1<<20) // Two parts
+	if err := uploadS3(context.Background(), "results", "big.json", "application/json", body); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.get("results/big.json"); got != string(body) || store.multipart != 1 {
+		t.Errorf("got %d bytes in %d multipart uploads, want %d bytes in one", len(got), store.multipart, len(body))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// --- Streaming Input ---
+
+// Input documents are decoded as they are read rather than read whole first. The "urls"
+// object, which holds the bulk of a large document as embedded content, is decoded one URL
+// at a time, so the document is only in memory once, as the decoded contents, and process
+// lets go of each URL's content once it gets to the URL.
+//
+// Every URL is still decoded before process starts, so peak memory is all of the contents
+// at once; only the copy of the raw document is saved. Processing URLs as they are decoded
+// would need the options first, and a JSON object's keys may come in any order: options
+// after "urls" are only known once all of the URLs have been read.
+
+// decodeInput decodes the input document read from r. Like strictUnmarshal, it rejects
+// unknown fields and data after the document.
+func decodeInput(r io.Reader) (*InputJson, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := expectDelim(decoder, '{', "the input"); err != nil {
+		return nil, err
+	}
+	var urls map[string]UrlData
+	options := make(map[string]json.RawMessage) // Everything but the URLs, decoded strictly below
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string) // Object keys are always strings
+		if !strings.EqualFold(key, "urls") {
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return nil, err
+			}
+			options[key] = value
+		} else if urls, err = decodeURLs(decoder); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after the document")
+	}
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	var input InputJson
+	if err := strictUnmarshal(data, &input, "the input"); err != nil {
+		return nil, err
+	}
+	input.Urls = urls
+	return &input, nil
+}
+
+// decodeURLs decodes the "urls" object, or null, one URL at a time.
+func decodeURLs(decoder *json.Decoder) (map[string]UrlData, error) {
+	token, err := decoder.Token()
+	if err != nil || token == nil {
+		return nil, err
+	}
+	if token != json.Delim('{') {
+		return nil, errors.New(`"urls" must be an object of URLs`)
+	}
+	urls := make(map[string]UrlData)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		pageURL := token.(string)
+		var urlData UrlData
+		if err := decoder.Decode(&urlData); err != nil {
+			return nil, strictError(err, &InputJson{}, "the input")
+		}
+		urls[pageURL] = urlData
+	}
+	_, err = decoder.Token() // The closing brace
+	return urls, err
+}
+
+// expectDelim reads the delimiter that must come next, what naming the value for the error.
+func expectDelim(decoder *json.Decoder, delim json.Delim, what string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("%s must be a JSON object", what)
+	}
+	return nil
+}
+
+// checksumReader sums up what is read through it, for the checksum of an input that is
+// never held whole.
+type checksumReader struct {
+	r io.Reader
+	runningChecksum
+	err error // The first error reading r, other than io.EOF
+}
+
+func newChecksumReader(r io.Reader) *checksumReader {
+	return &checksumReader{r: r, runningChecksum: newRunningChecksum()}
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.add(p[:n])
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeInput(t *testing.T) {
+	input, err := decodeInput(strings.NewReader(`{"urls": {"a": {"content": "<h1>A</h1>"}, "b": {"file": "b.html"}}, "xpaths": ["//h1"], "coverage": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]UrlData{"a": {Content: documentContent("<h1>A</h1>")}, "b": {File: "b.html"}}
+	if !reflect.DeepEqual(input.Urls, want) || len(input.Xpaths) != 1 || !input.Coverage {
+		t.Errorf("Unexpected input %+v", input)
+	}
+
+	for document, want := range map[string]string{
+		`{"xpaths": ["//h1"], "urls": null}`:      "",
+		`{"xpaths": ["//h1"], "URLs": {"a": {}}}`: "",
+		`["//h1"]`:                                            "the input must be a JSON object",
+		`{"urls": ["a"]}`:                                     `"urls" must be an object of URLs`,
+		`{"urls": {"a": {"content": 1}}}`:                     "content must be a string",
+		`{"urls": {"a": {"contents": ""}}}`:                   `unknown field "contents" in the input; did you mean "content"?`,
+		`{"xpath": ["//h1"]}`:                                 `unknown field "xpath" in the input; did you mean "xpaths"?`,
+		`{"xpaths": ["//h1"]} {}`:                             "unexpected data after the document",
+		`{"xpaths": ["//h1"], "urls": {"a": {"content": "<h1`: "unexpected EOF",
+	} {
+		_, err := decodeInput(strings.NewReader(document))
+		if want == "" && err != nil || want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("decodeInput(%s) = %v, want %q", document, err, want)
+		}
+	}
+}
+
+func TestChecksumReader(t *testing.T) {
+	document := `{"xpaths": ["//h1"], "urls": {"a": {"content": "<h1>A</h1>"}}}` + "\n"
+	read := newChecksumReader(strings.NewReader(document))
+	if _, err := readInput(read); err != nil {
+		t.Fatal(err)
+	}
+	if read.sum() != newChecksum([]byte(document)) || read.err != nil {
+		t.Errorf("Unexpected checksum %+v of the whole document", read.sum())
+	}
+
+	read = newChecksumReader(io.MultiReader(strings.NewReader(`{"xpaths": [`), &failingReader{}))
+	if _, err := readInput(read); err == nil || read.err == nil {
+		t.Errorf("Read error not kept: %v", err)
+	}
+}
+
+func TestConsumeContent(t *testing.T) {
+	// Options after the URLs apply to them, which is why all URLs are decoded before processing
+	input, err := parseInput([]byte(`{"urls": {"a": {"content": "<h1>A</h1>"}, "b": {"content": "<h1>B</h1>"}}, "xpaths": ["//h1"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(input.Urls["a"].Content) == 0 || len(input.Urls["b"].Content) == 0 {
+		t.Fatalf("Expected the decoded contents before processing, got %v", input.Urls)
+	}
+	input.consume = true
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output["//h1"]["a"] != "A" || output["//h1"]["b"] != "B" || len(input.Urls["a"].Content)+len(input.Urls["b"].Content) != 0 {
+		t.Errorf("Unexpected output %v and URLs %v", output, input.Urls)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, io.ErrClosedPipe }
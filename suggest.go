@@ -0,0 +1,197 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/user/go_goat/internal/xmlpath"
+)
+
+// --- XPath Suggestions ---
+
+// suggestionsKey is the output section with candidate xpaths for expressions that matched
+// nothing, per URL and expression key.
+const suggestionsKey = "$suggestions"
+
+// maxSuggestions bounds the candidates reported for one expression on one URL.
+const maxSuggestions = 5
+
+// suggestPaths proposes xpaths for an expression that matched nothing on root: every
+// element carrying the expression's leaf name (or attribute) is located from the nearest
+// ancestor with an id, keeping class predicates along the way. Candidates sharing more
+// step names with the original path rank first, then shorter ones.
+func suggestPaths(xpath string, root *xmlpath.Node) []string {
+	steps := pathSteps(xpath)
+	if len(steps) == 0 {
+		return nil
+	}
+	leaf, attr := steps[len(steps)-1], ""
+	if strings.HasPrefix(leaf, "@") {
+		attr = leaf[1:]
+		if len(steps) < 2 {
+			leaf = "*"
+		} else {
+			leaf = steps[len(steps)-2]
+		}
+	}
+	if leaf == "*" && attr == "" {
+		return nil
+	}
+
+	original := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		original[step] = true
+	}
+	seen := make(map[string]bool)
+	type candidate struct {
+		path  string
+		score int
+		depth int
+	}
+	var candidates []candidate
+	var walk func(*xmlpath.Node)
+	walk = func(n *xmlpath.Node) {
+		for _, child := range n.Children() {
+			if child.Kind() != xmlpath.ElementNode {
+				continue
+			}
+			if (leaf == "*" || child.Name().Local == leaf) && (attr == "" || hasAttr(child, attr)) {
+				names, path := locate(child)
+				if attr != "" {
+					path += "/@" + attr
+				}
+				if !seen[path] && path != xpath {
+					seen[path] = true
+					score := 0
+					for _, name := range names {
+						if original[name] {
+							score++
+						}
+					}
+					candidates = append(candidates, candidate{path: path, score: score, depth: len(names)})
+				}
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.depth != b.depth {
+			return a.depth < b.depth
+		}
+		return a.path < b.path
+	})
+	var paths []string
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		paths = append(paths, candidates[i].path)
+	}
+	return paths
+}
+
+// locate returns an xpath selecting n, anchored at the closest ancestor-or-self with an id
+// attribute or at the document root, together with the element names along it.
+func locate(n *xmlpath.Node) ([]string, string) {
+	var names, parts []string
+	for ; n != nil && n.Parent() != nil; n = n.Parent() {
+		name := n.Name().Local
+		names = append(names, name)
+		if id, ok := attrValue(n, "id"); ok && id != "" && !strings.Contains(id, "'") {
+			parts = append(parts, name+"[@id='"+id+"']")
+			return names, "//" + joinReversed(parts)
+		}
+		if class, ok := attrValue(n, "class"); ok && class != "" && !strings.Contains(class, "'") {
+			parts = append(parts, name+"[@class='"+class+"']")
+		} else {
+			parts = append(parts, name)
+		}
+	}
+	return names, "/" + joinReversed(parts)
+}
+
+func joinReversed(parts []string) string {
+	reversed := make([]string, len(parts))
+	for i, part := range parts {
+		reversed[len(parts)-1-i] = part
+	}
+	return strings.Join(reversed, "/")
+}
+
+// attrValue returns the value of the named (unqualified) attribute of element n.
+func attrValue(n *xmlpath.Node, name string) (string, bool) {
+	for _, a := range n.Attrs() {
+		if a.Name().Local == name && a.Name().Space == "" {
+			return a.String(), true
+		}
+	}
+	return "", false
+}
+
+func hasAttr(n *xmlpath.Node, name string) bool {
+	_, ok := attrValue(n, name)
+	return ok
+}
+
+// pathSteps returns the node tests of an XPath's location steps, without axes, predicates,
+// prefixes or trailing text()/node() steps: "//div[@id='x']/a:span/text()" gives
+// ["div", "span"], and attributes keep their "@".
+func pathSteps(xpath string) []string {
+	var steps []string
+	var sb strings.Builder
+	depth := 0
+	var quote rune
+	flush := func() {
+		step := sb.String()
+		sb.Reset()
+		if i := strings.Index(step, "::"); i >= 0 {
+			axis := step[:i]
+			step = step[i+2:]
+			if axis == "attribute" {
+				step = "@" + step
+			}
+		}
+		attr := strings.HasPrefix(step, "@")
+		step = strings.TrimPrefix(step, "@")
+		if i := strings.IndexByte(step, ':'); i >= 0 {
+			step = step[i+1:]
+		}
+		switch step {
+		case "", ".", "..", "text()", "node()", "comment()":
+			return
+		}
+		if attr {
+			step = "@" + step
+		}
+		steps = append(steps, step)
+	}
+	for _, r := range xpath {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			continue
+		case r == '\'' || r == '"':
+			quote = r
+			continue
+		case r == '[':
+			depth++
+			continue
+		case r == ']':
+			depth--
+			continue
+		case depth > 0:
+			continue
+		case r == '/':
+			flush()
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	flush()
+	return steps
+}
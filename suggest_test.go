@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathSteps(t *testing.T) {
+	cases := map[string][]string{
+		"//div[@id='x']/a:span/text()":      {"div", "span"},
+		"/html/body//a/@href":               {"html", "body", "a", "@href"},
+		"//p[contains(., 'a/b')]":           {"p"},
+		"descendant::li/attribute::data-id": {"li", "@data-id"},
+		"//text()":                          nil,
+	}
+	for xpath, expected := range cases {
+		if actual := pathSteps(xpath); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("pathSteps(%q) = %q, want %q", xpath, actual, expected)
+		}
+	}
+}
+
+func TestProcessInput_Suggest(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"suggest": true,
+		"xpaths": [
+			"/html/body/div/span[@class='price']",
+			"//article/img/@src",
+			"//h1",
+			"count(//table)",
+			"//blink"
+		],
+		"urls": {
+			"http://shop.com": {
+				"content": "<html><body><h1>Shop</h1><main id=\"content\"><section class=\"product\"><span class=\"amount\">12</span></section><span>other</span></main><figure><img src=\"a.png\"/></figure></body></html>"
+			}
+		}
+	}`)
+
+	expectedSuggestions := map[string]interface{}{
+		"http://shop.com": map[string][]string{
+			"/html/body/div/span[@class='price']": {
+				"//main[@id='content']/span",
+				"//main[@id='content']/section[@class='product']/span[@class='amount']",
+			},
+			"//article/img/@src": {"/html/body/figure/img/@src"},
+		},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedSuggestions, actualOutput[suggestionsKey]) {
+		t.Errorf("Unexpected suggestions.\nExpected: %#v\nGot:      %#v", expectedSuggestions, actualOutput[suggestionsKey])
+	}
+}
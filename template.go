@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// --- Template Output ---
+
+// TemplateOptions replaces the JSON output with a Go text/template executed once per URL,
+// in URL order. The template's data has the page URL as .URL and its results keyed like
+// the JSON output as .Fields, so {{.Fields.title}} or {{index .Fields "//h1"}}; a missing
+// result is nil. Every rendering ends with a newline.
+//
+// Besides the standard functions, templates can use json (JSON encoding), sql (an SQL
+// literal: a quoted string, a bare number or boolean, or NULL for a missing value) and
+// join (joins a list with a separator). String literals are escaped for Dialect, as
+// MySQL also treats backslashes as escapes; for anything beyond loading trusted output,
+// prefer -output, which stores values through parameterized statements.
+type TemplateOptions struct {
+	Source  string `json:"source,omitempty"`  // Template text
+	File    string `json:"file,omitempty"`    // Path of a file holding the template, instead of Source
+	Dialect string `json:"dialect,omitempty"` // SQL dialect of the sql function: "standard" (the default) or "mysql"
+}
+
+// templateData is what the template sees for one URL.
+type templateData struct {
+	URL    string
+	Fields map[string]interface{}
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join": func(sep string, v interface{}) string {
+		list, ok := v.([]interface{})
+		if !ok {
+			if v == nil {
+				return ""
+			}
+			return fmt.Sprint(v)
+		}
+		parts := make([]string, len(list))
+		for i, elem := range list {
+			parts[i] = fmt.Sprint(elem)
+		}
+		return strings.Join(parts, sep)
+	},
+}
+
+// sqlLiteral returns the template's sql function, escaping strings with escaper.
+func sqlLiteral(escaper *strings.Replacer) func(interface{}) string {
+	return func(v interface{}) string {
+		switch v := v.(type) {
+		case nil:
+			return "NULL"
+		case bool:
+			return strings.ToUpper(strconv.FormatBool(v))
+		case int:
+			return strconv.Itoa(v)
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return "NULL"
+			}
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		return "'" + escaper.Replace(fmt.Sprint(v)) + "'"
+	}
+}
+
+// compile parses the template.
+func (t *TemplateOptions) compile() (*template.Template, error) {
+	if (t.Source == "") == (t.File == "") {
+		return nil, errors.New("template needs exactly one of source and file")
+	}
+	var sql func(interface{}) string
+	switch t.Dialect {
+	case "", "standard":
+		sql = sqlLiteral(strings.NewReplacer("'", "''"))
+	case "mysql":
+		sql = sqlLiteral(strings.NewReplacer("'", "''", `\`, `\\`))
+	default:
+		return nil, fmt.Errorf("unknown template dialect %q", t.Dialect)
+	}
+	name, src := "template", t.Source
+	if t.File != "" {
+		data, err := os.ReadFile(t.File)
+		if err != nil {
+			return nil, fmt.Errorf("reading template: %w", err)
+		}
+		name, src = t.File, string(data)
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Funcs(template.FuncMap{"sql": sql}).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderTemplate writes tmpl's rendering of every URL in urls to w. Report sections
+// ("$" keys) are not part of .Fields.
+func renderTemplate(w io.Writer, tmpl *template.Template, output OutputJson, urls map[string]UrlData) error {
+	pageURLs := make([]string, 0, len(urls))
+	for pageURL := range urls {
+		pageURLs = append(pageURLs, pageURL)
+	}
+	sort.Strings(pageURLs)
+
+	for _, pageURL := range pageURLs {
+		data := templateData{URL: pageURL, Fields: make(map[string]interface{})}
+		for key, results := range output {
+			if strings.HasPrefix(key, "$") {
+				continue
+			}
+			if value, found := results[pageURL]; found {
+				data.Fields[key] = value
+			}
+		}
+		buf := getBuffer()
+		if err := tmpl.Execute(buf, data); err != nil {
+			putBuffer(buf)
+			return fmt.Errorf("rendering template for URL '%s': %w", pageURL, err)
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		_, err := w.Write(buf.Bytes())
+		putBuffer(buf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"template": {"source": "INSERT INTO pages (url, title, price) VALUES ({{sql .URL}}, {{sql .Fields.title}}, {{sql (index .Fields \"//span\")}});"},
+		"xpaths": [{"xpath": "//h1", "name": "title"}, "//span"],
+		"urls": {
+			"http://b.com": {"content": "<html><body><h1>Bob's</h1></body></html>"},
+			"http://a.com": {"content": "<html><body><h1>A</h1><span>9.99</span></body></html>"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("parseInput returned an unexpected error: %v", err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatalf("process returned an unexpected error: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := renderTemplate(&sb, input.template, output, input.Urls); err != nil {
+		t.Fatalf("renderTemplate returned an unexpected error: %v", err)
+	}
+	expected := "INSERT INTO pages (url, title, price) VALUES ('http://a.com', 'A', '9.99');\n" +
+		"INSERT INTO pages (url, title, price) VALUES ('http://b.com', 'Bob''s', NULL);\n"
+	if sb.String() != expected {
+		t.Errorf("Unexpected rendering.\nExpected:\n%s\nGot:\n%s", expected, sb.String())
+	}
+}
+
+func TestRenderTemplate_Markdown(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"template": {"source": "## {{.Fields.title}}\n\n{{join \", \" .Fields.tags}} {{json .Fields.count}}\n"},
+		"xpaths": [
+			{"xpath": "//h1", "name": "title"},
+			{"xpath": "//p", "name": "tags", "transforms": [{"type": "split", "separator": " "}]},
+			{"xpath": "count(//p)", "name": "count"}
+		],
+		"urls": {"http://a.com": {"content": "<html><body><h1>A</h1><p>x y</p></body></html>"}}
+	}`))
+	if err != nil {
+		t.Fatalf("parseInput returned an unexpected error: %v", err)
+	}
+	output, err := process(input)
+	if err != nil {
+		t.Fatalf("process returned an unexpected error: %v", err)
+	}
+	var sb strings.Builder
+	if err := renderTemplate(&sb, input.template, output, input.Urls); err != nil {
+		t.Fatalf("renderTemplate returned an unexpected error: %v", err)
+	}
+	if expected := "## A\n\nx, y 1\n"; sb.String() != expected {
+		t.Errorf("Unexpected rendering.\nExpected: %q\nGot:      %q", expected, sb.String())
+	}
+}
+
+func TestParseInput_BadTemplate(t *testing.T) {
+	if _, err := parseInput([]byte(`{"template": {"source": "{{.URL"}, "xpaths": [], "urls": {}}`)); err == nil {
+		t.Errorf("Expected an error for a malformed template, but got nil")
+	}
+}
+
+func TestRenderTemplate_SQLDialect(t *testing.T) {
+	for _, tc := range []struct{ dialect, expected string }{
+		{"", `('a\'' OR 1=1 -- ', 2, TRUE);`},
+		{"mysql", `('a\\'' OR 1=1 -- ', 2, TRUE);`},
+	} {
+		input, err := parseInput([]byte(`{
+			"template": {"source": "({{sql .Fields.name}}, {{sql .Fields.count}}, {{sql .Fields.any}});", "dialect": "` + tc.dialect + `"},
+			"xpaths": [{"xpath": "//h1", "name": "name"}, {"xpath": "count(//p)", "name": "count"}, {"xpath": "boolean(//p)", "name": "any"}],
+			"urls": {"http://a.com": {"content": "<html><body><h1>a\\' OR 1=1 -- </h1><p/><p/></body></html>"}}
+		}`))
+		if err != nil {
+			t.Fatalf("parseInput returned an unexpected error: %v", err)
+		}
+		output, err := process(input)
+		if err != nil {
+			t.Fatalf("process returned an unexpected error: %v", err)
+		}
+		var sb strings.Builder
+		if err := renderTemplate(&sb, input.template, output, input.Urls); err != nil {
+			t.Fatalf("renderTemplate returned an unexpected error: %v", err)
+		}
+		if sb.String() != tc.expected+"\n" {
+			t.Errorf("Unexpected rendering for dialect %q.\nExpected: %s\nGot:      %s", tc.dialect, tc.expected, sb.String())
+		}
+	}
+	if _, err := parseInput([]byte(`{"template": {"source": "", "file": "x", "dialect": "oracle"}, "xpaths": [], "urls": {}}`)); err == nil {
+		t.Errorf("Expected an error for an unknown dialect, but got nil")
+	}
+}
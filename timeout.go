@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/user/go_goat/internal/xmlpath"
+)
+
+// --- Evaluation Timeout ---
+
+// An expression such as //*//*[contains(., 'x')] can take hours on a large document. With
+// the input's "evaluation_timeout", matching an expression on a URL that takes longer is
+// given up on with a warnTimeout warning, and the run goes on with the next expression.
+// Matching checks the deadline as it goes through the document (see xmlpath's
+// Path.IterUntil) and stops there, so nothing keeps running, or keeps the document alive,
+// once it is given up on. Transforms run after the timeout applies.
+
+// errEvaluationTimeout reports that matching an expression took too long.
+var errEvaluationTimeout = errors.New("evaluation timed out")
+
+// parseEvaluationTimeout parses the input's "evaluation_timeout", giving 0 for none.
+func parseEvaluationTimeout(timeout string) (time.Duration, error) {
+	if timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid evaluation_timeout %q", timeout)
+	}
+	return d, nil
+}
+
+// evaluateWithin is evaluate, giving up with errEvaluationTimeout if matching takes
+// longer than timeout; 0 waits as long as it takes. A panic while matching is returned as
+// a *panicError.
+func (c compiledExpression) evaluateWithin(root *xmlpath.Node, base *url.URL, timeout time.Duration) (interface{}, bool, error) {
+	value, ok, err := c.matchWithin(root, base, timeout)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	value, ok = c.transform(value)
+	return value, ok, nil
+}
+
+// matchWithin is match, giving up after timeout as for evaluateWithin. Without a timeout,
+// a panic is left to the caller.
+func (c compiledExpression) matchWithin(root *xmlpath.Node, base *url.URL, timeout time.Duration) (interface{}, bool, error) {
+	if timeout == 0 {
+		value, ok := c.match(root, base, nil)
+		return value, ok, nil
+	}
+	done := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() { close(done) })
+	defer timer.Stop()
+	var r matchResult
+	r.err = recovered(func() error {
+		r.value, r.ok = c.match(root, base, done)
+		return nil
+	})
+	select {
+	case <-done:
+		// What was matched before it stopped is incomplete
+		return nil, false, errEvaluationTimeout
+	default:
+		return r.value, r.ok, r.err
+	}
+}
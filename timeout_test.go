@@ -0,0 +1,73 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluationTimeout(t *testing.T) {
+	// Deeply nested elements make the expression scan about n³ nodes
+	const n = 150
+	content := strings.Repeat("<a>", n) + "x" + strings.Repeat("</a>", n)
+	document := `{"xpaths": ["//*//*//*[@missing]", "//a/text()"], "evaluation_timeout": "1ms", "urls": {"http://a.com": {"content": "` + content + `"}}}`
+	input, err := parseInput([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goroutines := runtime.NumGoroutine()
+	start := time.Now()
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Took %s despite the timeout", elapsed)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("%d goroutines left running after the timeout, from %d", n, goroutines)
+	}
+	if output["//a/text()"]["http://a.com"] != "x" {
+		t.Errorf("Unexpected output %v", output)
+	}
+	if len(input.status.log) != 1 || input.status.log[0].Code != warnTimeout || input.status.skipped["http://a.com"] {
+		t.Errorf("Unexpected warnings %+v", input.status.log)
+	}
+
+	for _, timeout := range []string{"soon", "-1s", "0s"} {
+		if _, err := parseInput([]byte(`{"xpaths": ["//a"], "evaluation_timeout": "` + timeout + `", "urls": {}}`)); err == nil {
+			t.Errorf("Expected an error for timeout %q", timeout)
+		}
+	}
+}
+
+func TestEvaluateWithin(t *testing.T) {
+	input, err := parseInput([]byte(`{"xpaths": [{"xpath": "//p", "mode": "all", "transforms": [{"type": "replace", "pattern": "a", "with": "b"}]}], "urls": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := compileExpression(input.Xpaths[0], input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := decode(strings.NewReader("<r><p>a</p><p>aa</p></r>"), input, "http://a.com", pageSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, wantOK := compiled.evaluate(root, nil)
+	for _, timeout := range []time.Duration{0, time.Minute} {
+		value, ok, err := compiled.evaluateWithin(root, nil, timeout)
+		if err != nil || ok != wantOK || strings.Join(toStrings(value), ",") != strings.Join(toStrings(want), ",") {
+			t.Errorf("Unexpected value %v, %v and error %v within %s; want %v", value, ok, err, timeout, want)
+		}
+	}
+}
+
+func toStrings(value interface{}) []string {
+	var s []string
+	for _, v := range value.([]interface{}) {
+		s = append(s, v.(string))
+	}
+	return s
+}
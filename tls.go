@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// --- TLS ---
+
+// Pages of internal services are often served with certificates of a private CA, and some
+// ask for client certificates. The "tls" fetch options, and the -tls-* flags that take
+// precedence over them, say which CAs to trust besides the system's and which client
+// certificate to present. The flags apply to https:// input documents too. Skipping
+// verification has to be asked for by name, and is warned about on every run.
+
+// TLSOptions configure the TLS connections of fetches.
+type TLSOptions struct {
+	CA                 string `json:"ca,omitempty"`                   // PEM file of CA certificates to trust besides the system's
+	Cert               string `json:"cert,omitempty"`                 // PEM file of a client certificate, with Key
+	Key                string `json:"key,omitempty"`                  // PEM file of the client certificate's private key
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"` // Accept any server certificate; for testing only
+}
+
+// tlsFlags adds the -tls-* flags to flags, returning a function that gives the options they
+// set once they are parsed, or nil if none were given.
+func tlsFlags(flags *flag.FlagSet) func() *TLSOptions {
+	var o TLSOptions
+	flags.StringVar(&o.CA, "tls-ca", "", "trust the CA certificates in this PEM file besides the system's, for fetching")
+	flags.StringVar(&o.Cert, "tls-cert", "", "present the client certificate in this PEM file, with -tls-key")
+	flags.StringVar(&o.Key, "tls-key", "", "the private key of -tls-cert, as a PEM file")
+	flags.BoolVar(&o.InsecureSkipVerify, "tls-insecure-skip-verify", false, "don't verify server certificates when fetching (unsafe)")
+	return func() *TLSOptions {
+		if o == (TLSOptions{}) {
+			return nil
+		}
+		return &o
+	}
+}
+
+// over returns o with the fields it leaves unset taken from base. Either may be nil.
+func (o *TLSOptions) over(base *TLSOptions) *TLSOptions {
+	if o == nil {
+		return base
+	}
+	merged := *o
+	if base != nil {
+		if merged.CA == "" {
+			merged.CA = base.CA
+		}
+		if merged.Cert == "" && merged.Key == "" {
+			merged.Cert, merged.Key = base.Cert, base.Key
+		}
+		merged.InsecureSkipVerify = merged.InsecureSkipVerify || base.InsecureSkipVerify
+	}
+	return &merged
+}
+
+// config loads the files of o into a TLS configuration.
+func (o *TLSOptions) config() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CA != "" {
+		pem, err := readObject(context.Background(), o.CA)
+		if err != nil {
+			return nil, fmt.Errorf("tls: reading the CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates in the CA file %s", o.CA)
+		}
+		config.RootCAs = pool
+	}
+	if (o.Cert == "") != (o.Key == "") {
+		return nil, errors.New("tls: a client certificate needs both cert and key")
+	}
+	if o.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(o.Cert, o.Key)
+		if err != nil {
+			return nil, fmt.Errorf("tls: loading the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if o.InsecureSkipVerify {
+		logger.Warn("TLS certificate verification is disabled (insecure_skip_verify); connections can be intercepted")
+	}
+	return config, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetchTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><h1>Internal</h1></html>"))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	ca := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(ca, cert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fetch := func(options *TLSOptions) error {
+		o := &FetchOptions{TLS: options}
+		if err := o.check(); err != nil {
+			return err
+		}
+		_, _, err := o.fetch(server.URL, 0)
+		return err
+	}
+	if err := fetch(nil); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Fetched from a private CA without trusting it: %v", err)
+	}
+	if err := fetch(&TLSOptions{CA: ca}); err != nil {
+		t.Errorf("Fetching with the CA failed: %v", err)
+	}
+	if err := fetch(&TLSOptions{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("Fetching without verification failed: %v", err)
+	}
+	for _, options := range []*TLSOptions{
+		{CA: filepath.Join(dir, "missing.pem")},
+		{CA: filepath.Join(dir, "ca.pem"), Cert: ca},
+		{Key: ca},
+		{Cert: ca, Key: ca}, // Not a key
+	} {
+		if err := (&FetchOptions{TLS: options}).check(); err == nil {
+			t.Errorf("Expected an error for %+v", options)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty.pem"), []byte("none"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&FetchOptions{TLS: &TLSOptions{CA: filepath.Join(dir, "empty.pem")}}).check(); err == nil || !strings.Contains(err.Error(), "no certificates") {
+		t.Errorf("Unexpected error %v for a CA file without certificates", err)
+	}
+}
+
+func TestTLSFlags(t *testing.T) {
+	opts, err := parseFlags([]string{"-tls-ca", "ca.pem", "-tls-insecure-skip-verify"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.tls == nil || *opts.tls != (TLSOptions{CA: "ca.pem", InsecureSkipVerify: true}) {
+		t.Errorf("Unexpected TLS options %+v", opts.tls)
+	}
+	if opts, _ := parseFlags(nil); opts.tls != nil {
+		t.Errorf("TLS options %+v without flags", opts.tls)
+	}
+
+	// The flags take precedence over the input's options, field by field
+	merged := (&TLSOptions{Cert: "flag.crt", Key: "flag.key"}).over(&TLSOptions{CA: "input.pem", Cert: "input.crt", Key: "input.key"})
+	if *merged != (TLSOptions{CA: "input.pem", Cert: "flag.crt", Key: "flag.key"}) {
+		t.Errorf("Unexpected merged options %+v", merged)
+	}
+	if merged := (*TLSOptions)(nil).over(&TLSOptions{CA: "input.pem"}); merged.CA != "input.pem" {
+		t.Errorf("Unexpected merged options %+v", merged)
+	}
+}
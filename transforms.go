@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// --- Transform Pipeline ---
+
+// Values for Transform.Type.
+const (
+	transformReplace   = "replace"    // Regular expression replacement of Pattern by With
+	transformSplit     = "split"      // Split on Separator into a list, or keep the part at Index
+	transformStrip     = "strip"      // Remove Prefix and/or Suffix if present
+	transformURLDecode = "url_decode" // Decode %XX escapes and '+' as in a query string
+	transformNumber    = "number"     // Parse as a number; values that aren't numeric are omitted
+	transformStarlark  = "starlark"   // Call Function from the input's Starlark script, see script.go
+	transformDate      = "date"       // Parse a date in Locales and format it as ISO-8601, see dates.go
+	transformMoney     = "money"      // Parse a price into {amount, currency}, see money.go
+	transformLanguage  = "language"   // Replace text with the ISO 639-1 code of its language, see language.go
+)
+
+// Transform is one step of an expression's "transforms" pipeline. Steps run in order on
+// the extracted string after normalization and link resolution. A step applied to a list
+// (the result of an earlier split) runs on every element.
+type Transform struct {
+	Type string `json:"type"`
+
+	Pattern   string   `json:"pattern,omitempty"`   // replace: RE2 regular expression
+	With      string   `json:"with,omitempty"`      // replace: replacement text, may refer to groups as $1
+	Separator string   `json:"separator,omitempty"` // split: separator string
+	Index     *int     `json:"index,omitempty"`     // split: keep only this part; negative counts from the end
+	Prefix    string   `json:"prefix,omitempty"`    // strip: leading text to remove
+	Suffix    string   `json:"suffix,omitempty"`    // strip: trailing text to remove
+	Function  string   `json:"function,omitempty"`  // starlark: name of the function to call
+	Locales   []string `json:"locales,omitempty"`   // date: languages to recognize (en, de, fr, es); defaults to en
+	Currency  string   `json:"currency,omitempty"`  // money: ISO 4217 code to assume when the text has none
+}
+
+// UnmarshalJSON accepts either a transform object or, for steps without parameters,
+// just the type name, e.g. "url_decode".
+func (t *Transform) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = Transform{Type: name}
+		return nil
+	}
+	type transformFields Transform // Avoids recursing into this method
+	var fields transformFields
+	if err := strictUnmarshal(data, &fields, "a transform"); err != nil {
+		return err
+	}
+	*t = Transform(fields)
+	return nil
+}
+
+// transformStep transforms a single string. The boolean result is false if the value
+// should be dropped.
+type transformStep func(s string) (interface{}, bool)
+
+// compileTransforms checks the pipeline and prepares its steps. script is the input's
+// loaded Starlark module, or nil if it has none.
+func compileTransforms(transforms []Transform, script *starlarkScript) ([]transformStep, error) {
+	steps := make([]transformStep, 0, len(transforms))
+	for i, t := range transforms {
+		step, err := t.compile(script)
+		if err != nil {
+			return nil, fmt.Errorf("transform %d (%s): %w", i+1, t.Type, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// compile returns the step implementing t.
+func (t Transform) compile(script *starlarkScript) (transformStep, error) {
+	switch t.Type {
+	case transformStarlark:
+		if script == nil {
+			return nil, fmt.Errorf("the input has no script")
+		}
+		return script.transformStep(t.Function)
+	case transformDate:
+		return newDateStep(t.Locales)
+	case transformMoney:
+		return newMoneyStep(t.Currency), nil
+	case transformLanguage:
+		return newLanguageStep(), nil
+	case transformReplace:
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(s string) (interface{}, bool) {
+			return re.ReplaceAllString(s, t.With), true
+		}, nil
+	case transformSplit:
+		if t.Separator == "" {
+			return nil, fmt.Errorf("separator is required")
+		}
+		return func(s string) (interface{}, bool) {
+			parts := strings.Split(s, t.Separator)
+			if t.Index == nil {
+				list := make([]interface{}, len(parts))
+				for i, part := range parts {
+					list[i] = part
+				}
+				return list, true
+			}
+			i := *t.Index
+			if i < 0 {
+				i += len(parts)
+			}
+			if i < 0 || i >= len(parts) {
+				return nil, false
+			}
+			return parts[i], true
+		}, nil
+	case transformStrip:
+		if t.Prefix == "" && t.Suffix == "" {
+			return nil, fmt.Errorf("prefix or suffix is required")
+		}
+		return func(s string) (interface{}, bool) {
+			return strings.TrimSuffix(strings.TrimPrefix(s, t.Prefix), t.Suffix), true
+		}, nil
+	case transformURLDecode:
+		return func(s string) (interface{}, bool) {
+			decoded, err := url.QueryUnescape(s)
+			if err != nil {
+				return s, true // Malformed escapes are left as they are
+			}
+			return decoded, true
+		}, nil
+	case transformNumber:
+		return func(s string) (interface{}, bool) {
+			s = strings.TrimSpace(s)
+			if !xpathNumber.MatchString(s) {
+				return nil, false
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			return f, err == nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown transform type")
+	}
+}
+
+// applyTransforms runs steps over value in order. Lists are transformed element by
+// element, dropping elements a step rejects; a split inside a list flattens into it.
+// Values that have become non-strings (numbers, money, or anything a script returns) are passed
+// through unchanged.
+func applyTransforms(steps []transformStep, value interface{}) (interface{}, bool) {
+	for _, step := range steps {
+		switch v := value.(type) {
+		case string:
+			var ok bool
+			if value, ok = step(v); !ok {
+				return nil, false
+			}
+		case []interface{}:
+			var list []interface{}
+			for _, elem := range v {
+				s, isString := elem.(string)
+				if !isString {
+					list = append(list, elem)
+					continue
+				}
+				result, ok := step(s)
+				if !ok {
+					continue
+				}
+				if parts, isList := result.([]interface{}); isList {
+					list = append(list, parts...)
+				} else {
+					list = append(list, result)
+				}
+			}
+			if list == nil {
+				list = []interface{}{}
+			}
+			value = list
+		}
+	}
+	return value, true
+}
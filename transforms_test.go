@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProcessInput_Transforms(t *testing.T) {
+	inputJsonBytes := []byte(`{
+		"xpaths": [
+			{"xpath": "//span[@class='price']", "name": "price", "transforms": [
+				{"type": "strip", "prefix": "Price: ", "suffix": " EUR"},
+				{"type": "replace", "pattern": ",", "with": "."},
+				"number"
+			]},
+			{"xpath": "//span[@class='tags']", "name": "tags", "transforms": [
+				{"type": "split", "separator": ", "},
+				{"type": "replace", "pattern": "^#", "with": ""}
+			]},
+			{"xpath": "//a/@href", "name": "query", "transforms": [
+				{"type": "split", "separator": "q=", "index": -1},
+				"url_decode"
+			]},
+			{"xpath": "//h1", "name": "not-a-number", "transforms": ["number"]},
+			{"xpath": "count(//a)", "name": "bad-function", "transforms": ["number"]},
+			{"xpath": "//h1", "name": "bad-type", "transforms": ["uppercase"]},
+			{"xpath": "//h1", "name": "bad-pattern", "transforms": [{"type": "replace", "pattern": "("}]}
+		],
+		"urls": {
+			"http://shop.com": {
+				"content": "<html><body><h1>Sale</h1><span class=\"price\">Price: 12,50 EUR</span><span class=\"tags\">#red, #blue</span><a href=\"/search?q=big+red%20shoes\">s</a></body></html>"
+			}
+		}
+	}`)
+
+	expectedOutput := OutputJson{
+		"price":        {"http://shop.com": 12.5},
+		"tags":         {"http://shop.com": []interface{}{"red", "blue"}},
+		"query":        {"http://shop.com": "big red shoes"},
+		"not-a-number": {},
+		"bad-function": {},
+		"bad-type":     {},
+		"bad-pattern":  {},
+	}
+
+	actualOutput, err := processInput(inputJsonBytes)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		expectedJson, _ := json.MarshalIndent(expectedOutput, "", "  ")
+		actualJson, _ := json.MarshalIndent(actualOutput, "", "  ")
+		t.Errorf("Unexpected output.\nExpected:\n%s\nGot:\n%s", string(expectedJson), string(actualJson))
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// --- validate Subcommand ---
+
+const validateUsage = `Usage: goatpaver validate [-json] [FILE...]
+
+Checks input documents without processing any URLs: that each is valid JSON without
+unknown fields, that its options are valid, and that every expression compiles and
+every preset exists. Lists each problem as FILE: WHERE: MESSAGE, where WHERE is the
+expression (xpaths[INDEX] and its output key) or "input", and exits 1 if there are any.
+Documents without URLs, such as shared selector files, are fine. Reads stdin without
+FILEs.
+`
+
+// errInvalid reports that validated input documents have problems.
+var errInvalid = errors.New("input is invalid")
+
+// inputProblem is one problem validate found.
+type inputProblem struct {
+	File    string `json:"file"`
+	Where   string `json:"where"`
+	Message string `json:"message"`
+}
+
+// runValidate implements "goatpaver validate".
+func runValidate(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), validateUsage) }
+	asJSON := flags.Bool("json", false, "print the problems as a JSON array")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	problems := []inputProblem{}
+	for _, file := range files {
+		var document []byte
+		var err error
+		if file == "-" {
+			document, err = io.ReadAll(stdin)
+		} else {
+			document, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return err
+		}
+		for _, p := range validateInput(document) {
+			p.File = file
+			problems = append(problems, p)
+		}
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(problems, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(data))
+	} else {
+		for _, p := range problems {
+			fmt.Fprintf(stdout, "%s: %s: %s\n", p.File, p.Where, p.Message)
+		}
+	}
+	if len(problems) > 0 {
+		return errInvalid
+	}
+	return nil
+}
+
+// validateInput lists the problems of an input document, leaving File empty.
+func validateInput(document []byte) []inputProblem {
+	var problems []inputProblem
+	problem := func(where, format string, a ...interface{}) {
+		problems = append(problems, inputProblem{Where: where, Message: fmt.Sprintf(format, a...)})
+	}
+
+	input, err := parseInput(document)
+	if err != nil {
+		problem("input", "%v", err)
+		return problems
+	}
+	if len(input.Xpaths) == 0 && len(input.Presets) == 0 {
+		problem("input", "no xpaths or presets")
+	}
+	keys := make(map[string]int)
+	for i, expr := range input.Xpaths {
+		where := fmt.Sprintf("xpaths[%d] %q", i, expr.Key())
+		if other, taken := keys[expr.Key()]; taken {
+			problem(where, "output key is taken by xpaths[%d]; name one of them", other)
+		} else {
+			keys[expr.Key()] = i
+		}
+		if _, err := compileExpression(expr, input); err != nil {
+			problem(where, "%v", err)
+		}
+	}
+	for i, name := range input.Presets {
+		if _, ok := presets[name]; !ok {
+			problem(fmt.Sprintf("presets[%d]", i), "unknown preset %q", name)
+		}
+	}
+	return problems
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateInput(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		document string
+		expected []string // Where and message prefix of each problem
+	}{
+		{"valid", `{"xpaths": ["//h1", {"xpath": "//a/@href", "name": "links", "mode": "all"}], "presets": ["seo"]}`, nil},
+		{"not JSON", `{"xpaths": [`, []string{"input: error unmarshalling input JSON: unexpected EOF"}},
+		{"unknown field", `{"xpaths": ["//h1"], "coverag": true}`, []string{`input: error unmarshalling input JSON: unknown field "coverag" in the input; did you mean "coverage"?`}},
+		{"unknown expression field", `{"xpaths": [{"xpath": "//h1", "nmae": "title"}]}`, []string{`input: error unmarshalling input JSON: unknown field "nmae" in expression "//h1"; did you mean "name"?`}},
+		{"bad options", `{"xpaths": ["//h1"], "entities": "loose"}`, []string{`input: unknown entities mode "loose"`}},
+		{"nothing to do", `{"urls": {}}`, []string{"input: no xpaths or presets"}},
+		{"expressions", `{"xpaths": ["//h1", "[bad", {"xpath": "//h2", "mode": "some"}, {"xpath": "//h3", "name": "//h1"}], "presets": ["nope"]}`, []string{
+			`xpaths[1] "[bad": `,
+			`xpaths[2] "//h2": unknown mode "some"`,
+			`xpaths[3] "//h1": output key is taken by xpaths[0]`,
+			`presets[0]: unknown preset "nope"`,
+		}},
+	} {
+		problems := validateInput([]byte(c.document))
+		if len(problems) != len(c.expected) {
+			t.Errorf("%s: got problems %+v, want %q", c.name, problems, c.expected)
+			continue
+		}
+		for i, p := range problems {
+			if got := p.Where + ": " + p.Message; !strings.HasPrefix(got, c.expected[i]) {
+				t.Errorf("%s: got problem %q, want %q", c.name, got, c.expected[i])
+			}
+		}
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	good, bad := filepath.Join(dir, "good.json"), filepath.Join(dir, "bad.json")
+	os.WriteFile(good, []byte(`{"xpaths": ["//h1"]}`), 0o644)
+	os.WriteFile(bad, []byte(`{"xpaths": ["[bad"]}`), 0o644)
+
+	var out bytes.Buffer
+	if err := runValidate([]string{good}, nil, &out); err != nil || out.Len() != 0 {
+		t.Errorf("runValidate(good) = %v, %q; want no problems", err, out.String())
+	}
+	err := runValidate([]string{good, bad}, nil, &out)
+	if !errors.Is(err, errInvalid) || !strings.HasPrefix(out.String(), bad+`: xpaths[0] "[bad": `) || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("runValidate(good, bad) = %v, %q; want the bad expression", err, out.String())
+	}
+	out.Reset()
+	if err := runValidate([]string{"-json"}, strings.NewReader(`{"xpaths": ["//h1"]}`), &out); err != nil || strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("runValidate(-json) = %v, %q; want an empty list", err, out.String())
+	}
+}
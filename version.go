@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// --- version Subcommand ---
+
+const versionUsage = `Usage: goatpaver version [-json]
+
+Prints the goatpaver version, the git commit it was built from, the Go version and what
+the build supports: the expression engines, with whether the external tools they need
+are installed, and the names of the functions, modes, transforms, presets, formats,
+outputs and queues it knows. -json prints it as one JSON object, for scripts to check
+for a feature before relying on it.
+`
+
+// versionInfo is what "goatpaver version" reports.
+type versionInfo struct {
+	Version       string              `json:"version"`          // Module version, e.g. v1.4.0, or (devel)
+	Commit        string              `json:"commit,omitempty"` // VCS revision, if known
+	Modified      bool                `json:"modified,omitempty"`
+	GoVersion     string              `json:"go_version"`
+	SchemaVersion int                 `json:"schema_version"` // Of the output, see envelope.go
+	Engines       []engineInfo        `json:"engines"`
+	Features      map[string][]string `json:"features"`
+}
+
+// engineInfo is a way of processing documents. Builtin engines are always available;
+// the others run a command, see external.go.
+type engineInfo struct {
+	Name      string `json:"name"`
+	Command   string `json:"command,omitempty"`
+	Available bool   `json:"available"`
+}
+
+// readBuildInfo is debug.ReadBuildInfo, replaced by tests.
+var readBuildInfo = debug.ReadBuildInfo
+
+// newVersionInfo describes the running build.
+func newVersionInfo() versionInfo {
+	v := versionInfo{
+		Version:       "unknown",
+		GoVersion:     runtime.Version(),
+		SchemaVersion: outputSchemaVersion,
+		Engines: []engineInfo{
+			{Name: "xpath", Available: true},
+			{Name: "starlark", Available: true},
+			{Name: "xslt", Command: toolCommands.xslt},
+			{Name: "xml-schema", Command: toolCommands.validate},
+		},
+		Features: map[string][]string{
+			"subcommands":    completionCommands()[0].args,
+			"functions":      {fnBoolean, fnCount, fnNot, fnNumber, fnString},
+			"modes":          {modeFirst, modeAll},
+			"returns":        {returnText, returnOuterHTML, returnInnerHTML, returnC14N},
+			"transforms":     {transformReplace, transformSplit, transformStrip, transformURLDecode, transformNumber, transformStarlark, transformDate, transformMoney, transformLanguage},
+			"entities":       {entitiesHTML, entitiesStrict, entitiesLenient},
+			"input_formats":  {formatJSON, formatProtobuf},
+			"output_formats": {formatJSON, formatMsgpack, formatCBOR, formatProtobuf},
+			"presets":        sortedNames(presets),
+			"date_locales":   sortedNames(dateLocales),
+			"outputs":        sortedNames(sinks),
+			"queues":         sortedNames(queues),
+			"results":        sortedNames(publishers),
+		},
+	}
+	if info, ok := readBuildInfo(); ok {
+		if info.Main.Version != "" {
+			v.Version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				v.Commit = setting.Value
+			case "vcs.modified":
+				v.Modified = setting.Value == "true"
+			}
+		}
+	}
+	for i, engine := range v.Engines {
+		if engine.Command != "" {
+			_, err := exec.LookPath(engine.Command)
+			v.Engines[i].Available = err == nil
+		}
+	}
+	return v
+}
+
+// sortedNames returns the keys of a registry in order.
+func sortedNames[V any](registry map[string]V) []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runVersion implements "goatpaver version".
+func runVersion(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), versionUsage) }
+	asJSON := flags.Bool("json", false, "print the version and features as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+	v := newVersionInfo()
+	if *asJSON {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(data))
+		return nil
+	}
+	v.write(stdout)
+	return nil
+}
+
+// write prints v as text.
+func (v versionInfo) write(w io.Writer) {
+	fmt.Fprintf(w, "goatpaver %s", v.Version)
+	if v.Commit != "" {
+		fmt.Fprintf(w, " (commit %s", v.Commit)
+		if v.Modified {
+			fmt.Fprint(w, ", modified")
+		}
+		fmt.Fprint(w, ")")
+	}
+	fmt.Fprintf(w, "\n%s, output schema version %d\n\nEngines:\n", v.GoVersion, v.SchemaVersion)
+	for _, engine := range v.Engines {
+		switch {
+		case engine.Command == "":
+			fmt.Fprintf(w, "  %-16s builtin\n", engine.Name)
+		case engine.Available:
+			fmt.Fprintf(w, "  %-16s %s\n", engine.Name, engine.Command)
+		default:
+			fmt.Fprintf(w, "  %-16s %s not found\n", engine.Name, engine.Command)
+		}
+	}
+	fmt.Fprint(w, "\nFeatures:\n")
+	for _, name := range sortedNames(v.Features) {
+		fmt.Fprintf(w, "  %-16s %s\n", name, strings.Join(v.Features[name], " "))
+	}
+}
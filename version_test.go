@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestRunVersion(t *testing.T) {
+	defer func(saved func() (*debug.BuildInfo, bool)) { readBuildInfo = saved }(readBuildInfo)
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			Main:     debug.Module{Version: "v1.4.0"},
+			Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "abc123"}, {Key: "vcs.modified", Value: "true"}},
+		}, true
+	}
+
+	var stdout bytes.Buffer
+	if err := runVersion([]string{"-json"}, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	var v versionInfo
+	if err := json.Unmarshal(stdout.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != "v1.4.0" || v.Commit != "abc123" || !v.Modified || !strings.HasPrefix(v.GoVersion, "go") || v.SchemaVersion != outputSchemaVersion {
+		t.Errorf("Unexpected version %+v", v)
+	}
+	if v.Engines[0] != (engineInfo{Name: "xpath", Available: true}) || v.Engines[2].Command != "xsltproc" {
+		t.Errorf("Unexpected engines %+v", v.Engines)
+	}
+	for feature, want := range map[string]string{"transforms": "money", "outputs": "sqlite", "queues": "redis", "subcommands": "version"} {
+		if !strings.Contains(" "+strings.Join(v.Features[feature], " ")+" ", " "+want+" ") {
+			t.Errorf("Unexpected %s %v; want %s among them", feature, v.Features[feature], want)
+		}
+	}
+	if toolVersion() != "v1.4.0" {
+		t.Errorf("Unexpected tool version %q", toolVersion())
+	}
+
+	stdout.Reset()
+	if err := runVersion(nil, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if text := stdout.String(); !strings.HasPrefix(text, "goatpaver v1.4.0 (commit abc123, modified)\n") || !strings.Contains(text, "  xpath            builtin\n") || !strings.Contains(text, "  modes            first all\n") {
+		t.Errorf("Unexpected text %q", text)
+	}
+
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+	if v := newVersionInfo(); v.Version != "unknown" || v.Commit != "" {
+		t.Errorf("Unexpected version without build info %+v", v)
+	}
+	if err := runVersion([]string{"extra"}, &stdout); err == nil {
+		t.Error("Expected an error for an argument")
+	}
+}
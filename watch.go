@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --- Watch Mode ---
+
+// watchInterval is how often -watch looks at the files for changes.
+var watchInterval = 500 * time.Millisecond
+
+// watchInput runs with opts whenever an input file or a file it refers to changes, until
+// interrupted. A run that fails is logged, so the input can be fixed and saved again.
+func (opts runOptions) watchInput() error {
+	inputs := opts.inputFiles()
+	if len(inputs) == 0 {
+		return errors.New("-watch needs an -input file")
+	}
+	for _, input := range inputs {
+		if strings.Contains(input, "://") {
+			return errors.New("-watch needs an -input file")
+		}
+	}
+	for {
+		// Stamp the files before the run reads them, so that saves during the run aren't missed
+		files := opts.watchedFiles()
+		stamps := fileStamps(files)
+		code, err := run(opts)
+		if err != nil {
+			logger.Error(err.Error())
+		} else if code != 0 {
+			logger.Warn(fmt.Sprintf("Run exited with status %d", code), "exit_status", code)
+		}
+		logger.Info(fmt.Sprintf("Watching %d files for changes", len(files)), "files", len(files))
+		for fileStamps(files) == stamps {
+			time.Sleep(watchInterval)
+		}
+	}
+}
+
+// watchedFiles returns the input files and the local files they refer to: the URLs'
+// content and the files it includes, script, template, stylesheet and schema. An input
+// that can't be read or parsed is watched alone.
+func (opts runOptions) watchedFiles() []string {
+	var files []string
+	for _, input := range opts.inputFiles() {
+		files = append(files, input)
+		files = append(files, referredFiles(input, opts.inputFormat)...)
+	}
+	local := files[:0]
+	for _, file := range files {
+		if file != "" && !strings.Contains(file, "://") {
+			local = append(local, file)
+		}
+	}
+	return local
+}
+
+// referredFiles returns the files the input document at location refers to, or none if it
+// can't be read or parsed.
+func referredFiles(location, format string) []string {
+	document, err := readInputFile(context.Background(), location, format)
+	if err != nil {
+		return nil
+	}
+	var refs struct {
+		Urls map[string]struct {
+			File string `json:"file"`
+		} `json:"urls"`
+		Script   struct{ File string }       `json:"script"`
+		Template struct{ File string }       `json:"template"`
+		XSLT     struct{ Stylesheet string } `json:"xslt"`
+		Validate struct{ XSD, DTD string }   `json:"validate"`
+		XInclude struct{ Files bool }        `json:"xinclude"`
+	}
+	if json.Unmarshal(document, &refs) != nil {
+		return nil
+	}
+	var files []string
+	for pageURL, urlData := range refs.Urls {
+		files = append(files, urlData.File)
+		if !refs.XInclude.Files {
+			continue
+		}
+		// Only pages read from local files include files, see newXIncludeDecoder
+		if _, _, _, ok := splitObjectURI(urlData.File); urlData.File != "" && !ok {
+			files = append(files, includedFiles(urlData.File)...)
+		} else if u, err := url.Parse(pageURL); urlData.File == "" && err == nil && u.Scheme == "file" {
+			if file, err := fileURLPath(u); err == nil {
+				files = append(files, includedFiles(file)...)
+			}
+		}
+	}
+	return append(files, refs.Script.File, refs.Template.File, refs.XSLT.Stylesheet, refs.Validate.XSD, refs.Validate.DTD)
+}
+
+// includedFiles returns the local files that the page read from file includes, directly
+// or through the files it includes. As when expanding, they are only taken from the
+// page's directory and below.
+func includedFiles(file string) []string {
+	page, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer page.Close()
+	base := &url.URL{Path: filepath.ToSlash(file)}
+	root := path.Dir(path.Clean(base.Path))
+	var files []string
+	seen := make(map[string]bool)
+	var scan func(base *url.URL, r io.Reader)
+	scan = func(base *url.URL, r io.Reader) {
+		decoder := xml.NewDecoder(r)
+		decoder.Strict = false
+		for {
+			t, err := decoder.Token()
+			if err != nil {
+				return
+			}
+			start, ok := t.(xml.StartElement)
+			if !ok || start.Name.Space != xincludeNamespace || start.Name.Local != "include" {
+				continue
+			}
+			var href, parse string
+			for _, attr := range start.Attr {
+				switch attr.Name.Local {
+				case "href":
+					href = attr.Value
+				case "parse":
+					parse = attr.Value
+				}
+			}
+			target, err := includeTarget(base, href)
+			if err != nil || href == "" || (target.Scheme != "" && target.Scheme != "file") ||
+				!withinDir(root, target.Path) || seen[target.Path] {
+				continue
+			}
+			seen[target.Path] = true
+			files = append(files, target.Path)
+			if parse == "" || parse == "xml" {
+				if file, err := os.Open(filepath.FromSlash(target.Path)); err == nil {
+					scan(target, file)
+					file.Close()
+				}
+			}
+		}
+	}
+	scan(base, page)
+	return files
+}
+
+// fileStamps sums up the size and modification time of files, so that a change to any
+// of them changes the result.
+func fileStamps(files []string) string {
+	var stamps strings.Builder
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&stamps, "%s %d %d\n", file, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&stamps, "%s missing\n", file)
+		}
+	}
+	return stamps.String()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestWatchedFiles(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.json")
+	document := `{"xpaths": ["//h1"], "urls": {"a": {"file": "a.html"}, "b": {"file": "s3://bucket/b.html"}, "c": {"content": "<h1>"}},
+		"script": {"file": "hooks.star"}, "xslt": {"stylesheet": "clean.xsl"}}`
+	if err := os.WriteFile(input, []byte(document), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := parseFlags([]string{"-watch", "-input", input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := opts.watchedFiles()
+	sort.Strings(files)
+	if want := []string{input, "a.html", "clean.xsl", "hooks.star"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Watching %q; want %q", files, want)
+	}
+
+	// YAML input files given as arguments are watched along with theirs
+	extra := filepath.Join(dir, "sites.yaml")
+	if err := os.WriteFile(extra, []byte("urls:\n  d:\n    file: d.html\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	several, err := parseFlags([]string{"-watch", input, extra})
+	if err != nil {
+		t.Fatal(err)
+	}
+	both := several.watchedFiles()
+	sort.Strings(both)
+	if want := []string{input, extra, "a.html", "clean.xsl", "d.html", "hooks.star"}; !reflect.DeepEqual(both, want) {
+		t.Errorf("Watching %q; want %q", both, want)
+	}
+
+	stamps := fileStamps(files)
+	if fileStamps(files) != stamps {
+		t.Error("Stamps changed without changes")
+	}
+	if err := os.WriteFile(input, []byte(document+" "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if fileStamps(files) == stamps {
+		t.Error("Stamps didn't change with the input")
+	}
+
+	// Broken input is still watched, to be fixed
+	if err := os.WriteFile(input, []byte(`{"xpaths": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if files := opts.watchedFiles(); !reflect.DeepEqual(files, []string{input}) {
+		t.Errorf("Watching %q for broken input", files)
+	}
+
+	for _, args := range [][]string{{"-watch"}, {"-watch", "-input", "s3://bucket/input.json"}} {
+		opts, err := parseFlags(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := opts.watchInput(); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
+
+func TestWatchedFiles_SchemaAndIncludes(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.json")
+	up := filepath.Join(dir, "up.xml")
+	include := `<doc xmlns:xi="http://www.w3.org/2001/XInclude"><xi:include href="../secret.txt" parse="text"/></doc>`
+	if err := os.WriteFile(up, []byte(include), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	document := `{"xpaths": ["//title"], "xinclude": {"files": true}, "validate": {"xsd": "testdata/validate/price.xsd"},
+		"urls": {"book": {"file": "testdata/xinclude/book.xml"}, "up": {"file": "` + filepath.ToSlash(up) + `"},
+			"testdata/xinclude/page.xml": {"content": "<p xmlns:xi=\"http://www.w3.org/2001/XInclude\"><xi:include href=\"page1.xml\"/></p>"}}}`
+	if err := os.WriteFile(input, []byte(document), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := parseFlags([]string{"-watch", "-input", input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := opts.watchedFiles()
+	sort.Strings(files)
+	// Includes from outside the page's directory, and those of content, aren't followed;
+	// missing ones are watched for being created
+	want := []string{input, up, "testdata/validate/price.xsd", "testdata/xinclude/book.xml",
+		"testdata/xinclude/chapter.xml", "testdata/xinclude/note.txt", "testdata/xinclude/nope.xml"}
+	sort.Strings(want)
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Watching %q; want %q", files, want)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// --- Webhook Sink ---
+
+// webhookSecretEnv holds the key results are signed with; unset, they go unsigned.
+const webhookSecretEnv = "GOATPAVER_WEBHOOK_SECRET"
+
+// webhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the request body.
+const webhookSignatureHeader = "X-Goatpaver-Signature"
+
+// Deliveries are retried this many times after network errors, 429 and 5xx responses,
+// waiting webhookBackoff, then twice as long, and so on.
+const webhookRetries = 5
+
+var webhookBackoff = time.Second
+
+// webhookSink POSTs results as JSON to an http:// or https:// endpoint: by default the
+// whole run as {"run_id", "timestamp", "output"} with the nested output, or with ?per=url
+// one per-URL document at a time (the parameter is not sent on). With
+// $GOATPAVER_WEBHOOK_SECRET set, each request is signed like GitHub webhooks so
+// receivers can check where it came from.
+type webhookSink struct {
+	endpoint string
+	perURL   bool
+	secret   []byte
+	client   *http.Client
+}
+
+// webhookRun is the payload of a whole-run delivery.
+type webhookRun struct {
+	RunID     string     `json:"run_id"`
+	Timestamp time.Time  `json:"timestamp"`
+	Output    OutputJson `json:"output"`
+}
+
+func openWebhookSink(target *url.URL) (sink, error) {
+	endpoint := *target
+	query := endpoint.Query()
+	s := &webhookSink{secret: []byte(os.Getenv(webhookSecretEnv)), client: &http.Client{Timeout: time.Minute}}
+	switch per := query.Get("per"); per {
+	case "", "run":
+	case "url":
+		s.perURL = true
+	default:
+		return nil, fmt.Errorf("unknown webhook per=%q (want run or url)", per)
+	}
+	if query.Has("per") {
+		query.Del("per")
+		endpoint.RawQuery = query.Encode()
+	}
+	s.endpoint = endpoint.String()
+	return s, nil
+}
+
+func (s *webhookSink) write(run sinkRun) error {
+	if !s.perURL {
+		return s.deliver(webhookRun{RunID: run.ID, Timestamp: run.Time.UTC(), Output: run.Output}, run.ID)
+	}
+	for _, doc := range run.documents() {
+		if err := s.deliver(doc, run.ID); err != nil {
+			return fmt.Errorf("delivering %s: %w", doc.URL, err)
+		}
+	}
+	return nil
+}
+
+// deliver POSTs payload, retrying transient failures.
+func (s *webhookSink) deliver(payload interface{}, runID string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	wait := webhookBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(body, runID)
+		if err == nil || !retry || attempt == webhookRetries {
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// post sends body once, reporting whether a failure is worth retrying.
+func (s *webhookSink) post(body []byte, runID string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Goatpaver-Run", runID)
+	if len(s.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, webhookSignature(s.secret, body))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+// webhookSignature returns the signature header value for body.
+func webhookSignature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
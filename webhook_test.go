@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink(t *testing.T) {
+	t.Setenv(webhookSecretEnv, "s3cret")
+	defer func(backoff time.Duration) { webhookBackoff = backoff }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	var bodies [][]byte
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(webhookSignatureHeader), webhookSignature([]byte("s3cret"), body); got != want {
+			t.Errorf("Signature = %q; want %q", got, want)
+		}
+		if r.URL.Query().Has("per") || r.URL.Query().Get("token") != "t" || r.Header.Get("X-Goatpaver-Run") != "r1" {
+			t.Errorf("Unexpected request %s with run %q", r.URL, r.Header.Get("X-Goatpaver-Run"))
+		}
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	input := &InputJson{Urls: map[string]UrlData{"http://a.com": {}, "http://b.com": {}}}
+	output := OutputJson{"//h1": {"http://a.com": "A", "http://b.com": "B"}}
+
+	// The whole run in one request, after retrying the 503
+	opts, err := parseFlags([]string{"-output", server.URL + "/hook?token=t", "-run-id", "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.writeSink(input, output, at); err != nil {
+		t.Fatal(err)
+	}
+	var run webhookRun
+	if requests != 2 || len(bodies) != 1 || json.Unmarshal(bodies[0], &run) != nil || run.Output["//h1"]["http://b.com"] != "B" || !run.Timestamp.Equal(at) {
+		t.Fatalf("Got %d requests with bodies %q", requests, bodies)
+	}
+
+	// One request per URL
+	bodies = nil
+	if opts, err = parseFlags([]string{"-output", server.URL + "/hook?token=t&per=url", "-run-id", "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.writeSink(input, output, at); err != nil {
+		t.Fatal(err)
+	}
+	var doc urlDocument
+	if len(bodies) != 2 || json.Unmarshal(bodies[1], &doc) != nil || doc.URL != "http://b.com" || doc.Fields["//h1"] != "B" {
+		t.Errorf("Unexpected per-URL bodies %q", bodies)
+	}
+}
+
+func TestWebhookSinkFailures(t *testing.T) {
+	defer func(backoff time.Duration) { webhookBackoff = backoff }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+	requests := 0
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get(webhookSignatureHeader) != "" {
+			t.Error("Request signed without a secret")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	target, _ := parseSinkTarget(server.URL)
+	s, err := openWebhookSink(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Client errors are not retried, server errors are until the retries run out
+	if err := s.write(sinkRun{ID: "r1"}); err == nil || requests != 1 {
+		t.Errorf("write = %v after %d requests; want an error after 1", err, requests)
+	}
+	requests, status = 0, http.StatusBadGateway
+	if err := s.write(sinkRun{ID: "r1"}); err == nil || requests != webhookRetries+1 {
+		t.Errorf("write = %v after %d requests; want an error after %d", err, requests, webhookRetries+1)
+	}
+
+	target, _ = parseSinkTarget(server.URL + "?per=page")
+	if _, err := openWebhookSink(target); err == nil {
+		t.Error("Expected an error for per=page")
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// --- worker Subcommand ---
+
+const workerUsage = `Usage: goatpaver worker -queue URL [-results URL] [-concurrency N] [-trust-jobs]
+                        [-log-level LEVEL] [-log-format text|json] [-pprof ADDR]
+                        [-cpuprofile FILE] [-memprofile FILE] [-xslt-command PATH]
+                        [-validate-command PATH]
+       goatpaver worker -listen ADDR [FLAGS]
+
+Processes jobs from a queue until interrupted, N at a time. A job is an input document, as
+a plain run reads from stdin. Its result is published to -results (or printed to stdout)
+as {"job": ID, "output": {...}}, or {"job": ID, "error": "..."} if the input was
+rejected. A job is acknowledged once its result is published and returned to the queue
+if publishing fails. Interrupting the worker lets the jobs it holds finish. Warnings are
+logged to stderr as for a plain run, and flags can be set by environment variables too,
+e.g. GOATPAVER_QUEUE and GOATPAVER_CONCURRENCY.
+
+Whoever can send jobs decides what the worker does, so jobs are rejected if they reach
+beyond their own document: reading the worker's files, with "file" URL content, file://
+URLs, a script or template "file", "xslt", "validate", "xinclude" files or "fetch" TLS
+files, keeping a "history" store or "changes_only" file, and POSTing "alerts". -trust-jobs
+lets jobs use them as a plain run would, for queues only trusted senders can reach.
+
+-listen makes it a worker of distributed runs instead (see -workers in goatpaver -h): it
+takes batches of URLs POSTed to /batch on ADDR, such as :8080, N at a time, and answers
+with their values and warnings rather than publishing them. Interrupting it lets the
+batches at hand finish. With $GOATPAVER_WORKER_TOKEN set, it refuses batches sent without
+the same token; ADDR can only be reachable from other hosts with it set, as for :8080, so
+use localhost:8080 to take batches without a token. Batches have to be application/json
+and come without an Origin header, so web pages open in a browser can't send any.
+
+-xslt-command and -validate-command run another XSLT processor than xsltproc and another
+validator than xmllint, as for a plain run.
+
+-pprof serves the net/http/pprof profiles on ADDR, such as localhost:6060, under
+/debug/pprof/ while the worker runs. -cpuprofile and -memprofile write a CPU profile of
+the worker's whole run and a heap profile once it stops, as for a plain run.
+
+Queues:  sqs://sqs.REGION.amazonaws.com/ACCOUNT/QUEUE
+         nats://HOST:4222/STREAM/CONSUMER (JetStream, durable pull consumer)
+         redis://HOST:6379/LIST[?db=N] (reliable list queue, see redis.go)
+Results: sqs://..., sns://TOPIC-ARN, nats://HOST:4222/SUBJECT or redis://HOST:6379/LIST
+`
+
+// job is one message taken from a queue.
+type job struct {
+	ID   string
+	Body []byte
+	ack  func(ctx context.Context) error // Removes the job from the queue
+	nack func(ctx context.Context) error // Makes the job available again
+}
+
+// jobQueue is a source of jobs.
+type jobQueue interface {
+	// receive waits for jobs; it returns none once ctx is done.
+	receive(ctx context.Context) ([]job, error)
+	Close() error
+}
+
+// resultPublisher delivers job results. It is called from several goroutines at once.
+type resultPublisher interface {
+	publish(ctx context.Context, jobID string, result []byte) error
+}
+
+// queues and publishers are the registries of -queue and -results targets by URL scheme.
+var (
+	queues = map[string]func(target string) (jobQueue, error){
+		"sqs":   openSQSQueue,
+		"nats":  openNATSQueue,
+		"redis": openRedisQueue,
+	}
+	publishers = map[string]func(target string) (resultPublisher, error){
+		"sqs":   openSQSPublisher,
+		"sns":   openSNSPublisher,
+		"nats":  openNATSPublisher,
+		"redis": openRedisPublisher,
+	}
+)
+
+// jobResult is what is published for a job.
+type jobResult struct {
+	Job    string     `json:"job"`
+	Output OutputJson `json:"output,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// stdoutPublisher prints results, one JSON document per line.
+type stdoutPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (p *stdoutPublisher) publish(ctx context.Context, jobID string, result []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintf(p.w, "%s\n", result)
+	return err
+}
+
+// runWorker implements "goatpaver worker".
+func runWorker(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("worker", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), workerUsage) }
+	queueTarget := flags.String("queue", "", "queue to take jobs from")
+	listenAddr := flags.String("listen", "", "take batches of distributed runs on this address, e.g. :8080")
+	resultsTarget := flags.String("results", "", "where to publish results; default stdout")
+	concurrency := flags.Int("concurrency", 1, "number of jobs processed at a time")
+	trustJobs := flags.Bool("trust-jobs", false, "let jobs read local files, keep a history store and POST alerts")
+	newWorkerLogger := logFlags(flags)
+	pprofAddr := flags.String("pprof", "", "serve net/http/pprof on this address, e.g. localhost:6060")
+	profiles := profileFlags(flags)
+	commands := externalFlags(flags)
+	if err := setFlagsFromEnv(flags); err != nil {
+		return err
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	workerLogger, err := newWorkerLogger()
+	if err != nil {
+		return err
+	}
+	logger = workerLogger
+	toolCommands = *commands
+	if (*queueTarget == "") == (*listenAddr == "") || flags.NArg() > 0 {
+		flags.Usage()
+		return errors.New("worker needs a -queue or -listen")
+	}
+	if *listenAddr != "" && *resultsTarget != "" {
+		return errors.New("-results cannot be combined with -listen")
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("-concurrency must be at least 1")
+	}
+	var queue jobQueue
+	var publisher resultPublisher = &stdoutPublisher{w: stdout}
+	if *queueTarget != "" {
+		scheme, _, _ := strings.Cut(*queueTarget, "://")
+		openQueue, ok := queues[scheme]
+		if !ok {
+			return fmt.Errorf("unknown -queue %q (want sqs://..., nats://... or redis://...)", *queueTarget)
+		}
+		if *resultsTarget != "" {
+			scheme, _, _ := strings.Cut(*resultsTarget, "://")
+			openPublisher, ok := publishers[scheme]
+			if !ok {
+				return fmt.Errorf("unknown -results %q (want sqs://..., sns://..., nats://... or redis://...)", *resultsTarget)
+			}
+			var err error
+			if publisher, err = openPublisher(*resultsTarget); err != nil {
+				return err
+			}
+		}
+		if queue, err = openQueue(*queueTarget); err != nil {
+			return err
+		}
+		defer queue.Close()
+	}
+	if *pprofAddr != "" {
+		listener, err := servePprof(*pprofAddr)
+		if err != nil {
+			return fmt.Errorf("-pprof: %w", err)
+		}
+		defer listener.Close()
+	}
+	stopProfiles, err := profiles.start()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := stopProfiles(); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to write profiles: %v", err))
+		}
+	}()
+
+	// Interrupting lets the jobs at hand finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *listenAddr != "" {
+		return serveBatchesUntil(ctx, *listenAddr, *concurrency)
+	}
+	return work(ctx, queue, publisher, *concurrency, *trustJobs)
+}
+
+// work handles jobs from queue with concurrency goroutines until ctx is done. Jobs already
+// received when it is done are still handled, so none are left unacknowledged. Unless
+// trusted, jobs are restricted as checkJob says.
+func work(ctx context.Context, queue jobQueue, publisher resultPublisher, concurrency int, trusted bool) error {
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				handleJob(context.WithoutCancel(ctx), j, publisher, trusted)
+			}
+		}()
+	}
+
+	var err error
+	for ctx.Err() == nil {
+		received, receiveErr := queue.receive(ctx)
+		for _, j := range received {
+			jobs <- j
+		}
+		if receiveErr != nil {
+			if ctx.Err() == nil {
+				err = fmt.Errorf("receiving jobs: %w", receiveErr)
+			}
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return err
+}
+
+// handleJob runs one job and publishes its result, acknowledging the job on success.
+func handleJob(ctx context.Context, j job, publisher resultPublisher, trusted bool) {
+	result, err := json.Marshal(runJob(j.ID, j.Body, trusted))
+	if err == nil {
+		err = publisher.publish(ctx, j.ID, result)
+	}
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to publish result of job %s: %v. Returning it to the queue.", j.ID, err), "job", j.ID)
+		if err := j.nack(ctx); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to return job %s to the queue: %v", j.ID, err), "job", j.ID)
+		}
+		return
+	}
+	if err := j.ack(ctx); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to acknowledge job %s: %v. It may run again.", j.ID, err), "job", j.ID)
+	}
+}
+
+// runJob processes a job's input document like a plain run, including alerts, history and
+// change-only output if trusted. Templates and output flags don't apply; the result is
+// always the nested output.
+func runJob(id string, body []byte, trusted bool) jobResult {
+	if !trusted {
+		if err := checkJob(body); err != nil {
+			return jobResult{Job: id, Error: err.Error()}
+		}
+	}
+	input, err := parseInput(body)
+	if err != nil {
+		return jobResult{Job: id, Error: err.Error()}
+	}
+	output, err := process(input)
+	if err == nil {
+		output, err = finishRun(input, output, time.Now())
+	}
+	if err != nil {
+		return jobResult{Job: id, Error: err.Error()}
+	}
+	return jobResult{Job: id, Output: output}
+}
+
+// checkJob refuses the options of a job's input document that reach beyond the job: the
+// worker's files, also through file:// URLs, a history store kept on it, and the webhooks
+// alerts are POSTed to. It reads the document before parseInput, which already loads the
+// script and template files.
+func checkJob(body []byte) error {
+	var refs struct {
+		Urls map[string]struct {
+			File string `json:"file"`
+		} `json:"urls"`
+		Script      struct{ File string }         `json:"script"`
+		Template    struct{ File string }         `json:"template"`
+		XSLT        json.RawMessage               `json:"xslt"`
+		Validate    json.RawMessage               `json:"validate"`
+		XInclude    struct{ Files bool }          `json:"xinclude"`
+		Fetch       struct{ TLS json.RawMessage } `json:"fetch"`
+		History     string                        `json:"history"`
+		ChangesOnly struct{ Previous string }     `json:"changes_only"`
+		Alerts      json.RawMessage               `json:"alerts"`
+	}
+	if json.Unmarshal(body, &refs) != nil {
+		return nil // parseInput says what is wrong with it
+	}
+	given := func(raw json.RawMessage) bool { return len(raw) > 0 && string(raw) != "null" }
+	options := map[string]bool{
+		`"script" file`:       refs.Script.File != "",
+		`"template" file`:     refs.Template.File != "",
+		`"xslt"`:              given(refs.XSLT),
+		`"validate"`:          given(refs.Validate),
+		`"xinclude" files`:    refs.XInclude.Files,
+		`"fetch" TLS`:         given(refs.Fetch.TLS),
+		`"history"`:           refs.History != "",
+		`"changes_only" file`: refs.ChangesOnly.Previous != "",
+		`"alerts"`:            given(refs.Alerts),
+	}
+	for pageURL, urlData := range refs.Urls {
+		options[`"file" URL content`] = options[`"file" URL content`] || urlData.File != ""
+		if u, err := url.Parse(pageURL); err == nil && u.Scheme == "file" {
+			options["file:// URLs"] = true
+		}
+	}
+	var refused []string
+	for option, set := range options {
+		if set {
+			refused = append(refused, option)
+		}
+	}
+	if len(refused) == 0 {
+		return nil
+	}
+	sort.Strings(refused)
+	return fmt.Errorf("jobs cannot use %s unless the worker runs with -trust-jobs", strings.Join(refused, ", "))
+}
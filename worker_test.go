@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeQueue hands out its jobs once, then cancels the worker.
+type fakeQueue struct {
+	jobs   []job
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	acked  []string
+	nacked []string
+}
+
+func (q *fakeQueue) add(id, body string) {
+	q.jobs = append(q.jobs, job{
+		ID:   id,
+		Body: []byte(body),
+		ack:  func(context.Context) error { q.settle(&q.acked, id); return nil },
+		nack: func(context.Context) error { q.settle(&q.nacked, id); return nil },
+	})
+}
+
+func (q *fakeQueue) settle(ids *[]string, id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	*ids = append(*ids, id)
+	sort.Strings(*ids)
+}
+
+func (q *fakeQueue) receive(ctx context.Context) ([]job, error) {
+	jobs := q.jobs
+	q.jobs = nil
+	if len(jobs) == 0 {
+		q.cancel()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return jobs, nil
+}
+
+func (q *fakeQueue) Close() error { return nil }
+
+// fakePublisher collects results, failing for the job named in fail.
+type fakePublisher struct {
+	mu      sync.Mutex
+	results map[string]jobResult
+	fail    string
+}
+
+func (p *fakePublisher) publish(ctx context.Context, jobID string, result []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if jobID == p.fail {
+		return errors.New("publish failed")
+	}
+	var r jobResult
+	if err := json.Unmarshal(result, &r); err != nil {
+		return err
+	}
+	p.results[jobID] = r
+	return nil
+}
+
+func TestWork(t *testing.T) {
+	for _, concurrency := range []int{1, 3} {
+		testWork(t, concurrency)
+	}
+}
+
+func testWork(t *testing.T, concurrency int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := &fakeQueue{cancel: cancel}
+	queue.add("1", `{"xpaths": ["//h1"], "urls": {"http://a.com": {"content": "<h1>A</h1>"}}}`)
+	queue.add("2", `{"xpaths": [`)
+	queue.add("3", `{"xpaths": ["//h1"], "urls": {}}`)
+	publisher := &fakePublisher{results: map[string]jobResult{}, fail: "3"}
+
+	if err := work(ctx, queue, publisher, concurrency, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := publisher.results["1"].Output["//h1"]["http://a.com"]; got != "A" {
+		t.Errorf("Job 1 result = %#v; want A for //h1", publisher.results["1"])
+	}
+	if r := publisher.results["2"]; r.Output != nil || !strings.Contains(r.Error, "unmarshalling input JSON") {
+		t.Errorf("Job 2 result = %#v; want an input error", r)
+	}
+	if strings.Join(queue.acked, ",") != "1,2" || strings.Join(queue.nacked, ",") != "3" {
+		t.Errorf("acked %v, nacked %v; want 1 and 2 acked, 3 returned", queue.acked, queue.nacked)
+	}
+}
+
+func TestRunJobRestrictions(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "page.html")
+	if err := os.WriteFile(page, []byte("<h1>Local</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"xpaths": ["//h1"], "history": "` + filepath.Join(t.TempDir(), "history.db") + `",
+		"script": {"file": "/etc/passwd"}, "fetch": {},
+		"urls": {"http://a.com": {"file": "` + page + `"}, "file:///etc/hostname": {}}}`
+	r := runJob("1", []byte(body), false)
+	want := `jobs cannot use "file" URL content, "history", "script" file, file:// URLs unless the worker runs with -trust-jobs`
+	if r.Output != nil || r.Error != want {
+		t.Errorf("Untrusted job result = %#v; want the error %q", r, want)
+	}
+
+	body = `{"xpaths": ["//h1"], "urls": {"http://a.com": {"file": "` + page + `"}}}`
+	if r := runJob("2", []byte(body), true); r.Output["//h1"]["http://a.com"] != "Local" {
+		t.Errorf("Trusted job result = %#v; want Local for //h1", r)
+	}
+	if r := runJob("3", []byte(`{"xpaths": ["//h1"], "xslt": null, "urls": {"http://a.com": {"content": "<h1>A</h1>"}}}`), false); r.Error != "" {
+		t.Errorf("Job without local options failed: %s", r.Error)
+	}
+}
+
+func TestRunWorkerTargets(t *testing.T) {
+	for _, args := range [][]string{{}, {"-queue", "amqp://broker/jobs"}, {"-queue", "redis://localhost/jobs", "-concurrency", "0"}, {"-queue", "sqs://sqs.eu-west-1.amazonaws.com/1/jobs", "-results", "ftp://x"}} {
+		if err := runWorker(args, nil); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --- XInclude ---
+
+// xincludeNamespace is the namespace of xi:include and xi:fallback elements.
+const xincludeNamespace = "http://www.w3.org/2001/XInclude"
+
+// maxIncludeDepth bounds nested includes, as a backstop to the cycle check.
+const maxIncludeDepth = 16
+
+// XIncludeOptions enables xi:include expansion. Each source of included documents has
+// to be allowed explicitly, since a document can otherwise make goatpaver read arbitrary
+// local files or issue requests on its behalf. Even then, only documents of local files
+// include files, and only from the document's directory and below; a page fetched over
+// http, or given as content, can't copy local files into the output. The page and what it
+// includes count towards -max-doc-size together.
+type XIncludeOptions struct {
+	Files bool `json:"files,omitempty"` // Allow includes from the local filesystem (relative or file:// hrefs)
+	HTTP  bool `json:"http,omitempty"`  // Allow includes fetched over http and https
+
+	client    *http.Client // For the fetch options' TLS and Resolve, made by check; xincludeClient otherwise
+	userAgent string       // As for fetches
+}
+
+// xincludeTimeout bounds each http include.
+const xincludeTimeout = 30 * time.Second
+
+var xincludeClient = &http.Client{Timeout: xincludeTimeout}
+
+// check sets up http includes to connect and identify themselves as fetches do: with the
+// TLS options and resolve pins of fetch, which may be nil, and those of the flags over
+// them.
+func (o *XIncludeOptions) check(fetch *FetchOptions, tlsFlags *TLSOptions, resolveFlags []string) error {
+	o.client, o.userAgent = nil, fetch.userAgent()
+	options, resolve := tlsFlags, resolveFlags
+	if fetch != nil {
+		options = tlsFlags.over(fetch.TLS)
+		resolve = append(fetch.Resolve[:len(fetch.Resolve):len(fetch.Resolve)], resolveFlags...)
+	}
+	pins, err := parseResolve(resolve)
+	if err != nil {
+		return fmt.Errorf("xinclude: %w", err)
+	}
+	if options != nil || pins != nil {
+		if o.client, err = httpClient(options, pins, xincludeTimeout); err != nil {
+			return fmt.Errorf("xinclude: %w", err)
+		}
+	}
+	return nil
+}
+
+// pageSource describes the document being decoded for xi:include expansion.
+type pageSource struct {
+	file string // Local file the document was read from, or ""
+	size int64  // Bytes of the document, which its includes add to
+}
+
+// newXIncludeDecoder wraps decoder so that xi:include elements are replaced by the
+// documents (or text) they reference, resolved relative to the page's file if it was read
+// from one, and to pageURL otherwise.
+func newXIncludeDecoder(decoder *xml.Decoder, input *InputJson, pageURL string, source pageSource) *xml.Decoder {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		base = &url.URL{}
+	}
+	if source.file != "" {
+		base = &url.URL{Path: filepath.ToSlash(source.file)}
+	}
+	expander := &xincludeReader{
+		options:  *input.XInclude,
+		entities: input.Entities,
+		frames:   []*includeFrame{{decoder: decoder, base: base}},
+		active:   map[string]bool{base.String(): true},
+		maxSize:  input.maxDocSize,
+		included: source.size,
+	}
+	if source.file != "" {
+		expander.fileRoot = path.Dir(path.Clean(base.Path))
+	}
+	wrapped := xml.NewTokenDecoder(expander)
+	// The wrapping decoder re-checks element nesting, so keep it as forgiving as the inner one
+	wrapped.Strict = decoder.Strict
+	return wrapped
+}
+
+// includeFrame is a document being read: the top-level content or an included resource.
+type includeFrame struct {
+	decoder *xml.Decoder
+	base    *url.URL
+	closer  io.Closer
+	depth   int // Element depth within this document, to skip an included document's prolog
+}
+
+// xincludeReader is an xml.TokenReader that expands xi:include elements in place.
+type xincludeReader struct {
+	options  XIncludeOptions
+	entities string
+	frames   []*includeFrame
+	active   map[string]bool // Documents currently being included, to detect cycles
+	pending  []xml.Token     // Fallback content queued for output
+	fileRoot string          // Directory files can be included from, or "" if the page isn't a file
+	maxSize  int64           // Bytes the page and its includes can come to, or 0 for no limit
+	included int64           // Bytes of the page and its includes so far
+}
+
+func (x *xincludeReader) Token() (xml.Token, error) {
+	for {
+		if len(x.pending) > 0 {
+			t := x.pending[0]
+			x.pending = x.pending[1:]
+			return t, nil
+		}
+		frame := x.frames[len(x.frames)-1]
+		t, err := frame.decoder.Token()
+		if err == io.EOF && len(x.frames) > 1 {
+			x.pop()
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := t.(type) {
+		case xml.StartElement:
+			if tok.Name.Space == xincludeNamespace && tok.Name.Local == "include" {
+				if err := x.include(frame, tok); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			frame.depth++
+		case xml.EndElement:
+			frame.depth--
+		case xml.ProcInst, xml.Directive:
+			if len(x.frames) > 1 && frame.depth == 0 {
+				continue // Drop the XML declaration and doctype of included documents
+			}
+		}
+		return t, nil
+	}
+}
+
+// pop closes the innermost included document and returns to its includer.
+func (x *xincludeReader) pop() {
+	frame := x.frames[len(x.frames)-1]
+	x.frames = x.frames[:len(x.frames)-1]
+	delete(x.active, frame.base.String())
+	if frame.closer != nil {
+		frame.closer.Close()
+	}
+}
+
+// include handles one xi:include element whose start tag was just read from frame.
+// The element's content is consumed; its xi:fallback children are used if the
+// resource cannot be included.
+func (x *xincludeReader) include(frame *includeFrame, start xml.StartElement) error {
+	var href, parse, xpointer string
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "href":
+			href = attr.Value
+		case "parse":
+			parse = attr.Value
+		case "xpointer":
+			xpointer = attr.Value
+		}
+	}
+	fallback, err := readFallback(frame.decoder)
+	if err != nil {
+		return err
+	}
+
+	includeErr := x.open(frame, href, parse, xpointer)
+	if includeErr == nil {
+		return nil
+	}
+	if fallback == nil {
+		return fmt.Errorf("xi:include of %q: %w", href, includeErr)
+	}
+	x.pending = append(x.pending, fallback...)
+	return nil
+}
+
+// open loads the referenced resource, pushing a new frame for XML or queueing
+// character data for parse="text".
+func (x *xincludeReader) open(frame *includeFrame, href, parse, xpointer string) error {
+	if xpointer != "" {
+		return errors.New("xpointer is not supported")
+	}
+	if href == "" {
+		return errors.New("missing href (same-document includes are not supported)")
+	}
+	if parse != "" && parse != "xml" && parse != "text" {
+		return fmt.Errorf("unknown parse mode %q", parse)
+	}
+	target, err := includeTarget(frame.base, href)
+	if err != nil {
+		return err
+	}
+
+	if parse == "xml" || parse == "" {
+		if x.active[target.String()] {
+			return fmt.Errorf("inclusion loop through %s", target)
+		}
+		if len(x.frames) > maxIncludeDepth {
+			return fmt.Errorf("includes nested deeper than %d", maxIncludeDepth)
+		}
+	}
+
+	body, err := x.fetch(target)
+	if err != nil {
+		return err
+	}
+	body = &includeBody{ReadCloser: body, x: x}
+	if parse == "text" {
+		defer body.Close()
+		text, err := readAll(body)
+		if err != nil {
+			return err
+		}
+		x.pending = append(x.pending, xml.CharData(text))
+		return nil
+	}
+
+	decoder := newDecoder(body, x.entities)
+	x.frames = append(x.frames, &includeFrame{decoder: decoder, base: target, closer: body})
+	x.active[target.String()] = true
+	return nil
+}
+
+// fetch opens target if its source is allowed by the options.
+func (x *xincludeReader) fetch(target *url.URL) (io.ReadCloser, error) {
+	switch target.Scheme {
+	case "http", "https":
+		if !x.options.HTTP {
+			return nil, errors.New("http includes are not enabled")
+		}
+		req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if x.options.userAgent != "" {
+			req.Header.Set("User-Agent", x.options.userAgent)
+		}
+		client := xincludeClient
+		if x.options.client != nil {
+			client = x.options.client
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("GET %s: %s", target, resp.Status)
+		}
+		return resp.Body, nil
+	case "", "file":
+		if !x.options.Files {
+			return nil, errors.New("file includes are not enabled")
+		}
+		if x.fileRoot == "" {
+			return nil, errors.New("only documents of local files can include files")
+		}
+		if !withinDir(x.fileRoot, target.Path) {
+			return nil, fmt.Errorf("%s is outside %s", target.Path, x.fileRoot)
+		}
+		return os.Open(filepath.FromSlash(target.Path))
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", target.Scheme)
+	}
+}
+
+// includeTarget resolves href against the URL of the including document.
+func includeTarget(base *url.URL, href string) (*url.URL, error) {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+	var target *url.URL
+	if base.IsAbs() || ref.IsAbs() || path.IsAbs(ref.Path) {
+		target = base.ResolveReference(ref)
+	} else {
+		// ResolveReference would root the result; keep paths relative to the working directory
+		target = &url.URL{Path: path.Join(path.Dir(base.Path), ref.Path)}
+	}
+	target.Fragment = ""
+	return target, nil
+}
+
+// withinDir tells whether the file at the slash-separated path file is in dir, or below it.
+func withinDir(dir, file string) bool {
+	rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(path.Clean(file)))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// includeBody is an included resource, failing with a *tooLargeError once the page and
+// its includes come to more than -max-doc-size.
+type includeBody struct {
+	io.ReadCloser
+	x *xincludeReader
+}
+
+func (b *includeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.x.included += int64(n)
+	if b.x.maxSize > 0 && b.x.included > b.x.maxSize {
+		return 0, &tooLargeError{size: -1, limit: b.x.maxSize}
+	}
+	return n, err
+}
+
+// readFallback consumes the content of an xi:include element up to its end tag and
+// returns the children of its xi:fallback element, or nil if there is none.
+func readFallback(decoder *xml.Decoder) ([]xml.Token, error) {
+	var fallback []xml.Token
+	depth, inFallback := 0, false
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch tok := t.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 && tok.Name.Space == xincludeNamespace && tok.Name.Local == "fallback" {
+				inFallback = true
+				fallback = []xml.Token{}
+				continue
+			}
+		case xml.EndElement:
+			if depth == 0 {
+				return fallback, nil
+			}
+			depth--
+			if depth == 0 && inFallback {
+				inFallback = false
+				continue
+			}
+		}
+		if inFallback {
+			fallback = append(fallback, xml.CopyToken(t))
+		}
+	}
+}
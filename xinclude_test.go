@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/user/go_goat/internal/xmlpath"
+)
+
+func TestProcessInput_XInclude(t *testing.T) {
+	input := func(options string) []byte {
+		return []byte(`{
+			` + options + `
+			"xpaths": ["//chapter/title", "//chapter", "//missing"],
+			"urls": {"testdata/xinclude/book.xml": {"file": "testdata/xinclude/book.xml"}}
+		}`)
+	}
+
+	// With file includes allowed, both the nested XML and text includes are expanded
+	expectedOutput := OutputJson{
+		"//chapter/title": {"testdata/xinclude/book.xml": "Chapter One"},
+		"//chapter":       {"testdata/xinclude/book.xml": "Chapter OneA note."},
+		"//missing":       {"testdata/xinclude/book.xml": "gone"},
+	}
+	actualOutput, err := processInput(input(`"xinclude": {"files": true},`))
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+
+	// Without file access the first include has no fallback, so the URL fails to parse
+	expectedOutput = OutputJson{"//chapter/title": {}, "//chapter": {}, "//missing": {}}
+	actualOutput, err = processInput(input(`"xinclude": {"http": true},`))
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output without file access.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+
+	// Without the option xi:include is an ordinary element
+	expectedOutput = OutputJson{"//chapter/title": {}, "//chapter": {}, "//missing": {"testdata/xinclude/book.xml": "gone"}}
+	actualOutput, err = processInput(input(``))
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output with xinclude disabled.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+}
+
+func TestProcessInput_XIncludeFetchedFile(t *testing.T) {
+	// A page fetched from a file:// URL includes the files beside it, as one read from a file does
+	output, err := processInput([]byte(`{
+		"xinclude": {"files": true},
+		"fetch": {},
+		"xpaths": ["//chapter/title"],
+		"urls": {"file:testdata/xinclude/book.xml": {}}
+	}`))
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if title := output["//chapter/title"]["file:testdata/xinclude/book.xml"]; title != "Chapter One" {
+		t.Errorf("Unexpected output %v", output)
+	}
+}
+
+func TestProcessInput_XIncludeConfined(t *testing.T) {
+	// Each include is refused, leaving its fallback
+	include := func(href string) string {
+		return `<doc xmlns:xi=\"http://www.w3.org/2001/XInclude\"><xi:include href=\"` + href + `\" parse=\"text\"><xi:fallback>refused</xi:fallback></xi:include></doc>`
+	}
+	dir := t.TempDir()
+	pages := filepath.Join(dir, "pages")
+	if err := os.Mkdir(pages, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(pages, name)
+		if err := os.WriteFile(path, []byte(strings.ReplaceAll(content, `\"`, `"`)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return filepath.ToSlash(path)
+	}
+	up := write("up.xml", include("../secret.txt"))
+	absolute := write("absolute.xml", include("/etc/hostname"))
+	input := []byte(`{
+		"xinclude": {"files": true},
+		"xpaths": ["/doc"],
+		"urls": {
+			"http://example.com/page.xml": {"content": "` + include("file:///etc/hostname") + `"},
+			"page1": {"content": "` + include("testdata/xinclude/note.txt") + `"},
+			"up": {"file": "` + up + `"},
+			"absolute": {"file": "` + absolute + `"}
+		}
+	}`)
+	// Pages given as content include no files, not even under keys that look like paths
+	expectedOutput := OutputJson{"/doc": {
+		"http://example.com/page.xml": "refused",
+		"page1":                       "refused",
+		"up":                          "refused",
+		"absolute":                    "refused",
+	}}
+	actualOutput, err := processInput(input)
+	if err != nil {
+		t.Fatalf("processInput returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expectedOutput, actualOutput) {
+		t.Errorf("Unexpected output.\nExpected: %#v\nGot:      %#v", expectedOutput, actualOutput)
+	}
+}
+
+func TestProcessInput_XIncludeMaxDocSize(t *testing.T) {
+	input, err := parseInput([]byte(`{
+		"xinclude": {"files": true},
+		"xpaths": ["//title"],
+		"urls": {"testdata/xinclude/book.xml": {"file": "testdata/xinclude/book.xml"}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input.maxDocSize = 300 // More than the page or chapter.xml, but less than both
+	output, err := process(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output["//title"]) != 0 || !input.status.skipped["testdata/xinclude/book.xml"] || !strings.Contains(input.status.log[0].Message, "-max-doc-size") {
+		t.Errorf("Unexpected output %v and warnings %+v", output, input.status.log)
+	}
+}
+
+func TestProcessInput_XIncludeClient(t *testing.T) {
+	var userAgent string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		w.Write([]byte("<chapter>Remote</chapter>"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	content := `<book xmlns:xi=\"http://www.w3.org/2001/XInclude\"><xi:include href=\"https://example.com:` + port + `/chapter.xml\"/></book>`
+
+	// Includes connect with the fetch options' CA and pins, and send their User-Agent
+	input := []byte(`{
+		"xinclude": {"http": true},
+		"fetch": {"user_agent": "books/1.0", "tls": {"ca": "` + ca + `"}, "resolve": ["example.com:` + port + `:127.0.0.1"]},
+		"xpaths": ["//chapter"],
+		"urls": {"http://example.com/book.xml": {"content": "` + content + `"}}
+	}`)
+	output, err := processInput(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output["//chapter"]["http://example.com/book.xml"] != "Remote" || userAgent != "books/1.0" {
+		t.Errorf("Unexpected output %v with User-Agent %q", output, userAgent)
+	}
+
+	// And with those of the flags, without fetch options
+	o := &XIncludeOptions{HTTP: true}
+	if err := o.check(nil, &TLSOptions{CA: ca}, []string{"example.com:" + port + ":127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	root, err := decode(strings.NewReader(strings.ReplaceAll(content, `\"`, `"`)), &InputJson{XInclude: o}, "http://example.com/book.xml", pageSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := xmlpath.MustCompile("//chapter").String(root); got != "Remote" || !strings.HasPrefix(userAgent, "goatpaver/") {
+		t.Errorf("Unexpected include %q with User-Agent %q", got, userAgent)
+	}
+}